@@ -0,0 +1,508 @@
+// Package metrics provides a small registry of labelled counters, gauges and
+// histograms which are exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	counterType   = "counter"
+	gaugeType     = "gauge"
+	histogramType = "histogram"
+
+	labelSeparator = "\xff"
+)
+
+// DefBuckets are the default histogram buckets in seconds
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultRegistry is the registry used by the package level constructors
+var DefaultRegistry = NewRegistry()
+
+// collector is a metric family which can write itself in the text format
+type collector interface {
+	name() string
+	write(w io.Writer) error
+}
+
+// Registry holds a set of metric families
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]collector),
+	}
+}
+
+// register adds a collector, panic if the name is already registered
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.collectors[c.name()]; ok {
+		panic(fmt.Sprintf("metric %v is already registered", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteText writes all the metrics in the Prometheus text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		r.mu.RLock()
+		c := r.collectors[name]
+		r.mu.RUnlock()
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Handler returns a http handler serving the metrics of the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Handler returns a http handler serving the metrics of the default registry
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// family holds the common part of a labelled metric family
+type family struct {
+	fname      string
+	help       string
+	typ        string
+	labelNames []string
+
+	mu     sync.RWMutex
+	series map[string]interface{}
+	values map[string][]string
+}
+
+func newFamily(name, help, typ string, labelNames []string) *family {
+	return &family{
+		fname:      name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		series:     make(map[string]interface{}),
+		values:     make(map[string][]string),
+	}
+}
+
+func (f *family) name() string {
+	return f.fname
+}
+
+// get returns the series for the label values, it is created by fn if absent
+func (f *family) get(labelValues []string, fn func() interface{}) interface{} {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %v expects %d label values, got %d", f.fname, len(f.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, labelSeparator)
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok = f.series[key]; ok {
+		return s
+	}
+	s = fn()
+	f.series[key] = s
+	f.values[key] = append([]string(nil), labelValues...)
+	return s
+}
+
+// delete removes the series for the label values
+func (f *family) delete(labelValues []string) {
+	key := strings.Join(labelValues, labelSeparator)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.series, key)
+	delete(f.values, key)
+}
+
+// each calls fn for all the series ordered by label values
+func (f *family) each(fn func(labels string, s interface{}) error) error {
+	f.mu.RLock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	f.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f.mu.RLock()
+		s, ok := f.series[key]
+		values := f.values[key]
+		f.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := fn(formatLabels(f.labelNames, values, "", ""), s); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *family) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.fname, escapeHelp(f.help), f.fname, f.typ)
+	return err
+}
+
+// value is a float64 which can be updated atomically
+type value struct {
+	bits uint64
+}
+
+func (v *value) Load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+func (v *value) Store(val float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(val))
+}
+
+func (v *value) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		nv := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, nv) {
+			return
+		}
+	}
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	v value
+}
+
+// Inc increases the counter by 1
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add increases the counter by delta, negative delta is ignored
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.v.Add(delta)
+}
+
+// Value returns the current value
+func (c *Counter) Value() float64 {
+	return c.v.Load()
+}
+
+// CounterVec is a family of counters partitioned by labels
+type CounterVec struct {
+	*family
+}
+
+// NewCounterVec creates and registers a counter family in the default registry
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return DefaultRegistry.NewCounterVec(name, help, labelNames...)
+}
+
+// NewCounterVec creates and registers a counter family
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{newFamily(name, help, counterType, labelNames)}
+	r.register(c)
+	return c
+}
+
+// With returns the counter for the label values
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.get(labelValues, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+// Delete removes the counter for the label values
+func (c *CounterVec) Delete(labelValues ...string) {
+	c.delete(labelValues)
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	if err := c.writeHeader(w); err != nil {
+		return err
+	}
+	return c.each(func(labels string, s interface{}) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", c.fname, labels, formatFloat(s.(*Counter).Value()))
+		return err
+	})
+}
+
+// Gauge is a value which can go up and down
+type Gauge struct {
+	v value
+}
+
+// Set sets the gauge to val
+func (g *Gauge) Set(val float64) {
+	g.v.Store(val)
+}
+
+// Add adds delta to the gauge
+func (g *Gauge) Add(delta float64) {
+	g.v.Add(delta)
+}
+
+// Inc increases the gauge by 1
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+// Dec decreases the gauge by 1
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+// Value returns the current value
+func (g *Gauge) Value() float64 {
+	return g.v.Load()
+}
+
+// GaugeVec is a family of gauges partitioned by labels
+type GaugeVec struct {
+	*family
+}
+
+// NewGaugeVec creates and registers a gauge family in the default registry
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return DefaultRegistry.NewGaugeVec(name, help, labelNames...)
+}
+
+// NewGaugeVec creates and registers a gauge family
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{newFamily(name, help, gaugeType, labelNames)}
+	r.register(g)
+	return g
+}
+
+// With returns the gauge for the label values
+func (g *GaugeVec) With(labelValues ...string) *Gauge {
+	return g.get(labelValues, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+// Delete removes the gauge for the label values
+func (g *GaugeVec) Delete(labelValues ...string) {
+	g.delete(labelValues)
+}
+
+func (g *GaugeVec) write(w io.Writer) error {
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+	return g.each(func(labels string, s interface{}) error {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", g.fname, labels, formatFloat(s.(*Gauge).Value()))
+		return err
+	})
+}
+
+// Histogram counts observations in configurable buckets
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe adds an observation to the histogram
+func (h *Histogram) Observe(val float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if val <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += val
+}
+
+// Count returns the number of observations
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct {
+	*family
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a histogram family in the default
+// registry, nil buckets means DefBuckets
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return DefaultRegistry.NewHistogramVec(name, help, buckets, labelNames...)
+}
+
+// NewHistogramVec creates and registers a histogram family
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &HistogramVec{
+		family:  newFamily(name, help, histogramType, labelNames),
+		buckets: sorted,
+	}
+	r.register(h)
+	return h
+}
+
+// With returns the histogram for the label values
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.get(labelValues, func() interface{} {
+		return &Histogram{
+			buckets: h.buckets,
+			counts:  make([]uint64, len(h.buckets)),
+		}
+	}).(*Histogram)
+}
+
+// Delete removes the histogram for the label values
+func (h *HistogramVec) Delete(labelValues ...string) {
+	h.delete(labelValues)
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+
+	h.family.mu.RLock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	h.family.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		h.family.mu.RLock()
+		s, ok := h.series[key]
+		values := h.values[key]
+		h.family.mu.RUnlock()
+		if !ok {
+			continue
+		}
+
+		hist := s.(*Histogram)
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		count, sum := hist.count, hist.sum
+		hist.mu.Unlock()
+
+		for i, upper := range h.buckets {
+			labels := formatLabels(h.labelNames, values, "le", formatFloat(upper))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.fname, labels, counts[i]); err != nil {
+				return err
+			}
+		}
+		labels := formatLabels(h.labelNames, values, "le", "+Inf")
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.fname, labels, count); err != nil {
+			return err
+		}
+		labels = formatLabels(h.labelNames, values, "", "")
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", h.fname, labels, formatFloat(sum), h.fname, labels, count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatLabels formats the labels as {name="value",...}, an extra label is
+// appended if extraName is not empty
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, escapeLabel(extraValue))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("orders_total", "Number of orders.", "symbol", "result")
+	c.With("ADAUSDT", "success").Inc()
+	c.With("ADAUSDT", "success").Add(2)
+	c.With("ADAUSDT", "failure").Inc()
+	c.With("ADAUSDT", "failure").Add(-1)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP orders_total Number of orders.
+# TYPE orders_total counter
+orders_total{symbol="ADAUSDT",result="failure"} 1
+orders_total{symbol="ADAUSDT",result="success"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestGaugeVec(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGaugeVec("backlog", "Backlog of \"channel\".", "channel")
+	g.With("price").Set(3)
+	g.With("price").Dec()
+	g.With("trade\n").Inc()
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP backlog Backlog of "channel".
+# TYPE backlog gauge
+backlog{channel="price"} 2
+backlog{channel="trade\n"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "op")
+	h.With("fetch").Observe(0.05)
+	h.With("fetch").Observe(0.5)
+	h.With("fetch").Observe(5)
+	if c := h.With("fetch").Count(); c != 3 {
+		t.Errorf("count is %v, expected 3", c)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="fetch",le="0.1"} 1
+latency_seconds_bucket{op="fetch",le="1"} 2
+latency_seconds_bucket{op="fetch",le="+Inf"} 3
+latency_seconds_sum{op="fetch"} 5.55
+latency_seconds_count{op="fetch"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestDuplicateRegister(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup", "Duplicated.")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for duplicated metric")
+		}
+	}()
+	r.NewGaugeVec("dup", "Duplicated.")
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeVec("up", "Up.").With().Set(1)
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status %v", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "up 1\n") {
+		t.Errorf("unexpected body %v", w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type %v", w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vjoke/falcon/venus/pkg/keystore"
+)
+
+var (
+	keystoreArgs struct {
+		path           string
+		passphraseFile string
+	}
+
+	keystoreCmd = &cobra.Command{
+		Use:   "keystore",
+		Short: "Manage the encrypted keystore of credentials.",
+		Long: "Manage the encrypted keystore of credentials. The passphrase is read from " +
+			keystore.PASSPHRASE_ENV + " or the passphrase file.",
+	}
+
+	keystoreSetCmd = &cobra.Command{
+		Use:   "set NAME",
+		Short: "Set a secret read from stdin, the keystore is created if it does not exist.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			ks, err := openKeystore(true)
+			if err != nil {
+				return err
+			}
+
+			secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && secret == "" {
+				return fmt.Errorf("failed to read secret from stdin: %v", err)
+			}
+			secret = strings.TrimRight(secret, "\r\n")
+			if secret == "" {
+				return fmt.Errorf("secret should not be empty")
+			}
+
+			if err := ks.Set(args[0], secret); err != nil {
+				return err
+			}
+			if err := ks.Save(); err != nil {
+				return err
+			}
+			fmt.Printf("secret %v is saved, use keystore:%v in config\n", args[0], args[0])
+			return nil
+		},
+	}
+
+	keystoreListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the names of secrets.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(c *cobra.Command, args []string) error {
+			ks, err := openKeystore(false)
+			if err != nil {
+				return err
+			}
+			for _, name := range ks.Names() {
+				fmt.Println(name)
+			}
+			return nil
+		},
+	}
+
+	keystoreDeleteCmd = &cobra.Command{
+		Use:   "delete NAME",
+		Short: "Delete a secret.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			ks, err := openKeystore(false)
+			if err != nil {
+				return err
+			}
+			ks.Delete(args[0])
+			return ks.Save()
+		},
+	}
+)
+
+// openKeystore opens the keystore with the passphrase
+func openKeystore(create bool) (*keystore.Keystore, error) {
+	passphrase, err := keystore.Passphrase(keystoreArgs.passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		return keystore.OpenOrCreate(keystoreArgs.path, passphrase)
+	}
+	return keystore.Open(keystoreArgs.path, passphrase)
+}
+
+func init() {
+	keystoreCmd.PersistentFlags().StringVar(&keystoreArgs.path, "keystore", "./keystore.json",
+		"Path of the encrypted keystore.")
+	keystoreCmd.PersistentFlags().StringVar(&keystoreArgs.passphraseFile, "keystore_passphrase_file", "",
+		"File of the keystore passphrase, used if "+keystore.PASSPHRASE_ENV+" is not set.")
+
+	keystoreCmd.AddCommand(keystoreSetCmd)
+	keystoreCmd.AddCommand(keystoreListCmd)
+	keystoreCmd.AddCommand(keystoreDeleteCmd)
+	rootCmd.AddCommand(keystoreCmd)
+}
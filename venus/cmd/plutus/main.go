@@ -7,7 +7,11 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/vjoke/falcon/venus/pkg/bootstrap"
 	"github.com/vjoke/falcon/venus/pkg/cmd"
+	"github.com/vjoke/falcon/venus/pkg/grid"
+	"github.com/vjoke/falcon/venus/pkg/keystore"
 	"github.com/vjoke/falcon/venus/pkg/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/plutus"
+	"github.com/vjoke/falcon/venus/pkg/server"
 	"github.com/vjoke/falcon/pkg/log"
 )
 
@@ -29,8 +33,19 @@ var (
 		Args:              cobra.ExactArgs(0),
 		PersistentPreRunE: configureLogging,
 		PreRunE: func(c *cobra.Command, args []string) error {
-			// TODO: validate configure
-			return nil
+			if err := bootstrap.InitKeystore(botArgs); err != nil {
+				return err
+			}
+			if !server.ValidRestartPolicy(botArgs.Restart.Policy) {
+				return fmt.Errorf("unknown restart policy %v", botArgs.Restart.Policy)
+			}
+			if !bootstrap.ValidStrategy(botArgs.Strategy) {
+				return fmt.Errorf("unknown strategy %v", botArgs.Strategy)
+			}
+			if botArgs.ClockSpeed <= 0 {
+				return fmt.Errorf("clock speed %v should be positive", botArgs.ClockSpeed)
+			}
+			return validateFiles(botArgs.ConfigFiles, botArgs.Strategy, false)
 		},
 		RunE: func(c *cobra.Command, args []string) error {
 			cmd.PrintFlags(c.Flags())
@@ -39,8 +54,15 @@ var (
 			stop := make(chan struct{})
 
 			// Create the server for the discovery service.
-			builder := pixiu.NewBuilder().WithConfig(botArgs.ConfigFile)
-			pixiu, err := bootstrap.NewBot(builder)
+			var builder plutus.ArbitragerBuilder
+			clock := botArgs.NewClock()
+			switch botArgs.Strategy {
+			case bootstrap.STRATEGY_GRID:
+				builder = grid.NewBuilder().WithClock(clock)
+			default:
+				builder = pixiu.NewBuilder().WithMaxExposure(botArgs.MaxExposure).WithClock(clock)
+			}
+			pixiu, err := bootstrap.NewBot(botArgs, builder)
 			if err != nil {
 				return fmt.Errorf("failed to create pixiu service: %v", err)
 			}
@@ -50,11 +72,11 @@ var (
 				return fmt.Errorf("failed to start pixiu service: %v", err)
 			}
 
-			cmd.WaitSignal(stop)
+			failure := cmd.WaitSignalOrFailure(stop, pixiu.Failed())
 			// Wait until we shut down. In theory this could block forever; in practice we will get
 			// forcibly shut down after 30s in Kubernetes.
 			pixiu.WaitUntilCompletion()
-			return nil
+			return failure
 		},
 	}
 )
@@ -72,8 +94,32 @@ func init() {
 	})
 
 	// Process commandline args.
-	pixiuCmd.PersistentFlags().StringVar(&botArgs.ConfigFile, "config", "./config/binance/normal-policy.toml",
-		"Config file name for trading. If not specified, a default config file will be used.")
+	pixiuCmd.PersistentFlags().StringSliceVar(&botArgs.ConfigFiles, "config", []string{"./config/binance/normal-policy.toml"},
+		"Config files or directories of config files for trading, one policy is run for each file. If not specified, a default config file will be used.")
+	pixiuCmd.PersistentFlags().StringVar(&botArgs.Strategy, "strategy", botArgs.Strategy,
+		"Strategy of the arbitragers, one of pixiu and grid. All the config files should be of the strategy.")
+	pixiuCmd.PersistentFlags().Float64Var(&botArgs.MaxExposure, "max_exposure", 0,
+		"Combined exposure in USDT allowed for all the pixiu policies. If zero, the exposure is unlimited.")
+	pixiuCmd.PersistentFlags().DurationVar(&botArgs.ConfigWatchInterval, "config_watch_interval", botArgs.ConfigWatchInterval,
+		"Interval to check changes of the config file for reloading. If zero, the config file is not watched.")
+	pixiuCmd.PersistentFlags().StringVar(&botArgs.AdminAddr, "admin_addr", botArgs.AdminAddr,
+		"Listening address of the admin server. If empty, the admin server is disabled.")
+	pixiuCmd.PersistentFlags().StringVar(&botArgs.ProbeAddr, "probe_addr", botArgs.ProbeAddr,
+		"Listening address of the /healthz and /readyz probes, which require no token. If empty, the probe server is disabled.")
+	pixiuCmd.PersistentFlags().StringVar(&botArgs.AdminToken, "admin_token", "",
+		"Bearer token for the control actions of the admin server. If empty, control actions are disabled.")
+	pixiuCmd.PersistentFlags().Float64Var(&botArgs.ClockSpeed, "clock_speed", botArgs.ClockSpeed,
+		"Speed of the clock of the trading logic relative to the wall clock, e.g. to replay against the mock exchange faster than real time.")
+	pixiuCmd.PersistentFlags().StringVar((*string)(&botArgs.Restart.Policy), "restart_policy", string(botArgs.Restart.Policy),
+		"Restart policy of the fetcher, oracle and trader of policies, one of never, on-failure and always.")
+	pixiuCmd.PersistentFlags().IntVar(&botArgs.Restart.MaxFailures, "max_failures", botArgs.Restart.MaxFailures,
+		"Consecutive failures of a worker to shut down the process. If zero, failures are never escalated.")
+	pixiuCmd.PersistentFlags().DurationVar(&botArgs.Restart.MaxBackoff, "max_restart_backoff", botArgs.Restart.MaxBackoff,
+		"Maximum delay before restarting a failed worker, the delay is doubled from 1s for each failure.")
+	pixiuCmd.PersistentFlags().StringVar(&botArgs.Keystore, "keystore", "",
+		"Encrypted keystore for the keystore: references of credentials in config. If empty, no keystore is opened.")
+	pixiuCmd.PersistentFlags().StringVar(&botArgs.KeystorePassphraseFile, "keystore_passphrase_file", "",
+		"File of the keystore passphrase, used if "+keystore.PASSPHRASE_ENV+" is not set.")
 
 	// Attach the pixiu logging options to the command.
 	loggingOptions.AttachCobraFlags(rootCmd)
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vjoke/falcon/venus/pkg/cmd"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+)
+
+var (
+	mockArgs = struct {
+		listen  string
+		script  string
+		symbols []string
+	}{}
+
+	mockExchangeCmd = &cobra.Command{
+		Use:   "mock-exchange",
+		Short: "Start a local binance compatible mock exchange.",
+		Long: "Start a local binance compatible mock exchange with scripted prices and failure injection. " +
+			"Set base_url of [exchange] in the config to its address to run pixiu offline.",
+		Args:              cobra.ExactArgs(0),
+		PersistentPreRunE: configureLogging,
+		RunE: func(c *cobra.Command, args []string) error {
+			script := mockexchange.DefaultScript(mockArgs.symbols...)
+			if mockArgs.script != "" {
+				var err error
+				if script, err = mockexchange.LoadScript(mockArgs.script); err != nil {
+					return fmt.Errorf("failed to load script %v: %v", mockArgs.script, err)
+				}
+			}
+
+			stop := make(chan struct{})
+			exchange := mockexchange.New(script)
+			go exchange.Run(stop)
+
+			server := &http.Server{Addr: mockArgs.listen, Handler: exchange}
+			failed := make(chan error, 1)
+			go func() {
+				if err := server.ListenAndServe(); err != http.ErrServerClosed {
+					failed <- err
+				}
+			}()
+			fmt.Printf("mock exchange is listening on %v\n", mockArgs.listen)
+
+			err := cmd.WaitSignalOrFailure(stop, failed)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(ctx)
+			return err
+		},
+	}
+)
+
+func init() {
+	mockExchangeCmd.Flags().StringVar(&mockArgs.listen, "listen", "127.0.0.1:9090", "Listening address of the mock exchange.")
+	mockExchangeCmd.Flags().StringVar(&mockArgs.script, "script", "",
+		"Script file of markets, balances and failures. If empty, random walks of --symbol with 1000 USDT are used.")
+	mockExchangeCmd.Flags().StringSliceVar(&mockArgs.symbols, "symbol", []string{"ADAUSDT", "DOTUSDT"},
+		"Symbols of the default script.")
+
+	rootCmd.AddCommand(mockExchangeCmd)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/vjoke/falcon/venus/pkg/bootstrap"
+	"github.com/vjoke/falcon/venus/pkg/keystore"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/pixiu"
+)
+
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+)
+
+var (
+	opsArgs = struct {
+		bootstrap.PixiuArgs
+		configFile string
+		output     string
+		symbols    []string
+		all        bool
+		yes        bool
+		limit      int
+	}{}
+
+	accountCmd = &cobra.Command{
+		Use:   "account",
+		Short: "Show the balances of the account with USDT valuation.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(c *cobra.Command, args []string) error {
+			op, err := newOperator()
+			if err != nil {
+				return err
+			}
+			balances, total, err := op.Balances()
+			if err != nil {
+				return err
+			}
+
+			return printOutput(map[string]interface{}{"balances": balances, "total": total}, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "ASSET\tFREE\tLOCKED\tVALUE(USDT)")
+				for _, b := range balances {
+					fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", b.Asset, b.Free, b.Locked, b.Value.StringFixed(2))
+				}
+				fmt.Fprintf(w, "TOTAL\t\t\t%v\n", total.StringFixed(2))
+			})
+		},
+	}
+
+	ordersCmd = &cobra.Command{
+		Use:   "orders",
+		Short: "Show the open orders and oco orders of symbols, all the symbols with open orders by default.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(c *cobra.Command, args []string) error {
+			op, err := newOperator()
+			if err != nil {
+				return err
+			}
+			groups, err := op.OpenOrders(opsArgs.symbols)
+			if err != nil {
+				return err
+			}
+
+			return printOutput(groups, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "SYMBOL\tID\tKIND\tTYPE\tSIDE\tPRICE\tSTOP PRICE\tQUANTITY\tEXECUTED\tTIME")
+				for _, g := range groups {
+					for _, o := range g.Orders {
+						fmt.Fprintf(w, "%v\t%v\torder\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", o.Symbol, o.OrderID, o.Type, o.Side,
+							o.Price, o.StopPrice, o.OrigQuantity, o.ExecutedQuantity, formatMillis(o.Time))
+					}
+					for _, o := range g.OCO {
+						fmt.Fprintf(w, "%v\t%v\toco\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", o.Symbol, o.OrderID, o.Type, o.Side,
+							o.Price, o.StopPrice, o.OrigQuantity, o.ExecutedQuantity, formatMillis(o.Time))
+					}
+				}
+			})
+		},
+	}
+
+	cancelCmd = &cobra.Command{
+		Use:   "cancel",
+		Short: "Cancel the open orders of symbols.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(c *cobra.Command, args []string) error {
+			op, err := newOperator()
+			if err != nil {
+				return err
+			}
+			symbols, err := selectSymbols(op)
+			if err != nil {
+				return err
+			}
+			if !confirm(fmt.Sprintf("cancel all the open orders of %v?", symbols)) {
+				return fmt.Errorf("aborted")
+			}
+
+			return printResults(op.Cancel(symbols))
+		},
+	}
+
+	flattenCmd = &cobra.Command{
+		Use:   "flatten",
+		Short: "Cancel the open orders of symbols and sell the positions with market price.",
+		Args:  cobra.ExactArgs(0),
+		RunE: func(c *cobra.Command, args []string) error {
+			op, err := newOperator()
+			if err != nil {
+				return err
+			}
+			symbols, err := selectSymbols(op)
+			if err != nil {
+				return err
+			}
+			if !confirm(fmt.Sprintf("sell the positions of %v with market price?", symbols)) {
+				return fmt.Errorf("aborted")
+			}
+
+			results, err := op.Flatten(symbols)
+			if err != nil {
+				return err
+			}
+			return printResults(results)
+		},
+	}
+
+	tradesCmd = &cobra.Command{
+		Use:   "trades SYMBOL",
+		Short: "Show the recent fills of a symbol.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			op, err := newOperator()
+			if err != nil {
+				return err
+			}
+			trades, err := op.Trades(args[0], opsArgs.limit)
+			if err != nil {
+				return err
+			}
+
+			return printOutput(trades, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "ID\tORDER\tSIDE\tPRICE\tQUANTITY\tQUOTE\tCOMMISSION\tTIME")
+				for _, t := range trades {
+					side := "SELL"
+					if t.IsBuyer {
+						side = "BUY"
+					}
+					fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v %v\t%v\n", t.ID, t.OrderID, side, t.Price, t.Quantity,
+						t.QuoteQuantity, t.Commission, t.CommissionAsset, formatMillis(t.Time))
+				}
+			})
+		},
+	}
+)
+
+// configureOpsLogging writes logs to stderr by default, so that the output
+// can be piped
+func configureOpsLogging(c *cobra.Command, args []string) error {
+	if !c.Flags().Changed("log_target") {
+		loggingOptions.OutputPaths = []string{"stderr"}
+	}
+	return configureLogging(c, args)
+}
+
+// newOperator creates an operator with the config and credentials of a policy
+func newOperator() (*pixiu.Operator, error) {
+	if opsArgs.output != OUTPUT_TABLE && opsArgs.output != OUTPUT_JSON {
+		return nil, fmt.Errorf("output should be one of %v and %v", OUTPUT_TABLE, OUTPUT_JSON)
+	}
+	if err := bootstrap.InitKeystore(&opsArgs.PixiuArgs); err != nil {
+		return nil, err
+	}
+
+	conf, err := model.LoadConfigFromFile(opsArgs.configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.VerifyConfig(conf); err != nil {
+		return nil, err
+	}
+
+	return pixiu.NewOperator(conf)
+}
+
+// selectSymbols returns the symbols of a destructive action, either the
+// symbols or all the symbols of the policy are required
+func selectSymbols(op *pixiu.Operator) ([]string, error) {
+	if opsArgs.all {
+		return op.Symbols(), nil
+	}
+	if len(opsArgs.symbols) == 0 {
+		return nil, fmt.Errorf("either --symbol or --all is required")
+	}
+	return opsArgs.symbols, nil
+}
+
+// confirm asks for confirmation of a destructive action unless --yes is set
+func confirm(prompt string) bool {
+	if opsArgs.yes {
+		return true
+	}
+
+	fmt.Printf("%v [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// printOutput prints v as json or as a table by the table function
+func printOutput(v interface{}, table func(w *tabwriter.Writer)) error {
+	if opsArgs.output == OUTPUT_JSON {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// printResults prints the results of an action, an error is returned if
+// the action failed on any symbol
+func printResults(results []*pixiu.Result) error {
+	err := printOutput(results, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "SYMBOL\tQUANTITY\tORDER\tERROR")
+		for _, r := range results {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", r.Symbol, r.Quantity, r.OrderID, r.Error)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed on %v of %v symbols", failed, len(results))
+	}
+	return nil
+}
+
+// formatMillis formats a timestamp in milliseconds
+func formatMillis(ms int64) string {
+	return time.Unix(0, ms*int64(time.Millisecond)).Format(time.RFC3339)
+}
+
+func init() {
+	for _, c := range []*cobra.Command{accountCmd, ordersCmd, cancelCmd, flattenCmd, tradesCmd} {
+		c.PersistentPreRunE = configureOpsLogging
+		c.Flags().StringVar(&opsArgs.configFile, "config", "./config/binance/normal-policy.toml",
+			"Config file of the policy whose account is operated.")
+		c.Flags().StringVarP(&opsArgs.output, "output", "o", OUTPUT_TABLE,
+			"Output format, one of "+OUTPUT_TABLE+" and "+OUTPUT_JSON+".")
+		c.Flags().StringVar(&opsArgs.Keystore, "keystore", "",
+			"Encrypted keystore for the keystore: references of credentials in config. If empty, no keystore is opened.")
+		c.Flags().StringVar(&opsArgs.KeystorePassphraseFile, "keystore_passphrase_file", "",
+			"File of the keystore passphrase, used if "+keystore.PASSPHRASE_ENV+" is not set.")
+		rootCmd.AddCommand(c)
+	}
+
+	for _, c := range []*cobra.Command{ordersCmd, cancelCmd, flattenCmd} {
+		c.Flags().StringSliceVar(&opsArgs.symbols, "symbol", nil, "Symbols to operate on.")
+	}
+	for _, c := range []*cobra.Command{cancelCmd, flattenCmd} {
+		c.Flags().BoolVar(&opsArgs.all, "all", false, "Operate on all the symbols of the policy.")
+		c.Flags().BoolVarP(&opsArgs.yes, "yes", "y", false, "Skip the confirmation prompt.")
+	}
+	tradesCmd.Flags().IntVar(&opsArgs.limit, "limit", 20, "Number of recent fills to show.")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/spf13/cobra"
+	"github.com/vjoke/falcon/pkg/structured"
+	"github.com/vjoke/falcon/venus/pkg/bootstrap"
+	"github.com/vjoke/falcon/venus/pkg/keystore"
+	gridmodel "github.com/vjoke/falcon/venus/pkg/model/grid"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+var (
+	validateArgs = struct {
+		bootstrap.PixiuArgs
+		online bool
+	}{}
+
+	validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the config files of policies.",
+		Long: "Validate the structure, ranges and cross-field rules of the config files of policies. " +
+			"With --online, the symbols and trade size are checked against the exchange info.",
+		Args:              cobra.ExactArgs(0),
+		PersistentPreRunE: configureLogging,
+		RunE: func(c *cobra.Command, args []string) error {
+			if err := bootstrap.InitKeystore(&validateArgs.PixiuArgs); err != nil {
+				return err
+			}
+			if !bootstrap.ValidStrategy(validateArgs.Strategy) {
+				return fmt.Errorf("unknown strategy %v", validateArgs.Strategy)
+			}
+			return validateFiles(validateArgs.ConfigFiles, validateArgs.Strategy, validateArgs.online)
+		},
+	}
+)
+
+// validateFiles validates the config files of a strategy and prints the
+// problems, an error is returned if any problem is found
+func validateFiles(paths []string, strategy string, online bool) error {
+	files, err := bootstrap.ResolveConfigFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	infos := make(map[string]*binance.ExchangeInfo)
+	for _, file := range files {
+		var errs []*structured.Error
+		if strategy == bootstrap.STRATEGY_GRID {
+			errs = validateGridFile(file, online, infos)
+		} else {
+			errs = validateFile(file, online, infos)
+		}
+		printProblems(file, errs)
+		problems += len(errs)
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("found %v problems in %v config files", problems, len(files))
+	}
+	return nil
+}
+
+// errLoadConfig is the problem of a config file failed to load
+var errLoadConfig = &structured.Error{
+	Impact: "The arbitrager can not be started with the config.",
+	Action: "Fix the syntax of the config file or the references of credentials.",
+}
+
+// validateFile validates a config file of pixiu, exchange info is cached in
+// infos by the testnet and base url of policies
+func validateFile(file string, online bool, infos map[string]*binance.ExchangeInfo) []*structured.Error {
+	conf, err := model.LoadConfigFromFile(file)
+	if err != nil {
+		return []*structured.Error{structured.NewErr(errLoadConfig, err)}
+	}
+
+	errs := model.ValidateConfig(conf)
+	if !online || conf.Policy == nil {
+		return errs
+	}
+
+	info, serr := exchangeInfo(conf.Policy.Testnet, conf.Exchange, infos)
+	if serr != nil {
+		return append(errs, serr)
+	}
+	return append(errs, model.ValidateSymbols(conf, info)...)
+}
+
+// validateGridFile validates a config file of grid, exchange info is cached
+// in infos by the testnet and base url of policies
+func validateGridFile(file string, online bool, infos map[string]*binance.ExchangeInfo) []*structured.Error {
+	conf, err := gridmodel.LoadConfigFromFile(file)
+	if err != nil {
+		return []*structured.Error{structured.NewErr(errLoadConfig, err)}
+	}
+
+	errs := gridmodel.ValidateConfig(conf)
+	if !online || conf.Policy == nil {
+		return errs
+	}
+
+	info, serr := exchangeInfo(conf.Policy.Testnet, conf.Exchange, infos)
+	if serr != nil {
+		return append(errs, serr)
+	}
+	return append(errs, gridmodel.ValidateSymbols(conf, info)...)
+}
+
+// exchangeInfo returns the exchange info of a network, which is cached in
+// infos by the testnet and base url
+func exchangeInfo(testnet bool, exchange *model.Exchange, infos map[string]*binance.ExchangeInfo) (*binance.ExchangeInfo, *structured.Error) {
+	baseURL := ""
+	if exchange != nil {
+		baseURL = exchange.BaseURL
+	}
+	network := fmt.Sprintf("%v:%v", testnet, baseURL)
+	if info, ok := infos[network]; ok {
+		return info, nil
+	}
+
+	binance.UseTestnet = testnet
+	client := binance.NewClient("", "")
+	if baseURL != "" {
+		client.BaseURL = baseURL
+	}
+	info, err := client.NewExchangeInfoService().Do(context.Background())
+	if err != nil {
+		return nil, structured.NewErr(&structured.Error{
+			Impact: "The symbols and trade size are not validated.",
+			Action: "Check the network connectivity to the exchange and try again.",
+		}, fmt.Errorf("failed to get exchange info: %v", err))
+	}
+	infos[network] = info
+	return info, nil
+}
+
+// printProblems prints the problems of a config file
+func printProblems(file string, errs []*structured.Error) {
+	if len(errs) == 0 {
+		fmt.Printf("%v: ok\n", file)
+		return
+	}
+
+	fmt.Printf("%v: %v problems\n", file, len(errs))
+	for i, e := range errs {
+		fmt.Printf("  [%d] %v\n", i+1, e.Err)
+		fmt.Printf("      impact: %v\n", e.Impact)
+		fmt.Printf("      action: %v\n", e.Action)
+	}
+}
+
+func init() {
+	validateCmd.Flags().StringSliceVar(&validateArgs.ConfigFiles, "config", []string{"./config/binance/normal-policy.toml"},
+		"Config files or directories of config files to validate.")
+	validateCmd.Flags().StringVar(&validateArgs.Strategy, "strategy", bootstrap.STRATEGY_PIXIU,
+		"Strategy of the config files, one of pixiu and grid.")
+	validateCmd.Flags().BoolVar(&validateArgs.online, "online", false,
+		"Check the symbols and trade size against the exchange info.")
+	validateCmd.Flags().StringVar(&validateArgs.Keystore, "keystore", "",
+		"Encrypted keystore for the keystore: references of credentials in config. If empty, no keystore is opened.")
+	validateCmd.Flags().StringVar(&validateArgs.KeystorePassphraseFile, "keystore_passphrase_file", "",
+		"File of the keystore passphrase, used if "+keystore.PASSPHRASE_ENV+" is not set.")
+
+	rootCmd.AddCommand(validateCmd)
+}
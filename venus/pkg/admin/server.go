@@ -0,0 +1,353 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	glog "github.com/vjoke/falcon/pkg/log"
+	"github.com/vjoke/falcon/venus/pkg/plutus"
+)
+
+var adminLog = glog.RegisterScope("admin", "admin", 0)
+
+const (
+	API_PREFIX = "/api/v1"
+)
+
+// Options defines the options for the admin server
+type Options struct {
+	// Addr is the listening address, empty disables the server
+	Addr string
+	// ProbeAddr is the listening address of the liveness and readiness
+	// probes only, empty disables it
+	ProbeAddr string
+	// Token authenticates the control actions, empty disables them
+	Token string
+}
+
+// policy holds the inspector and controller of a policy
+type policy struct {
+	inspector  plutus.Inspector
+	controller plutus.Controller
+}
+
+// Check returns an error if the checked target is not healthy
+type Check func() error
+
+// check is a named health check
+type check struct {
+	name string
+	fn   Check
+}
+
+// Server serves the http admin api for live status and control
+type Server struct {
+	opts      *Options
+	names     []string
+	policies  map[string]*policy
+	liveness  []*check
+	readiness []*check
+	mux       *http.ServeMux
+	probeMux  *http.ServeMux
+}
+
+// NewServer creates a new admin server
+func NewServer(opts *Options) *Server {
+	s := &Server{
+		opts:     opts,
+		policies: make(map[string]*policy),
+		mux:      http.NewServeMux(),
+		probeMux: http.NewServeMux(),
+	}
+
+	s.handleInspect("/config", func(i plutus.Inspector) (interface{}, error) { return i.Config(), nil })
+	s.handleInspect("/epochs", func(i plutus.Inspector) (interface{}, error) { return i.Epochs(), nil })
+	s.handleInspect("/positions", func(i plutus.Inspector) (interface{}, error) { return i.Positions() })
+	s.handleInspect("/orders", func(i plutus.Inspector) (interface{}, error) { return i.Orders() })
+	s.handleInspect("/decisions", func(i plutus.Inspector) (interface{}, error) { return i.Decisions(), nil })
+	s.handleInspect("/balances", func(i plutus.Inspector) (interface{}, error) { return i.Balances() })
+
+	for _, mux := range []*http.ServeMux{s.mux, s.probeMux} {
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { s.handleChecks(w, r, s.liveness) })
+		mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) { s.handleChecks(w, r, s.readiness) })
+	}
+	s.mux.HandleFunc(API_PREFIX+"/policies", s.handlePolicies)
+	s.mux.HandleFunc(API_PREFIX+"/status", s.handleStatus)
+	s.handleControl("/pause", false, func(c plutus.Controller, _ []string) error {
+		c.Pause()
+		return nil
+	})
+	s.handleControl("/resume", false, func(c plutus.Controller, _ []string) error {
+		c.Resume()
+		return nil
+	})
+	s.handleControl("/reload", false, func(c plutus.Controller, _ []string) error { return c.Reload() })
+	s.handleControl("/flatten", true, func(c plutus.Controller, symbols []string) error { return c.Flatten(symbols) })
+	s.handleControl("/cancel", true, func(c plutus.Controller, symbols []string) error { return c.CancelOrders(symbols) })
+
+	return s
+}
+
+// Register adds a policy to the admin server before it runs, the inspector
+// or controller may be nil if the arbitrager does not support it
+func (s *Server) Register(name string, inspector plutus.Inspector, controller plutus.Controller) {
+	if _, ok := s.policies[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.policies[name] = &policy{
+		inspector:  inspector,
+		controller: controller,
+	}
+}
+
+// AddLivenessCheck adds a check to /healthz of both servers, it should be added before the
+// server runs
+func (s *Server) AddLivenessCheck(name string, fn Check) {
+	s.liveness = append(s.liveness, &check{name: name, fn: fn})
+}
+
+// AddReadinessCheck adds a check to /readyz of both servers, it should be added before the
+// server runs
+func (s *Server) AddReadinessCheck(name string, fn Check) {
+	s.readiness = append(s.readiness, &check{name: name, fn: fn})
+}
+
+// Handle registers an extra handler on the admin server
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleInspect registers an extra read-only endpoint under the api prefix,
+// the returned value is encoded as json
+func (s *Server) HandleInspect(path string, fn func() interface{}) {
+	s.mux.HandleFunc(API_PREFIX+path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+			return
+		}
+		writeJSON(w, http.StatusOK, fn())
+	})
+}
+
+// Handler returns the http handler of the admin server
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// ProbeHandler returns the http handler of the probe server
+func (s *Server) ProbeHandler() http.Handler {
+	return s.probeMux
+}
+
+// Run starts the admin server and the probe server and shuts them down when
+// stop is closed
+func (s *Server) Run(stop <-chan struct{}) error {
+	if s.opts.Addr != "" {
+		if err := serve("admin", s.opts.Addr, s.mux, stop); err != nil {
+			return err
+		}
+		if s.opts.Token == "" {
+			adminLog.Warn("no admin token, control actions are disabled")
+		}
+	}
+
+	if s.opts.ProbeAddr != "" {
+		if err := serve("probe", s.opts.ProbeAddr, s.probeMux, stop); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serve serves a handler on addr until stop is closed
+func serve(name, addr string, handler http.Handler, stop <-chan struct{}) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %v: %v", addr, err)
+	}
+
+	httpServer := &http.Server{Handler: handler}
+	adminLog.Infof("%v server is listening on %v", name, listener.Addr())
+
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			adminLog.Errorf("%v server error: %v", name, err)
+		}
+	}()
+
+	go func() {
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			adminLog.Errorf("failed to shutdown %v server: %v", name, err)
+		}
+		adminLog.Infof("%v server is stopped", name)
+	}()
+
+	return nil
+}
+
+// lookup finds the policy of a request by the policy parameter, which may
+// be omitted if there is only one policy
+func (s *Server) lookup(r *http.Request) (*policy, int, error) {
+	name := r.URL.Query().Get("policy")
+	if name == "" {
+		if len(s.names) != 1 {
+			return nil, http.StatusBadRequest, fmt.Errorf("policy is required, should be one of %v", s.names)
+		}
+		name = s.names[0]
+	}
+
+	p, ok := s.policies[name]
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("unknown policy %v", name)
+	}
+	return p, http.StatusOK, nil
+}
+
+// handleInspect registers a read-only endpoint
+func (s *Server) handleInspect(path string, fn func(plutus.Inspector) (interface{}, error)) {
+	s.mux.HandleFunc(API_PREFIX+path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+			return
+		}
+		p, code, err := s.lookup(r)
+		if err != nil {
+			writeError(w, code, err)
+			return
+		}
+		if p.inspector == nil {
+			writeError(w, http.StatusNotImplemented, fmt.Errorf("inspecting is not supported"))
+			return
+		}
+
+		v, err := fn(p.inspector)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	})
+}
+
+// handleControl registers an authenticated control endpoint, for actions
+// on symbols, the symbols are read from the symbol parameter and all=true
+// selects all the symbols
+func (s *Server) handleControl(path string, onSymbols bool, fn func(c plutus.Controller, symbols []string) error) {
+	s.mux.HandleFunc(API_PREFIX+path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+			return
+		}
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+			return
+		}
+		p, code, err := s.lookup(r)
+		if err != nil {
+			writeError(w, code, err)
+			return
+		}
+		if p.controller == nil {
+			writeError(w, http.StatusNotImplemented, fmt.Errorf("controlling is not supported"))
+			return
+		}
+
+		symbols := r.URL.Query()["symbol"]
+		if onSymbols && len(symbols) == 0 && r.URL.Query().Get("all") != "true" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("either symbol or all=true is required"))
+			return
+		}
+
+		adminLog.Warnf("control action %v for %v of %v from %v", path, symbols, r.URL.Query().Get("policy"), r.RemoteAddr)
+		if err := fn(p.controller, symbols); err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"action":  strings.TrimPrefix(path, "/"),
+			"symbols": symbols,
+		})
+	})
+}
+
+// handlePolicies returns the names of the policies
+func (s *Server) handlePolicies(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.names)
+}
+
+// handleStatus returns the status of trading of all the policies
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	policies := map[string]interface{}{}
+	for name, p := range s.policies {
+		status := map[string]interface{}{}
+		if p.controller != nil {
+			status["paused"] = p.controller.Paused()
+		}
+		policies[name] = status
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"policies": policies})
+}
+
+// handleChecks runs the health checks, the status is 503 if any of them
+// fails
+func (s *Server) handleChecks(w http.ResponseWriter, r *http.Request, checks []*check) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+
+	code, status := http.StatusOK, "ok"
+	results := make(map[string]string, len(checks))
+	for _, c := range checks {
+		if err := c.fn(); err != nil {
+			code, status = http.StatusServiceUnavailable, "failed"
+			results[c.name] = err.Error()
+			continue
+		}
+		results[c.name] = "ok"
+	}
+	if code != http.StatusOK {
+		adminLog.Warnf("%v failed: %v", r.URL.Path, results)
+	}
+
+	writeJSON(w, code, map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+}
+
+// authorized checks the bearer token of a request
+func (s *Server) authorized(r *http.Request) bool {
+	if s.opts.Token == "" {
+		return false
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		adminLog.Errorf("failed to encode response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,173 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type fakeArbitrager struct {
+	paused    bool
+	flattened []string
+}
+
+func (f *fakeArbitrager) Config() interface{}             { return map[string]string{"name": "fake"} }
+func (f *fakeArbitrager) Epochs() interface{}             { return []string{} }
+func (f *fakeArbitrager) Positions() (interface{}, error) { return []string{}, nil }
+func (f *fakeArbitrager) Orders() (interface{}, error)    { return []string{}, nil }
+func (f *fakeArbitrager) Decisions() interface{}          { return []string{} }
+func (f *fakeArbitrager) Balances() (interface{}, error)  { return []string{}, nil }
+func (f *fakeArbitrager) Pause()                          { f.paused = true }
+func (f *fakeArbitrager) Resume()                         { f.paused = false }
+func (f *fakeArbitrager) Paused() bool                    { return f.paused }
+func (f *fakeArbitrager) Reload() error                   { return nil }
+func (f *fakeArbitrager) CancelOrders(symbols []string) error {
+	return nil
+}
+func (f *fakeArbitrager) Flatten(symbols []string) error {
+	f.flattened = symbols
+	return nil
+}
+
+type serverTestSuite struct {
+	suite.Suite
+	arb    *fakeArbitrager
+	server *Server
+}
+
+func TestServer(t *testing.T) {
+	suite.Run(t, new(serverTestSuite))
+}
+
+func (s *serverTestSuite) SetupTest() {
+	s.arb = &fakeArbitrager{}
+	s.server = NewServer(&Options{Token: "secret"})
+	s.server.Register("fake", s.arb, s.arb)
+}
+
+func (s *serverTestSuite) do(method, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.server.Handler().ServeHTTP(w, req)
+	return w
+}
+
+func (s *serverTestSuite) TestInspect() {
+	w := s.do(http.MethodGet, API_PREFIX+"/config", "")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	var conf map[string]string
+	assert.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &conf))
+	assert.Equal(s.T(), "fake", conf["name"])
+
+	w = s.do(http.MethodPost, API_PREFIX+"/config", "")
+	assert.Equal(s.T(), http.StatusMethodNotAllowed, w.Code)
+}
+
+func (s *serverTestSuite) TestControlRequiresToken() {
+	w := s.do(http.MethodPost, API_PREFIX+"/pause", "")
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+	w = s.do(http.MethodPost, API_PREFIX+"/pause", "wrong")
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+	assert.False(s.T(), s.arb.paused)
+
+	// the bearer scheme is required
+	req := httptest.NewRequest(http.MethodPost, API_PREFIX+"/pause", nil)
+	req.Header.Set("Authorization", "secret")
+	w = httptest.NewRecorder()
+	s.server.Handler().ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+	assert.False(s.T(), s.arb.paused)
+
+	w = s.do(http.MethodPost, API_PREFIX+"/pause", "secret")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.True(s.T(), s.arb.paused)
+}
+
+func (s *serverTestSuite) TestFlatten() {
+	w := s.do(http.MethodPost, API_PREFIX+"/flatten", "secret")
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+
+	w = s.do(http.MethodPost, API_PREFIX+"/flatten?symbol=ADAUSDT", "secret")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Equal(s.T(), []string{"ADAUSDT"}, s.arb.flattened)
+
+	w = s.do(http.MethodPost, API_PREFIX+"/flatten?all=true", "secret")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.Empty(s.T(), s.arb.flattened)
+}
+
+func (s *serverTestSuite) TestDisabledWithoutToken() {
+	server := NewServer(&Options{})
+	server.Register("fake", s.arb, s.arb)
+	req := httptest.NewRequest(http.MethodPost, API_PREFIX+"/pause", nil)
+	w := httptest.NewRecorder()
+	server.Handler().ServeHTTP(w, req)
+	assert.Equal(s.T(), http.StatusUnauthorized, w.Code)
+}
+
+func (s *serverTestSuite) TestMultiplePolicies() {
+	other := &fakeArbitrager{}
+	s.server.Register("other", other, other)
+
+	w := s.do(http.MethodGet, API_PREFIX+"/policies", "")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	var names []string
+	assert.Nil(s.T(), json.Unmarshal(w.Body.Bytes(), &names))
+	assert.Equal(s.T(), []string{"fake", "other"}, names)
+
+	w = s.do(http.MethodPost, API_PREFIX+"/pause", "secret")
+	assert.Equal(s.T(), http.StatusBadRequest, w.Code)
+	w = s.do(http.MethodPost, API_PREFIX+"/pause?policy=unknown", "secret")
+	assert.Equal(s.T(), http.StatusNotFound, w.Code)
+
+	w = s.do(http.MethodPost, API_PREFIX+"/pause?policy=other", "secret")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+	assert.True(s.T(), other.paused)
+	assert.False(s.T(), s.arb.paused)
+}
+
+func (s *serverTestSuite) TestHealthChecks() {
+	var failure error
+	s.server.AddLivenessCheck("fake", func() error { return nil })
+	s.server.AddReadinessCheck("fake", func() error { return failure })
+
+	w := s.do(http.MethodGet, "/healthz", "")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	w = s.do(http.MethodGet, "/readyz", "")
+	assert.Equal(s.T(), http.StatusOK, w.Code)
+
+	failure = fmt.Errorf("no sample yet")
+	w = s.do(http.MethodGet, "/readyz", "")
+	assert.Equal(s.T(), http.StatusServiceUnavailable, w.Code)
+	var body struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}
+	assert.NoError(s.T(), json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(s.T(), "failed", body.Status)
+	assert.Equal(s.T(), "no sample yet", body.Checks["fake"])
+}
+
+func (s *serverTestSuite) TestProbeServer() {
+	s.server.AddReadinessCheck("fake", func() error { return fmt.Errorf("no sample yet") })
+
+	probe := func(target string) int {
+		w := httptest.NewRecorder()
+		s.server.ProbeHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Code
+	}
+	assert.Equal(s.T(), http.StatusOK, probe("/healthz"))
+	assert.Equal(s.T(), http.StatusServiceUnavailable, probe("/readyz"))
+	// the admin api is not exposed on the probe address
+	assert.Equal(s.T(), http.StatusNotFound, probe(API_PREFIX+"/config"))
+}
@@ -1,7 +1,14 @@
 package bootstrap
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/vjoke/falcon/pkg/log"
+	"github.com/vjoke/falcon/pkg/metrics"
+	"github.com/vjoke/falcon/venus/pkg/admin"
+	"github.com/vjoke/falcon/venus/pkg/keystore"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
 	"github.com/vjoke/falcon/venus/pkg/plutus"
 	"github.com/vjoke/falcon/venus/pkg/server"
 )
@@ -9,12 +16,19 @@ import (
 // Bot contains the runtime configuration for the bot
 type Bot struct {
 	// TODO: add other components
-	server server.Instance
-	arb    plutus.Arbitrager
+	server   server.Instance
+	policies []*policy
+	admin    *admin.Server
+}
+
+// policy is an arbitrager running the policy of a config file
+type policy struct {
+	configFile string
+	arb        plutus.Arbitrager
 }
 
 // NewBot creates a new bot instance based on the provided parameters
-func NewBot(builder plutus.ArbitragerBuilder, initFuncs ...func(*Bot)) (*Bot, error) {
+func NewBot(args *PixiuArgs, builder plutus.ArbitragerBuilder, initFuncs ...func(*Bot)) (*Bot, error) {
 	b := &Bot{
 		server: server.New(),
 	}
@@ -23,31 +37,143 @@ func NewBot(builder plutus.ArbitragerBuilder, initFuncs ...func(*Bot)) (*Bot, er
 		fn(b)
 	}
 
-	err := b.initArbitrager(builder)
+	if err := InitKeystore(args); err != nil {
+		log.Errorf("failed to open keystore: %v", err)
+		return nil, err
+	}
+
+	err := b.initArbitragers(args, builder)
 	if err != nil {
-		log.Errorf("failed to init arbitrager: %v", err)
+		log.Errorf("failed to init arbitragers: %v", err)
 		return nil, err
 	}
 
+	b.initAdmin(args)
+	b.initReloader(args)
+
 	return b, nil
 }
 
-func (b *Bot) initArbitrager(builder plutus.ArbitragerBuilder) error {
-	arb, err := builder.Build()
+// initArbitragers builds an arbitrager for each policy file, they share
+// the resources of the builder
+func (b *Bot) initArbitragers(args *PixiuArgs, builder plutus.ArbitragerBuilder) error {
+	files, err := ResolveConfigFiles(args.ConfigFiles)
 	if err != nil {
 		return err
 	}
 
-	b.arb = arb
+	for _, file := range files {
+		arb, err := builder.WithConfig(file).Build()
+		if err != nil {
+			return fmt.Errorf("failed to build policy of %v: %v", file, err)
+		}
+		log.Infof("loaded policy %v from %v", arb.Name(), file)
+		b.policies = append(b.policies, &policy{
+			configFile: file,
+			arb:        arb,
+		})
+	}
+
 	b.addStartFunc(func(stop <-chan struct{}) error {
-		log.Infof("start arbitrager ...")
-		b.arb.Start(stop)
+		for _, p := range b.policies {
+			log.Infof("start arbitrager %v ...", p.arb.Name())
+			if s, ok := p.arb.(plutus.Supervised); ok {
+				s.Prepare(stop)
+				continue
+			}
+			p.arb.Start(stop)
+		}
+		return nil
+	})
+	// Workers are supervised to be restarted on failures
+	for _, p := range b.policies {
+		if s, ok := p.arb.(plutus.Supervised); ok {
+			for _, w := range s.Workers() {
+				b.server.RunSupervised(p.arb.Name()+"/"+w.Name, args.Restart, w.Run)
+			}
+		}
+	}
+	// Stop the arbitragers before the server shuts down
+	b.addTerminatingStartFunc(func(stop <-chan struct{}) error {
+		<-stop
+		var wg sync.WaitGroup
+		for _, p := range b.policies {
+			wg.Add(1)
+			go func(arb plutus.Arbitrager) {
+				defer wg.Done()
+				log.Infof("stop arbitrager %v ...", arb.Name())
+				arb.Stop()
+			}(p.arb)
+		}
+		wg.Wait()
 		return nil
 	})
 
 	return nil
 }
 
+// InitKeystore opens the keystore for resolving the credentials of policies
+func InitKeystore(args *PixiuArgs) error {
+	if args.Keystore == "" {
+		return nil
+	}
+
+	passphrase, err := keystore.Passphrase(args.KeystorePassphraseFile)
+	if err != nil {
+		return err
+	}
+	ks, err := keystore.Open(args.Keystore, passphrase)
+	if err != nil {
+		return err
+	}
+
+	model.SetSecretStore(ks)
+	log.Infof("opened keystore %v", args.Keystore)
+	return nil
+}
+
+func (b *Bot) initAdmin(args *PixiuArgs) {
+	if args.AdminAddr == "" && args.ProbeAddr == "" {
+		log.Info("admin server is disabled")
+		return
+	}
+
+	b.admin = admin.NewServer(&admin.Options{
+		Addr:      args.AdminAddr,
+		ProbeAddr: args.ProbeAddr,
+		Token:     args.AdminToken,
+	})
+	for _, p := range b.policies {
+		inspector, _ := p.arb.(plutus.Inspector)
+		controller, _ := p.arb.(plutus.Controller)
+		b.admin.Register(p.arb.Name(), inspector, controller)
+	}
+	b.admin.Handle("/metrics", metrics.Handler())
+	b.admin.HandleInspect("/components", func() interface{} { return b.server.Status() })
+	b.initProbes()
+	b.addStartFunc(b.admin.Run)
+}
+
+// initProbes adds the checks of the policies and the supervised workers to
+// the liveness and readiness probes of the admin and probe servers
+func (b *Bot) initProbes() {
+	for _, p := range b.policies {
+		if prober, ok := p.arb.(plutus.Prober); ok {
+			b.admin.AddLivenessCheck(p.arb.Name(), prober.Alive)
+			b.admin.AddReadinessCheck(p.arb.Name(), prober.Ready)
+		}
+	}
+
+	b.admin.AddReadinessCheck("components", func() error {
+		for _, s := range b.server.Status() {
+			if s.State != server.STATE_RUNNING {
+				return fmt.Errorf("component %v is %v", s.Name, s.State)
+			}
+		}
+		return nil
+	})
+}
+
 // Start starts all components of the pixiu bot
 // Bot can be canceled at any time by closing the provided stop channel.
 func (b *Bot) Start(stop <-chan struct{}) error {
@@ -67,11 +193,16 @@ func (b *Bot) Start(stop <-chan struct{}) error {
 func (b *Bot) waitForShutdown(stop <-chan struct{}) {
 	go func() {
 		<-stop
-		// TODO: shutdown all the comonents
-		log.Info("bot shutdown")
+		log.Info("bot is shutting down")
 	}()
 }
 
+// Failed returns a channel which receives the failure escalated by a
+// supervised component, the bot should be stopped then
+func (b *Bot) Failed() <-chan error {
+	return b.server.Failed()
+}
+
 // WaitUntilCompletion waits for everything marked as a "required termination" to complete.
 // This should be called before exiting.
 func (b *Bot) WaitUntilCompletion() {
@@ -1,8 +1,60 @@
 package bootstrap
 
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/vjoke/falcon/venus/pkg/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/server"
+)
+
+// Strategies of the arbitragers built for the policies
+const (
+	STRATEGY_PIXIU = "pixiu"
+	STRATEGY_GRID  = "grid"
+)
+
+// ValidStrategy returns whether s is a known strategy
+func ValidStrategy(s string) bool {
+	return s == STRATEGY_PIXIU || s == STRATEGY_GRID
+}
+
 // PixiuArgs provids all of the configuration parameters for pixiu service
 type PixiuArgs struct {
-	ConfigFile string
+	// ConfigFiles are the policy files or directories of policy files, one
+	// arbitrager is run for each policy
+	ConfigFiles []string
+	// Strategy is the strategy of the arbitragers, one of pixiu and grid
+	Strategy string
+	// MaxExposure is the combined exposure in USDT of all the policies,
+	// zero means unlimited
+	MaxExposure float64
+	// ConfigWatchInterval is the interval to check changes of the config
+	// file for reloading, zero disables watching
+	ConfigWatchInterval time.Duration
+	// AdminAddr is the listening address of the admin server, empty disables it
+	AdminAddr string
+	// ProbeAddr is the listening address of the liveness and readiness
+	// probes, which need no token, empty disables it
+	ProbeAddr string
+	// AdminToken authenticates the control actions of the admin server
+	AdminToken string
+	// Keystore is the encrypted keystore for the keystore: references of
+	// credentials, empty means no keystore
+	Keystore string
+	// KeystorePassphraseFile is the file of the keystore passphrase, it is
+	// used if the passphrase environment variable is not set
+	KeystorePassphraseFile string
+	// ClockSpeed is the speed of the clock of the trading logic relative to
+	// the wall clock, e.g. to replay against the mock exchange faster than
+	// real time, 1 is the wall clock
+	ClockSpeed float64
+	// Restart is the restart options of the supervised workers of policies
+	Restart *server.RestartOptions
 }
 
 func NewPixiuArgs(initFuncs ...func(*PixiuArgs)) *PixiuArgs {
@@ -21,5 +73,65 @@ func NewPixiuArgs(initFuncs ...func(*PixiuArgs)) *PixiuArgs {
 
 // Apply default value to PixiuArgs
 func (p *PixiuArgs)applyDefaults() {
-	p.ConfigFile = "./config.toml"
-}
\ No newline at end of file
+	p.ConfigFiles = []string{"./config.toml"}
+	p.Strategy = STRATEGY_PIXIU
+	p.ConfigWatchInterval = 10 * time.Second
+	p.AdminAddr = "127.0.0.1:8686"
+	p.ProbeAddr = ":8687"
+	p.ClockSpeed = 1
+	p.Restart = server.DefaultRestartOptions()
+}
+
+// NewClock returns the clock of the trading logic of the arbitragers, it is
+// accelerated from now if ClockSpeed is not 1
+func (p *PixiuArgs) NewClock() pixiu.Clock {
+	if p.ClockSpeed == 1 {
+		return pixiu.NewRealClock()
+	}
+	return pixiu.NewAcceleratedClock(time.Now(), p.ClockSpeed)
+}
+
+// ResolveConfigFiles expands the directories in paths to the toml files in
+// them, the files are sorted by name within a directory and duplicated
+// files are removed
+func ResolveConfigFiles(paths []string) ([]string, error) {
+	files := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if abs, err := filepath.Abs(file); err == nil && !seen[abs] {
+			seen[abs] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			add(path)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if !e.IsDir() && filepath.Ext(e.Name()) == ".toml" {
+				names = append(names, e.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(filepath.Join(path, name))
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no config file found in %v", paths)
+	}
+	return files, nil
+}
@@ -0,0 +1,77 @@
+package bootstrap
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/vjoke/falcon/pkg/log"
+	"github.com/vjoke/falcon/venus/pkg/cmd"
+	"github.com/vjoke/falcon/venus/pkg/plutus"
+)
+
+// initReloader reloads the configs on SIGHUP, or the config of a policy on
+// changes of its config file
+func (b *Bot) initReloader(args *PixiuArgs) {
+	reload := func(p *policy, reason string) {
+		controller, ok := p.arb.(plutus.Controller)
+		if !ok {
+			log.Infof("arbitrager %v does not support reloading", p.arb.Name())
+			return
+		}
+
+		log.Infof("reload config of %v for %v", p.arb.Name(), reason)
+		if err := controller.Reload(); err != nil {
+			log.Errorf("failed to reload config of %v: %v", p.arb.Name(), err)
+		}
+	}
+
+	b.addStartFunc(func(stop <-chan struct{}) error {
+		go cmd.NotifySignalFunc(stop, func(sig os.Signal) {
+			for _, p := range b.policies {
+				reload(p, sig.String())
+			}
+		}, syscall.SIGHUP)
+
+		if args.ConfigWatchInterval > 0 {
+			for _, p := range b.policies {
+				go func(p *policy) {
+					watchFile(p.configFile, args.ConfigWatchInterval, stop, func() {
+						reload(p, "changes of "+p.configFile)
+					})
+				}(p)
+			}
+		}
+		return nil
+	})
+}
+
+// watchFile calls fn when the modification time or size of a file changes
+func watchFile(path string, interval time.Duration, stop <-chan struct{}, fn func()) {
+	stat := func() (time.Time, int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Warnf("failed to stat %v: %v", path, err)
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+
+	modTime, size := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t, s := stat()
+			if s < 0 || (t.Equal(modTime) && s == size) {
+				continue
+			}
+			modTime, size = t, s
+			fn()
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/spf13/cobra"
@@ -35,6 +36,24 @@ func WaitSignal(stop chan struct{}) {
 	_ = log.Sync()
 }
 
+// WaitSignalOrFailure awaits for SIGINT, SIGTERM or a failure and closes the
+// stop channel, the failure is returned if any
+func WaitSignalOrFailure(stop chan struct{}, failed <-chan error) error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	var err error
+	select {
+	case <-sigs:
+	case err = <-failed:
+		log.Errorf("shutting down on failure: %v", err)
+	}
+	close(stop)
+	_ = log.Sync()
+	return err
+}
+
 // WaitSignalFunc awaits for SIGINT or SIGTERM and calls the cancel function
 func WaitSignalFunc(cancel func()) {
 	sigs := make(chan os.Signal, 1)
@@ -44,14 +63,56 @@ func WaitSignalFunc(cancel func()) {
 	_ = log.Sync()
 }
 
+// NotifySignalFunc calls fn every time one of the signals is received until
+// the stop channel is closed
+func NotifySignalFunc(stop <-chan struct{}, fn func(os.Signal), sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case sig := <-ch:
+			fn(sig)
+		}
+	}
+}
+
 // AddFlags adds all command line flags to the given command.
 func AddFlags(rootCmd *cobra.Command) {
 	rootCmd.PersistentFlags().AddGoFlagSet(flag.CommandLine)
 }
 
-// PrintFlags logs the flags in the flagset
+// secretFlags lists the words in names of flags whose values are secrets
+var secretFlags = []string{
+	"token",
+	"password",
+	"passphrase",
+	"secret",
+	"api_key",
+}
+
+// PrintFlags logs the flags in the flagset, values of secret flags are
+// redacted
 func PrintFlags(flags *pflag.FlagSet) {
 	flags.VisitAll(func(flag *pflag.Flag) {
-		log.Infof("FLAG: --%s=%q", flag.Name, flag.Value)
+		value := flag.Value.String()
+		if value != "" && IsSecretFlag(flag.Name) {
+			value = "******"
+		}
+		log.Infof("FLAG: --%s=%q", flag.Name, value)
 	})
 }
+
+// IsSecretFlag checks if the value of a flag is a secret by its name
+func IsSecretFlag(name string) bool {
+	name = strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+	for _, word := range secretFlags {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -124,3 +124,17 @@ func TestInitializeDurationFlag(t *testing.T) {
 		t.Errorf("%s: pflag parse error. Actual %d, Expected %d", testName, testDuration, defaultDuration)
 	}
 }
+
+func TestIsSecretFlag(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"admin_token":              true,
+		"keystore_passphrase_file": true,
+		"api-key":                  true,
+		"config":                   false,
+		"admin_addr":               false,
+	} {
+		if actual := IsSecretFlag(name); actual != expected {
+			t.Errorf("IsSecretFlag(%q) returns %v, expected %v", name, actual, expected)
+		}
+	}
+}
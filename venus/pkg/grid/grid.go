@@ -0,0 +1,339 @@
+package grid
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	glog "github.com/vjoke/falcon/pkg/log"
+	model "github.com/vjoke/falcon/venus/pkg/model/grid"
+	pmodel "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/plutus"
+)
+
+const (
+	DEFAULT_SHUTDOWN_TIMEOUT = 20 * time.Second
+)
+
+var gLog = glog.RegisterScope("grid", "grid", 0)
+
+var (
+	_ plutus.Supervised = &Grid{}
+	_ plutus.Prober     = &Grid{}
+)
+
+// Builder implements the builder for grid arbitragers, all the grids built
+// by the same builder share the exchange clients and the request limit
+type Builder struct {
+	configFile string
+	shared     *pixiu.Shared
+}
+
+// NewBuilder creates a builder of grid arbitragers
+func NewBuilder() *Builder {
+	return &Builder{
+		shared: pixiu.NewShared(0),
+	}
+}
+
+// WithClock sets the clock of all the grids, it should be called before
+// building any grid
+func (b *Builder) WithClock(clock pixiu.Clock) *Builder {
+	b.shared.SetClock(clock)
+	return b
+}
+
+// WithConfig sets the config file
+func (b *Builder) WithConfig(configFile string) plutus.ArbitragerBuilder {
+	b.configFile = configFile
+	return b
+}
+
+// Build creates a grid arbitrager
+func (b *Builder) Build() (plutus.Arbitrager, error) {
+	conf, err := model.LoadConfigFromFile(b.configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := model.VerifyConfig(conf); err != nil {
+		return nil, err
+	}
+
+	return NewGrid(conf, b.shared)
+}
+
+// Grid places ladders of limit orders between the bounds of each symbol of
+// a policy and re-places the opposite order when one is filled
+type Grid struct {
+	name    string
+	log     *glog.Scope
+	config  *model.Config
+	shared  *pixiu.Shared
+	client  *binance.Client
+	clock   pixiu.Clock
+	ladders []*Ladder
+	// running counts the running workers, Stop waits for them
+	running sync.WaitGroup
+
+	mu       sync.Mutex
+	info     *binance.ExchangeInfo
+	lastBeat time.Time
+	lastPoll time.Time
+	pollErr  error
+
+	// ctx is canceled when the grid is stopped
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewGrid creates a grid arbitrager with the shared resources, the symbols
+// of the grids are claimed on the account
+func NewGrid(config *model.Config, shared *pixiu.Shared) (*Grid, error) {
+	p := config.Policy
+	if err := shared.Register(p.Name, p.Testnet, config.Exchange.BaseURL); err != nil {
+		return nil, err
+	}
+
+	symbols := make([]string, 0, len(p.Symbols))
+	for _, s := range p.Symbols {
+		symbols = append(symbols, s.Symbol)
+	}
+	apiKey := config.Exchange.ApiKey.Value()
+	if err := shared.Claim(p.Name, apiKey, symbols); err != nil {
+		shared.Unregister(p.Name)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g := &Grid{
+		name:   p.Name,
+		log:    gLog.WithLabels("policy", p.Name),
+		config: config,
+		shared: shared,
+		client: shared.Client(apiKey, config.Exchange.SecretKey.Value()),
+		clock:  shared.Clock(),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for _, s := range p.Symbols {
+		g.ladders = append(g.ladders, NewLadder(g, s))
+	}
+	return g, nil
+}
+
+// Name returns the name of the policy
+func (g *Grid) Name() string {
+	return g.name
+}
+
+// Start starts the grid with its worker
+func (g *Grid) Start(stopCh <-chan struct{}) {
+	g.Prepare(stopCh)
+	for _, w := range g.Workers() {
+		go w.Run(stopCh)
+	}
+}
+
+// Prepare starts the grid without its worker, which is run by a supervisor
+func (g *Grid) Prepare(stopCh <-chan struct{}) {
+	go func() {
+		<-stopCh
+		g.cancel()
+	}()
+}
+
+// Workers returns the worker laying and polling the ladders, a worker
+// returning before stop is closed is a failure
+func (g *Grid) Workers() []plutus.Worker {
+	return []plutus.Worker{{
+		Name: "grid",
+		Run: func(stop <-chan struct{}) error {
+			err := g.Run(stop)
+			select {
+			case <-stop:
+				return nil
+			default:
+				if err == nil {
+					err = fmt.Errorf("grid of %v exited unexpectedly", g.name)
+				}
+				return err
+			}
+		},
+	}}
+}
+
+// Run polls the ladders every interval until stop is closed, the ladders
+// are laid by the first poll and a restarted worker goes on with the
+// orders of the ladders
+func (g *Grid) Run(stopCh <-chan struct{}) error {
+	g.running.Add(1)
+	defer g.running.Done()
+
+	if err := g.loadInfo(); err != nil {
+		return fmt.Errorf("failed to load exchange info: %v", err)
+	}
+	g.poll()
+
+	ticker := g.clock.NewTicker(g.config.Policy.GetInterval())
+	defer ticker.Stop()
+	heartbeat := g.clock.NewTicker(pixiu.HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	g.log.Info("worker is running")
+
+	for {
+		g.beat()
+		select {
+		case <-stopCh:
+			g.log.Info("worker is stopped")
+			return nil
+		case <-heartbeat.C():
+		case <-ticker.C():
+			g.poll()
+		}
+	}
+}
+
+// poll polls all the ladders and records the result for readiness
+func (g *Grid) poll() {
+	g.checkTime()
+
+	var failed error
+	for _, l := range g.ladders {
+		if err := l.Poll(); err != nil {
+			l.log.Errorf("poll error: %v", err)
+			pollErrors.With(g.name, l.Symbol()).Inc()
+			failed = err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lastPoll = g.clock.Now()
+	g.pollErr = failed
+}
+
+// checkTime syncs the clock with the exchange when the last sync is old,
+// orders are refused by the ladders while the clock is not in sync
+func (g *Grid) checkTime() {
+	ctx, cancel := g.requestContext(pmodel.OP_MARKET_DATA)
+	defer cancel()
+	ts := g.shared.TimeSync()
+	if err := ts.Sync(ctx, g.client, false); err != nil {
+		g.log.Warnf("failed to sync time: %v", err)
+	}
+	if err := ts.Check(g.config.Exchange.TimeDrift()); err != nil {
+		g.log.Warn(err)
+	}
+}
+
+// loadInfo loads the filters of the symbols of the ladders
+func (g *Grid) loadInfo() error {
+	ctx, cancel := g.requestContext(pmodel.OP_MARKET_DATA)
+	defer cancel()
+	info, err := g.shared.ExchangeInfo(ctx, g.client, time.Hour)
+	if err != nil {
+		return err
+	}
+
+	symbols := make(map[string]*binance.Symbol)
+	for i := range info.Symbols {
+		symbols[info.Symbols[i].Symbol] = &info.Symbols[i]
+	}
+	for _, l := range g.ladders {
+		s, ok := symbols[l.Symbol()]
+		if !ok {
+			return fmt.Errorf("symbol %v is unknown to the exchange", l.Symbol())
+		}
+		if err := l.setFilters(s); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.info = info
+	return nil
+}
+
+// Stop shuts down the grid, it should be called after the stop channel is
+// closed. The worker is waited until the shutdown timeout, then the open
+// orders of the ladders are canceled and the base bought is left.
+func (g *Grid) Stop() {
+	defer glog.Sync()
+
+	done := make(chan struct{})
+	go func() {
+		g.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(DEFAULT_SHUTDOWN_TIMEOUT):
+		g.log.Warn("grid is still running after timeout")
+	}
+
+	for _, l := range g.ladders {
+		l.CancelAll()
+		l.log.Infof("stopped with profit %v of %v round trips", l.Profit(), l.RoundTrips())
+	}
+	g.shared.Unregister(g.name)
+	g.log.Info("grid is stopped")
+}
+
+// Alive returns an error if the worker has no heartbeat in time
+func (g *Grid) Alive() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.lastBeat.IsZero() && g.clock.Since(g.lastBeat) > pixiu.HEARTBEAT_TIMEOUT {
+		return fmt.Errorf("no heartbeat from grid in %v", pixiu.HEARTBEAT_TIMEOUT)
+	}
+	return nil
+}
+
+// Ready returns an error if the exchange info is not loaded, the clock is
+// not in sync or the last poll failed or is too old
+func (g *Grid) Ready() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.info == nil {
+		return fmt.Errorf("exchange info is not loaded")
+	}
+	if err := g.shared.TimeSync().Check(g.config.Exchange.TimeDrift()); err != nil {
+		return err
+	}
+	if g.pollErr != nil {
+		return fmt.Errorf("last poll failed: %v", g.pollErr)
+	}
+	if g.lastPoll.IsZero() {
+		return fmt.Errorf("no poll yet")
+	}
+	maxAge := pixiu.STALE_SAMPLE_INTERVALS*g.config.Policy.GetInterval() + pixiu.HEARTBEAT_INTERVAL
+	if age := g.clock.Since(g.lastPoll); age > maxAge {
+		return fmt.Errorf("last poll is %v old", age.Truncate(time.Second))
+	}
+	return nil
+}
+
+// beat records a heartbeat of the worker
+func (g *Grid) beat() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lastBeat = g.clock.Now()
+}
+
+// requestContext returns the context of a request by its class, requests
+// are canceled when the grid is stopped except orders, which are needed to
+// cancel the open orders on shutdown
+func (g *Grid) requestContext(class string) (context.Context, context.CancelFunc) {
+	parent := g.ctx
+	if class == pmodel.OP_ORDER {
+		parent = context.Background()
+	}
+	return context.WithTimeout(parent, g.config.Exchange.Timeouts.Get(class))
+}
@@ -0,0 +1,228 @@
+package grid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+	model "github.com/vjoke/falcon/venus/pkg/model/grid"
+	pmodel "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/pixiu"
+)
+
+type gridTestSuite struct {
+	suite.Suite
+	exchange *mockexchange.Exchange
+	server   *httptest.Server
+	client   *binance.Client
+}
+
+func TestGrid(t *testing.T) {
+	suite.Run(t, new(gridTestSuite))
+}
+
+func dec(s string) pmodel.Decimal {
+	return pmodel.MustParseDecimal(s)
+}
+
+func (r *gridTestSuite) SetupTest() {
+	r.exchange = mockexchange.New(mockexchange.DefaultScript("ADAUSDT"))
+	r.server = httptest.NewServer(r.exchange)
+	r.client = binance.NewClient("key", "secret")
+	r.client.BaseURL = r.server.URL
+}
+
+func (r *gridTestSuite) TearDownTest() {
+	r.server.Close()
+}
+
+// newTestGrid creates a grid of ADAUSDT at prices 0.9, 0.95, 1, 1.05 and
+// 1.1 with 20 ADA each of the mock exchange at price 1
+func (r *gridTestSuite) newTestGrid(outOfRange string, dryrun bool) (*Grid, *Ladder) {
+	conf := &model.Config{
+		Exchange: &pmodel.Exchange{ApiKey: "key", SecretKey: "secret", BaseURL: r.server.URL},
+		Policy: &model.Policy{
+			Name:   "grid-test",
+			Dryrun: dryrun,
+			Fee:    mockexchange.DEFAULT_FEE,
+			Symbols: []*model.Symbol{{
+				Symbol: "ADAUSDT", Lower: dec("0.9"), Upper: dec("1.1"), Grids: 4,
+				Quantity: dec("20"), OutOfRange: outOfRange,
+			}},
+		},
+	}
+	r.Require().Empty(model.ValidateConfig(conf))
+
+	g, err := NewGrid(conf, pixiu.NewShared(0))
+	r.Require().NoError(err)
+	r.Require().NoError(g.loadInfo())
+	return g, g.ladders[0]
+}
+
+// openOrders returns the open orders of ADAUSDT by price
+func (r *gridTestSuite) openOrders() map[string]binance.SideType {
+	orders, err := r.client.NewListOpenOrdersService().Symbol("ADAUSDT").Do(context.Background())
+	r.Require().NoError(err)
+
+	sides := make(map[string]binance.SideType)
+	for _, o := range orders {
+		sides[dec(o.Price).String()] = o.Side
+	}
+	return sides
+}
+
+func (r *gridTestSuite) TestLay() {
+	g, l := r.newTestGrid("", false)
+	assert.Error(r.T(), g.Ready())
+
+	g.poll()
+	assert.NoError(r.T(), g.Ready())
+	assert.Equal(r.T(), map[string]binance.SideType{
+		"0.9": binance.SideTypeBuy, "0.95": binance.SideTypeBuy,
+		"1.05": binance.SideTypeSell, "1.1": binance.SideTypeSell,
+	}, r.openOrders())
+	// 40.1 ADA is bought for the sells, 40.0599 is received after the fee
+	usdt, _ := r.exchange.Balance("USDT")
+	assert.InDelta(r.T(), 1000-40.1-20*0.9-20*0.95, usdt, 1e-9)
+	ada, locked := r.exchange.Balance("ADA")
+	assert.InDelta(r.T(), 0.0599, ada, 1e-9)
+	assert.InDelta(r.T(), 40, locked, 1e-9)
+
+	// the sells of the inventory cost the price one level below
+	for _, o := range l.Orders() {
+		if o.Side == binance.SideTypeSell {
+			assert.Equal(r.T(), l.prices[o.Level-1], o.Cost)
+		}
+	}
+}
+
+func (r *gridTestSuite) TestRoundTrip() {
+	g, l := r.newTestGrid("", false)
+	g.poll()
+
+	// the buy at 0.95 is replaced by a sell of the ADA received at 1
+	r.exchange.SetPrice("ADAUSDT", 0.94)
+	g.poll()
+	assert.Equal(r.T(), binance.SideTypeSell, r.openOrders()["1"])
+	_, ok := r.openOrders()["0.95"]
+	assert.False(r.T(), ok)
+
+	// the sell at 1 completes a round trip and the buy at 0.95 is back
+	r.exchange.SetPrice("ADAUSDT", 1)
+	g.poll()
+	assert.Equal(r.T(), binance.SideTypeBuy, r.openOrders()["0.95"])
+	assert.Equal(r.T(), 1, l.RoundTrips())
+	// 19.9 ADA are sold for 19.9 * 0.999 USDT, their buy cost 19 / 19.98 each
+	assert.Equal(r.T(), dec("0.9561761"), l.Profit())
+
+	// the sell of the inventory at 1.05 costs 1 each
+	r.exchange.SetPrice("ADAUSDT", 1.05)
+	g.poll()
+	assert.Equal(r.T(), 2, l.RoundTrips())
+	assert.Equal(r.T(), dec("0.9561761").Add(dec("0.979")), l.Profit())
+	assert.Equal(r.T(), binance.SideTypeBuy, r.openOrders()["1"])
+}
+
+func (r *gridTestSuite) TestCanceledOutside() {
+	g, l := r.newTestGrid("", false)
+	g.poll()
+
+	for _, o := range l.Orders() {
+		if o.Price == dec("0.9") {
+			_, err := r.client.NewCancelOrderService().Symbol("ADAUSDT").OrderID(o.ID).Do(context.Background())
+			r.Require().NoError(err)
+		}
+	}
+	_, ok := r.openOrders()["0.9"]
+	r.Require().False(ok)
+
+	g.poll()
+	assert.Equal(r.T(), binance.SideTypeBuy, r.openOrders()["0.9"])
+	assert.Len(r.T(), l.Orders(), 4)
+}
+
+func (r *gridTestSuite) TestOutOfRange() {
+	// hold keeps the orders
+	g, l := r.newTestGrid(model.OUT_OF_RANGE_HOLD, false)
+	g.poll()
+	r.exchange.SetPrice("ADAUSDT", 0.8)
+	g.poll()
+	assert.True(r.T(), l.out)
+	assert.Equal(r.T(), map[string]binance.SideType{
+		"0.95": binance.SideTypeSell, "1": binance.SideTypeSell,
+		"1.05": binance.SideTypeSell, "1.1": binance.SideTypeSell,
+	}, r.openOrders())
+	g.Stop()
+	assert.Empty(r.T(), r.openOrders())
+}
+
+func (r *gridTestSuite) TestCancelOutOfRange() {
+	g, l := r.newTestGrid(model.OUT_OF_RANGE_CANCEL, false)
+	g.poll()
+	r.exchange.SetPrice("ADAUSDT", 1.2)
+	g.poll()
+	assert.True(r.T(), l.idle)
+	assert.Empty(r.T(), r.openOrders())
+	assert.Equal(r.T(), 2, l.RoundTrips())
+
+	// the ladder is laid again when the price is back
+	r.exchange.SetPrice("ADAUSDT", 1)
+	g.poll()
+	assert.False(r.T(), l.idle)
+	assert.Len(r.T(), r.openOrders(), 4)
+}
+
+func (r *gridTestSuite) TestShiftOutOfRange() {
+	g, l := r.newTestGrid(model.OUT_OF_RANGE_SHIFT, false)
+	g.poll()
+	r.exchange.SetPrice("ADAUSDT", 1.3)
+	g.poll()
+
+	lower, upper := l.Bounds()
+	assert.Equal(r.T(), dec("1.2"), lower)
+	assert.Equal(r.T(), dec("1.4"), upper)
+	assert.Equal(r.T(), map[string]binance.SideType{
+		"1.2": binance.SideTypeBuy, "1.25": binance.SideTypeBuy,
+		"1.35": binance.SideTypeSell, "1.4": binance.SideTypeSell,
+	}, r.openOrders())
+	assert.False(r.T(), l.out)
+}
+
+func (r *gridTestSuite) TestUnsyncedClock() {
+	// the time of the exchange is unavailable for the first sync
+	r.server.Close()
+	script := mockexchange.DefaultScript("ADAUSDT")
+	script.Failures = []*mockexchange.Failure{{
+		Method: http.MethodGet, Path: "/api/v3/time", Status: http.StatusInternalServerError, Count: 1,
+	}}
+	r.exchange = mockexchange.New(script)
+	r.server = httptest.NewServer(r.exchange)
+	r.client.BaseURL = r.server.URL
+
+	g, l := r.newTestGrid("", false)
+	g.poll()
+	assert.Error(r.T(), g.Ready())
+	assert.False(r.T(), l.laid)
+	assert.Empty(r.T(), r.openOrders())
+	usdt, _ := r.exchange.Balance("USDT")
+	assert.Equal(r.T(), 1000.0, usdt)
+
+	r.Require().NoError(g.shared.TimeSync().Sync(context.Background(), g.client, true))
+	g.poll()
+	assert.NoError(r.T(), g.Ready())
+	assert.Len(r.T(), r.openOrders(), 4)
+}
+
+func (r *gridTestSuite) TestDryrun() {
+	g, l := r.newTestGrid("", true)
+	g.poll()
+	assert.True(r.T(), l.laid)
+	assert.Empty(r.T(), r.openOrders())
+	usdt, _ := r.exchange.Balance("USDT")
+	assert.Equal(r.T(), 1000.0, usdt)
+}
@@ -0,0 +1,588 @@
+package grid
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	glog "github.com/vjoke/falcon/pkg/log"
+	model "github.com/vjoke/falcon/venus/pkg/model/grid"
+	pmodel "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+const (
+	// CODE_UNKNOWN_ORDER is returned by binance when there is no open order
+	// to cancel
+	CODE_UNKNOWN_ORDER = -2011
+)
+
+// Order defines an order of a level of a ladder, ID is zero until it is
+// placed on the exchange
+type Order struct {
+	ID       int64            `json:"id"`
+	Level    int              `json:"level"`
+	Side     binance.SideType `json:"side"`
+	Price    pmodel.Decimal   `json:"price"`
+	Quantity pmodel.Decimal   `json:"quantity"`
+	// Cost is the quote paid for each base of a sell by the buy one level
+	// below it, the sells laid from the inventory cost the price below
+	Cost pmodel.Decimal `json:"cost"`
+}
+
+// Ladder is the grid of a symbol, a buy is resting at each price below the
+// current price and a sell at each price above it except the nearest one.
+// A filled buy is replaced by a sell one level above it and a filled sell
+// by a buy one level below it, the sell of a buy completes a round trip.
+type Ladder struct {
+	grid *Grid
+	conf *model.Symbol
+	log  *glog.Scope
+
+	mu sync.Mutex
+	// filters of the symbol
+	base        string
+	tick        pmodel.Decimal
+	step        pmodel.Decimal
+	minQty      pmodel.Decimal
+	minNotional pmodel.Decimal
+	// lower and upper are the current bounds, they are moved by shift
+	lower  pmodel.Decimal
+	upper  pmodel.Decimal
+	prices []pmodel.Decimal
+	orders []*Order
+	profit pmodel.Decimal
+	trips  int
+	// laid is false until the ladder is laid at the current bounds
+	laid bool
+	// out is true while the price is out of the bounds, idle is true while
+	// the orders are canceled for it
+	out  bool
+	idle bool
+}
+
+// NewLadder creates the ladder of a symbol, it is laid after the filters of
+// the symbol are set
+func NewLadder(g *Grid, conf *model.Symbol) *Ladder {
+	return &Ladder{
+		grid:  g,
+		conf:  conf,
+		log:   gLog.WithLabels("policy", g.name, "symbol", conf.Symbol),
+		lower: conf.Lower,
+		upper: conf.Upper,
+	}
+}
+
+// Symbol returns the symbol of the ladder
+func (l *Ladder) Symbol() string {
+	return l.conf.Symbol
+}
+
+// Profit returns the profit in the quote asset of the round trips
+func (l *Ladder) Profit() pmodel.Decimal {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.profit
+}
+
+// RoundTrips returns the number of sells filled above their buys
+func (l *Ladder) RoundTrips() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.trips
+}
+
+// Bounds returns the current lower and upper bounds
+func (l *Ladder) Bounds() (pmodel.Decimal, pmodel.Decimal) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lower, l.upper
+}
+
+// Orders returns a copy of the orders of the ladder
+func (l *Ladder) Orders() []Order {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	orders := make([]Order, 0, len(l.orders))
+	for _, o := range l.orders {
+		orders = append(orders, *o)
+	}
+	return orders
+}
+
+// setFilters sets the filters of the symbol from the exchange info
+func (l *Ladder) setFilters(s *binance.Symbol) error {
+	lot, price := s.LotSizeFilter(), s.PriceFilter()
+	if lot == nil || price == nil {
+		return fmt.Errorf("missing lot size or price filter for %v", s.Symbol)
+	}
+
+	minNotional := "0"
+	if f := s.MinNotionalFilter(); f != nil {
+		minNotional = f.MinNotional
+	}
+	values := make([]pmodel.Decimal, 0, 4)
+	for _, v := range []string{price.TickSize, lot.StepSize, lot.MinQuantity, minNotional} {
+		d, err := pmodel.ParseDecimal(v)
+		if err != nil {
+			return fmt.Errorf("invalid filter %q of %v: %v", v, s.Symbol, err)
+		}
+		values = append(values, d)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.base = s.BaseAsset
+	l.tick, l.step, l.minQty, l.minNotional = values[0], values[1], values[2], values[3]
+	return nil
+}
+
+// Poll accounts the fills since the last poll, applies the out of range
+// action at the current price, lays the ladder if it is not laid and
+// places the orders which are not placed yet
+func (l *Ladder) Poll() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	price, err := l.price()
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	if l.laid {
+		failed = l.sync()
+	}
+	if !l.checkRange(price) {
+		return failed
+	}
+	if !l.laid {
+		if err := l.lay(price); err != nil {
+			return err
+		}
+		return failed
+	}
+	if err := l.place(); err != nil {
+		return err
+	}
+	return failed
+}
+
+// CancelAll cancels the open orders of the ladder, it is laid again by
+// the next poll
+func (l *Ladder) CancelAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.cancelOpen(); err != nil {
+		l.log.Errorf("failed to cancel open orders: %v", err)
+		return
+	}
+	l.orders = nil
+	l.laid = false
+}
+
+// levels returns the prices of the levels at the current bounds, rounded
+// down to the tick size
+func (l *Ladder) levels() []pmodel.Decimal {
+	spacing := l.upper.Sub(l.lower).Div(pmodel.NewDecimal(int64(l.conf.Grids), 0))
+	prices := make([]pmodel.Decimal, 0, l.conf.Grids+1)
+	for i := 0; i <= l.conf.Grids; i++ {
+		p := l.lower.Add(spacing.Mul(pmodel.NewDecimal(int64(i), 0)))
+		if i == l.conf.Grids {
+			p = l.upper
+		}
+		prices = append(prices, p.FloorToStep(l.tick))
+	}
+	return prices
+}
+
+// checkRange applies the out of range action of the symbol, false is
+// returned if the ladder is idle until the price is back in range
+func (l *Ladder) checkRange(price pmodel.Decimal) bool {
+	out := price.LessThan(l.lower) || price.GreaterThan(l.upper)
+	if out != l.out {
+		if out {
+			l.log.Warnf("price %v is out of range [%v, %v], action is %v", price, l.lower, l.upper, l.conf.GetOutOfRange())
+			outOfRange.With(l.grid.name, l.Symbol()).Set(1)
+		} else {
+			l.log.Infof("price %v is back in range [%v, %v]", price, l.lower, l.upper)
+			outOfRange.With(l.grid.name, l.Symbol()).Set(0)
+		}
+		l.out = out
+	}
+
+	if !out {
+		if l.idle {
+			// the ladder is laid again at the current price
+			l.idle, l.laid = false, false
+		}
+		return true
+	}
+
+	switch l.conf.GetOutOfRange() {
+	case model.OUT_OF_RANGE_CANCEL:
+		if !l.idle {
+			if err := l.cancelOpen(); err != nil {
+				l.log.Errorf("failed to cancel open orders out of range: %v", err)
+				return false
+			}
+			l.orders = nil
+			l.idle, l.laid = true, false
+		}
+		return false
+	case model.OUT_OF_RANGE_SHIFT:
+		l.shift(price)
+	}
+	return true
+}
+
+// shift moves the bounds by whole grids so that the price is nearest to
+// the middle of the range, the ladder is laid again at the new bounds
+func (l *Ladder) shift(price pmodel.Decimal) {
+	spacing := l.upper.Sub(l.lower).Div(pmodel.NewDecimal(int64(l.conf.Grids), 0))
+	mid := l.lower.Add(l.upper).Div(pmodel.NewDecimal(2, 0))
+	grids := int64(math.Round(price.Sub(mid).Div(spacing).Float64()))
+	offset := spacing.Mul(pmodel.NewDecimal(grids, 0))
+	lower, upper := l.lower.Add(offset).FloorToStep(l.tick), l.upper.Add(offset).FloorToStep(l.tick)
+	if lower.Sign() <= 0 {
+		l.log.Warnf("can not shift the range below zero, hold the orders at price %v", price)
+		return
+	}
+
+	l.log.Infof("shift range [%v, %v] by %v grids to [%v, %v]", l.lower, l.upper, grids, lower, upper)
+	l.lower, l.upper = lower, upper
+	l.laid, l.out = false, false
+	outOfRange.With(l.grid.name, l.Symbol()).Set(0)
+}
+
+// lay cancels the open orders of the symbol and places the buys below the
+// price and the sells above it, the base missing for the sells is bought
+// at the market price
+func (l *Ladder) lay(price pmodel.Decimal) error {
+	l.prices = l.levels()
+	nearest := 0
+	for i, p := range l.prices {
+		if p.Sub(price).Abs().LessThan(l.prices[nearest].Sub(price).Abs()) {
+			nearest = i
+		}
+	}
+
+	quantity := l.conf.Quantity.FloorToStep(l.step)
+	buys, sells := make([]*Order, 0), make([]*Order, 0)
+	for i, p := range l.prices {
+		switch {
+		case i == nearest:
+		case p.LessThan(price):
+			buys = append(buys, &Order{Level: i, Side: binance.SideTypeBuy, Price: p, Quantity: quantity})
+		case p.GreaterThan(price):
+			sells = append(sells, &Order{Level: i, Side: binance.SideTypeSell, Price: p, Quantity: quantity, Cost: l.prices[i-1]})
+		}
+	}
+
+	if l.grid.config.Policy.Dryrun {
+		for _, o := range append(buys, sells...) {
+			l.log.Infof("dryrun, %v %v at level %v price %v", o.Side, o.Quantity, o.Level, o.Price)
+		}
+		l.laid = true
+		return nil
+	}
+
+	if err := l.cancelOpen(); err != nil {
+		return err
+	}
+	l.orders = nil
+
+	free, err := l.freeBase()
+	if err != nil {
+		return err
+	}
+	need := quantity.Mul(pmodel.NewDecimal(int64(len(sells)), 0))
+	if shortfall := need.Sub(free); shortfall.Sign() > 0 {
+		if err := l.buyBase(shortfall, price); err != nil {
+			return err
+		}
+		if free, err = l.freeBase(); err != nil {
+			return err
+		}
+	}
+
+	// the base received after fees may be short for the highest sells
+	for _, o := range sells {
+		o.Quantity = o.Quantity.Min(free).FloorToStep(l.step)
+		if !l.tradable(o.Quantity, o.Price) {
+			l.log.Warnf("not enough %v for the sell at level %v, free %v", l.base, o.Level, free)
+			continue
+		}
+		free = free.Sub(o.Quantity)
+		l.orders = append(l.orders, o)
+	}
+	l.orders = append(l.orders, buys...)
+	l.laid = true
+	l.log.Infof("lay %v buys and %v sells in [%v, %v] at price %v", len(buys), len(sells), l.lower, l.upper, price)
+
+	return l.place()
+}
+
+// sync finds the orders which are no longer open, the opposite orders of
+// the filled ones and the rest of the ones closed outside of the grid are
+// added to be placed
+func (l *Ladder) sync() error {
+	open, err := l.openOrders()
+	if err != nil {
+		return err
+	}
+
+	var failed error
+	orders := l.orders
+	l.orders = make([]*Order, 0, len(orders))
+	for _, o := range orders {
+		if o.ID == 0 || open[o.ID] {
+			l.orders = append(l.orders, o)
+			continue
+		}
+
+		res, err := l.queryOrder(o.ID)
+		if err != nil {
+			l.orders = append(l.orders, o)
+			failed = err
+			continue
+		}
+		executed, quote, err := parseExecuted(res)
+		if err != nil {
+			l.orders = append(l.orders, o)
+			failed = err
+			continue
+		}
+
+		switch res.Status {
+		case binance.OrderStatusTypeFilled:
+			l.filled(o, executed, quote)
+		case binance.OrderStatusTypeNew, binance.OrderStatusTypePartiallyFilled:
+			l.orders = append(l.orders, o)
+		default:
+			l.log.Warnf("%v order %v at level %v is %v outside of the grid", o.Side, o.ID, o.Level, res.Status)
+			if executed.Sign() > 0 {
+				l.filled(o, executed, quote)
+			}
+			rest := o.Quantity.Sub(executed).FloorToStep(l.step)
+			if l.tradable(rest, o.Price) {
+				l.orders = append(l.orders, &Order{Level: o.Level, Side: o.Side, Price: o.Price, Quantity: rest, Cost: o.Cost})
+			}
+		}
+	}
+	return failed
+}
+
+// filled accounts a fill and adds the opposite order one level away, the
+// received asset is reduced by the fee
+func (l *Ladder) filled(o *Order, executed, quote pmodel.Decimal) {
+	fillsTotal.With(l.grid.name, l.Symbol(), string(o.Side)).Inc()
+	keep := pmodel.NewDecimalFromFloat(1 - l.grid.config.Policy.Fee)
+
+	if o.Side == binance.SideTypeBuy {
+		received := executed.Mul(keep)
+		if received.Sign() <= 0 || o.Level+1 >= len(l.prices) {
+			return
+		}
+		sell := &Order{
+			Level:    o.Level + 1,
+			Side:     binance.SideTypeSell,
+			Price:    l.prices[o.Level+1],
+			Quantity: received.FloorToStep(l.step),
+			Cost:     quote.Div(received),
+		}
+		l.log.Infof("buy %v filled at level %v, sell %v at %v", executed, o.Level, sell.Quantity, sell.Price)
+		l.add(sell)
+		return
+	}
+
+	profit := quote.Mul(keep).Sub(executed.Mul(o.Cost))
+	l.profit = l.profit.Add(profit)
+	l.trips++
+	roundTrips.With(l.grid.name, l.Symbol()).Inc()
+	gridProfit.With(l.grid.name, l.Symbol()).Set(l.profit.Float64())
+	if o.Level == 0 {
+		return
+	}
+	buy := &Order{
+		Level:    o.Level - 1,
+		Side:     binance.SideTypeBuy,
+		Price:    l.prices[o.Level-1],
+		Quantity: l.conf.Quantity.FloorToStep(l.step),
+	}
+	l.log.Infof("sell %v filled at level %v with profit %v, total %v of %v round trips, buy %v at %v",
+		executed, o.Level, profit, l.profit, l.trips, buy.Quantity, buy.Price)
+	l.add(buy)
+}
+
+// add adds an order to be placed if it passes the filters
+func (l *Ladder) add(o *Order) {
+	if !l.tradable(o.Quantity, o.Price) {
+		l.log.Warnf("%v %v at level %v is below the filters, the level is left empty", o.Side, o.Quantity, o.Level)
+		return
+	}
+	l.orders = append(l.orders, o)
+}
+
+// tradable checks the quantity and the notional of an order
+func (l *Ladder) tradable(quantity, price pmodel.Decimal) bool {
+	return quantity.Sign() > 0 && !quantity.LessThan(l.minQty) && !quantity.Mul(price).LessThan(l.minNotional)
+}
+
+// place places the orders which are not placed yet, the failed ones are
+// placed again by the next poll
+func (l *Ladder) place() error {
+	var failed error
+	for _, o := range l.orders {
+		if o.ID != 0 {
+			continue
+		}
+		id, err := l.limitOrder(o)
+		if err != nil {
+			l.log.Errorf("failed to place %v %v at level %v price %v: %v", o.Side, o.Quantity, o.Level, o.Price, err)
+			failed = err
+			continue
+		}
+		o.ID = id
+	}
+	return failed
+}
+
+// buyBase buys the base for the sells at the market price, the quantity
+// covers the fee and the filters
+func (l *Ladder) buyBase(shortfall, price pmodel.Decimal) error {
+	keep := pmodel.NewDecimalFromFloat(1 - l.grid.config.Policy.Fee)
+	quantity := shortfall.Div(keep).CeilToStep(l.step)
+	if quantity.LessThan(l.minQty) {
+		quantity = l.minQty.CeilToStep(l.step)
+	}
+	if quantity.Mul(price).LessThan(l.minNotional) {
+		quantity = l.minNotional.Div(price).CeilToStep(l.step)
+	}
+
+	// signed requests are rejected or misjudged with a drifting clock
+	if err := l.grid.shared.TimeSync().Check(l.grid.config.Exchange.TimeDrift()); err != nil {
+		return fmt.Errorf("refuse to buy %v %v for the sells: %v", quantity, l.base, err)
+	}
+	ctx, cancel := l.grid.requestContext(pmodel.OP_ORDER)
+	defer cancel()
+	_, err := l.grid.client.NewCreateOrderService().Symbol(l.Symbol()).Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).Quantity(quantity.StringFixed(l.step.Places())).Do(ctx)
+	l.orderResult(binance.SideTypeBuy, err)
+	if err != nil {
+		return fmt.Errorf("failed to buy %v %v for the sells: %v", quantity, l.base, err)
+	}
+	l.log.Infof("bought %v %v for the sells at price %v", quantity, l.base, price)
+	return nil
+}
+
+// limitOrder places a limit order of a level
+func (l *Ladder) limitOrder(o *Order) (int64, error) {
+	if err := l.grid.shared.TimeSync().Check(l.grid.config.Exchange.TimeDrift()); err != nil {
+		return 0, err
+	}
+	ctx, cancel := l.grid.requestContext(pmodel.OP_ORDER)
+	defer cancel()
+	res, err := l.grid.client.NewCreateOrderService().Symbol(l.Symbol()).Side(o.Side).
+		Type(binance.OrderTypeLimit).TimeInForce(binance.TimeInForceTypeGTC).
+		Quantity(o.Quantity.StringFixed(l.step.Places())).Price(o.Price.StringFixed(l.tick.Places())).Do(ctx)
+	l.orderResult(o.Side, err)
+	if err != nil {
+		return 0, err
+	}
+	return res.OrderID, nil
+}
+
+// orderResult counts the result of an order request
+func (l *Ladder) orderResult(side binance.SideType, err error) {
+	result := RESULT_SUCCESS
+	if err != nil {
+		result = RESULT_FAILURE
+	}
+	ordersTotal.With(l.grid.name, l.Symbol(), string(side), result).Inc()
+}
+
+// cancelOpen cancels all the open orders of the symbol
+func (l *Ladder) cancelOpen() error {
+	if l.grid.config.Policy.Dryrun {
+		return nil
+	}
+
+	ctx, cancel := l.grid.requestContext(pmodel.OP_ORDER)
+	defer cancel()
+	_, err := l.grid.client.NewCancelOpenOrdersService().Symbol(l.Symbol()).Do(ctx)
+	if e, ok := err.(*common.APIError); ok && e.Code == CODE_UNKNOWN_ORDER {
+		return nil
+	}
+	return err
+}
+
+// price returns the latest price of the symbol
+func (l *Ladder) price() (pmodel.Decimal, error) {
+	ctx, cancel := l.grid.requestContext(pmodel.OP_MARKET_DATA)
+	defer cancel()
+	prices, err := l.grid.client.NewListPricesService().Symbol(l.Symbol()).Do(ctx)
+	if err != nil {
+		return pmodel.Decimal{}, err
+	}
+	if len(prices) == 0 {
+		return pmodel.Decimal{}, fmt.Errorf("no price of %v", l.Symbol())
+	}
+	return pmodel.ParseDecimal(prices[0].Price)
+}
+
+// openOrders returns the ids of the open orders of the symbol
+func (l *Ladder) openOrders() (map[int64]bool, error) {
+	ctx, cancel := l.grid.requestContext(pmodel.OP_ACCOUNT)
+	defer cancel()
+	orders, err := l.grid.client.NewListOpenOrdersService().Symbol(l.Symbol()).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	open := make(map[int64]bool, len(orders))
+	for _, o := range orders {
+		open[o.OrderID] = true
+	}
+	return open, nil
+}
+
+// queryOrder returns an order of the symbol
+func (l *Ladder) queryOrder(id int64) (*binance.Order, error) {
+	ctx, cancel := l.grid.requestContext(pmodel.OP_ACCOUNT)
+	defer cancel()
+	return l.grid.client.NewGetOrderService().Symbol(l.Symbol()).OrderID(id).Do(ctx)
+}
+
+// freeBase returns the free balance of the base asset
+func (l *Ladder) freeBase() (pmodel.Decimal, error) {
+	ctx, cancel := l.grid.requestContext(pmodel.OP_ACCOUNT)
+	defer cancel()
+	account, err := l.grid.client.NewGetAccountService().Do(ctx)
+	if err != nil {
+		return pmodel.Decimal{}, err
+	}
+
+	for _, b := range account.Balances {
+		if b.Asset == l.base {
+			return pmodel.ParseDecimal(b.Free)
+		}
+	}
+	return pmodel.Decimal{}, nil
+}
+
+// parseExecuted returns the executed base and quote of an order
+func parseExecuted(o *binance.Order) (pmodel.Decimal, pmodel.Decimal, error) {
+	executed, err := pmodel.ParseDecimal(o.ExecutedQuantity)
+	if err != nil {
+		return pmodel.Decimal{}, pmodel.Decimal{}, fmt.Errorf("invalid executed quantity %q: %v", o.ExecutedQuantity, err)
+	}
+	quote, err := pmodel.ParseDecimal(o.CummulativeQuoteQuantity)
+	if err != nil {
+		return pmodel.Decimal{}, pmodel.Decimal{}, fmt.Errorf("invalid quote quantity %q: %v", o.CummulativeQuoteQuantity, err)
+	}
+	return executed, quote, nil
+}
@@ -0,0 +1,25 @@
+package grid
+
+import (
+	"github.com/vjoke/falcon/pkg/metrics"
+)
+
+const (
+	RESULT_SUCCESS = "success"
+	RESULT_FAILURE = "failure"
+)
+
+var (
+	ordersTotal = metrics.NewCounterVec("grid_orders_total",
+		"Number of orders placed by the grids.", "policy", "symbol", "side", "result")
+	fillsTotal = metrics.NewCounterVec("grid_fills_total",
+		"Number of orders of the grids filled.", "policy", "symbol", "side")
+	roundTrips = metrics.NewCounterVec("grid_round_trips_total",
+		"Number of sells filled above the buys of the grids.", "policy", "symbol")
+	gridProfit = metrics.NewGaugeVec("grid_profit",
+		"Profit in the quote asset of the round trips of a grid after fees.", "policy", "symbol")
+	outOfRange = metrics.NewGaugeVec("grid_out_of_range",
+		"Whether the price is out of the range of a grid, 1 if it is.", "policy", "symbol")
+	pollErrors = metrics.NewCounterVec("grid_poll_errors_total",
+		"Number of failed polls of the price and the orders of a grid.", "policy", "symbol")
+)
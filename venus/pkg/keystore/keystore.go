@@ -0,0 +1,270 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	VERSION    = 1
+	KDF        = "pbkdf2-sha256"
+	ITERATIONS = 200000
+	SALT_SIZE  = 16
+	KEY_SIZE   = 32
+
+	// PASSPHRASE_ENV is the environment variable of the passphrase
+	PASSPHRASE_ENV = "FALCON_KEYSTORE_PASSPHRASE"
+
+	// VERIFIER is the plaintext of the verifier, which checks the
+	// passphrase of a keystore without secrets
+	VERIFIER = "falcon-keystore"
+)
+
+// entry is an encrypted secret
+type entry struct {
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// file is the format of a keystore file
+type file struct {
+	Version    int               `json:"version"`
+	KDF        string            `json:"kdf"`
+	Iterations int               `json:"iterations"`
+	Salt       string            `json:"salt"`
+	Verifier   *entry            `json:"verifier"`
+	Entries    map[string]*entry `json:"entries"`
+}
+
+// Keystore keeps secrets encrypted by a key derived from a passphrase
+type Keystore struct {
+	path string
+	data *file
+	aead cipher.AEAD
+}
+
+// Create creates an empty keystore, it is written to path by Save
+func Create(path, passphrase string) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase should not be empty")
+	}
+
+	salt := make([]byte, SALT_SIZE)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	data := &file{
+		Version:    VERSION,
+		KDF:        KDF,
+		Iterations: ITERATIONS,
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Entries:    make(map[string]*entry),
+	}
+
+	ks, err := newKeystore(path, data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if data.Verifier, err = ks.seal(VERIFIER, ""); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Open opens a keystore file, the passphrase is verified with the verifier
+// and the entries
+func Open(path, passphrase string) (*Keystore, error) {
+	if err := CheckPermissions(path); err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var data file
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("invalid keystore %v: %v", path, err)
+	}
+	if data.Version != VERSION || data.KDF != KDF {
+		return nil, fmt.Errorf("unsupported keystore version %v with kdf %v", data.Version, data.KDF)
+	}
+	if data.Verifier == nil {
+		return nil, fmt.Errorf("invalid keystore %v: no verifier", path)
+	}
+	if data.Entries == nil {
+		data.Entries = make(map[string]*entry)
+	}
+
+	ks, err := newKeystore(path, &data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if v, err := ks.open(data.Verifier, ""); err != nil || v != VERIFIER {
+		return nil, fmt.Errorf("failed to unlock keystore %v: wrong passphrase", path)
+	}
+	for name := range data.Entries {
+		if _, err := ks.Get(name); err != nil {
+			return nil, fmt.Errorf("failed to unlock keystore %v: %v", path, err)
+		}
+	}
+
+	return ks, nil
+}
+
+// OpenOrCreate opens a keystore file or creates it if it does not exist
+func OpenOrCreate(path, passphrase string) (*Keystore, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return Create(path, passphrase)
+	}
+	return Open(path, passphrase)
+}
+
+func newKeystore(path string, data *file, passphrase string) (*Keystore, error) {
+	salt, err := base64.StdEncoding.DecodeString(data.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+
+	key := pbkdf2.Key([]byte(passphrase), salt, data.Iterations, KEY_SIZE, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keystore{
+		path: path,
+		data: data,
+		aead: aead,
+	}, nil
+}
+
+// Get decrypts the secret of a name
+func (ks *Keystore) Get(name string) (string, error) {
+	e, ok := ks.data.Entries[name]
+	if !ok {
+		return "", fmt.Errorf("no secret %v in keystore", name)
+	}
+	return ks.open(e, name)
+}
+
+// Set encrypts the secret of a name
+func (ks *Keystore) Set(name, secret string) error {
+	if name == "" {
+		return fmt.Errorf("name should not be empty")
+	}
+
+	e, err := ks.seal(secret, name)
+	if err != nil {
+		return err
+	}
+	ks.data.Entries[name] = e
+	return nil
+}
+
+// seal encrypts a secret, the name is authenticated with it
+func (ks *Keystore) seal(secret, name string) (*entry, error) {
+	nonce := make([]byte, ks.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := ks.aead.Seal(nil, nonce, []byte(secret), []byte(name))
+	return &entry{
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// open decrypts an entry sealed with the name
+func (ks *Keystore) open(e *entry, name string) (string, error) {
+	nonce, err := base64.StdEncoding.DecodeString(e.Nonce)
+	if err != nil {
+		return "", fmt.Errorf("invalid nonce of %v: %v", name, err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(e.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext of %v: %v", name, err)
+	}
+	plaintext, err := ks.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("wrong passphrase or corrupted secret %v", name)
+	}
+	return string(plaintext), nil
+}
+
+// Delete removes the secret of a name
+func (ks *Keystore) Delete(name string) {
+	delete(ks.data.Entries, name)
+}
+
+// Names returns the sorted names of the secrets
+func (ks *Keystore) Names() []string {
+	names := make([]string, 0, len(ks.data.Entries))
+	for name := range ks.data.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save writes the keystore to its file, only the owner can read it
+func (ks *Keystore) Save() error {
+	b, err := json.MarshalIndent(ks.data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := ks.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.path)
+}
+
+// CheckPermissions checks that a file holding secrets is not accessible by
+// group or others
+func CheckPermissions(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("permissions %#o of %v are too open, it should be 0600 or 0400", perm, path)
+	}
+	return nil
+}
+
+// Passphrase reads the passphrase from PASSPHRASE_ENV, or from a file
+// with restrictive permissions if the variable is not set
+func Passphrase(passphraseFile string) (string, error) {
+	if p := os.Getenv(PASSPHRASE_ENV); p != "" {
+		return p, nil
+	}
+	if passphraseFile == "" {
+		return "", fmt.Errorf("no passphrase, set %v or a passphrase file", PASSPHRASE_ENV)
+	}
+
+	if err := CheckPermissions(passphraseFile); err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(passphraseFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
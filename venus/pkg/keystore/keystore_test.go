@@ -0,0 +1,92 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type keystoreTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestKeystore(t *testing.T) {
+	suite.Run(t, new(keystoreTestSuite))
+}
+
+func (k *keystoreTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "keystore")
+	assert.Nil(k.T(), err)
+	k.dir = dir
+}
+
+func (k *keystoreTestSuite) TearDownTest() {
+	os.RemoveAll(k.dir)
+}
+
+func (k *keystoreTestSuite) TestRoundTrip() {
+	path := filepath.Join(k.dir, "keystore.json")
+	ks, err := Create(path, "passphrase")
+	assert.Nil(k.T(), err)
+	assert.Nil(k.T(), ks.Set("api_key", "my-api-key"))
+	assert.Nil(k.T(), ks.Set("secret_key", "my-secret-key"))
+	assert.Nil(k.T(), ks.Save())
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(k.T(), err)
+	assert.NotContains(k.T(), string(data), "my-api-key")
+
+	ks, err = Open(path, "passphrase")
+	assert.Nil(k.T(), err)
+	assert.Equal(k.T(), []string{"api_key", "secret_key"}, ks.Names())
+	v, err := ks.Get("api_key")
+	assert.Nil(k.T(), err)
+	assert.Equal(k.T(), "my-api-key", v)
+
+	_, err = Open(path, "wrong")
+	assert.NotNil(k.T(), err)
+}
+
+func (k *keystoreTestSuite) TestEmptyKeystore() {
+	path := filepath.Join(k.dir, "keystore.json")
+	ks, err := Create(path, "passphrase")
+	assert.Nil(k.T(), err)
+	assert.Nil(k.T(), ks.Save())
+
+	ks, err = Open(path, "passphrase")
+	assert.Nil(k.T(), err)
+	assert.Empty(k.T(), ks.Names())
+
+	// the verifier rejects a wrong passphrase without any secret
+	_, err = Open(path, "wrong")
+	assert.NotNil(k.T(), err)
+	_, err = OpenOrCreate(path, "wrong")
+	assert.NotNil(k.T(), err)
+}
+
+func (k *keystoreTestSuite) TestNoVerifier() {
+	path := filepath.Join(k.dir, "keystore.json")
+	data := `{"version":1,"kdf":"pbkdf2-sha256","iterations":1,"salt":"c2FsdA==","entries":{}}`
+	assert.Nil(k.T(), ioutil.WriteFile(path, []byte(data), 0600))
+
+	_, err := Open(path, "passphrase")
+	assert.NotNil(k.T(), err)
+}
+
+func (k *keystoreTestSuite) TestPermissions() {
+	path := filepath.Join(k.dir, "secret")
+	assert.Nil(k.T(), ioutil.WriteFile(path, []byte("pass\n"), 0644))
+	assert.NotNil(k.T(), CheckPermissions(path))
+	_, err := Passphrase(path)
+	assert.NotNil(k.T(), err)
+
+	assert.Nil(k.T(), os.Chmod(path, 0600))
+	p, err := Passphrase(path)
+	assert.Nil(k.T(), err)
+	assert.Equal(k.T(), "pass", p)
+}
@@ -0,0 +1,1285 @@
+package mockexchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	glog "github.com/vjoke/falcon/pkg/log"
+)
+
+var mLog = glog.RegisterScope("mockexchange", "mockexchange", 0)
+
+const (
+	// AVG_PRICE_STEPS is the number of price steps of avgPrice
+	AVG_PRICE_STEPS = 5
+	// DEFAULT_RECV_WINDOW is the recvWindow of signed requests which do not
+	// set it, in milliseconds
+	DEFAULT_RECV_WINDOW = 5000
+	// MAX_TRADES is the number of trades kept per symbol
+	MAX_TRADES = 1000
+	// MAX_CLOSED_ORDERS is the number of filled, canceled and expired orders
+	// kept for queries
+	MAX_CLOSED_ORDERS = 1000
+	// limits of open orders per symbol
+	MAX_NUM_ORDERS      = 200
+	MAX_NUM_ALGO_ORDERS = 5
+	// limit prices must be within the multipliers of the average price
+	MULTIPLIER_UP   = 5.0
+	MULTIPLIER_DOWN = 0.2
+)
+
+// error codes of binance
+const (
+	CODE_UNKNOWN       = -1000
+	CODE_TIMESTAMP     = -1021
+	CODE_MANDATORY     = -1102
+	CODE_BAD_PARAM     = -1100
+	CODE_FILTER        = -1013
+	CODE_BAD_SYMBOL    = -1121
+	CODE_REJECTED      = -2010
+	CODE_UNKNOWN_ORDER = -2011
+	CODE_NOT_EXIST     = -2013
+	CODE_NO_API_KEY    = -2014
+	CODE_NOT_FOUND     = -1000
+)
+
+// Exchange is a binance compatible mock exchange serving the REST endpoints
+// and the user data stream used by pixiu with scripted prices, it fills
+// market orders immediately and resting orders when the price crosses them
+type Exchange struct {
+	mu       sync.Mutex
+	script   *Script
+	rand     *rand.Rand
+	markets  map[string]*market
+	symbols  []string
+	balances map[string]*balance
+	orders   map[int64]*order
+	// closed keeps the orders which are no longer open, oldest first in
+	// closedIDs
+	closed    map[int64]*order
+	closedIDs []int64
+	trades    map[string][]*binance.TradeV3
+	nextID    int64
+	failures  []*failureState
+	// listenKeys and streams of the user data stream
+	listenKeys map[string]bool
+	streams    map[*stream]struct{}
+	// weight and orders used in the current windows, reported by headers
+	weightWindow time.Time
+	weight       int
+	orderWindow  time.Time
+	orderCount   int
+}
+
+type market struct {
+	script *SymbolScript
+	step   int
+	price  float64
+	// history keeps the prices of the last steps for avgPrice
+	history []float64
+}
+
+type balance struct {
+	free   float64
+	locked float64
+}
+
+type order struct {
+	binance.Order
+	listID int64
+	// price and quantity of the order, stop is the stop price of stop
+	// orders
+	price    float64
+	stop     float64
+	quantity float64
+}
+
+type failureState struct {
+	*Failure
+	matched int
+	failed  int
+}
+
+// apiError is the error body of binance
+type apiError struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// New creates a mock exchange with a script
+func New(script *Script) *Exchange {
+	e := &Exchange{
+		script:   script,
+		rand:     rand.New(rand.NewSource(script.Seed)),
+		markets:  make(map[string]*market),
+		balances: make(map[string]*balance),
+		orders:   make(map[int64]*order),
+		closed:   make(map[int64]*order),
+		trades:   make(map[string][]*binance.TradeV3),
+		nextID:   1,
+
+		listenKeys: make(map[string]bool),
+		streams:    make(map[*stream]struct{}),
+	}
+	for _, s := range script.Symbols {
+		m := &market{script: s}
+		if len(s.Prices) > 0 {
+			m.price = s.Prices[0]
+		} else {
+			m.price = s.Start
+		}
+		m.history = []float64{m.price}
+		e.markets[s.Symbol] = m
+		e.symbols = append(e.symbols, s.Symbol)
+	}
+	sort.Strings(e.symbols)
+	for asset, free := range script.Balances {
+		e.balances[asset] = &balance{free: free}
+	}
+	for _, f := range script.Failures {
+		e.failures = append(e.failures, &failureState{Failure: f})
+	}
+	return e
+}
+
+// Run steps the prices by the interval of the script until stop is closed
+func (e *Exchange) Run(stopCh <-chan struct{}) {
+	if e.script.Interval.Duration <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(e.script.Interval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			e.Step()
+		}
+	}
+}
+
+// Step moves the prices of all the symbols one step along their paths and
+// fills the resting orders crossed by the new prices
+func (e *Exchange) Step() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, symbol := range e.symbols {
+		m := e.markets[symbol]
+		// prices of closed markets are frozen
+		if m.script.Status != DEFAULT_STATUS {
+			continue
+		}
+		m.step++
+		if n := len(m.script.Prices); n > 0 {
+			i := m.step
+			if m.script.Loop {
+				i %= n
+			} else if i >= n {
+				i = n - 1
+			}
+			m.price = m.script.Prices[i]
+		} else {
+			change := (e.rand.Float64()*2 - 1) * m.script.Volatility
+			m.price = math.Max(m.script.TickSize, m.price*(1+change))
+		}
+		m.price = round(m.price, m.script.TickSize)
+		m.history = append(m.history, m.price)
+		if len(m.history) > AVG_PRICE_STEPS {
+			m.history = m.history[1:]
+		}
+		e.match(symbol)
+	}
+}
+
+// SetPrice sets the price of a symbol and fills the crossed orders
+func (e *Exchange) SetPrice(symbol string, price float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	m, ok := e.markets[symbol]
+	if !ok {
+		return
+	}
+	m.price = round(price, m.script.TickSize)
+	m.history = append(m.history, m.price)
+	if len(m.history) > AVG_PRICE_STEPS {
+		m.history = m.history[1:]
+	}
+	e.match(symbol)
+}
+
+// SetStatus sets the status of a symbol, e.g. BREAK to close the market,
+// orders are rejected and prices are frozen until it is TRADING again
+func (e *Exchange) SetStatus(symbol, status string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if m, ok := e.markets[symbol]; ok {
+		m.script.Status = status
+	}
+}
+
+// Price returns the current price of a symbol
+func (e *Exchange) Price(symbol string) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if m, ok := e.markets[symbol]; ok {
+		return m.price
+	}
+	return 0
+}
+
+// Balance returns the free and locked balance of an asset
+func (e *Exchange) Balance(asset string) (float64, float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if b, ok := e.balances[asset]; ok {
+		return b.free, b.locked
+	}
+	return 0, 0
+}
+
+// ServeHTTP serves the REST api and the user data stream of binance
+func (e *Exchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := parseForm(r); err != nil {
+		writeError(w, http.StatusBadRequest, CODE_BAD_PARAM, err.Error())
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/ws/") {
+		e.serveStream(w, r)
+		return
+	}
+	var recorded *httptest.ResponseRecorder
+	if f := e.inject(r); f != nil {
+		if f.Late {
+			// the request is executed before the failure, e.g. an order
+			// whose response is lost
+			recorded = httptest.NewRecorder()
+			e.handle(recorded, r)
+		}
+		if f.Delay.Duration > 0 {
+			select {
+			case <-time.After(f.Delay.Duration):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if f.Status != 0 {
+			mLog.Infof("inject failure %v %v into %v %v", f.Status, f.Code, r.Method, r.URL.Path)
+			if f.RetryAfter.Duration > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter.Seconds())))
+			}
+			writeError(w, f.Status, f.Code, f.Msg)
+			return
+		}
+	}
+	if recorded != nil {
+		for k, v := range recorded.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(recorded.Code)
+		w.Write(recorded.Body.Bytes())
+		return
+	}
+
+	e.handle(w, r)
+}
+
+// handle executes a request of the api
+func (e *Exchange) handle(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.useWeight(w, r)
+	if isSigned(r.URL.Path, r.Method) {
+		if status, code, msg := e.checkSigned(r); code != 0 {
+			writeError(w, status, code, msg)
+			return
+		}
+	}
+
+	var (
+		result interface{}
+		err    *apiError
+	)
+	switch route := r.Method + " " + r.URL.Path; route {
+	case "GET /api/v3/ping":
+		result = struct{}{}
+	case "GET /api/v3/time":
+		result = map[string]int64{"serverTime": binance.FormatTimestamp(time.Now())}
+	case "GET /api/v3/exchangeInfo":
+		result = e.exchangeInfo()
+	case "GET /api/v3/ticker/price":
+		result, err = e.tickerPrice(r.Form.Get("symbol"))
+	case "GET /api/v3/ticker/bookTicker":
+		result, err = e.bookTicker(r.Form.Get("symbol"))
+	case "GET /api/v3/avgPrice":
+		result, err = e.avgPrice(r.Form.Get("symbol"))
+	case "GET /api/v3/depth":
+		result, err = e.depth(r.Form.Get("symbol"), r.Form.Get("limit"))
+	case "GET /api/v3/account":
+		result = e.account()
+	case "POST /api/v3/order":
+		result, err = e.createOrder(r)
+	case "POST /api/v3/order/oco":
+		result, err = e.createOCO(r)
+	case "GET /api/v3/order":
+		result, err = e.queryOrder(r.Form.Get("symbol"), r.Form.Get("orderId"), r.Form.Get("origClientOrderId"))
+	case "DELETE /api/v3/order":
+		result, err = e.cancelOrder(r.Form.Get("symbol"), r.Form.Get("orderId"))
+	case "GET /api/v3/openOrders":
+		result = e.openOrders(r.Form.Get("symbol"))
+	case "DELETE /api/v3/openOrders":
+		result, err = e.cancelOpenOrders(r.Form.Get("symbol"))
+	case "GET /api/v3/myTrades":
+		result, err = e.myTrades(r.Form.Get("symbol"), r.Form.Get("limit"))
+	case "POST /api/v3/userDataStream":
+		result, err = e.startStream(r)
+	case "PUT /api/v3/userDataStream":
+		result, err = e.keepaliveStream(r.Form.Get("listenKey"))
+	case "DELETE /api/v3/userDataStream":
+		result, err = e.closeStream(r.Form.Get("listenKey"))
+	default:
+		writeError(w, http.StatusNotFound, CODE_NOT_FOUND, "unknown endpoint "+route)
+		return
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Code, err.Msg)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// parseForm parses the query and the body, the body of DELETE requests is
+// ignored by ParseForm but go-binance sends the listen key in it
+func parseForm(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	if r.Method != http.MethodDelete || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range values {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	return nil
+}
+
+// inject returns the failure injected into a request if any
+func (e *Exchange) inject(r *http.Request) *Failure {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, f := range e.failures {
+		if (f.Method != "" && f.Method != r.Method) || (f.Path != "" && f.Path != r.URL.Path) {
+			continue
+		}
+		f.matched++
+		if f.matched <= f.After || (f.Count > 0 && f.failed >= f.Count) {
+			continue
+		}
+		if f.Rate > 0 && e.rand.Float64() >= f.Rate {
+			continue
+		}
+		f.failed++
+		return f.Failure
+	}
+	return nil
+}
+
+// useWeight counts the weight of a request and reports the usage headers
+func (e *Exchange) useWeight(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	if window := now.Truncate(time.Minute); !window.Equal(e.weightWindow) {
+		e.weightWindow, e.weight = window, 0
+	}
+	if window := now.Truncate(10 * time.Second); !window.Equal(e.orderWindow) {
+		e.orderWindow, e.orderCount = window, 0
+	}
+
+	e.weight += requestWeight(r)
+	if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/v3/order") {
+		e.orderCount++
+	}
+	w.Header().Set("X-MBX-USED-WEIGHT-1M", strconv.Itoa(e.weight))
+	w.Header().Set("X-MBX-ORDER-COUNT-10S", strconv.Itoa(e.orderCount))
+}
+
+// requestWeight returns the weight of the endpoints served by the mock
+func requestWeight(r *http.Request) int {
+	hasSymbol := r.Form.Get("symbol") != ""
+	switch r.URL.Path {
+	case "/api/v3/exchangeInfo", "/api/v3/account", "/api/v3/myTrades":
+		return 10
+	case "/api/v3/order":
+		if r.Method == http.MethodGet {
+			return 2
+		}
+	case "/api/v3/openOrders":
+		if r.Method == http.MethodGet && !hasSymbol {
+			return 40
+		} else if r.Method == http.MethodGet {
+			return 3
+		}
+	case "/api/v3/ticker/price", "/api/v3/ticker/bookTicker":
+		if !hasSymbol {
+			return 2
+		}
+	}
+	return 1
+}
+
+// isSigned checks if an endpoint requires signature
+func isSigned(path, method string) bool {
+	switch path {
+	case "/api/v3/account", "/api/v3/order", "/api/v3/order/oco", "/api/v3/openOrders", "/api/v3/myTrades":
+		return true
+	}
+	return false
+}
+
+// checkSigned checks the api key and the timestamp of a signed request,
+// signatures are not verified since the mock does not know the secrets
+func (e *Exchange) checkSigned(r *http.Request) (int, int, string) {
+	if r.Header.Get("X-MBX-APIKEY") == "" {
+		return http.StatusUnauthorized, CODE_NO_API_KEY, "API-key format invalid."
+	}
+	if r.Form.Get("signature") == "" {
+		return http.StatusBadRequest, CODE_MANDATORY, "Mandatory parameter 'signature' was not sent, was empty/null, or malformed."
+	}
+	timestamp, err := strconv.ParseInt(r.Form.Get("timestamp"), 10, 64)
+	if err != nil {
+		return http.StatusBadRequest, CODE_MANDATORY, "Mandatory parameter 'timestamp' was not sent, was empty/null, or malformed."
+	}
+	recvWindow := int64(DEFAULT_RECV_WINDOW)
+	if v, err := strconv.ParseInt(r.Form.Get("recvWindow"), 10, 64); err == nil {
+		recvWindow = v
+	}
+	now := binance.FormatTimestamp(time.Now())
+	if timestamp > now+1000 || now-timestamp > recvWindow {
+		return http.StatusBadRequest, CODE_TIMESTAMP, "Timestamp for this request is outside of the recvWindow."
+	}
+	return 0, 0, ""
+}
+
+func (e *Exchange) exchangeInfo() *binance.ExchangeInfo {
+	info := &binance.ExchangeInfo{
+		Timezone:   "UTC",
+		ServerTime: binance.FormatTimestamp(time.Now()),
+		RateLimits: []binance.RateLimit{
+			{RateLimitType: "REQUEST_WEIGHT", Interval: "MINUTE", Limit: 1200},
+			{RateLimitType: "ORDERS", Interval: "SECOND", Limit: 10},
+		},
+		ExchangeFilters: []interface{}{},
+	}
+	for _, symbol := range e.symbols {
+		s := e.markets[symbol].script
+		info.Symbols = append(info.Symbols, binance.Symbol{
+			Symbol:               s.Symbol,
+			Status:               s.Status,
+			BaseAsset:            s.BaseAsset,
+			BaseAssetPrecision:   8,
+			QuoteAsset:           s.QuoteAsset,
+			QuotePrecision:       8,
+			OrderTypes:           []string{"LIMIT", "LIMIT_MAKER", "MARKET", "STOP_LOSS_LIMIT", "TAKE_PROFIT_LIMIT"},
+			OcoAllowed:           true,
+			IsSpotTradingAllowed: true,
+			Filters: []map[string]interface{}{
+				{"filterType": "PRICE_FILTER", "minPrice": format(s.TickSize, s.TickSize), "maxPrice": "1000000.00000000", "tickSize": format(s.TickSize, s.TickSize)},
+				{"filterType": "LOT_SIZE", "minQty": format(s.StepSize, s.StepSize), "maxQty": "9000000.00000000", "stepSize": format(s.StepSize, s.StepSize)},
+				{"filterType": "MIN_NOTIONAL", "minNotional": format(s.MinNotional, 0.00000001), "applyToMarket": true, "avgPriceMins": AVG_PRICE_STEPS},
+				{"filterType": "PERCENT_PRICE", "multiplierUp": format(MULTIPLIER_UP, 1), "multiplierDown": format(MULTIPLIER_DOWN, 0.1), "avgPriceMins": AVG_PRICE_STEPS},
+				{"filterType": "MARKET_LOT_SIZE", "minQty": "0.00000000", "maxQty": "100000.00000000", "stepSize": "0.00000000"},
+				{"filterType": "MAX_NUM_ORDERS", "maxNumOrders": MAX_NUM_ORDERS},
+				{"filterType": "MAX_NUM_ALGO_ORDERS", "maxNumAlgoOrders": MAX_NUM_ALGO_ORDERS},
+			},
+		})
+	}
+	return info
+}
+
+func (e *Exchange) market(symbol string) (*market, *apiError) {
+	if symbol == "" {
+		return nil, &apiError{CODE_MANDATORY, "Mandatory parameter 'symbol' was not sent, was empty/null, or malformed."}
+	}
+	m, ok := e.markets[symbol]
+	if !ok {
+		return nil, &apiError{CODE_BAD_SYMBOL, "Invalid symbol."}
+	}
+	return m, nil
+}
+
+func (e *Exchange) tickerPrice(symbol string) (interface{}, *apiError) {
+	if symbol != "" {
+		m, err := e.market(symbol)
+		if err != nil {
+			return nil, err
+		}
+		return &binance.SymbolPrice{Symbol: symbol, Price: format(m.price, m.script.TickSize)}, nil
+	}
+
+	prices := make([]*binance.SymbolPrice, 0, len(e.symbols))
+	for _, symbol := range e.symbols {
+		m := e.markets[symbol]
+		prices = append(prices, &binance.SymbolPrice{Symbol: symbol, Price: format(m.price, m.script.TickSize)})
+	}
+	return prices, nil
+}
+
+// bookTicker returns the best bid and ask of the order book of a symbol or
+// of all the symbols
+func (e *Exchange) bookTicker(symbol string) (interface{}, *apiError) {
+	if symbol != "" {
+		m, err := e.market(symbol)
+		if err != nil {
+			return nil, err
+		}
+		return m.bookTicker(), nil
+	}
+
+	tickers := make([]*binance.BookTicker, 0, len(e.symbols))
+	for _, symbol := range e.symbols {
+		tickers = append(tickers, e.markets[symbol].bookTicker())
+	}
+	return tickers, nil
+}
+
+// bookTicker returns the first levels of the order book of depth
+func (m *market) bookTicker() *binance.BookTicker {
+	s := m.script
+	quantity := format(s.Liquidity, s.StepSize)
+	return &binance.BookTicker{
+		Symbol:      s.Symbol,
+		BidPrice:    format(math.Max(m.price-s.TickSize, 0), s.TickSize),
+		BidQuantity: quantity,
+		AskPrice:    format(m.price+s.TickSize, s.TickSize),
+		AskQuantity: quantity,
+	}
+}
+
+func (e *Exchange) avgPrice(symbol string) (interface{}, *apiError) {
+	m, err := e.market(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	return &binance.AvgPrice{Mins: AVG_PRICE_STEPS, Price: format(m.avgPrice(), 0.00000001)}, nil
+}
+
+// depth returns the order book of a symbol, the levels are synthesized
+// around the price while market orders still fill at the price
+func (e *Exchange) depth(symbol, limit string) (interface{}, *apiError) {
+	m, err := e.market(symbol)
+	if err != nil {
+		return nil, err
+	}
+	levels := m.script.Levels
+	if n, err := strconv.Atoi(limit); err == nil && n > 0 && n < levels {
+		levels = n
+	}
+
+	tick, quantity := m.script.TickSize, format(m.script.Liquidity, m.script.StepSize)
+	bids := make([][2]string, 0, levels)
+	asks := make([][2]string, 0, levels)
+	for i := 1; i <= levels; i++ {
+		if bid := m.price - float64(i)*tick; bid > 0 {
+			bids = append(bids, [2]string{format(bid, tick), quantity})
+		}
+		asks = append(asks, [2]string{format(m.price+float64(i)*tick, tick), quantity})
+	}
+	return map[string]interface{}{
+		"lastUpdateId": m.step,
+		"bids":         bids,
+		"asks":         asks,
+	}, nil
+}
+
+// avgPrice returns the average price of the last steps
+func (m *market) avgPrice() float64 {
+	sum := 0.0
+	for _, p := range m.history {
+		sum += p
+	}
+	return sum / float64(len(m.history))
+}
+
+func (e *Exchange) account() *binance.Account {
+	assets := make([]string, 0, len(e.balances))
+	for asset := range e.balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	account := &binance.Account{
+		MakerCommission: int64(e.script.Fee * 10000),
+		TakerCommission: int64(e.script.Fee * 10000),
+		CanTrade:        true,
+		Balances:        make([]binance.Balance, 0, len(assets)),
+	}
+	for _, asset := range assets {
+		b := e.balances[asset]
+		account.Balances = append(account.Balances, binance.Balance{
+			Asset:  asset,
+			Free:   format(b.free, 0.00000001),
+			Locked: format(b.locked, 0.00000001),
+		})
+	}
+	return account
+}
+
+func (e *Exchange) balance(asset string) *balance {
+	b, ok := e.balances[asset]
+	if !ok {
+		b = &balance{}
+		e.balances[asset] = b
+	}
+	return b
+}
+
+// createOrder places MARKET and LIMIT orders
+func (e *Exchange) createOrder(r *http.Request) (interface{}, *apiError) {
+	m, err := e.market(r.Form.Get("symbol"))
+	if err != nil {
+		return nil, err
+	}
+	s := m.script
+	if s.Status != DEFAULT_STATUS {
+		return nil, &apiError{CODE_REJECTED, "Market is closed."}
+	}
+	side := binance.SideType(r.Form.Get("side"))
+	if side != binance.SideTypeBuy && side != binance.SideTypeSell {
+		return nil, &apiError{CODE_BAD_PARAM, "Invalid side."}
+	}
+
+	switch binance.OrderType(r.Form.Get("type")) {
+	case binance.OrderTypeMarket:
+		quantity, err := e.marketQuantity(r, m)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.checkOrder(s, m.price, quantity); err != nil {
+			return nil, err
+		}
+		o := e.newOrder(s.Symbol, side, binance.OrderTypeMarket, m.price, 0, quantity, -1)
+		o.setClientOrderID(r.Form.Get("newClientOrderId"))
+		if err := e.lock(o); err != nil {
+			return nil, err
+		}
+		e.report(o, "NEW", 0, 0, 0, "")
+		fills := e.fill(o, m.price)
+		return e.orderResponse(o, fills), nil
+	case binance.OrderTypeLimit, binance.OrderTypeLimitMaker:
+		price, perr := strconv.ParseFloat(r.Form.Get("price"), 64)
+		quantity, qerr := strconv.ParseFloat(r.Form.Get("quantity"), 64)
+		if perr != nil || qerr != nil {
+			return nil, &apiError{CODE_MANDATORY, "Mandatory parameter 'price' or 'quantity' was not sent, was empty/null, or malformed."}
+		}
+		if err := e.checkPrice(m, price); err != nil {
+			return nil, err
+		}
+		if err := e.checkOrder(s, price, quantity); err != nil {
+			return nil, err
+		}
+		if err := e.checkNumOrders(s.Symbol, 1, 0); err != nil {
+			return nil, err
+		}
+		o := e.newOrder(s.Symbol, side, binance.OrderType(r.Form.Get("type")), price, 0, quantity, -1)
+		o.setClientOrderID(r.Form.Get("newClientOrderId"))
+		if err := e.lock(o); err != nil {
+			return nil, err
+		}
+		e.orders[o.OrderID] = o
+		e.report(o, "NEW", 0, 0, 0, "")
+		e.match(s.Symbol)
+		return e.orderResponse(o, nil), nil
+	default:
+		return nil, &apiError{CODE_BAD_PARAM, "Unsupported order type."}
+	}
+}
+
+// marketQuantity returns the base quantity of a market order given by
+// quantity or quoteOrderQty
+func (e *Exchange) marketQuantity(r *http.Request, m *market) (float64, *apiError) {
+	if v := r.Form.Get("quantity"); v != "" {
+		quantity, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, &apiError{CODE_BAD_PARAM, "Illegal characters found in parameter 'quantity'."}
+		}
+		return quantity, nil
+	}
+	if v := r.Form.Get("quoteOrderQty"); v != "" {
+		quote, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, &apiError{CODE_BAD_PARAM, "Illegal characters found in parameter 'quoteOrderQty'."}
+		}
+		return floor(quote/m.price, m.script.StepSize), nil
+	}
+	return 0, &apiError{CODE_MANDATORY, "Mandatory parameter 'quantity' was not sent, was empty/null, or malformed."}
+}
+
+// checkOrder checks the lot size and the min notional of an order
+func (e *Exchange) checkOrder(s *SymbolScript, price, quantity float64) *apiError {
+	if quantity < s.StepSize || !onStep(quantity, s.StepSize) {
+		return &apiError{CODE_FILTER, "Filter failure: LOT_SIZE"}
+	}
+	if price*quantity < s.MinNotional {
+		return &apiError{CODE_FILTER, "Filter failure: MIN_NOTIONAL"}
+	}
+	return nil
+}
+
+// checkPrice checks the tick size of a price and its range around the
+// average price
+func (e *Exchange) checkPrice(m *market, price float64) *apiError {
+	if price < m.script.TickSize || !onStep(price, m.script.TickSize) {
+		return &apiError{CODE_FILTER, "Filter failure: PRICE_FILTER"}
+	}
+	if avg := m.avgPrice(); price > avg*MULTIPLIER_UP || price < avg*MULTIPLIER_DOWN {
+		return &apiError{CODE_FILTER, "Filter failure: PERCENT_PRICE"}
+	}
+	return nil
+}
+
+// checkNumOrders checks the limits of open orders of a symbol
+func (e *Exchange) checkNumOrders(symbol string, orders, algoOrders int) *apiError {
+	for _, o := range e.orders {
+		if o.Symbol != symbol {
+			continue
+		}
+		orders++
+		if o.Type == binance.OrderTypeStopLossLimit {
+			algoOrders++
+		}
+	}
+	if orders > MAX_NUM_ORDERS {
+		return &apiError{CODE_FILTER, "Filter failure: MAX_NUM_ORDERS"}
+	}
+	if algoOrders > MAX_NUM_ALGO_ORDERS {
+		return &apiError{CODE_FILTER, "Filter failure: MAX_NUM_ALGO_ORDERS"}
+	}
+	return nil
+}
+
+func (e *Exchange) newOrder(symbol string, side binance.SideType, typ binance.OrderType, price, stop, quantity float64, listID int64) *order {
+	id := e.nextID
+	e.nextID++
+	now := binance.FormatTimestamp(time.Now())
+	tick := e.markets[symbol].script.TickSize
+	step := e.markets[symbol].script.StepSize
+	o := &order{
+		Order: binance.Order{
+			Symbol:                   symbol,
+			OrderID:                  id,
+			ClientOrderID:            fmt.Sprintf("mock%d", id),
+			Price:                    format(price, tick),
+			OrigQuantity:             format(quantity, step),
+			ExecutedQuantity:         format(0, step),
+			CummulativeQuoteQuantity: format(0, tick),
+			Status:                   binance.OrderStatusTypeNew,
+			TimeInForce:              binance.TimeInForceTypeGTC,
+			Type:                     typ,
+			Side:                     side,
+			StopPrice:                format(stop, tick),
+			IcebergQuantity:          format(0, step),
+			Time:                     now,
+			UpdateTime:               now,
+			IsWorking:                true,
+		},
+		listID:   listID,
+		price:    price,
+		stop:     stop,
+		quantity: quantity,
+	}
+	if typ == binance.OrderTypeMarket {
+		o.Price = format(0, tick)
+	}
+	return o
+}
+
+// setClientOrderID sets the client order id given by the request
+func (o *order) setClientOrderID(id string) {
+	if id != "" {
+		o.ClientOrderID = id
+	}
+}
+
+// lock locks the balance of an order, legs of an oco share the lock of
+// the first leg
+func (e *Exchange) lock(o *order) *apiError {
+	s := e.markets[o.Symbol].script
+	asset, amount := s.BaseAsset, o.quantity
+	if o.Side == binance.SideTypeBuy {
+		asset, amount = s.QuoteAsset, o.quantity*o.price
+	}
+
+	b := e.balance(asset)
+	if b.free < amount-1e-9 {
+		return &apiError{CODE_REJECTED, "Account has insufficient balance for requested action."}
+	}
+	b.free -= amount
+	b.locked += amount
+	e.position(asset)
+	return nil
+}
+
+// unlock releases the balance locked by an order
+func (e *Exchange) unlock(o *order) {
+	s := e.markets[o.Symbol].script
+	asset, amount := s.BaseAsset, o.quantity
+	if o.Side == binance.SideTypeBuy {
+		asset, amount = s.QuoteAsset, o.quantity*o.price
+	}
+
+	b := e.balance(asset)
+	b.locked -= amount
+	b.free += amount
+	e.position(asset)
+}
+
+// fill fills a locked order at a price, the commission is paid in the
+// received asset
+func (e *Exchange) fill(o *order, price float64) []*binance.Fill {
+	s := e.markets[o.Symbol].script
+	base, quote := e.balance(s.BaseAsset), e.balance(s.QuoteAsset)
+	amount := o.quantity * price
+	commission, commissionAsset := 0.0, ""
+	if o.Side == binance.SideTypeBuy {
+		quote.locked -= o.quantity * o.price
+		// a buy filled below its limit price returns the difference
+		quote.free += o.quantity*o.price - amount
+		commission, commissionAsset = o.quantity*e.script.Fee, s.BaseAsset
+		base.free += o.quantity - commission
+	} else {
+		base.locked -= o.quantity
+		commission, commissionAsset = amount*e.script.Fee, s.QuoteAsset
+		quote.free += amount - commission
+	}
+
+	o.Status = binance.OrderStatusTypeFilled
+	o.IsWorking = false
+	o.ExecutedQuantity = format(o.quantity, s.StepSize)
+	o.CummulativeQuoteQuantity = format(amount, 0.00000001)
+	o.UpdateTime = binance.FormatTimestamp(time.Now())
+	e.close(o)
+
+	trades := append(e.trades[o.Symbol], &binance.TradeV3{
+		ID:              int64(len(e.trades[o.Symbol]) + 1),
+		Symbol:          o.Symbol,
+		OrderID:         o.OrderID,
+		Price:           format(price, s.TickSize),
+		Quantity:        format(o.quantity, s.StepSize),
+		QuoteQuantity:   format(amount, 0.00000001),
+		Commission:      format(commission, 0.00000001),
+		CommissionAsset: commissionAsset,
+		Time:            o.UpdateTime,
+		IsBuyer:         o.Side == binance.SideTypeBuy,
+		IsMaker:         o.Type != binance.OrderTypeMarket,
+		IsBestMatch:     true,
+	})
+	if len(trades) > MAX_TRADES {
+		trades = trades[len(trades)-MAX_TRADES:]
+	}
+	e.trades[o.Symbol] = trades
+	e.report(o, "TRADE", o.quantity, price, commission, commissionAsset)
+	e.position(s.BaseAsset, s.QuoteAsset)
+	mLog.Infof("filled %v %v %v %v at %v", o.Side, o.Type, o.OrigQuantity, o.Symbol, price)
+
+	return []*binance.Fill{{
+		Price:           format(price, s.TickSize),
+		Quantity:        format(o.quantity, s.StepSize),
+		Commission:      format(commission, 0.00000001),
+		CommissionAsset: commissionAsset,
+	}}
+}
+
+// match fills the resting orders of a symbol crossed by its price, the
+// other leg of a filled oco is expired
+func (e *Exchange) match(symbol string) {
+	price := e.markets[symbol].price
+	for _, o := range e.sortedOrders(symbol) {
+		if _, ok := e.orders[o.OrderID]; !ok {
+			continue
+		}
+
+		var fillPrice float64
+		switch {
+		case o.Type == binance.OrderTypeStopLossLimit && price <= o.stop:
+			fillPrice = o.price
+		case o.Type == binance.OrderTypeStopLossLimit:
+			continue
+		case o.Side == binance.SideTypeSell && price >= o.price:
+			fillPrice = o.price
+		case o.Side == binance.SideTypeBuy && price <= o.price:
+			fillPrice = o.price
+		default:
+			continue
+		}
+
+		legs := []*order{o}
+		if o.listID >= 0 {
+			// the legs of an oco share one lock, the other leg is expired
+			for _, other := range e.sortedOrders(symbol) {
+				if other.listID == o.listID && other.OrderID != o.OrderID {
+					other.Status = binance.OrderStatusTypeExpired
+					other.IsWorking = false
+					e.close(other)
+					e.report(other, "EXPIRED", 0, 0, 0, "")
+					legs = append(legs, other)
+				}
+			}
+		}
+		e.fill(o, fillPrice)
+		if o.listID >= 0 {
+			e.listStatus(o.listID, symbol, "ALL_DONE", "ALL_DONE", legs)
+		}
+	}
+}
+
+// createOCO places a sell oco of a LIMIT_MAKER and a STOP_LOSS_LIMIT leg
+func (e *Exchange) createOCO(r *http.Request) (interface{}, *apiError) {
+	m, err := e.market(r.Form.Get("symbol"))
+	if err != nil {
+		return nil, err
+	}
+	s := m.script
+	if s.Status != DEFAULT_STATUS {
+		return nil, &apiError{CODE_REJECTED, "Market is closed."}
+	}
+	if binance.SideType(r.Form.Get("side")) != binance.SideTypeSell {
+		return nil, &apiError{CODE_BAD_PARAM, "Only sell oco is supported by the mock."}
+	}
+
+	var values [4]float64
+	for i, name := range []string{"quantity", "price", "stopPrice", "stopLimitPrice"} {
+		v, perr := strconv.ParseFloat(r.Form.Get(name), 64)
+		if perr != nil {
+			return nil, &apiError{CODE_MANDATORY, fmt.Sprintf("Mandatory parameter '%v' was not sent, was empty/null, or malformed.", name)}
+		}
+		values[i] = v
+	}
+	quantity, price, stopPrice, stopLimitPrice := values[0], values[1], values[2], values[3]
+	for _, p := range []float64{price, stopPrice, stopLimitPrice} {
+		if err := e.checkPrice(m, p); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.checkOrder(s, stopLimitPrice, quantity); err != nil {
+		return nil, err
+	}
+	if err := e.checkNumOrders(s.Symbol, 2, 1); err != nil {
+		return nil, err
+	}
+	if price <= m.price || stopPrice >= m.price {
+		return nil, &apiError{CODE_REJECTED, "The relationship of the prices for the orders is not correct."}
+	}
+
+	listID := e.nextID
+	stop := e.newOrder(s.Symbol, binance.SideTypeSell, binance.OrderTypeStopLossLimit, stopLimitPrice, stopPrice, quantity, listID)
+	limit := e.newOrder(s.Symbol, binance.SideTypeSell, binance.OrderTypeLimitMaker, price, 0, quantity, listID)
+	if err := e.lock(limit); err != nil {
+		return nil, err
+	}
+	e.orders[stop.OrderID] = stop
+	e.orders[limit.OrderID] = limit
+	e.report(stop, "NEW", 0, 0, 0, "")
+	e.report(limit, "NEW", 0, 0, 0, "")
+	e.listStatus(listID, s.Symbol, "EXEC_STARTED", "EXECUTING", []*order{stop, limit})
+
+	return e.listResponse(listID, s.Symbol, "EXEC_STARTED", "EXECUTING", []*order{stop, limit}), nil
+}
+
+// cancelOrder cancels an order, both legs of an oco are canceled
+func (e *Exchange) cancelOrder(symbol, orderID string) (interface{}, *apiError) {
+	if _, err := e.market(symbol); err != nil {
+		return nil, err
+	}
+	id, perr := strconv.ParseInt(orderID, 10, 64)
+	if perr != nil {
+		return nil, &apiError{CODE_MANDATORY, "Mandatory parameter 'orderId' was not sent, was empty/null, or malformed."}
+	}
+	o, ok := e.orders[id]
+	if !ok || o.Symbol != symbol {
+		return nil, &apiError{CODE_UNKNOWN_ORDER, "Unknown order sent."}
+	}
+
+	if o.listID >= 0 {
+		legs := e.cancelList(o.listID)
+		return e.orderResponse(legs[0], nil), nil
+	}
+	e.cancel(o)
+	return e.orderResponse(o, nil), nil
+}
+
+// cancel cancels an order and unlocks its balance
+func (e *Exchange) cancel(o *order) {
+	o.Status = binance.OrderStatusTypeCanceled
+	o.IsWorking = false
+	e.close(o)
+	e.report(o, "CANCELED", 0, 0, 0, "")
+	e.unlock(o)
+}
+
+// cancelList cancels the legs of an oco, which share one lock
+func (e *Exchange) cancelList(listID int64) []*order {
+	legs := make([]*order, 0, 2)
+	for _, o := range e.orders {
+		if o.listID == listID {
+			legs = append(legs, o)
+		}
+	}
+	sort.Slice(legs, func(i, j int) bool { return legs[i].OrderID < legs[j].OrderID })
+	for i, o := range legs {
+		o.Status = binance.OrderStatusTypeCanceled
+		o.IsWorking = false
+		e.close(o)
+		e.report(o, "CANCELED", 0, 0, 0, "")
+		if i == 0 {
+			e.unlock(o)
+		}
+	}
+	if len(legs) > 0 {
+		e.listStatus(listID, legs[0].Symbol, "ALL_DONE", "ALL_DONE", legs)
+	}
+	return legs
+}
+
+// close moves an order from the open orders to the closed orders, the
+// oldest closed orders are dropped beyond MAX_CLOSED_ORDERS
+func (e *Exchange) close(o *order) {
+	delete(e.orders, o.OrderID)
+	e.closed[o.OrderID] = o
+	e.closedIDs = append(e.closedIDs, o.OrderID)
+	if len(e.closedIDs) > MAX_CLOSED_ORDERS {
+		delete(e.closed, e.closedIDs[0])
+		e.closedIDs = e.closedIDs[1:]
+	}
+}
+
+// queryOrder returns an open or closed order
+func (e *Exchange) queryOrder(symbol, orderID, clientOrderID string) (interface{}, *apiError) {
+	if _, err := e.market(symbol); err != nil {
+		return nil, err
+	}
+	var o *order
+	if clientOrderID != "" {
+		o = e.findClientOrder(clientOrderID)
+	} else {
+		id, perr := strconv.ParseInt(orderID, 10, 64)
+		if perr != nil {
+			return nil, &apiError{CODE_MANDATORY, "Mandatory parameter 'orderId' was not sent, was empty/null, or malformed."}
+		}
+		if o = e.orders[id]; o == nil {
+			o = e.closed[id]
+		}
+	}
+	if o == nil || o.Symbol != symbol {
+		return nil, &apiError{CODE_NOT_EXIST, "Order does not exist."}
+	}
+	copied := o.Order
+	return &copied, nil
+}
+
+// findClientOrder finds an open or closed order by its client order id
+func (e *Exchange) findClientOrder(clientOrderID string) *order {
+	for _, orders := range []map[int64]*order{e.orders, e.closed} {
+		for _, o := range orders {
+			if o.ClientOrderID == clientOrderID {
+				return o
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Exchange) sortedOrders(symbol string) []*order {
+	result := make([]*order, 0, len(e.orders))
+	for _, o := range e.orders {
+		if symbol == "" || o.Symbol == symbol {
+			result = append(result, o)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].OrderID < result[j].OrderID })
+	return result
+}
+
+func (e *Exchange) openOrders(symbol string) []*binance.Order {
+	orders := make([]*binance.Order, 0)
+	for _, o := range e.sortedOrders(symbol) {
+		copied := o.Order
+		orders = append(orders, &copied)
+	}
+	return orders
+}
+
+// cancelOpenOrders cancels all the open orders of a symbol, the response
+// lists single orders and ocos like binance
+func (e *Exchange) cancelOpenOrders(symbol string) (interface{}, *apiError) {
+	if _, err := e.market(symbol); err != nil {
+		return nil, err
+	}
+	orders := e.sortedOrders(symbol)
+	if len(orders) == 0 {
+		return nil, &apiError{CODE_UNKNOWN_ORDER, "Unknown order sent."}
+	}
+
+	result := make([]interface{}, 0, len(orders))
+	for _, o := range orders {
+		if _, ok := e.orders[o.OrderID]; !ok {
+			continue
+		}
+		if o.listID >= 0 {
+			legs := e.cancelList(o.listID)
+			result = append(result, e.listResponse(o.listID, symbol, "ALL_DONE", "ALL_DONE", legs))
+			continue
+		}
+		e.cancel(o)
+		result = append(result, e.orderResponse(o, nil))
+	}
+	return result, nil
+}
+
+func (e *Exchange) myTrades(symbol, limit string) (interface{}, *apiError) {
+	if _, err := e.market(symbol); err != nil {
+		return nil, err
+	}
+	trades := e.trades[symbol]
+	if n, err := strconv.Atoi(limit); err == nil && n > 0 && n < len(trades) {
+		trades = trades[len(trades)-n:]
+	}
+	if trades == nil {
+		trades = []*binance.TradeV3{}
+	}
+	return trades, nil
+}
+
+// orderResponse is the response of order requests, it has the fields of
+// both binance.CreateOrderResponse and binance.CancelOrderResponse
+func (e *Exchange) orderResponse(o *order, fills []*binance.Fill) map[string]interface{} {
+	if fills == nil {
+		fills = []*binance.Fill{}
+	}
+	return map[string]interface{}{
+		"symbol":              o.Symbol,
+		"orderId":             o.OrderID,
+		"orderListId":         o.listID,
+		"clientOrderId":       o.ClientOrderID,
+		"origClientOrderId":   o.ClientOrderID,
+		"transactTime":        o.UpdateTime,
+		"price":               o.Price,
+		"origQty":             o.OrigQuantity,
+		"executedQty":         o.ExecutedQuantity,
+		"cummulativeQuoteQty": o.CummulativeQuoteQuantity,
+		"status":              o.Status,
+		"timeInForce":         o.TimeInForce,
+		"type":                o.Type,
+		"side":                o.Side,
+		"fills":               fills,
+	}
+}
+
+// listResponse is the response of oco requests
+func (e *Exchange) listResponse(listID int64, symbol, listStatus, orderStatus string, legs []*order) *binance.CreateOCOResponse {
+	res := &binance.CreateOCOResponse{
+		OrderListID:       listID,
+		ContingencyType:   "OCO",
+		ListStatusType:    listStatus,
+		ListOrderStatus:   orderStatus,
+		ListClientOrderID: fmt.Sprintf("mocklist%d", listID),
+		TransactionTime:   binance.FormatTimestamp(time.Now()),
+		Symbol:            symbol,
+	}
+	for _, o := range legs {
+		res.Orders = append(res.Orders, &binance.OCOOrder{Symbol: symbol, OrderID: o.OrderID, ClientOrderID: o.ClientOrderID})
+		res.OrderReports = append(res.OrderReports, &binance.OCOOrderReport{
+			Symbol:                   symbol,
+			OrderID:                  o.OrderID,
+			OrderListID:              listID,
+			ClientOrderID:            o.ClientOrderID,
+			TransactionTime:          o.UpdateTime,
+			Price:                    o.Price,
+			OrigQuantity:             o.OrigQuantity,
+			ExecutedQuantity:         o.ExecutedQuantity,
+			CummulativeQuoteQuantity: o.CummulativeQuoteQuantity,
+			Status:                   o.Status,
+			TimeInForce:              o.TimeInForce,
+			Type:                     o.Type,
+			Side:                     o.Side,
+			StopPrice:                o.StopPrice,
+			IcebergQuantity:          o.IcebergQuantity,
+		})
+	}
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		mLog.Errorf("failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status, code int, msg string) {
+	if code == 0 {
+		code = CODE_UNKNOWN
+	}
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	writeJSON(w, status, &apiError{Code: code, Msg: msg})
+}
+
+// round rounds a value to a multiple of step
+func round(v, step float64) float64 {
+	return math.Round(v/step) * step
+}
+
+// floor rounds a value down to a multiple of step
+func floor(v, step float64) float64 {
+	return math.Floor(v/step+1e-9) * step
+}
+
+// onStep checks if a value is a multiple of step
+func onStep(v, step float64) bool {
+	return math.Abs(v-round(v, step)) < step*1e-6
+}
+
+// format formats a value with the precision of step
+func format(v, step float64) string {
+	precision := 0
+	for step < 1 && precision < 8 {
+		step *= 10
+		precision++
+	}
+	if precision < 8 {
+		precision = 8
+	}
+	return strconv.FormatFloat(v, 'f', precision, 64)
+}
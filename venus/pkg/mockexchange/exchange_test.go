@@ -0,0 +1,335 @@
+package mockexchange
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type exchangeTestSuite struct {
+	suite.Suite
+	exchange *Exchange
+	server   *httptest.Server
+	client   *binance.Client
+}
+
+func TestExchange(t *testing.T) {
+	suite.Run(t, new(exchangeTestSuite))
+}
+
+func (e *exchangeTestSuite) SetupTest() {
+	script := &Script{
+		Seed:     1,
+		Balances: map[string]float64{"USDT": 100},
+		Symbols: []*SymbolScript{
+			{Symbol: "ADAUSDT", Prices: []float64{1.0, 1.1, 1.2, 0.9}, TickSize: 0.001, StepSize: 0.1},
+			{Symbol: "DOTUSDT", Start: 20, TickSize: 0.01, StepSize: 0.01},
+		},
+		Failures: []*Failure{
+			{Method: http.MethodGet, Path: "/api/v3/avgPrice", Status: http.StatusTooManyRequests, Code: -1003, After: 1, Count: 1},
+		},
+	}
+	e.Require().NoError(script.applyDefaults())
+
+	e.exchange = New(script)
+	e.server = httptest.NewServer(e.exchange)
+	e.client = binance.NewClient("key", "secret")
+	e.client.BaseURL = e.server.URL
+}
+
+func (e *exchangeTestSuite) TearDownTest() {
+	e.server.Close()
+}
+
+func (e *exchangeTestSuite) price(symbol string) float64 {
+	prices, err := e.client.NewListPricesService().Symbol(symbol).Do(context.Background())
+	e.Require().NoError(err)
+	e.Require().Len(prices, 1)
+	p, _ := strconv.ParseFloat(prices[0].Price, 64)
+	return p
+}
+
+func (e *exchangeTestSuite) TestExchangeInfo() {
+	info, err := e.client.NewExchangeInfoService().Do(context.Background())
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), info.Symbols, 2)
+
+	ada := info.Symbols[0]
+	assert.Equal(e.T(), "ADAUSDT", ada.Symbol)
+	assert.Equal(e.T(), "ADA", ada.BaseAsset)
+	assert.Equal(e.T(), "TRADING", ada.Status)
+	assert.Equal(e.T(), "0.00100000", ada.PriceFilter().TickSize)
+	assert.Equal(e.T(), "0.10000000", ada.LotSizeFilter().StepSize)
+	assert.Equal(e.T(), "10.00000000", ada.MinNotionalFilter().MinNotional)
+}
+
+func (e *exchangeTestSuite) TestPricePath() {
+	assert.Equal(e.T(), 1.0, e.price("ADAUSDT"))
+	for _, want := range []float64{1.1, 1.2, 0.9, 0.9} {
+		e.exchange.Step()
+		assert.InDelta(e.T(), want, e.price("ADAUSDT"), 1e-9)
+	}
+	assert.NotEqual(e.T(), 20.0, e.price("DOTUSDT"))
+
+	prices, err := e.client.NewListPricesService().Do(context.Background())
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), prices, 2)
+
+	avg, err := e.client.NewAveragePriceService().Symbol("ADAUSDT").Do(context.Background())
+	assert.NoError(e.T(), err)
+	assert.Equal(e.T(), "1.02000000", avg.Price)
+}
+
+func (e *exchangeTestSuite) TestDepth() {
+	depth, err := e.client.NewDepthService().Symbol("ADAUSDT").Limit(5).Do(context.Background())
+	assert.NoError(e.T(), err)
+	if assert.Len(e.T(), depth.Bids, 5) && assert.Len(e.T(), depth.Asks, 5) {
+		assert.Equal(e.T(), "0.99900000", depth.Bids[0].Price)
+		assert.Equal(e.T(), "0.99500000", depth.Bids[4].Price)
+		assert.Equal(e.T(), "1.00100000", depth.Asks[0].Price)
+		assert.Equal(e.T(), "1000.00000000", depth.Asks[0].Quantity)
+	}
+
+	depth, err = e.client.NewDepthService().Symbol("ADAUSDT").Limit(100).Do(context.Background())
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), depth.Asks, DEFAULT_LEVELS)
+
+	_, err = e.client.NewDepthService().Symbol("BTCUSDT").Do(context.Background())
+	assert.Error(e.T(), err)
+}
+
+func (e *exchangeTestSuite) TestBookTicker() {
+	tickers, err := e.client.NewListBookTickersService().Symbol("ADAUSDT").Do(context.Background())
+	assert.NoError(e.T(), err)
+	if assert.Len(e.T(), tickers, 1) {
+		assert.Equal(e.T(), "0.99900000", tickers[0].BidPrice)
+		assert.Equal(e.T(), "1.00100000", tickers[0].AskPrice)
+		assert.Equal(e.T(), "1000.00000000", tickers[0].AskQuantity)
+	}
+
+	tickers, err = e.client.NewListBookTickersService().Do(context.Background())
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), tickers, 2)
+}
+
+func (e *exchangeTestSuite) TestMarketOrder() {
+	ctx := context.Background()
+	res, err := e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).QuoteOrderQty("20").Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Equal(e.T(), binance.OrderStatusTypeFilled, res.Status)
+	assert.Equal(e.T(), "20.00000000", res.ExecutedQuantity)
+	assert.Len(e.T(), res.Fills, 1)
+	assert.Equal(e.T(), "ADA", res.Fills[0].CommissionAsset)
+
+	usdt, _ := e.exchange.Balance("USDT")
+	ada, _ := e.exchange.Balance("ADA")
+	assert.InDelta(e.T(), 80, usdt, 1e-9)
+	assert.InDelta(e.T(), 19.98, ada, 1e-9)
+
+	account, err := e.client.NewGetAccountService().Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), account.Balances, 2)
+
+	trades, err := e.client.NewListTradesService().Symbol("ADAUSDT").Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), trades, 1)
+	assert.True(e.T(), trades[0].IsBuyer)
+
+	// rejected by balance and filters
+	_, err = e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).QuoteOrderQty("200").Do(ctx)
+	assert.Equal(e.T(), int64(CODE_REJECTED), apiCode(err))
+	_, err = e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeSell).
+		Type(binance.OrderTypeMarket).Quantity("5").Do(ctx)
+	assert.Equal(e.T(), int64(CODE_FILTER), apiCode(err))
+	_, err = e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeSell).
+		Type(binance.OrderTypeMarket).Quantity("12.05").Do(ctx)
+	assert.Equal(e.T(), int64(CODE_FILTER), apiCode(err))
+}
+
+func (e *exchangeTestSuite) TestOCO() {
+	ctx := context.Background()
+	_, err := e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).Quantity("20").Do(ctx)
+	e.Require().NoError(err)
+
+	oco, err := e.client.NewCreateOCOService().Symbol("ADAUSDT").Side(binance.SideTypeSell).
+		Quantity("19.9").Price("1.15").StopPrice("0.95").StopLimitPrice("0.95").
+		StopLimitTimeInForce(binance.TimeInForceTypeGTC).Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), oco.Orders, 2)
+	_, locked := e.exchange.Balance("ADA")
+	assert.InDelta(e.T(), 19.9, locked, 1e-9)
+
+	orders, err := e.client.NewListOpenOrdersService().Symbol("ADAUSDT").Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), orders, 2)
+
+	// the limit leg is filled at 1.1 -> 1.2, the stop leg is expired
+	e.exchange.Step()
+	e.exchange.Step()
+	orders, err = e.client.NewListOpenOrdersService().Symbol("ADAUSDT").Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), orders, 0)
+	usdt, _ := e.exchange.Balance("USDT")
+	assert.InDelta(e.T(), 80+19.9*1.15*(1-DEFAULT_FEE), usdt, 1e-9)
+	ada, locked := e.exchange.Balance("ADA")
+	assert.InDelta(e.T(), 0.08, ada, 1e-9)
+	assert.Equal(e.T(), 0.0, locked)
+
+	_, err = e.client.NewCancelOpenOrdersService().Symbol("ADAUSDT").Do(ctx)
+	assert.Equal(e.T(), int64(CODE_UNKNOWN_ORDER), apiCode(err))
+}
+
+func (e *exchangeTestSuite) TestCancelOpenOrders() {
+	ctx := context.Background()
+	_, err := e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).Quantity("20").Do(ctx)
+	e.Require().NoError(err)
+	_, err = e.client.NewCreateOCOService().Symbol("ADAUSDT").Side(binance.SideTypeSell).
+		Quantity("19.9").Price("1.5").StopPrice("0.6").StopLimitPrice("0.6").
+		StopLimitTimeInForce(binance.TimeInForceTypeGTC).Do(ctx)
+	e.Require().NoError(err)
+	_, err = e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeLimit).TimeInForce(binance.TimeInForceTypeGTC).
+		Quantity("20").Price("0.8").Do(ctx)
+	e.Require().NoError(err)
+
+	res, err := e.client.NewCancelOpenOrdersService().Symbol("ADAUSDT").Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Len(e.T(), res.Orders, 1)
+	assert.Len(e.T(), res.OCOOrders, 1)
+	assert.Len(e.T(), res.OCOOrders[0].OrderReports, 2)
+
+	usdt, usdtLocked := e.exchange.Balance("USDT")
+	ada, adaLocked := e.exchange.Balance("ADA")
+	assert.InDelta(e.T(), 80, usdt, 1e-9)
+	assert.InDelta(e.T(), 19.98, ada, 1e-9)
+	assert.Equal(e.T(), 0.0, usdtLocked+adaLocked)
+}
+
+func (e *exchangeTestSuite) TestQueryOrder() {
+	ctx := context.Background()
+	res, err := e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeLimit).TimeInForce(binance.TimeInForceTypeGTC).
+		Quantity("20").Price("0.95").Do(ctx)
+	e.Require().NoError(err)
+
+	o, err := e.client.NewGetOrderService().Symbol("ADAUSDT").OrderID(res.OrderID).Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Equal(e.T(), binance.OrderStatusTypeNew, o.Status)
+
+	// the buy is filled at 1.1 -> 1.2 -> 0.9 and kept after it is closed
+	e.exchange.Step()
+	e.exchange.Step()
+	e.exchange.Step()
+	o, err = e.client.NewGetOrderService().Symbol("ADAUSDT").OrderID(res.OrderID).Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Equal(e.T(), binance.OrderStatusTypeFilled, o.Status)
+	assert.Equal(e.T(), "20.00000000", o.ExecutedQuantity)
+
+	_, err = e.client.NewGetOrderService().Symbol("DOTUSDT").OrderID(res.OrderID).Do(ctx)
+	assert.Equal(e.T(), int64(CODE_NOT_EXIST), apiCode(err))
+
+	// orders are also found by the client order id
+	res, err = e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).QuoteOrderQty("20").NewClientOrderID("buy-1").Do(ctx)
+	e.Require().NoError(err)
+	o, err = e.client.NewGetOrderService().Symbol("ADAUSDT").OrigClientOrderID("buy-1").Do(ctx)
+	assert.NoError(e.T(), err)
+	assert.Equal(e.T(), res.OrderID, o.OrderID)
+	assert.Equal(e.T(), binance.OrderStatusTypeFilled, o.Status)
+	_, err = e.client.NewGetOrderService().Symbol("ADAUSDT").OrigClientOrderID("buy-2").Do(ctx)
+	assert.Equal(e.T(), int64(CODE_NOT_EXIST), apiCode(err))
+}
+
+func (e *exchangeTestSuite) TestFailureInjection() {
+	ctx := context.Background()
+	_, err := e.client.NewAveragePriceService().Symbol("ADAUSDT").Do(ctx)
+	assert.NoError(e.T(), err)
+
+	req, _ := http.NewRequest(http.MethodGet, e.server.URL+"/api/v3/avgPrice?symbol=ADAUSDT", nil)
+	res, err := http.DefaultClient.Do(req)
+	e.Require().NoError(err)
+	res.Body.Close()
+	assert.Equal(e.T(), http.StatusTooManyRequests, res.StatusCode)
+
+	_, err = e.client.NewAveragePriceService().Symbol("ADAUSDT").Do(ctx)
+	assert.NoError(e.T(), err)
+}
+
+func (e *exchangeTestSuite) TestSignedRequests() {
+	ctx := context.Background()
+	res, err := http.Get(e.server.URL + "/api/v3/account")
+	e.Require().NoError(err)
+	res.Body.Close()
+	assert.Equal(e.T(), http.StatusUnauthorized, res.StatusCode)
+	assert.NotEmpty(e.T(), res.Header.Get("X-MBX-USED-WEIGHT-1M"))
+
+	e.client.TimeOffset = 10000
+	_, err = e.client.NewGetAccountService().Do(ctx)
+	assert.Equal(e.T(), int64(CODE_TIMESTAMP), apiCode(err))
+
+	_, err = e.client.NewGetAccountService().Do(ctx, binance.WithRecvWindow(20000))
+	assert.NoError(e.T(), err)
+}
+
+func (e *exchangeTestSuite) TestUserStream() {
+	ctx := context.Background()
+	listenKey, err := e.client.NewStartUserStreamService().Do(ctx)
+	e.Require().NoError(err)
+	assert.NoError(e.T(), e.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx))
+	assert.Equal(e.T(), int64(CODE_LISTEN_KEY), apiCode(e.client.NewKeepaliveUserStreamService().ListenKey("unknown").Do(ctx)))
+
+	endpoint := "ws" + strings.TrimPrefix(e.server.URL, "http") + "/ws/" + listenKey
+	conn, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	e.Require().NoError(err)
+	defer conn.Close()
+
+	_, err = e.client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).QuoteOrderQty("20").Do(ctx)
+	e.Require().NoError(err)
+
+	events := make([]map[string]interface{}, 0)
+	e.Require().NoError(conn.SetReadDeadline(time.Now().Add(5 * time.Second)))
+	for len(events) < 4 {
+		_, message, err := conn.ReadMessage()
+		e.Require().NoError(err)
+		event := make(map[string]interface{})
+		e.Require().NoError(json.Unmarshal(message, &event))
+		events = append(events, event)
+	}
+	// lock, new, trade and the balances after the trade
+	assert.Equal(e.T(), "outboundAccountPosition", events[0]["e"])
+	assert.Equal(e.T(), "NEW", events[1]["x"])
+	assert.Equal(e.T(), "TRADE", events[2]["x"])
+	assert.Equal(e.T(), "FILLED", events[2]["X"])
+	assert.Equal(e.T(), "20.00000000", events[2]["l"])
+	assert.Equal(e.T(), "ADA", events[2]["N"])
+	balances := events[3]["B"].([]interface{})
+	assert.Equal(e.T(), map[string]interface{}{"a": "ADA", "f": "19.98000000", "l": "0.00000000"}, balances[0])
+
+	// closing the listen key disconnects the stream
+	assert.NoError(e.T(), e.client.NewCloseUserStreamService().ListenKey(listenKey).Do(ctx))
+	_, _, err = conn.ReadMessage()
+	assert.Error(e.T(), err)
+}
+
+func apiCode(err error) int64 {
+	if apiErr, ok := err.(*common.APIError); ok {
+		return apiErr.Code
+	}
+	return 0
+}
@@ -0,0 +1,177 @@
+package mockexchange
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+const (
+	DEFAULT_FEE          = 0.001
+	DEFAULT_TICK_SIZE    = 0.0001
+	DEFAULT_STEP_SIZE    = 0.1
+	DEFAULT_MIN_NOTIONAL = 10.0
+	DEFAULT_VOLATILITY   = 0.005
+	DEFAULT_STATUS       = "TRADING"
+	DEFAULT_LEVELS       = 20
+	DEFAULT_LIQUIDITY    = 1000.0
+	// DEFAULT_INTERVAL is the interval of price steps of the default script
+	DEFAULT_INTERVAL = 5 * time.Second
+)
+
+// Script defines the markets, balances and injected failures of the mock
+// exchange
+type Script struct {
+	// Interval is the interval of price steps, zero steps only by Step
+	Interval model.Duration `toml:"interval"`
+	// Fee is the commission rate of fills
+	Fee float64 `toml:"fee"`
+	// Seed seeds the random walks and the failure rates
+	Seed     int64              `toml:"seed"`
+	Balances map[string]float64 `toml:"balances"`
+	Symbols  []*SymbolScript    `toml:"symbols"`
+	Failures []*Failure         `toml:"failures"`
+}
+
+// SymbolScript defines a market and its price path
+type SymbolScript struct {
+	Symbol      string  `toml:"symbol"`
+	BaseAsset   string  `toml:"base_asset"`
+	QuoteAsset  string  `toml:"quote_asset"`
+	Status      string  `toml:"status"`
+	TickSize    float64 `toml:"tick_size"`
+	StepSize    float64 `toml:"step_size"`
+	MinNotional float64 `toml:"min_notional"`
+	// Prices is the price path, the last price is kept after the path ends
+	// unless Loop is set
+	Prices []float64 `toml:"prices"`
+	Loop   bool      `toml:"loop"`
+	// Start and Volatility define a random walk if Prices is empty, the
+	// price moves by at most Volatility of itself each step
+	Start      float64 `toml:"start"`
+	Volatility float64 `toml:"volatility"`
+	// Levels and Liquidity define the order book, the levels of each side
+	// are one tick apart around the price with Liquidity of base each
+	Levels    int     `toml:"levels"`
+	Liquidity float64 `toml:"liquidity"`
+}
+
+// Failure defines a failure injected into matching requests
+type Failure struct {
+	Method string `toml:"method"`
+	// Path matches the path of requests exactly, empty matches all
+	Path string `toml:"path"`
+	// Status is the http status, 0 responds normally after Delay
+	Status int    `toml:"status"`
+	Code   int    `toml:"code"`
+	Msg    string `toml:"msg"`
+	// RetryAfter is set as the Retry-After header of 429 and 418
+	RetryAfter model.Duration `toml:"retry_after"`
+	// Delay delays the response, e.g. to trigger timeouts
+	Delay model.Duration `toml:"delay"`
+	// Late executes the request before the delay and the failure, e.g. an
+	// order executed whose response times out
+	Late bool `toml:"late"`
+	// Rate is the probability to fail a matching request, zero always fails
+	Rate float64 `toml:"rate"`
+	// After skips the first matching requests
+	After int `toml:"after"`
+	// Count is the number of failures, zero is unlimited
+	Count int `toml:"count"`
+}
+
+// LoadScript loads a script from a toml file
+func LoadScript(path string) (*Script, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	var s Script
+	if _, err := toml.DecodeFile(path, &s); err != nil {
+		return nil, err
+	}
+	if err := s.applyDefaults(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DefaultScript creates a script of random walks for the symbols with
+// 1000 USDT
+func DefaultScript(symbols ...string) *Script {
+	s := &Script{
+		Interval: model.Duration{Duration: DEFAULT_INTERVAL},
+		Balances: map[string]float64{"USDT": 1000},
+	}
+	for _, symbol := range symbols {
+		s.Symbols = append(s.Symbols, &SymbolScript{Symbol: symbol, Start: 1})
+	}
+	if err := s.applyDefaults(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// applyDefaults fills the defaults and checks the script
+func (s *Script) applyDefaults() error {
+	if s.Fee == 0 {
+		s.Fee = DEFAULT_FEE
+	}
+	if s.Seed == 0 {
+		s.Seed = time.Now().UnixNano()
+	}
+	if s.Balances == nil {
+		s.Balances = make(map[string]float64)
+	}
+
+	seen := make(map[string]bool)
+	for i, m := range s.Symbols {
+		if m.Symbol == "" {
+			return fmt.Errorf("symbols[%d].symbol is empty", i)
+		}
+		if seen[m.Symbol] {
+			return fmt.Errorf("duplicate symbol %v", m.Symbol)
+		}
+		seen[m.Symbol] = true
+
+		if m.QuoteAsset == "" {
+			m.QuoteAsset = "USDT"
+		}
+		if m.BaseAsset == "" {
+			if len(m.Symbol) <= len(m.QuoteAsset) {
+				return fmt.Errorf("base_asset of %v is required", m.Symbol)
+			}
+			m.BaseAsset = m.Symbol[:len(m.Symbol)-len(m.QuoteAsset)]
+		}
+		if m.Status == "" {
+			m.Status = DEFAULT_STATUS
+		}
+		if m.TickSize == 0 {
+			m.TickSize = DEFAULT_TICK_SIZE
+		}
+		if m.StepSize == 0 {
+			m.StepSize = DEFAULT_STEP_SIZE
+		}
+		if m.MinNotional == 0 {
+			m.MinNotional = DEFAULT_MIN_NOTIONAL
+		}
+		if m.Levels == 0 {
+			m.Levels = DEFAULT_LEVELS
+		}
+		if m.Liquidity == 0 {
+			m.Liquidity = DEFAULT_LIQUIDITY
+		}
+		if len(m.Prices) == 0 {
+			if m.Start <= 0 {
+				return fmt.Errorf("prices or start of %v is required", m.Symbol)
+			}
+			if m.Volatility == 0 {
+				m.Volatility = DEFAULT_VOLATILITY
+			}
+		}
+	}
+	return nil
+}
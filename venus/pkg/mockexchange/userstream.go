@@ -0,0 +1,244 @@
+package mockexchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// STREAM_BUFFER is the number of events buffered for a connection, a
+	// connection which falls behind is closed
+	STREAM_BUFFER = 256
+	// CODE_LISTEN_KEY is the error of an unknown listen key
+	CODE_LISTEN_KEY = -1125
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// stream is a connection of the user data stream
+type stream struct {
+	listenKey string
+	ch        chan []byte
+}
+
+// startStream creates a listen key, binance returns the same key while it
+// is valid
+func (e *Exchange) startStream(r *http.Request) (interface{}, *apiError) {
+	apiKey := r.Header.Get("X-MBX-APIKEY")
+	if apiKey == "" {
+		return nil, &apiError{CODE_NO_API_KEY, "API-key format invalid."}
+	}
+	key := fmt.Sprintf("mock%x", apiKey)
+	e.listenKeys[key] = true
+	return map[string]string{"listenKey": key}, nil
+}
+
+// keepaliveStream extends a listen key, the keys of the mock do not expire
+func (e *Exchange) keepaliveStream(listenKey string) (interface{}, *apiError) {
+	if !e.listenKeys[listenKey] {
+		return nil, &apiError{CODE_LISTEN_KEY, "This listenKey does not exist."}
+	}
+	return struct{}{}, nil
+}
+
+// closeStream closes a listen key with its connections
+func (e *Exchange) closeStream(listenKey string) (interface{}, *apiError) {
+	if !e.listenKeys[listenKey] {
+		return nil, &apiError{CODE_LISTEN_KEY, "This listenKey does not exist."}
+	}
+	delete(e.listenKeys, listenKey)
+	for s := range e.streams {
+		if s.listenKey == listenKey {
+			e.unregister(s)
+		}
+	}
+	return struct{}{}, nil
+}
+
+// CloseStreams closes all the connections of the user data stream, the
+// listen keys are kept so clients are able to reconnect
+func (e *Exchange) CloseStreams() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for s := range e.streams {
+		e.unregister(s)
+	}
+}
+
+// serveStream serves the user data stream of a listen key on /ws/<key>
+func (e *Exchange) serveStream(w http.ResponseWriter, r *http.Request) {
+	s := &stream{
+		listenKey: strings.TrimPrefix(r.URL.Path, "/ws/"),
+		ch:        make(chan []byte, STREAM_BUFFER),
+	}
+	e.mu.Lock()
+	ok := e.listenKeys[s.listenKey]
+	e.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, CODE_LISTEN_KEY, "This listenKey does not exist.")
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		mLog.Errorf("failed to upgrade user data stream: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	e.mu.Lock()
+	e.streams[s] = struct{}{}
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.unregister(s)
+	}()
+
+	// messages from clients are discarded, reading detects the close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case message, ok := <-s.ch:
+			if !ok {
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// unregister removes a connection, its channel is closed so it is
+// disconnected
+func (e *Exchange) unregister(s *stream) {
+	if _, ok := e.streams[s]; ok {
+		delete(e.streams, s)
+		close(s.ch)
+	}
+}
+
+// emit sends an event to all the connections
+func (e *Exchange) emit(event map[string]interface{}) {
+	if len(e.streams) == 0 {
+		return
+	}
+	event["E"] = binance.FormatTimestamp(time.Now())
+	message, err := json.Marshal(event)
+	if err != nil {
+		mLog.Errorf("failed to marshal event: %v", err)
+		return
+	}
+	for s := range e.streams {
+		select {
+		case s.ch <- message:
+		default:
+			mLog.Warnf("user data stream %v falls behind, closed", s.listenKey)
+			e.unregister(s)
+		}
+	}
+}
+
+// report emits the executionReport of an order, last is the quantity of a
+// trade
+func (e *Exchange) report(o *order, execution string, last, price, commission float64, commissionAsset string) {
+	s := e.markets[o.Symbol].script
+	event := map[string]interface{}{
+		"e": "executionReport",
+		"s": o.Symbol,
+		"c": o.ClientOrderID,
+		"S": o.Side,
+		"o": o.Type,
+		"f": o.TimeInForce,
+		"q": o.OrigQuantity,
+		"p": o.Price,
+		"P": o.StopPrice,
+		"F": o.IcebergQuantity,
+		"g": o.listID,
+		"C": "",
+		"x": execution,
+		"X": o.Status,
+		"r": "NONE",
+		"i": o.OrderID,
+		"l": format(last, s.StepSize),
+		"z": o.ExecutedQuantity,
+		"L": format(price, s.TickSize),
+		"n": format(commission, 0.00000001),
+		"N": nil,
+		"T": o.UpdateTime,
+		"t": -1,
+		"I": 0,
+		"w": o.IsWorking,
+		"m": false,
+		"M": false,
+		"O": o.Time,
+		"Z": o.CummulativeQuoteQuantity,
+		"Y": format(last*price, 0.00000001),
+		"Q": format(0, 0.00000001),
+	}
+	if execution == "TRADE" {
+		event["N"] = commissionAsset
+		event["t"] = len(e.trades[o.Symbol])
+		event["m"] = o.Type != binance.OrderTypeMarket
+	}
+	e.emit(event)
+}
+
+// listStatus emits the listStatus of an oco
+func (e *Exchange) listStatus(listID int64, symbol, listStatus, orderStatus string, legs []*order) {
+	orders := make([]map[string]interface{}, 0, len(legs))
+	for _, o := range legs {
+		orders = append(orders, map[string]interface{}{"s": symbol, "i": o.OrderID, "c": o.ClientOrderID})
+	}
+	e.emit(map[string]interface{}{
+		"e": "listStatus",
+		"s": symbol,
+		"g": listID,
+		"c": "OCO",
+		"l": listStatus,
+		"L": orderStatus,
+		"r": "NONE",
+		"C": fmt.Sprintf("mocklist%d", listID),
+		"T": binance.FormatTimestamp(time.Now()),
+		"O": orders,
+	})
+}
+
+// position emits the outboundAccountPosition of assets
+func (e *Exchange) position(assets ...string) {
+	balances := make([]map[string]string, 0, len(assets))
+	for _, asset := range assets {
+		b := e.balance(asset)
+		balances = append(balances, map[string]string{
+			"a": asset,
+			"f": format(b.free, 0.00000001),
+			"l": format(b.locked, 0.00000001),
+		})
+	}
+	e.emit(map[string]interface{}{
+		"e": "outboundAccountPosition",
+		"u": binance.FormatTimestamp(time.Now()),
+		"B": balances,
+	})
+}
@@ -0,0 +1,69 @@
+package grid
+
+import (
+	"time"
+
+	"github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+const (
+	// OUT_OF_RANGE_HOLD keeps the orders when the price leaves the range
+	OUT_OF_RANGE_HOLD = "hold"
+	// OUT_OF_RANGE_CANCEL cancels the orders until the price is back
+	OUT_OF_RANGE_CANCEL = "cancel"
+	// OUT_OF_RANGE_SHIFT moves the range by whole grids around the price
+	OUT_OF_RANGE_SHIFT = "shift"
+)
+
+const (
+	DEFAULT_INTERVAL = 10 * time.Second
+)
+
+// Config defines the configuration of a grid trading policy
+type Config struct {
+	Exchange *pixiu.Exchange `toml:"exchange"`
+	Policy   *Policy         `toml:"policy"`
+}
+
+// Policy defines the grids traded by a policy
+type Policy struct {
+	Name    string `toml:"name"`
+	Testnet bool   `toml:"testnet"`
+	Dryrun  bool   `toml:"dryrun"`
+	// Interval is the interval of polling the price and the orders, default
+	// is 10s
+	Interval pixiu.Duration `toml:"interval"`
+	// Fee is the commission rate of fills, it is used to size the orders
+	// re-placed after fills and to account the grid profit
+	Fee     float64   `toml:"fee"`
+	Symbols []*Symbol `toml:"symbols"`
+}
+
+// Symbol defines the grid of a symbol, there are Grids+1 prices evenly
+// spaced from Lower to Upper
+type Symbol struct {
+	Symbol string        `toml:"symbol"`
+	Lower  pixiu.Decimal `toml:"lower"`
+	Upper  pixiu.Decimal `toml:"upper"`
+	Grids  int           `toml:"grids"`
+	// Quantity is the base quantity of each buy order
+	Quantity pixiu.Decimal `toml:"quantity"`
+	// OutOfRange is hold, cancel or shift, default is hold
+	OutOfRange string `toml:"out_of_range"`
+}
+
+// GetInterval returns the polling interval of the policy
+func (p *Policy) GetInterval() time.Duration {
+	if p.Interval.Duration > 0 {
+		return p.Interval.Duration
+	}
+	return DEFAULT_INTERVAL
+}
+
+// GetOutOfRange returns the out of range action of a symbol
+func (s *Symbol) GetOutOfRange() string {
+	if s.OutOfRange != "" {
+		return s.OutOfRange
+	}
+	return OUT_OF_RANGE_HOLD
+}
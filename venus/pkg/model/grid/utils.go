@@ -0,0 +1,44 @@
+package grid
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+// LoadConfigFromFile loads config from file, the credentials of the
+// exchange are resolved like pixiu
+func LoadConfigFromFile(filePath string) (*Config, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, err
+	}
+
+	var conf Config
+	if _, err := toml.DecodeFile(filePath, &conf); err != nil {
+		return nil, err
+	}
+
+	if err := pixiu.ResolveSecrets(&pixiu.Config{Exchange: conf.Exchange}); err != nil {
+		return nil, err
+	}
+
+	return &conf, nil
+}
+
+// VerifyConfig verify if config is ok or not, all the problems found by
+// ValidateConfig are reported in the error
+func VerifyConfig(conf *Config) error {
+	errs := ValidateConfig(conf)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Err.Error())
+	}
+	return fmt.Errorf("invalid config: %v", strings.Join(msgs, "; "))
+}
@@ -0,0 +1,152 @@
+package grid
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/vjoke/falcon/pkg/structured"
+	"github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+const (
+	MIN_INTERVAL    = time.Second
+	MIN_GRIDS       = 2
+	MAX_GRIDS       = 100
+	MAX_TRADING_FEE = 0.01
+)
+
+// Dictionary of the problems found by validation, the general ones are
+// shared with pixiu
+var (
+	ErrMissingField      = pixiu.ErrMissingField
+	ErrOutOfRange        = pixiu.ErrOutOfRange
+	ErrInconsistent      = pixiu.ErrInconsistent
+	ErrUnknownSymbol     = pixiu.ErrUnknownSymbol
+	ErrSymbolNotTradable = pixiu.ErrSymbolNotTradable
+	ErrBelowMinNotional  = &structured.Error{
+		Impact: "Orders of the grid are rejected by the exchange for a too small notional.",
+		Action: "Increase the quantity of the grid so that it is above the min notional at the lower price.",
+	}
+	ErrBelowTickSize = &structured.Error{
+		Impact: "Prices of the grid collapse to the same tick, orders would be placed at the same price.",
+		Action: "Decrease the grids of the symbol or widen its range.",
+	}
+)
+
+// validator collects the problems of a config
+type validator struct {
+	errs []*structured.Error
+}
+
+func (v *validator) add(serr *structured.Error, format string, args ...interface{}) {
+	v.errs = append(v.errs, structured.NewErr(serr, fmt.Errorf(format, args...)))
+}
+
+// ValidateConfig checks the structure, ranges and cross-field rules of a
+// config without accessing the exchange, all the problems are returned
+func ValidateConfig(conf *Config) []*structured.Error {
+	v := &validator{}
+	v.errs = append(v.errs, pixiu.ValidateExchange(conf.Exchange)...)
+
+	if conf.Policy == nil {
+		v.add(ErrMissingField, "[policy] is missing")
+	} else {
+		v.validatePolicy(conf.Policy)
+	}
+
+	return v.errs
+}
+
+func (v *validator) validatePolicy(p *Policy) {
+	if p.Name == "" {
+		v.add(ErrMissingField, "policy.name is empty")
+	}
+	if d := p.Interval.Duration; d != 0 && d < MIN_INTERVAL {
+		v.add(ErrOutOfRange, "policy.interval is %v, should be at least %v", d, MIN_INTERVAL)
+	}
+	if p.Fee < 0 || p.Fee > MAX_TRADING_FEE {
+		v.add(ErrOutOfRange, "policy.fee is %v, should be within [0, %v]", p.Fee, MAX_TRADING_FEE)
+	}
+
+	if len(p.Symbols) == 0 {
+		v.add(ErrMissingField, "[[policy.symbols]] is empty")
+	}
+	seen := make(map[string]bool)
+	for i, s := range p.Symbols {
+		path := fmt.Sprintf("policy.symbols[%d]", i)
+		if s.Symbol == "" || s.Symbol != strings.ToUpper(s.Symbol) {
+			v.add(ErrOutOfRange, "%v.symbol is %q, should be an upper case symbol", path, s.Symbol)
+		}
+		if seen[s.Symbol] {
+			v.add(ErrInconsistent, "policy.symbols has duplicated %v", s.Symbol)
+		}
+		seen[s.Symbol] = true
+
+		if s.Lower.Sign() <= 0 {
+			v.add(ErrOutOfRange, "%v.lower is %v, should be positive", path, s.Lower)
+		}
+		if !s.Upper.GreaterThan(s.Lower) {
+			v.add(ErrInconsistent, "%v.upper %v should be greater than %v.lower %v", path, s.Upper, path, s.Lower)
+		}
+		if s.Grids < MIN_GRIDS || s.Grids > MAX_GRIDS {
+			v.add(ErrOutOfRange, "%v.grids is %v, should be within [%v, %v]", path, s.Grids, MIN_GRIDS, MAX_GRIDS)
+		}
+		if s.Quantity.Sign() <= 0 {
+			v.add(ErrOutOfRange, "%v.quantity is %v, should be positive", path, s.Quantity)
+		}
+		if a := s.OutOfRange; a != "" && a != OUT_OF_RANGE_HOLD && a != OUT_OF_RANGE_CANCEL && a != OUT_OF_RANGE_SHIFT {
+			v.add(ErrOutOfRange, "%v.out_of_range is %q, should be one of %v", path, a,
+				[]string{OUT_OF_RANGE_HOLD, OUT_OF_RANGE_CANCEL, OUT_OF_RANGE_SHIFT})
+		}
+	}
+}
+
+// ValidateSymbols checks the grids of a config against the exchange info,
+// all the problems are returned
+func ValidateSymbols(conf *Config, info *binance.ExchangeInfo) []*structured.Error {
+	v := &validator{}
+	if conf.Policy == nil {
+		return v.errs
+	}
+
+	symbols := make(map[string]*binance.Symbol)
+	for i := range info.Symbols {
+		symbols[info.Symbols[i].Symbol] = &info.Symbols[i]
+	}
+
+	for _, g := range conf.Policy.Symbols {
+		s, ok := symbols[g.Symbol]
+		if !ok {
+			v.add(ErrUnknownSymbol, "symbol %v is unknown to the exchange", g.Symbol)
+			continue
+		}
+		if s.Status != string(binance.SymbolStatusTypeTrading) || !s.IsSpotTradingAllowed {
+			v.add(ErrSymbolNotTradable, "symbol %v is %v, spot trading allowed: %v", g.Symbol, s.Status, s.IsSpotTradingAllowed)
+		}
+
+		if f := s.PriceFilter(); f == nil {
+			v.add(ErrSymbolNotTradable, "symbol %v has no price filter", g.Symbol)
+		} else if tick, err := pixiu.ParseDecimal(f.TickSize); err == nil && g.Grids > 0 {
+			spacing := g.Upper.Sub(g.Lower).Div(pixiu.NewDecimal(int64(g.Grids), 0))
+			if spacing.LessThan(tick) {
+				v.add(ErrBelowTickSize, "spacing %v of the grids of %v is below the tick size %v", spacing, g.Symbol, tick)
+			}
+		}
+		if f := s.LotSizeFilter(); f == nil {
+			v.add(ErrSymbolNotTradable, "symbol %v has no lot size filter", g.Symbol)
+		} else if minQty, err := pixiu.ParseDecimal(f.MinQuantity); err == nil && g.Quantity.LessThan(minQty) {
+			v.add(ErrOutOfRange, "quantity %v of the grid of %v is below the min quantity %v", g.Quantity, g.Symbol, minQty)
+		}
+		if f := s.MinNotionalFilter(); f != nil {
+			minNotional, err := pixiu.ParseDecimal(f.MinNotional)
+			if notional := g.Quantity.Mul(g.Lower); err == nil && notional.LessThan(minNotional) {
+				v.add(ErrBelowMinNotional, "notional %v of the grid of %v at the lower price is below the min notional %v",
+					notional, g.Symbol, minNotional)
+			}
+		}
+	}
+
+	return v.errs
+}
@@ -0,0 +1,127 @@
+package grid
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/pkg/structured"
+	"github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+type validateTestSuite struct {
+	suite.Suite
+}
+
+func TestValidate(t *testing.T) {
+	suite.Run(t, new(validateTestSuite))
+}
+
+// newValidConfig returns a config passing the offline validation
+func newValidConfig() *Config {
+	return &Config{
+		Exchange: &pixiu.Exchange{ApiKey: "key", SecretKey: "secret"},
+		Policy: &Policy{
+			Name: "grid-test",
+			Fee:  0.001,
+			Symbols: []*Symbol{{
+				Symbol:   "ADAUSDT",
+				Lower:    pixiu.MustParseDecimal("0.9"),
+				Upper:    pixiu.MustParseDecimal("1.1"),
+				Grids:    4,
+				Quantity: pixiu.NewDecimal(20, 0),
+			}},
+		},
+	}
+}
+
+// messages returns the error messages of the problems
+func messages(errs []*structured.Error) string {
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (v *validateTestSuite) TestLoadConfig() {
+	os.Setenv("BINANCE_API_KEY", "key")
+	os.Setenv("BINANCE_SECRET_KEY", "secret")
+	conf, err := LoadConfigFromFile("../../../../config/grid.toml")
+	v.Require().NoError(err)
+	assert.Nil(v.T(), VerifyConfig(conf))
+
+	assert.Equal(v.T(), "key", conf.Exchange.ApiKey.Value())
+	assert.Equal(v.T(), 10*time.Second, conf.Policy.GetInterval())
+	v.Require().Len(conf.Policy.Symbols, 2)
+	s := conf.Policy.Symbols[1]
+	assert.Equal(v.T(), "XRPUSDT", s.Symbol)
+	assert.Equal(v.T(), pixiu.MustParseDecimal("0.4"), s.Lower)
+	assert.Equal(v.T(), 8, s.Grids)
+	assert.Equal(v.T(), OUT_OF_RANGE_SHIFT, s.GetOutOfRange())
+}
+
+func (v *validateTestSuite) TestValid() {
+	conf := newValidConfig()
+	errs := ValidateConfig(conf)
+	assert.Empty(v.T(), errs, messages(errs))
+	assert.Equal(v.T(), DEFAULT_INTERVAL, conf.Policy.GetInterval())
+	assert.Equal(v.T(), OUT_OF_RANGE_HOLD, conf.Policy.Symbols[0].GetOutOfRange())
+}
+
+func (v *validateTestSuite) TestAllProblemsReported() {
+	errs := ValidateConfig(&Config{})
+	assert.Len(v.T(), errs, 2)
+	assert.Equal(v.T(), ErrMissingField.Impact, errs[0].Impact)
+
+	conf := newValidConfig()
+	conf.Policy.Interval = pixiu.Duration{Duration: time.Millisecond * 100}
+	conf.Policy.Fee = 0.1
+	conf.Policy.Symbols = append(conf.Policy.Symbols, &Symbol{
+		Symbol: "ADAUSDT", Lower: pixiu.NewDecimal(2, 0), Upper: pixiu.NewDecimal(1, 0),
+		Grids: 1, OutOfRange: "close",
+	})
+
+	errs = ValidateConfig(conf)
+	msg := messages(errs)
+	assert.Len(v.T(), errs, 7, msg)
+	assert.Contains(v.T(), msg, "policy.interval is 100ms")
+	assert.Contains(v.T(), msg, "policy.fee is 0.1")
+	assert.Contains(v.T(), msg, "duplicated ADAUSDT")
+	assert.Contains(v.T(), msg, "policy.symbols[1].upper 1 should be greater")
+	assert.Contains(v.T(), msg, "policy.symbols[1].grids is 1")
+	assert.Contains(v.T(), msg, "policy.symbols[1].quantity is 0")
+	assert.Contains(v.T(), msg, `policy.symbols[1].out_of_range is "close"`)
+	assert.NotNil(v.T(), VerifyConfig(conf))
+}
+
+func (v *validateTestSuite) TestSymbols() {
+	info := &binance.ExchangeInfo{Symbols: []binance.Symbol{
+		{
+			Symbol: "ADAUSDT", Status: "TRADING", IsSpotTradingAllowed: true,
+			Filters: []map[string]interface{}{
+				{"filterType": "LOT_SIZE", "minQty": "0.10000000", "maxQty": "900000.00000000", "stepSize": "0.10000000"},
+				{"filterType": "PRICE_FILTER", "minPrice": "0.00010000", "maxPrice": "1000.00000000", "tickSize": "0.00010000"},
+				{"filterType": "MIN_NOTIONAL", "minNotional": "20.00000000"},
+			},
+		},
+	}}
+
+	conf := newValidConfig()
+	conf.Policy.Symbols[0].Grids = 4000
+	conf.Policy.Symbols = append(conf.Policy.Symbols, &Symbol{Symbol: "DOTUSDT"})
+	errs := ValidateSymbols(conf, info)
+	msg := messages(errs)
+	assert.Len(v.T(), errs, 3, msg)
+	assert.Equal(v.T(), ErrBelowTickSize.Action, errs[0].Action)
+	assert.Equal(v.T(), ErrBelowMinNotional.Action, errs[1].Action)
+	assert.Contains(v.T(), msg, "DOTUSDT is unknown")
+
+	conf = newValidConfig()
+	conf.Policy.Symbols[0].Quantity = pixiu.NewDecimal(25, 0)
+	assert.Empty(v.T(), ValidateSymbols(conf, info))
+}
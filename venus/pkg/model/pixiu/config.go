@@ -7,6 +7,50 @@ import (
 const (
 	REALTIME_PRICE = "realtime"
 	AVERAGE_PRICE = "average"
+	MID_PRICE = "mid"
+)
+
+const (
+	MODE_MOMENTUM = "momentum"
+	MODE_TRIANGULAR = "triangular"
+)
+
+const (
+	SLIPPAGE_SKIP = "skip"
+	SLIPPAGE_SHRINK = "shrink"
+)
+
+const (
+	EXIT_LEAVE = "leave"
+	EXIT_CANCEL = "cancel"
+	EXIT_FLATTEN = "flatten"
+)
+
+const (
+	OP_MARKET_DATA = "market_data"
+	OP_ORDER = "order"
+	OP_ACCOUNT = "account"
+)
+
+const (
+	DEFAULT_MARKET_DATA_TIMEOUT = 5 * time.Second
+	DEFAULT_ORDER_TIMEOUT = 10 * time.Second
+	DEFAULT_ACCOUNT_TIMEOUT = 10 * time.Second
+)
+
+const (
+	// DEFAULT_MAX_TIME_DRIFT is the maximum offset between the local clock
+	// and the clock of the exchange to trade
+	DEFAULT_MAX_TIME_DRIFT = time.Second
+	// RECV_WINDOW is the recvWindow of signed requests which do not set it
+	RECV_WINDOW = 5 * time.Second
+)
+
+const (
+	SINK_WEBHOOK = "webhook"
+	SINK_TELEGRAM = "telegram"
+	SINK_SMTP = "smtp"
+	SINK_FILE = "file"
 )
 
 // Config defines the configuration
@@ -14,14 +58,61 @@ type Config struct {
 	Exchange *Exchange `toml:"exchange"`
 	Policy   *Policy   `toml:"policy"`
 	Res      *Res      `toml:"res"`
+	Notify   *Notify   `toml:"notify"`
 }
 
 // Exchange defines the information for an exchange
 type Exchange struct {
 	Name      string `toml:"name"`
 	Api       string `toml:"api"`
-	ApiKey    string `toml:"api_key"`
-	SecretKey string `toml:"secret_key"`
+	ApiKey    Secret `toml:"api_key"`
+	SecretKey Secret `toml:"secret_key"`
+	Timeouts  *Timeouts `toml:"timeouts"`
+	// BaseURL overrides the endpoint of the REST API, e.g. a mock exchange,
+	// if empty the production or testnet endpoint is used by policy.testnet
+	BaseURL   string `toml:"base_url"`
+	// DisableUserStream polls the account by REST instead of caching it
+	// from the user data stream
+	DisableUserStream bool `toml:"disable_user_stream"`
+	// MaxTimeDrift is the maximum offset of the local clock to the exchange
+	// to open positions, zero means DEFAULT_MAX_TIME_DRIFT
+	MaxTimeDrift Duration `toml:"max_time_drift"`
+}
+
+// TimeDrift returns the maximum offset of the local clock to trade
+func (e *Exchange) TimeDrift() time.Duration {
+	if e == nil || e.MaxTimeDrift.Duration <= 0 {
+		return DEFAULT_MAX_TIME_DRIFT
+	}
+	return e.MaxTimeDrift.Duration
+}
+
+// Timeouts defines the timeouts of exchange requests by operation class,
+// zero means the default timeout
+type Timeouts struct {
+	MarketData Duration `toml:"market_data"`
+	Order      Duration `toml:"order"`
+	Account    Duration `toml:"account"`
+}
+
+// Get returns the timeout of an operation class
+func (t *Timeouts) Get(class string) time.Duration {
+	var d time.Duration
+	switch class {
+	case OP_MARKET_DATA:
+		if d = DEFAULT_MARKET_DATA_TIMEOUT; t != nil && t.MarketData.Duration > 0 {
+			d = t.MarketData.Duration
+		}
+	case OP_ORDER:
+		if d = DEFAULT_ORDER_TIMEOUT; t != nil && t.Order.Duration > 0 {
+			d = t.Order.Duration
+		}
+	default:
+		if d = DEFAULT_ACCOUNT_TIMEOUT; t != nil && t.Account.Duration > 0 {
+			d = t.Account.Duration
+		}
+	}
+	return d
 }
 
 // Policy defines a particular policy for trading
@@ -29,21 +120,46 @@ type Policy struct {
 	Name      string     `toml:"name"`
 	Testnet   bool       `toml:"testnet"`
 	Dryrun    bool       `toml:"dryrun"`
+	// Mode is momentum or triangular, default is momentum
+	Mode      string     `toml:"mode"`
 	Symbols   []string   `toml:"symbols"`
 	Sample    *Sample    `toml:"sample"`
 	Condition *Condition `toml:"condition"`
 	Trigger   *Trigger   `toml:"trigger"`
 	Trade     *Trade     `toml:"trade"`
+	Shutdown  *Shutdown  `toml:"shutdown"`
+	Triangular *Triangular `toml:"triangular"`
+}
+
+// Triangular defines the triangular arbitrage among the symbols of a policy
+// in triangular mode, the tickers are polled every sample interval and the
+// fee is policy.trade.fee
+type Triangular struct {
+	// Quote is the asset cycles start and end with, default is USDT
+	Quote     string  `toml:"quote"`
+	// Threshold is the min net return of a cycle after fees, e.g. 0.002
+	Threshold float64 `toml:"threshold"`
+	// Notional is the amount of the quote asset traded by a cycle
+	Notional  Decimal `toml:"notional"`
 }
 
 // Sample defines configuration for sampling
 type Sample struct {
-	Interval    duration `toml:"interval"`
-	Window      duration `toml:"window"`
+	Interval    Duration `toml:"interval"`
+	Window      Duration `toml:"window"`
 	SlideDetect bool     `toml:"slide_detect"`
 	PriceMode	string	 `toml:"price_mode"`
 }
 
+// Shutdown defines the behaviour when the arbitrager is stopped
+type Shutdown struct {
+	// Timeout is the deadline for in-flight orders to complete
+	Timeout Duration `toml:"timeout"`
+	// Exit is what to do with positions and open orders, one of
+	// leave, cancel and flatten
+	Exit string `toml:"exit"`
+}
+
 // Condition defines the total trading amout of an exchange pair
 // We only select the non-mainstream pairs
 type Condition struct {
@@ -67,14 +183,68 @@ type Trade struct {
 	StopLoss      float64 `toml:"stop_loss"`
 	StopProfit    float64 `toml:"stop_profit"`
 	Position      float64 `toml:"position"`
-	USDTPerBuy    float64 `toml:"usdt_per_buy"`
-	MaxUSDTPerBuy float64 `toml:"max_usdt_per_buy"`
+	USDTPerBuy    Decimal `toml:"usdt_per_buy"`
+	MaxUSDTPerBuy Decimal `toml:"max_usdt_per_buy"`
+	Cooldown      *Cooldown `toml:"cooldown"`
+	Slippage      *Slippage `toml:"slippage"`
+}
+
+// Slippage defines the limit of the slippage of market buys expected by the
+// order book
+type Slippage struct {
+	// Max is the max slippage of the average fill price to the mid price,
+	// e.g. 0.005 for 0.5%
+	Max float64 `toml:"max"`
+	// Action is skip or shrink, a buy exceeding the limit is skipped or
+	// shrunk to the notional within the limit, default is skip
+	Action string `toml:"action"`
+}
+
+// Cooldown defines the quiet periods after an entry or exit,
+// zero value disables the corresponding cooldown
+type Cooldown struct {
+	Symbol Duration `toml:"symbol"`
+	Global Duration `toml:"global"`
 }
 
 // Span defines time span for trading
 type Span struct {
-	From duration `toml:"from"`
-	To   duration `toml:"to"`
+	From Duration `toml:"from"`
+	To   Duration `toml:"to"`
+}
+
+// Notify defines the sinks for notifications
+type Notify struct {
+	Sinks []*Sink `toml:"sinks"`
+}
+
+// Sink defines a notification sink, the fields used depend on the type
+type Sink struct {
+	// Type is one of webhook, telegram, smtp and file
+	Type string `toml:"type"`
+	Name string `toml:"name"`
+	// Events filters the events to send, empty means all the events
+	Events []string `toml:"events"`
+	// RateLimit is the max number of messages per minute, zero means unlimited
+	RateLimit uint `toml:"rate_limit"`
+	// Template is a text/template for the message
+	Template string `toml:"template"`
+
+	// webhook
+	URL string `toml:"url"`
+	// telegram
+	Api    string `toml:"api"`
+	Token  Secret `toml:"token"`
+	ChatID string `toml:"chat_id"`
+	// smtp
+	Host     string   `toml:"host"`
+	Port     uint     `toml:"port"`
+	Username string   `toml:"username"`
+	Password Secret   `toml:"password"`
+	From     string   `toml:"from"`
+	To       []string `toml:"to"`
+	// file
+	Path string `toml:"path"`
 }
 
 // Res defines the database configurations
@@ -82,12 +252,17 @@ type Res struct {
 	// TODO:
 }
 
-type duration struct {
+// Duration is a time.Duration parsed from a string like "10s" in config
+type Duration struct {
 	time.Duration
 }
 
-func (d *duration) UnmarshalText(text []byte) error {
+func (d *Duration) UnmarshalText(text []byte) error {
 	var err error
 	d.Duration, err = time.ParseDuration(string(text))
 	return err
 }
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
@@ -2,6 +2,7 @@ package pixiu
 
 import (
 	"fmt"
+	"os"
 	"time"
 	"testing"
 
@@ -19,7 +20,14 @@ func TestConfig(t *testing.T) {
 }
 
 func (c *configTestSuite) SetupTest() {
-	c.configFile = "../../../../config/pixiu.toml"
+	c.configFile = "../../../../config/demo.toml"
+	os.Setenv("BINANCE_API_KEY", "key")
+	os.Setenv("BINANCE_SECRET_KEY", "secret")
+}
+
+func (c *configTestSuite) TearDownTest() {
+	os.Unsetenv("BINANCE_API_KEY")
+	os.Unsetenv("BINANCE_SECRET_KEY")
 }
 	
 func (c *configTestSuite) TestLoadFromFile() {
@@ -28,4 +36,11 @@ func (c *configTestSuite) TestLoadFromFile() {
 	fmt.Println(conf.Exchange.Name)
 	assert.Equal(c.T(), conf.Policy.Sample.Interval.Duration, time.Minute)
 	assert.Equal(c.T(), conf.Policy.Sample.Window.Duration, time.Minute * 5)
-} 
\ No newline at end of file
+} 
+
+func (c *configTestSuite) TestDemoIsValid() {
+	conf, err := LoadConfigFromFile(c.configFile)
+	assert.Nil(c.T(), err)
+	assert.Empty(c.T(), ValidateConfig(conf))
+	assert.Equal(c.T(), "key", conf.Exchange.ApiKey.Value())
+}
@@ -0,0 +1,279 @@
+package pixiu
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DECIMAL_PLACES is the number of fractional digits of Decimal, the same as
+// the precision of prices and quantities of binance
+const DECIMAL_PLACES = 8
+
+const decimalScale = 100000000
+
+// Decimal is a fixed-point decimal with 8 fractional digits for prices,
+// quantities and amounts, values of the exchange are parsed exactly and
+// rounded to step and tick sizes without float errors. The zero value is 0.
+type Decimal struct {
+	v int64
+}
+
+// NewDecimal creates a decimal of value * 10^exp, digits beyond 8
+// fractional digits are truncated, e.g. NewDecimal(29, -2) is 0.29
+func NewDecimal(value int64, exp int) Decimal {
+	d := new(big.Int).Mul(big.NewInt(value), big.NewInt(decimalScale))
+	if exp >= 0 {
+		d.Mul(d, pow10(exp))
+	} else {
+		d.Quo(d, pow10(-exp))
+	}
+	return fromBig(d)
+}
+
+// NewDecimalFromFloat creates a decimal from a float rounded to 8
+// fractional digits, it is used for values of config and flags
+func NewDecimalFromFloat(f float64) Decimal {
+	v := math.Round(f * decimalScale)
+	if v > math.MaxInt64 || v < math.MinInt64 || math.IsNaN(v) {
+		panic(fmt.Sprintf("decimal overflow: %v", f))
+	}
+	return Decimal{int64(v)}
+}
+
+// ParseDecimal parses a decimal string such as "0.00100000", digits beyond 8
+// fractional digits are truncated
+func ParseDecimal(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	neg := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "-"), "+")
+
+	intPart, fracPart := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		intPart, fracPart = str[:i], str[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	if len(fracPart) > DECIMAL_PLACES {
+		fracPart = fracPart[:DECIMAL_PLACES]
+	}
+	fracPart += strings.Repeat("0", DECIMAL_PLACES-len(fracPart))
+
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	if digits == "" {
+		return Decimal{}, nil
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Decimal{}, fmt.Errorf("invalid decimal %q", s)
+		}
+	}
+	v, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Decimal{}, fmt.Errorf("decimal %q is out of range", s)
+	}
+	if neg {
+		v = -v
+	}
+	return Decimal{v}, nil
+}
+
+// MustParseDecimal parses a decimal string, panic if error
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal{d.v + o.v}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return Decimal{d.v - o.v}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{-d.v}
+}
+
+// Abs returns the absolute value of d
+func (d Decimal) Abs() Decimal {
+	if d.v < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Mul multiplies decimals, digits beyond 8 fractional digits are truncated
+func (d Decimal) Mul(o Decimal) Decimal {
+	r := new(big.Int).Mul(big.NewInt(d.v), big.NewInt(o.v))
+	return fromBig(r.Quo(r, big.NewInt(decimalScale)))
+}
+
+// Div divides decimals, digits beyond 8 fractional digits are truncated.
+// Division by zero is zero.
+func (d Decimal) Div(o Decimal) Decimal {
+	if o.v == 0 {
+		return Decimal{}
+	}
+	r := new(big.Int).Mul(big.NewInt(d.v), big.NewInt(decimalScale))
+	return fromBig(r.Quo(r, big.NewInt(o.v)))
+}
+
+// Cmp returns -1, 0 or 1 if d is less than, equal to or greater than o
+func (d Decimal) Cmp(o Decimal) int {
+	switch {
+	case d.v < o.v:
+		return -1
+	case d.v > o.v:
+		return 1
+	}
+	return 0
+}
+
+func (d Decimal) LessThan(o Decimal) bool {
+	return d.v < o.v
+}
+
+func (d Decimal) GreaterThan(o Decimal) bool {
+	return d.v > o.v
+}
+
+func (d Decimal) Sign() int {
+	return d.Cmp(Decimal{})
+}
+
+func (d Decimal) IsZero() bool {
+	return d.v == 0
+}
+
+// Min returns the smaller one of d and o
+func (d Decimal) Min(o Decimal) Decimal {
+	if o.v < d.v {
+		return o
+	}
+	return d
+}
+
+// FloorToStep rounds down to a multiple of step like the LOT_SIZE and
+// PRICE_FILTER of binance, a non-positive step keeps the value
+func (d Decimal) FloorToStep(step Decimal) Decimal {
+	if step.v <= 0 {
+		return d
+	}
+	q := d.v / step.v
+	if d.v%step.v != 0 && d.v < 0 {
+		q--
+	}
+	return Decimal{q * step.v}
+}
+
+// CeilToStep rounds up to a multiple of step
+func (d Decimal) CeilToStep(step Decimal) Decimal {
+	return d.Neg().FloorToStep(step).Neg()
+}
+
+// IsMultipleOf checks if the value is a multiple of step
+func (d Decimal) IsMultipleOf(step Decimal) bool {
+	return step.v <= 0 || d.v%step.v == 0
+}
+
+// Places returns the number of fractional digits of the value, e.g. 2 for
+// a step size of 0.01
+func (d Decimal) Places() int {
+	v := d.v
+	if v < 0 {
+		v = -v
+	}
+	places := DECIMAL_PLACES
+	for places > 0 && v%10 == 0 {
+		v /= 10
+		places--
+	}
+	return places
+}
+
+// StringFixed formats the value with the fractional digits, extra digits
+// are truncated
+func (d Decimal) StringFixed(places int) string {
+	if places < 0 {
+		places = 0
+	} else if places > DECIMAL_PLACES {
+		places = DECIMAL_PLACES
+	}
+
+	v := d.v
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	s := fmt.Sprintf("%s%d.%08d", sign, v/decimalScale, v%decimalScale)
+	if places == 0 {
+		return s[:len(s)-DECIMAL_PLACES-1]
+	}
+	return s[:len(s)-DECIMAL_PLACES+places]
+}
+
+// String formats the value without trailing zeros
+func (d Decimal) String() string {
+	return d.StringFixed(d.Places())
+}
+
+// Float64 converts the value to a float, e.g. for metrics and statistics
+func (d Decimal) Float64() float64 {
+	return float64(d.v) / decimalScale
+}
+
+// MarshalJSON encodes the value as a json number
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON decodes a json number or string
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	v, err := ParseDecimal(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// UnmarshalTOML decodes a toml float, integer or string
+func (d *Decimal) UnmarshalTOML(data interface{}) error {
+	switch v := data.(type) {
+	case float64:
+		if math.Abs(v) >= math.MaxInt64/decimalScale {
+			return fmt.Errorf("decimal %v is out of range", v)
+		}
+		*d = NewDecimalFromFloat(v)
+	case int64:
+		*d = NewDecimal(v, 0)
+	case string:
+		parsed, err := ParseDecimal(v)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+	default:
+		return fmt.Errorf("invalid decimal %v", data)
+	}
+	return nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func fromBig(v *big.Int) Decimal {
+	if !v.IsInt64() {
+		panic(fmt.Sprintf("decimal overflow: %v", v))
+	}
+	return Decimal{v.Int64()}
+}
@@ -0,0 +1,115 @@
+package pixiu
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type decimalTestSuite struct {
+	suite.Suite
+}
+
+func TestDecimal(t *testing.T) {
+	suite.Run(t, new(decimalTestSuite))
+}
+
+func (s *decimalTestSuite) TestParse() {
+	cases := map[string]string{
+		"0.00100000":   "0.001",
+		"12":           "12",
+		"-1.5":         "-1.5",
+		".25":          "0.25",
+		"1.123456789":  "1.12345678",
+		"900000.00000": "900000",
+		"0":            "0",
+	}
+	for in, want := range cases {
+		d, err := ParseDecimal(in)
+		assert.Nil(s.T(), err, in)
+		assert.Equal(s.T(), want, d.String(), in)
+	}
+
+	for _, in := range []string{"", ".", "1.2.3", "abc", "1e5", "99999999999999999999"} {
+		_, err := ParseDecimal(in)
+		assert.NotNil(s.T(), err, in)
+	}
+	assert.Panics(s.T(), func() { MustParseDecimal("abc") })
+}
+
+func (s *decimalTestSuite) TestConstructors() {
+	assert.Equal(s.T(), MustParseDecimal("0.29"), NewDecimal(29, -2))
+	assert.Equal(s.T(), MustParseDecimal("1200"), NewDecimal(12, 2))
+	assert.Equal(s.T(), MustParseDecimal("0.29"), NewDecimalFromFloat(0.29))
+	assert.Equal(s.T(), MustParseDecimal("0.3"), NewDecimalFromFloat(0.1+0.2))
+	assert.Panics(s.T(), func() { NewDecimalFromFloat(1e12) })
+}
+
+func (s *decimalTestSuite) TestArithmetic() {
+	a, b := MustParseDecimal("0.1"), MustParseDecimal("0.2")
+	assert.Equal(s.T(), MustParseDecimal("0.3"), a.Add(b))
+	assert.Equal(s.T(), MustParseDecimal("-0.1"), a.Sub(b))
+	assert.Equal(s.T(), MustParseDecimal("0.02"), a.Mul(b))
+	assert.Equal(s.T(), MustParseDecimal("0.5"), a.Div(b))
+	assert.Equal(s.T(), MustParseDecimal("0.33333333"), MustParseDecimal("1").Div(MustParseDecimal("3")))
+	assert.True(s.T(), a.Div(Decimal{}).IsZero())
+	// products beyond the precision are truncated
+	assert.Equal(s.T(), MustParseDecimal("0.00000001"), MustParseDecimal("0.0001").Mul(MustParseDecimal("0.00019")))
+
+	assert.True(s.T(), a.LessThan(b))
+	assert.True(s.T(), b.GreaterThan(a))
+	assert.Equal(s.T(), 0, a.Cmp(MustParseDecimal("0.10")))
+	assert.Equal(s.T(), -1, a.Neg().Sign())
+	assert.Equal(s.T(), a, a.Neg().Abs())
+	assert.Equal(s.T(), a, b.Min(a))
+}
+
+func (s *decimalTestSuite) TestStep() {
+	step := MustParseDecimal("0.01")
+	assert.Equal(s.T(), "0.29", MustParseDecimal("0.29").FloorToStep(step).String())
+	assert.Equal(s.T(), "0.29", MustParseDecimal("0.2999").FloorToStep(step).String())
+	assert.Equal(s.T(), "-0.3", MustParseDecimal("-0.2999").FloorToStep(step).String())
+	assert.Equal(s.T(), "0.3", MustParseDecimal("0.2901").CeilToStep(step).String())
+	assert.Equal(s.T(), "0.2999", MustParseDecimal("0.2999").FloorToStep(Decimal{}).String())
+	assert.True(s.T(), MustParseDecimal("0.29").IsMultipleOf(step))
+	assert.False(s.T(), MustParseDecimal("0.295").IsMultipleOf(step))
+
+	assert.Equal(s.T(), 2, step.Places())
+	assert.Equal(s.T(), 0, MustParseDecimal("10").Places())
+	assert.Equal(s.T(), 8, MustParseDecimal("0.00000001").Places())
+}
+
+func (s *decimalTestSuite) TestFormat() {
+	d := MustParseDecimal("-1.23456789")
+	assert.Equal(s.T(), "-1.23456789", d.String())
+	assert.Equal(s.T(), "-1.2345", d.StringFixed(4))
+	assert.Equal(s.T(), "-1", d.StringFixed(0))
+	assert.Equal(s.T(), "12.00000000", MustParseDecimal("12").StringFixed(DECIMAL_PLACES))
+	assert.InDelta(s.T(), -1.23456789, d.Float64(), 1e-12)
+}
+
+func (s *decimalTestSuite) TestEncoding() {
+	var v struct {
+		Price    Decimal `json:"price" toml:"price"`
+		Quantity Decimal `json:"quantity" toml:"quantity"`
+		Amount   Decimal `json:"amount" toml:"amount"`
+	}
+
+	_, err := toml.Decode("price = 0.29\nquantity = 12\namount = \"0.10000000\"", &v)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "0.29", v.Price.String())
+	assert.Equal(s.T(), "12", v.Quantity.String())
+	assert.Equal(s.T(), "0.1", v.Amount.String())
+	_, err = toml.Decode("price = 1e20", &v)
+	assert.NotNil(s.T(), err)
+
+	data, err := json.Marshal(v)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), `{"price":0.29,"quantity":12,"amount":0.1}`, string(data))
+	assert.Nil(s.T(), json.Unmarshal([]byte(`{"price":"1.5","quantity":2.25}`), &v))
+	assert.Equal(s.T(), "1.5", v.Price.String())
+	assert.Equal(s.T(), "2.25", v.Quantity.String())
+}
@@ -0,0 +1,116 @@
+package pixiu
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// unsafeChanges lists the config paths which can not be changed without
+// restarting, changes of sub paths are unsafe as well
+var unsafeChanges = []string{
+	"exchange",
+	"policy.name",
+	"policy.testnet",
+	"policy.mode",
+	"policy.sample.interval",
+	"policy.sample.window",
+	"res",
+	"notify",
+}
+
+// secretFields lists the names of fields which should not be displayed
+var secretFields = []string{
+	"api_key",
+	"secret_key",
+	"token",
+	"password",
+}
+
+// Change defines a changed field between two configs
+type Change struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+func (c *Change) String() string {
+	for _, name := range secretFields {
+		if c.Path == name || strings.HasSuffix(c.Path, "."+name) {
+			return fmt.Sprintf("%v: changed", c.Path)
+		}
+	}
+	return fmt.Sprintf("%v: %v -> %v", c.Path, c.Old, c.New)
+}
+
+// DiffConfig compares the running config with a new one, returns the
+// changes or error if any of them can not be applied at runtime
+func DiffConfig(old, new *Config) ([]*Change, error) {
+	changes := make([]*Change, 0)
+	diffValue("", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), &changes)
+
+	unsafe := make([]string, 0)
+	for _, c := range changes {
+		if isUnsafeChange(c.Path) {
+			unsafe = append(unsafe, c.Path)
+		}
+	}
+	if len(unsafe) > 0 {
+		return changes, fmt.Errorf("changes of %v require a restart", strings.Join(unsafe, ", "))
+	}
+
+	return changes, nil
+}
+
+// isUnsafeChange checks if the path is or is under an unsafe path
+func isUnsafeChange(path string) bool {
+	for _, p := range unsafeChanges {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diffValue compares two values recursively, the toml tags of struct
+// fields are used as path
+func diffValue(path string, old, new reflect.Value, changes *[]*Change) {
+	if old.Kind() == reflect.Ptr {
+		if old.IsNil() || new.IsNil() {
+			if old.IsNil() != new.IsNil() {
+				*changes = append(*changes, &Change{path, valueOf(old), valueOf(new)})
+			}
+			return
+		}
+		diffValue(path, old.Elem(), new.Elem(), changes)
+		return
+	}
+
+	// Leaf structs such as durations are compared as a whole
+	if old.Kind() == reflect.Struct && old.NumField() > 0 && old.Type().Field(0).Tag.Get("toml") != "" {
+		for i := 0; i < old.NumField(); i++ {
+			field := old.Type().Field(i)
+			name := strings.Split(field.Tag.Get("toml"), ",")[0]
+			if name == "" {
+				name = strings.ToLower(field.Name)
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			diffValue(name, old.Field(i), new.Field(i), changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+		*changes = append(*changes, &Change{path, old.Interface(), new.Interface()})
+	}
+}
+
+func valueOf(v reflect.Value) interface{} {
+	if v.IsNil() {
+		return nil
+	}
+	return v.Elem().Interface()
+}
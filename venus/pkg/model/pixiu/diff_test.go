@@ -0,0 +1,81 @@
+package pixiu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type diffTestSuite struct {
+	suite.Suite
+}
+
+func TestDiff(t *testing.T) {
+	suite.Run(t, new(diffTestSuite))
+}
+
+func newTestConfig() *Config {
+	return &Config{
+		Exchange: &Exchange{Name: "binance", ApiKey: "key", SecretKey: "secret"},
+		Policy: &Policy{
+			Name:    "test",
+			Symbols: []string{"ADAUSDT", "DOTUSDT"},
+			Sample: &Sample{
+				Interval:  Duration{time.Minute},
+				Window:    Duration{time.Minute * 5},
+				PriceMode: REALTIME_PRICE,
+			},
+			Trigger: &Trigger{SellThreshold: 0.6, BuyThreshold: 0.3},
+			Trade: &Trade{
+				Span:     &Span{From: Duration{0}, To: Duration{time.Hour}},
+				Position: 1.0,
+			},
+		},
+		Res: &Res{},
+	}
+}
+
+func (d *diffTestSuite) TestNoChange() {
+	changes, err := DiffConfig(newTestConfig(), newTestConfig())
+	assert.Nil(d.T(), err)
+	assert.Empty(d.T(), changes)
+}
+
+func (d *diffTestSuite) TestSafeChanges() {
+	conf := newTestConfig()
+	conf.Policy.Symbols = []string{"ADAUSDT", "XRPUSDT"}
+	conf.Policy.Trigger.BuyThreshold = 0.4
+	conf.Policy.Trade.Span.To = Duration{time.Hour * 2}
+	conf.Policy.Trade.Cooldown = &Cooldown{Symbol: Duration{time.Minute}}
+
+	changes, err := DiffConfig(newTestConfig(), conf)
+	assert.Nil(d.T(), err)
+
+	paths := make([]string, 0, len(changes))
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	assert.ElementsMatch(d.T(), []string{
+		"policy.symbols",
+		"policy.trigger.buy_threshold",
+		"policy.trade.span.to",
+		"policy.trade.cooldown",
+	}, paths)
+}
+
+func (d *diffTestSuite) TestUnsafeChanges() {
+	conf := newTestConfig()
+	conf.Exchange.SecretKey = "another"
+	conf.Policy.Sample.Window = Duration{time.Minute * 10}
+
+	changes, err := DiffConfig(newTestConfig(), conf)
+	assert.NotNil(d.T(), err)
+	assert.Contains(d.T(), err.Error(), "exchange.secret_key")
+	assert.Contains(d.T(), err.Error(), "policy.sample.window")
+	assert.NotContains(d.T(), err.Error(), "another")
+	for _, c := range changes {
+		assert.NotContains(d.T(), c.String(), "another")
+	}
+}
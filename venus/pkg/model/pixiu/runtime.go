@@ -1,10 +1,15 @@
 package pixiu 
 
+import (
+	"sort"
+	"strings"
+)
+
 // Price defines the price for sampling
 type SamplePrice struct {
 	Tick   uint64
 	Symbol string
-	Price  float64
+	Price  Decimal
 	Start  string
 }
 
@@ -23,7 +28,7 @@ const (
 // Slot represents the change of price
 type Slot struct {
 	Tick      uint64
-	Price     float64
+	Price     Decimal
 	Direction int32
 }
 
@@ -37,3 +42,13 @@ type Order struct {
 	Type    string
 	Symbols []string
 }
+
+// Key returns the identity of an order intent, orders with the same type
+// and the same set of symbols share the same key
+func (o *Order) Key() string {
+	symbols := make([]string, len(o.Symbols))
+	copy(symbols, o.Symbols)
+	sort.Strings(symbols)
+
+	return o.Type + ":" + strings.Join(symbols, ",")
+}
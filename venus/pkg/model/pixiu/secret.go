@@ -0,0 +1,120 @@
+package pixiu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vjoke/falcon/pkg/log"
+	"github.com/vjoke/falcon/venus/pkg/keystore"
+)
+
+const (
+	SECRET_ENV      = "env:"
+	SECRET_FILE     = "file:"
+	SECRET_KEYSTORE = "keystore:"
+	SECRET_MASK     = "******"
+)
+
+// Secret defines a credential in config, it is masked when it is printed
+// or encoded, use Value to get the real value
+type Secret string
+
+// Value returns the real value of the secret
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return SECRET_MASK
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SecretStore defines the store for looking up secrets by name
+type SecretStore interface {
+	Get(name string) (string, error)
+}
+
+var secretStore SecretStore
+
+// SetSecretStore sets the store for the keystore: references
+func SetSecretStore(store SecretStore) {
+	secretStore = store
+}
+
+// ResolveSecret resolves a secret reference, which is one of
+//
+//	env:NAME      the environment variable NAME
+//	file:PATH     the content of a file readable only by the owner
+//	keystore:NAME the secret NAME in the keystore
+//
+// other values are returned as is with plaintext set to true
+func ResolveSecret(ref string) (value string, plaintext bool, err error) {
+	switch {
+	case strings.HasPrefix(ref, SECRET_ENV):
+		name := strings.TrimPrefix(ref, SECRET_ENV)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", false, fmt.Errorf("environment variable %v is not set", name)
+		}
+		return v, false, nil
+	case strings.HasPrefix(ref, SECRET_FILE):
+		path := strings.TrimPrefix(ref, SECRET_FILE)
+		if err := keystore.CheckPermissions(path); err != nil {
+			return "", false, err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", false, err
+		}
+		return strings.TrimSpace(string(b)), false, nil
+	case strings.HasPrefix(ref, SECRET_KEYSTORE):
+		if secretStore == nil {
+			return "", false, fmt.Errorf("no keystore is opened for %v", ref)
+		}
+		v, err := secretStore.Get(strings.TrimPrefix(ref, SECRET_KEYSTORE))
+		return v, false, err
+	default:
+		return ref, ref != "", nil
+	}
+}
+
+// ResolveSecrets resolves all the secrets of a config in place
+func ResolveSecrets(conf *Config) error {
+	fields := make(map[string]*Secret)
+	if conf.Exchange != nil {
+		fields["exchange.api_key"] = &conf.Exchange.ApiKey
+		fields["exchange.secret_key"] = &conf.Exchange.SecretKey
+	}
+	if conf.Notify != nil {
+		for i, s := range conf.Notify.Sinks {
+			fields[fmt.Sprintf("notify.sinks[%d].token", i)] = &s.Token
+			fields[fmt.Sprintf("notify.sinks[%d].password", i)] = &s.Password
+		}
+	}
+
+	for path, secret := range fields {
+		value, plaintext, err := ResolveSecret(secret.Value())
+		if err != nil {
+			return fmt.Errorf("failed to resolve %v: %v", path, err)
+		}
+		if plaintext {
+			log.Warnf("%v is in plaintext, use %v, %v or %v instead", path, SECRET_ENV, SECRET_FILE, SECRET_KEYSTORE)
+		}
+		*secret = Secret(value)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package pixiu
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type secretTestSuite struct {
+	suite.Suite
+}
+
+func TestSecret(t *testing.T) {
+	suite.Run(t, new(secretTestSuite))
+}
+
+type fakeStore map[string]string
+
+func (f fakeStore) Get(name string) (string, error) {
+	v, ok := f[name]
+	if !ok {
+		return "", fmt.Errorf("no secret %v", name)
+	}
+	return v, nil
+}
+
+func (s *secretTestSuite) TestMasked() {
+	exch := &Exchange{Name: "binance", ApiKey: "my-api-key", SecretKey: "my-secret-key"}
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		out := fmt.Sprintf(format, exch)
+		assert.NotContains(s.T(), out, "my-api-key", format)
+		assert.NotContains(s.T(), out, "my-secret-key", format)
+	}
+	assert.Equal(s.T(), "my-api-key", exch.ApiKey.Value())
+	assert.Equal(s.T(), "", Secret("").String())
+}
+
+func (s *secretTestSuite) TestResolve() {
+	os.Setenv("PIXIU_TEST_SECRET", "from-env")
+	defer os.Unsetenv("PIXIU_TEST_SECRET")
+	v, plaintext, err := ResolveSecret("env:PIXIU_TEST_SECRET")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), plaintext)
+	assert.Equal(s.T(), "from-env", v)
+	_, _, err = ResolveSecret("env:PIXIU_TEST_MISSING")
+	assert.NotNil(s.T(), err)
+
+	dir, err := ioutil.TempDir("", "secret")
+	assert.Nil(s.T(), err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "key")
+	assert.Nil(s.T(), ioutil.WriteFile(path, []byte("from-file\n"), 0644))
+	_, _, err = ResolveSecret("file:" + path)
+	assert.NotNil(s.T(), err)
+	assert.Nil(s.T(), os.Chmod(path, 0600))
+	v, _, err = ResolveSecret("file:" + path)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "from-file", v)
+
+	SetSecretStore(fakeStore{"api_key": "from-keystore"})
+	defer SetSecretStore(nil)
+	v, _, err = ResolveSecret("keystore:api_key")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "from-keystore", v)
+
+	v, plaintext, err = ResolveSecret("plain")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), plaintext)
+	assert.Equal(s.T(), "plain", v)
+}
+
+func (s *secretTestSuite) TestResolveConfig() {
+	os.Setenv("PIXIU_TEST_API_KEY", "key")
+	defer os.Unsetenv("PIXIU_TEST_API_KEY")
+	conf := &Config{
+		Exchange: &Exchange{ApiKey: "env:PIXIU_TEST_API_KEY", SecretKey: "env:PIXIU_TEST_MISSING"},
+	}
+	err := ResolveSecrets(conf)
+	assert.NotNil(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "exchange.secret_key")
+
+	conf.Exchange.SecretKey = "plain"
+	assert.Nil(s.T(), ResolveSecrets(conf))
+	assert.Equal(s.T(), "key", conf.Exchange.ApiKey.Value())
+}
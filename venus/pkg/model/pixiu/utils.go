@@ -3,6 +3,7 @@ package pixiu
 import (
 	"os"
 	"fmt"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
@@ -18,42 +19,56 @@ func LoadConfigFromFile(filePath string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := ResolveSecrets(&conf); err != nil {
+		return nil, err
+	}
+
 	return &conf, nil
 }
 
-// VerifyConfig verify if config is ok or not
+// VerifyConfig verify if config is ok or not, all the problems found by
+// ValidateConfig are reported in the error
 func VerifyConfig(conf *Config) error {
-	if len(conf.Policy.Symbols) == 0 {
-		return fmt.Errorf("symbols should not be empty")
-	}
-
-	if conf.Policy.Trigger.BuyThreshold <= 0 || conf.Policy.Trigger.BuyThreshold > 1 {
-		return fmt.Errorf("invalid buy threshold, should be within (0,1]")
-	} 
-
-	if conf.Policy.Trigger.SellThreshold <= 0 || conf.Policy.Trigger.SellThreshold > 1 {
-		return fmt.Errorf("invalid sell threshold, should be within (0,1]")
-	}
-
-	if conf.Policy.Trade.Position <= 0 || conf.Policy.Trade.Position > 1 {
-		return fmt.Errorf("invalid position %v, should be within (0,1]", conf.Policy.Trade.Position)
+	errs := ValidateConfig(conf)
+	if len(errs) == 0 {
+		return nil
 	}
 
-	if conf.Policy.Trade.USDTPerBuy < 10 || conf.Policy.Trade.USDTPerBuy >= conf.Policy.Trade.MaxUSDTPerBuy {
-		return fmt.Errorf("invalid max usdt per buy, should be within [10.0, MaxUSDTPerBuy]")
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Err.Error())
 	}
+	return fmt.Errorf("invalid config: %v", strings.Join(msgs, "; "))
+}
 
-	if conf.Policy.Trade.MaxUSDTPerBuy < 10 || conf.Policy.Trade.MaxUSDTPerBuy > 100 {
-		return fmt.Errorf("invalid max usdt per buy, should be within [10.0, 100.0]")
+// verifySink checks the required fields of a notification sink
+func verifySink(s *Sink) error {
+	switch s.Type {
+	case SINK_WEBHOOK:
+		if s.URL == "" {
+			return fmt.Errorf("url is required for webhook")
+		}
+	case SINK_TELEGRAM:
+		if s.Token == "" || s.ChatID == "" {
+			return fmt.Errorf("token and chat_id are required for telegram")
+		}
+	case SINK_SMTP:
+		if s.Host == "" || s.Port == 0 || s.From == "" || len(s.To) == 0 {
+			return fmt.Errorf("host, port, from and to are required for smtp")
+		}
+	case SINK_FILE:
+		if s.Path == "" {
+			return fmt.Errorf("path is required for file")
+		}
+	default:
+		sinks := []string{
+			SINK_WEBHOOK,
+			SINK_TELEGRAM,
+			SINK_SMTP,
+			SINK_FILE,
+		}
+		return fmt.Errorf("invalid type %v, should be one of %+v", s.Type, sinks)
 	}
 
-	if conf.Policy.Sample.PriceMode != AVERAGE_PRICE && conf.Policy.Sample.PriceMode !=  REALTIME_PRICE {
-		priceModes := []string{
-			AVERAGE_PRICE,
-			REALTIME_PRICE,
-		}
-		return fmt.Errorf("invalid price mode %v, should be one of %+v", conf.Policy.Sample.PriceMode, priceModes)
-	} 
-	// TODO: more checks
 	return nil
-}
\ No newline at end of file
+}
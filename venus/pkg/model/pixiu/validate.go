@@ -0,0 +1,360 @@
+package pixiu
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/vjoke/falcon/pkg/structured"
+	"github.com/vjoke/falcon/venus/pkg/notify"
+)
+
+const (
+	MIN_USDT_PER_BUY    = 10.0
+	MAX_USDT_PER_BUY    = 100.0
+	QUOTE_ASSET         = "USDT"
+	MIN_SAMPLE_INTERVAL = time.Second
+	MAX_TRADING_FEE     = 0.01
+	MAX_REQUEST_TIMEOUT = time.Minute
+)
+
+// Dictionary of the problems found by validation
+var (
+	ErrMissingField = &structured.Error{
+		Impact: "The arbitrager can not be started with the config.",
+		Action: "Add the section or field to the config.",
+	}
+	ErrOutOfRange = &structured.Error{
+		Impact: "The policy would not sample or trade as intended.",
+		Action: "Change the value to be within the valid range.",
+	}
+	ErrInconsistent = &structured.Error{
+		Impact: "The fields contradict each other, the policy would not sample or trade as intended.",
+		Action: "Adjust the related fields so that they are consistent.",
+	}
+	ErrUnknownSymbol = &structured.Error{
+		Impact: "The arbitrager can not be started, orders of the symbol are rejected by the exchange.",
+		Action: "Fix the name of the symbol or remove it from policy.symbols.",
+	}
+	ErrSymbolNotTradable = &structured.Error{
+		Impact: "Orders of the symbol are rejected by the exchange.",
+		Action: "Remove the symbol from policy.symbols until it can be traded.",
+	}
+	ErrBelowMinNotional = &structured.Error{
+		Impact: "Buy orders of the symbol are rejected by the exchange for a too small notional.",
+		Action: "Increase policy.trade.usdt_per_buy above the min notional of the symbol.",
+	}
+)
+
+// validator collects the problems of a config
+type validator struct {
+	errs []*structured.Error
+}
+
+func (v *validator) add(serr *structured.Error, format string, args ...interface{}) {
+	v.errs = append(v.errs, structured.NewErr(serr, fmt.Errorf(format, args...)))
+}
+
+// within checks that value is within [min, max]
+func (v *validator) within(path string, value, min, max float64) {
+	if value < min || value > max {
+		v.add(ErrOutOfRange, "%v is %v, should be within [%v, %v]", path, value, min, max)
+	}
+}
+
+// ratio checks that value is within (0, 1]
+func (v *validator) ratio(path string, value float64) {
+	if value <= 0 || value > 1 {
+		v.add(ErrOutOfRange, "%v is %v, should be within (0, 1]", path, value)
+	}
+}
+
+// oneOf checks that value is one of the options
+func (v *validator) oneOf(path, value string, options ...string) {
+	for _, o := range options {
+		if value == o {
+			return
+		}
+	}
+	v.add(ErrOutOfRange, "%v is %q, should be one of %v", path, value, options)
+}
+
+// timeout checks that a request timeout is not negative or too long, zero
+// means the default
+func (v *validator) timeout(path string, d time.Duration) {
+	if d < 0 || d > MAX_REQUEST_TIMEOUT {
+		v.add(ErrOutOfRange, "%v is %v, should be within [0, %v]", path, d, MAX_REQUEST_TIMEOUT)
+	}
+}
+
+// ValidateConfig checks the structure, ranges and cross-field rules of a
+// config without accessing the exchange, all the problems are returned
+func ValidateConfig(conf *Config) []*structured.Error {
+	v := &validator{}
+	v.validateExchange(conf.Exchange)
+
+	if conf.Policy == nil {
+		v.add(ErrMissingField, "[policy] is missing")
+	} else {
+		v.validatePolicy(conf.Policy)
+	}
+
+	if conf.Notify != nil {
+		for i, s := range conf.Notify.Sinks {
+			v.validateSink(fmt.Sprintf("notify.sinks[%d]", i), s)
+		}
+	}
+
+	return v.errs
+}
+
+// ValidateExchange checks the [exchange] block of a config, it is shared by
+// the configs of all the strategies
+func ValidateExchange(e *Exchange) []*structured.Error {
+	v := &validator{}
+	v.validateExchange(e)
+	return v.errs
+}
+
+func (v *validator) validateExchange(e *Exchange) {
+	if e == nil {
+		v.add(ErrMissingField, "[exchange] is missing")
+		return
+	}
+
+	if e.ApiKey == "" {
+		v.add(ErrMissingField, "exchange.api_key is empty")
+	}
+	if e.SecretKey == "" {
+		v.add(ErrMissingField, "exchange.secret_key is empty")
+	}
+	if t := e.Timeouts; t != nil {
+		v.timeout("exchange.timeouts.market_data", t.MarketData.Duration)
+		v.timeout("exchange.timeouts.order", t.Order.Duration)
+		v.timeout("exchange.timeouts.account", t.Account.Duration)
+	}
+	// signed requests are rejected before the drift reaches recvWindow
+	if d := e.MaxTimeDrift.Duration; d < 0 || d >= RECV_WINDOW {
+		v.add(ErrOutOfRange, "exchange.max_time_drift is %v, should be within [0, %v) of recv_window", d, RECV_WINDOW)
+	}
+	if base := e.BaseURL; base != "" {
+		if u, err := url.Parse(base); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(ErrOutOfRange, "exchange.base_url is %q, should be an http or https url", base)
+		}
+	}
+}
+
+func (v *validator) validatePolicy(p *Policy) {
+	if p.Name == "" {
+		v.add(ErrMissingField, "policy.name is empty")
+	}
+
+	if len(p.Symbols) == 0 {
+		v.add(ErrMissingField, "policy.symbols is empty")
+	}
+	triangular := p.Mode == MODE_TRIANGULAR
+	if p.Mode != "" {
+		v.oneOf("policy.mode", p.Mode, MODE_MOMENTUM, MODE_TRIANGULAR)
+	}
+	seen := make(map[string]bool)
+	for _, symbol := range p.Symbols {
+		if seen[symbol] {
+			v.add(ErrInconsistent, "policy.symbols has duplicated %v", symbol)
+		}
+		seen[symbol] = true
+		// cycles of triangular mode trade the cross symbols of other quotes
+		if triangular {
+			if symbol == "" || symbol != strings.ToUpper(symbol) {
+				v.add(ErrOutOfRange, "policy.symbols has %q, should be an upper case symbol", symbol)
+			}
+		} else if symbol != strings.ToUpper(symbol) || !strings.HasSuffix(symbol, QUOTE_ASSET) || len(symbol) == len(QUOTE_ASSET) {
+			v.add(ErrOutOfRange, "policy.symbols has %q, should be an upper case symbol quoted in %v", symbol, QUOTE_ASSET)
+		}
+	}
+	if t := p.Triangular; t == nil && triangular {
+		v.add(ErrMissingField, "[policy.triangular] is missing in triangular mode")
+	} else if t != nil {
+		v.ratio("policy.triangular.threshold", t.Threshold)
+		if t.Notional.Sign() <= 0 {
+			v.add(ErrOutOfRange, "policy.triangular.notional is %v, should be positive", t.Notional)
+		}
+		if t.Quote != "" && t.Quote != strings.ToUpper(t.Quote) {
+			v.add(ErrOutOfRange, "policy.triangular.quote is %q, should be an upper case asset", t.Quote)
+		}
+	}
+
+	if s := p.Sample; s == nil {
+		v.add(ErrMissingField, "[policy.sample] is missing")
+	} else {
+		interval, window := s.Interval.Duration, s.Window.Duration
+		if interval < MIN_SAMPLE_INTERVAL {
+			v.add(ErrOutOfRange, "policy.sample.interval is %v, should be at least %v", interval, MIN_SAMPLE_INTERVAL)
+		}
+		if window < interval || (interval > 0 && window%interval != 0) {
+			v.add(ErrInconsistent, "policy.sample.window %v should be a positive multiple of policy.sample.interval %v", window, interval)
+		}
+		v.oneOf("policy.sample.price_mode", s.PriceMode, AVERAGE_PRICE, REALTIME_PRICE, MID_PRICE)
+	}
+
+	if c := p.Condition; c != nil && c.Min > c.Max {
+		v.add(ErrInconsistent, "policy.condition.min %v should not be greater than policy.condition.max %v", c.Min, c.Max)
+	}
+
+	if t := p.Trigger; t == nil {
+		v.add(ErrMissingField, "[policy.trigger] is missing")
+	} else {
+		v.ratio("policy.trigger.buy_threshold", t.BuyThreshold)
+		v.ratio("policy.trigger.sell_threshold", t.SellThreshold)
+	}
+
+	if t := p.Trade; t == nil {
+		v.add(ErrMissingField, "[policy.trade] is missing")
+	} else {
+		v.validateTrade(t)
+	}
+
+	if s := p.Shutdown; s != nil {
+		if s.Timeout.Duration < 0 {
+			v.add(ErrOutOfRange, "policy.shutdown.timeout is %v, should not be negative", s.Timeout.Duration)
+		}
+		if s.Exit != "" {
+			v.oneOf("policy.shutdown.exit", s.Exit, EXIT_LEAVE, EXIT_CANCEL, EXIT_FLATTEN)
+		}
+	}
+}
+
+func (v *validator) validateTrade(t *Trade) {
+	v.within("policy.trade.fee", t.Fee, 0, MAX_TRADING_FEE)
+	if t.StopLoss <= 0 || t.StopLoss >= 1 {
+		v.add(ErrOutOfRange, "policy.trade.stop_loss is %v, should be within (0, 1)", t.StopLoss)
+	}
+	if t.StopProfit <= 0 {
+		v.add(ErrOutOfRange, "policy.trade.stop_profit is %v, should be positive", t.StopProfit)
+	} else if t.StopProfit <= 2*t.Fee {
+		v.add(ErrInconsistent, "policy.trade.stop_profit %v should be greater than the fees of buying and selling %v", t.StopProfit, 2*t.Fee)
+	}
+	v.ratio("policy.trade.position", t.Position)
+	v.within("policy.trade.max_usdt_per_buy", t.MaxUSDTPerBuy.Float64(), MIN_USDT_PER_BUY, MAX_USDT_PER_BUY)
+	v.within("policy.trade.usdt_per_buy", t.USDTPerBuy.Float64(), MIN_USDT_PER_BUY, MAX_USDT_PER_BUY)
+	if !t.USDTPerBuy.LessThan(t.MaxUSDTPerBuy) {
+		v.add(ErrInconsistent, "policy.trade.usdt_per_buy %v should be less than policy.trade.max_usdt_per_buy %v", t.USDTPerBuy, t.MaxUSDTPerBuy)
+	}
+
+	if s := t.Span; s == nil {
+		v.add(ErrMissingField, "[policy.trade.span] is missing")
+	} else {
+		day := 24 * time.Hour
+		if s.From.Duration < 0 || s.From.Duration > day || s.To.Duration < 0 || s.To.Duration > day {
+			v.add(ErrOutOfRange, "policy.trade.span is %v - %v, should be within 24h", s.From.Duration, s.To.Duration)
+		}
+		if s.From.Duration >= s.To.Duration {
+			v.add(ErrInconsistent, "policy.trade.span.from %v should be before policy.trade.span.to %v", s.From.Duration, s.To.Duration)
+		}
+	}
+
+	if c := t.Cooldown; c != nil {
+		if c.Symbol.Duration < 0 || c.Global.Duration < 0 {
+			v.add(ErrOutOfRange, "policy.trade.cooldown is %v/%v, should not be negative", c.Symbol.Duration, c.Global.Duration)
+		}
+	}
+
+	if s := t.Slippage; s != nil {
+		v.ratio("policy.trade.slippage.max", s.Max)
+		if s.Action != "" {
+			v.oneOf("policy.trade.slippage.action", s.Action, SLIPPAGE_SKIP, SLIPPAGE_SHRINK)
+		}
+	}
+}
+
+func (v *validator) validateSink(path string, s *Sink) {
+	if err := verifySink(s); err != nil {
+		v.add(ErrMissingField, "%v: %v", path, err)
+	}
+	for _, e := range s.Events {
+		v.oneOf(path+".events", e, notify.Events...)
+	}
+	if s.Template != "" {
+		if _, err := template.New(path).Parse(s.Template); err != nil {
+			v.add(ErrOutOfRange, "%v.template is invalid: %v", path, err)
+		}
+	}
+}
+
+// ValidateSymbols checks the symbols and trade size of a config against the
+// exchange info, all the problems are returned
+func ValidateSymbols(conf *Config, info *binance.ExchangeInfo) []*structured.Error {
+	v := &validator{}
+	if conf.Policy == nil {
+		return v.errs
+	}
+
+	symbols := make(map[string]*binance.Symbol)
+	for i := range info.Symbols {
+		symbols[info.Symbols[i].Symbol] = &info.Symbols[i]
+	}
+
+	for _, name := range conf.Policy.Symbols {
+		s, ok := symbols[name]
+		if !ok {
+			v.add(ErrUnknownSymbol, "symbol %v is unknown to the exchange", name)
+			continue
+		}
+		if s.Status != string(binance.SymbolStatusTypeTrading) || !s.IsSpotTradingAllowed {
+			v.add(ErrSymbolNotTradable, "symbol %v is %v, spot trading allowed: %v", name, s.Status, s.IsSpotTradingAllowed)
+		}
+		if conf.Policy.Mode == MODE_TRIANGULAR {
+			v.validateCycleSymbol(conf.Policy.Triangular, s)
+			continue
+		}
+		if !s.OcoAllowed {
+			v.add(ErrSymbolNotTradable, "symbol %v does not allow oco orders for stop profit and loss", name)
+		}
+		if s.LotSizeFilter() == nil || s.PriceFilter() == nil {
+			v.add(ErrSymbolNotTradable, "symbol %v has no lot size or price filter", name)
+		}
+
+		f := s.MinNotionalFilter()
+		if f == nil || conf.Policy.Trade == nil {
+			continue
+		}
+		minNotional, err := ParseDecimal(f.MinNotional)
+		if err != nil {
+			continue
+		}
+		if conf.Policy.Trade.USDTPerBuy.LessThan(minNotional) {
+			v.add(ErrBelowMinNotional, "policy.trade.usdt_per_buy %v is below the min notional %v of %v",
+				conf.Policy.Trade.USDTPerBuy, minNotional, name)
+		}
+		// The oco order sells at the stop price after fees
+		t := conf.Policy.Trade
+		if stop := t.USDTPerBuy.Mul(NewDecimalFromFloat((1 - t.Fee) * (1 - t.StopLoss))); stop.LessThan(minNotional) {
+			v.add(ErrBelowMinNotional, "stop loss order of %v USDT after fees is below the min notional %v of %v",
+				stop, minNotional, name)
+		}
+	}
+
+	return v.errs
+}
+
+// validateCycleSymbol checks that the notional of triangular cycles is not
+// below the min notional of a symbol quoted in the quote asset of cycles
+func (v *validator) validateCycleSymbol(t *Triangular, s *binance.Symbol) {
+	f := s.MinNotionalFilter()
+	if t == nil || f == nil {
+		return
+	}
+	quote := t.Quote
+	if quote == "" {
+		quote = QUOTE_ASSET
+	}
+	if s.QuoteAsset != quote {
+		return
+	}
+	minNotional, err := ParseDecimal(f.MinNotional)
+	if err == nil && t.Notional.LessThan(minNotional) {
+		v.add(ErrBelowMinNotional, "policy.triangular.notional %v is below the min notional %v of %v", t.Notional, minNotional, s.Symbol)
+	}
+}
@@ -0,0 +1,236 @@
+package pixiu
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/pkg/structured"
+)
+
+type validateTestSuite struct {
+	suite.Suite
+}
+
+func TestValidate(t *testing.T) {
+	suite.Run(t, new(validateTestSuite))
+}
+
+// newValidConfig returns a config passing the offline validation
+func newValidConfig() *Config {
+	conf := newTestConfig()
+	conf.Policy.Trade.Fee = 0.002
+	conf.Policy.Trade.StopLoss = 0.02
+	conf.Policy.Trade.StopProfit = 0.008
+	conf.Policy.Trade.USDTPerBuy = NewDecimal(12, 0)
+	conf.Policy.Trade.MaxUSDTPerBuy = NewDecimal(20, 0)
+	return conf
+}
+
+// messages returns the error messages of the problems
+func messages(errs []*structured.Error) string {
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (v *validateTestSuite) TestValid() {
+	errs := ValidateConfig(newValidConfig())
+	assert.Empty(v.T(), errs, messages(errs))
+	assert.Nil(v.T(), VerifyConfig(newValidConfig()))
+}
+
+func (v *validateTestSuite) TestMissingSections() {
+	errs := ValidateConfig(&Config{})
+	assert.Len(v.T(), errs, 2)
+	assert.Equal(v.T(), ErrMissingField.Impact, errs[0].Impact)
+
+	conf := newValidConfig()
+	conf.Policy.Sample = nil
+	conf.Policy.Trade.Span = nil
+	msg := messages(ValidateConfig(conf))
+	assert.Contains(v.T(), msg, "[policy.sample] is missing")
+	assert.Contains(v.T(), msg, "[policy.trade.span] is missing")
+}
+
+func (v *validateTestSuite) TestAllProblemsReported() {
+	conf := newValidConfig()
+	conf.Policy.Symbols = []string{"ADAUSDT", "ADAUSDT", "adabtc"}
+	conf.Policy.Sample.Window = Duration{time.Second * 90}
+	conf.Policy.Trade.Span = &Span{From: Duration{time.Hour * 2}, To: Duration{time.Hour}}
+	conf.Policy.Trade.USDTPerBuy = NewDecimal(30, 0)
+	conf.Policy.Trigger.BuyThreshold = 0
+
+	errs := ValidateConfig(conf)
+	msg := messages(errs)
+	assert.Len(v.T(), errs, 6, msg)
+	assert.Contains(v.T(), msg, "duplicated ADAUSDT")
+	assert.Contains(v.T(), msg, `"adabtc"`)
+	assert.Contains(v.T(), msg, "positive multiple")
+	assert.Contains(v.T(), msg, "span.from")
+	assert.Contains(v.T(), msg, "usdt_per_buy 30")
+	assert.Contains(v.T(), msg, "buy_threshold is 0")
+
+	err := VerifyConfig(conf)
+	assert.NotNil(v.T(), err)
+	assert.Contains(v.T(), err.Error(), "span.from")
+}
+
+func (v *validateTestSuite) TestSink() {
+	conf := newValidConfig()
+	conf.Notify = &Notify{Sinks: []*Sink{
+		{Type: SINK_FILE, Path: "/tmp/events", Events: []string{"fill"}, Template: "{{.Type"},
+		{Type: "pager"},
+	}}
+
+	msg := messages(ValidateConfig(conf))
+	assert.Contains(v.T(), msg, "notify.sinks[0].events")
+	assert.Contains(v.T(), msg, "notify.sinks[0].template")
+	assert.Contains(v.T(), msg, "notify.sinks[1]: invalid type pager")
+}
+
+func (v *validateTestSuite) TestSymbols() {
+	info := &binance.ExchangeInfo{Symbols: []binance.Symbol{
+		{
+			Symbol: "ADAUSDT", Status: "TRADING", IsSpotTradingAllowed: true, OcoAllowed: true,
+			Filters: []map[string]interface{}{
+				{"filterType": "LOT_SIZE", "minQty": "0.10000000", "maxQty": "900000.00000000", "stepSize": "0.10000000"},
+				{"filterType": "PRICE_FILTER", "minPrice": "0.00010000", "maxPrice": "1000.00000000", "tickSize": "0.00010000"},
+				{"filterType": "MIN_NOTIONAL", "minNotional": "12.00000000"},
+			},
+		},
+	}}
+
+	conf := newValidConfig()
+	errs := ValidateSymbols(conf, info)
+	msg := messages(errs)
+	assert.Len(v.T(), errs, 2, msg)
+	assert.Equal(v.T(), ErrUnknownSymbol.Action, errs[1].Action)
+	assert.Contains(v.T(), msg, "DOTUSDT is unknown")
+	assert.Contains(v.T(), msg, "stop loss order")
+
+	conf.Policy.Symbols = []string{"ADAUSDT"}
+	conf.Policy.Trade.USDTPerBuy = NewDecimal(15, 0)
+	assert.Empty(v.T(), ValidateSymbols(conf, info))
+}
+
+func (v *validateTestSuite) TestUSDTPerBuy() {
+	conf := newValidConfig()
+	conf.Policy.Trade.USDTPerBuy = NewDecimal(20, 0)
+	errs := ValidateConfig(conf)
+	assert.Len(v.T(), errs, 1)
+	assert.Contains(v.T(), errs[0].Err.Error(), "should be less than policy.trade.max_usdt_per_buy")
+}
+
+func (v *validateTestSuite) TestTimeouts() {
+	var t *Timeouts
+	assert.Equal(v.T(), DEFAULT_MARKET_DATA_TIMEOUT, t.Get(OP_MARKET_DATA))
+
+	t = &Timeouts{Order: Duration{3 * time.Second}}
+	assert.Equal(v.T(), 3*time.Second, t.Get(OP_ORDER))
+	assert.Equal(v.T(), DEFAULT_ACCOUNT_TIMEOUT, t.Get(OP_ACCOUNT))
+
+	conf := newValidConfig()
+	conf.Exchange.Timeouts = &Timeouts{Account: Duration{2 * time.Minute}}
+	errs := ValidateConfig(conf)
+	assert.Len(v.T(), errs, 1)
+	assert.Contains(v.T(), errs[0].Err.Error(), "exchange.timeouts.account")
+}
+
+func (v *validateTestSuite) TestMaxTimeDrift() {
+	var e *Exchange
+	assert.Equal(v.T(), DEFAULT_MAX_TIME_DRIFT, e.TimeDrift())
+
+	conf := newValidConfig()
+	conf.Exchange.MaxTimeDrift = Duration{3 * time.Second}
+	assert.Equal(v.T(), 3*time.Second, conf.Exchange.TimeDrift())
+	assert.Empty(v.T(), ValidateConfig(conf))
+
+	// the drift should be below recv_window
+	conf.Exchange.MaxTimeDrift = Duration{RECV_WINDOW}
+	errs := ValidateConfig(conf)
+	assert.Len(v.T(), errs, 1)
+	assert.Contains(v.T(), errs[0].Err.Error(), "exchange.max_time_drift")
+}
+
+func (v *validateTestSuite) TestSlippage() {
+	conf := newValidConfig()
+	conf.Policy.Sample.PriceMode = MID_PRICE
+	conf.Policy.Trade.Slippage = &Slippage{Max: 0.005, Action: SLIPPAGE_SHRINK}
+	assert.Empty(v.T(), ValidateConfig(conf))
+
+	conf.Policy.Trade.Slippage = &Slippage{Action: "cancel"}
+	msg := messages(ValidateConfig(conf))
+	assert.Contains(v.T(), msg, "policy.trade.slippage.max")
+	assert.Contains(v.T(), msg, "policy.trade.slippage.action")
+}
+
+func (v *validateTestSuite) TestTriangular() {
+	conf := newValidConfig()
+	conf.Policy.Mode = MODE_TRIANGULAR
+	conf.Policy.Symbols = []string{"BTCUSDT", "ADABTC", "ADAUSDT"}
+	msg := messages(ValidateConfig(conf))
+	assert.Contains(v.T(), msg, "[policy.triangular] is missing")
+	assert.NotContains(v.T(), msg, "ADABTC")
+
+	conf.Policy.Triangular = &Triangular{Threshold: 0.002, Notional: NewDecimal(20, 0)}
+	errs := ValidateConfig(conf)
+	assert.Empty(v.T(), errs, messages(errs))
+
+	conf.Policy.Triangular = &Triangular{Quote: "usdt"}
+	msg = messages(ValidateConfig(conf))
+	assert.Contains(v.T(), msg, "policy.triangular.threshold")
+	assert.Contains(v.T(), msg, "policy.triangular.notional")
+	assert.Contains(v.T(), msg, "policy.triangular.quote")
+
+	// cross symbols are only allowed in triangular mode
+	conf.Policy.Mode = "grid"
+	msg = messages(ValidateConfig(conf))
+	assert.Contains(v.T(), msg, "policy.mode")
+	assert.Contains(v.T(), msg, "ADABTC")
+}
+
+func (v *validateTestSuite) TestTriangularSymbols() {
+	filters := func(minNotional string) []map[string]interface{} {
+		return []map[string]interface{}{
+			{"filterType": "LOT_SIZE", "minQty": "0.10000000", "maxQty": "900000.00000000", "stepSize": "0.10000000"},
+			{"filterType": "PRICE_FILTER", "minPrice": "0.00000001", "maxPrice": "1000.00000000", "tickSize": "0.00000001"},
+			{"filterType": "MIN_NOTIONAL", "minNotional": minNotional},
+		}
+	}
+	info := &binance.ExchangeInfo{Symbols: []binance.Symbol{
+		{Symbol: "ADAUSDT", Status: "TRADING", IsSpotTradingAllowed: true, QuoteAsset: "USDT", Filters: filters("25.00000000")},
+		{Symbol: "ADABTC", Status: "TRADING", IsSpotTradingAllowed: true, QuoteAsset: "BTC", Filters: filters("0.00010000")},
+	}}
+
+	conf := newValidConfig()
+	conf.Policy.Mode = MODE_TRIANGULAR
+	conf.Policy.Symbols = []string{"ADAUSDT", "ADABTC"}
+	conf.Policy.Triangular = &Triangular{Threshold: 0.002, Notional: NewDecimal(20, 0)}
+	errs := ValidateSymbols(conf, info)
+	// oco orders are not required and the min notional is of the notional
+	if assert.Len(v.T(), errs, 1, messages(errs)) {
+		assert.Contains(v.T(), errs[0].Err.Error(), "policy.triangular.notional 20 is below the min notional 25 of ADAUSDT")
+	}
+
+	conf.Policy.Triangular.Notional = NewDecimal(30, 0)
+	assert.Empty(v.T(), ValidateSymbols(conf, info))
+}
+
+func (v *validateTestSuite) TestBaseURL() {
+	conf := newValidConfig()
+	conf.Exchange.BaseURL = "http://127.0.0.1:9090"
+	assert.Empty(v.T(), ValidateConfig(conf))
+
+	for _, base := range []string{"127.0.0.1:9090", "ftp://127.0.0.1", "http://"} {
+		conf.Exchange.BaseURL = base
+		errs := ValidateConfig(conf)
+		assert.Len(v.T(), errs, 1, base)
+		assert.Contains(v.T(), errs[0].Err.Error(), "exchange.base_url")
+	}
+}
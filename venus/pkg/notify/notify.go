@@ -0,0 +1,253 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"text/template"
+	"time"
+
+	glog "github.com/vjoke/falcon/pkg/log"
+)
+
+var nLog = glog.RegisterScope("notify", "notify", 0)
+
+const (
+	EVENT_ENTRY                 = "entry"
+	EVENT_EXIT                  = "exit"
+	EVENT_ORDER_FAILED          = "order_failed"
+	EVENT_CONNECTIVITY_LOST     = "connectivity_lost"
+	EVENT_CONNECTIVITY_RESTORED = "connectivity_restored"
+	EVENT_SYMBOL_STATUS         = "symbol_status"
+	// EVENT_RISK is a trade refused by a risk limit, e.g. the exhausted risk
+	// budget or an unsynced clock
+	EVENT_RISK = "risk"
+)
+
+// Events lists all the types of events
+var Events = []string{
+	EVENT_ENTRY,
+	EVENT_EXIT,
+	EVENT_ORDER_FAILED,
+	EVENT_CONNECTIVITY_LOST,
+	EVENT_CONNECTIVITY_RESTORED,
+	EVENT_SYMBOL_STATUS,
+	EVENT_RISK,
+}
+
+const (
+	DEFAULT_TEMPLATE = "[{{.Policy}}] {{.Type}}{{if .Symbol}} {{.Symbol}}{{end}}: {{.Message}}"
+	QUEUE_SIZE       = 256
+)
+
+// Event defines an event worth notifying
+type Event struct {
+	Type    string                 `json:"type"`
+	Policy  string                 `json:"policy"`
+	Symbol  string                 `json:"symbol,omitempty"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+	Time    time.Time              `json:"time"`
+}
+
+// Notifier accepts events for notifying
+type Notifier interface {
+	Notify(e *Event)
+}
+
+// Sink delivers a rendered message of an event
+type Sink interface {
+	Name() string
+	Send(text string, e *Event) error
+}
+
+// Route binds a sink with its filter, rate limit and template
+type Route struct {
+	sink     Sink
+	events   map[string]bool
+	limiter  *rateLimiter
+	template *template.Template
+}
+
+// NewRoute creates a route for a sink, empty events means all the events,
+// zero rate means no rate limiting and empty tmpl means DEFAULT_TEMPLATE
+func NewRoute(sink Sink, events []string, ratePerMinute uint, tmpl string) (*Route, error) {
+	if tmpl == "" {
+		tmpl = DEFAULT_TEMPLATE
+	}
+	t, err := template.New(sink.Name()).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for %v: %v", sink.Name(), err)
+	}
+
+	r := &Route{
+		sink:     sink,
+		template: t,
+	}
+	if len(events) > 0 {
+		r.events = make(map[string]bool)
+		for _, e := range events {
+			r.events[e] = true
+		}
+	}
+	if ratePerMinute > 0 {
+		r.limiter = newRateLimiter(ratePerMinute, time.Minute)
+	}
+
+	return r, nil
+}
+
+// accepts checks if the event passes the filter
+func (r *Route) accepts(e *Event) bool {
+	return r.events == nil || r.events[e.Type]
+}
+
+// render renders the message of an event
+func (r *Route) render(e *Event) (string, error) {
+	var buf bytes.Buffer
+	if err := r.template.Execute(&buf, e); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Dispatcher delivers events to the routes asynchronously
+type Dispatcher struct {
+	routes  []*Route
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+	queue   chan *Event
+	done    chan struct{}
+}
+
+var _ Notifier = &Dispatcher{}
+
+// NewDispatcher creates a new dispatcher for the routes
+func NewDispatcher(routes ...*Route) *Dispatcher {
+	return &Dispatcher{
+		routes: routes,
+		queue:  make(chan *Event, QUEUE_SIZE),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start starts delivering events
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.started || d.closed {
+		return
+	}
+	d.started = true
+
+	go func() {
+		defer close(d.done)
+		for e := range d.queue {
+			d.dispatch(e)
+		}
+	}()
+}
+
+// Notify queues an event, it is dropped if the queue is full
+func (d *Dispatcher) Notify(e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		nLog.Warnf("dispatcher is closed, drop event %v", e.Type)
+		return
+	}
+
+	select {
+	case d.queue <- e:
+	default:
+		nLog.Warnf("queue is full, drop event %v", e.Type)
+	}
+}
+
+// Close stops accepting events and waits for the queued events to be
+// delivered until timeout
+func (d *Dispatcher) Close(timeout time.Duration) {
+	d.mu.Lock()
+	started := d.started
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	if !started {
+		return
+	}
+
+	select {
+	case <-d.done:
+	case <-time.After(timeout):
+		nLog.Warnf("queued events are not delivered in %v", timeout)
+	}
+}
+
+// dispatch sends an event to all the routes accepting it
+func (d *Dispatcher) dispatch(e *Event) {
+	for _, r := range d.routes {
+		if !r.accepts(e) {
+			continue
+		}
+		if r.limiter != nil && !r.limiter.Allow(e.Time) {
+			nLog.Warnf("rate limited, drop event %v for %v", e.Type, r.sink.Name())
+			continue
+		}
+
+		text, err := r.render(e)
+		if err != nil {
+			nLog.Errorf("failed to render event %v for %v: %v", e.Type, r.sink.Name(), err)
+			continue
+		}
+		if err := r.sink.Send(text, e); err != nil {
+			nLog.Errorf("failed to send event %v to %v: %v", e.Type, r.sink.Name(), err)
+		}
+	}
+}
+
+// rateLimiter is a token bucket refilled with rate tokens per period
+type rateLimiter struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	perSec   float64
+	last     time.Time
+}
+
+func newRateLimiter(rate uint, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		capacity: float64(rate),
+		tokens:   float64(rate),
+		perSec:   float64(rate) / period.Seconds(),
+	}
+}
+
+// Allow takes a token at now, returns false if no token is left
+func (l *rateLimiter) Allow(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.perSec
+		if l.tokens > l.capacity {
+			l.tokens = l.capacity
+		}
+	}
+	if now.After(l.last) {
+		l.last = now
+	}
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type fakeSink struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (f *fakeSink) Name() string { return "fake" }
+func (f *fakeSink) Send(text string, e *Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.texts = append(f.texts, text)
+	return nil
+}
+
+type notifyTestSuite struct {
+	suite.Suite
+}
+
+func TestNotify(t *testing.T) {
+	suite.Run(t, new(notifyTestSuite))
+}
+
+func (s *notifyTestSuite) TestDispatch() {
+	sink := &fakeSink{}
+	route, err := NewRoute(sink, []string{EVENT_ORDER_FAILED}, 0, "")
+	assert.Nil(s.T(), err)
+
+	d := NewDispatcher(route)
+	d.Start()
+	d.Notify(&Event{Type: EVENT_ENTRY, Policy: "p", Symbol: "ADAUSDT", Message: "bought"})
+	d.Notify(&Event{Type: EVENT_ORDER_FAILED, Policy: "p", Symbol: "ADAUSDT", Message: "failed"})
+	d.Close(time.Second)
+
+	assert.Equal(s.T(), []string{"[p] order_failed ADAUSDT: failed"}, sink.texts)
+
+	// Events after close are dropped
+	d.Notify(&Event{Type: EVENT_ORDER_FAILED})
+	assert.Len(s.T(), sink.texts, 1)
+}
+
+func (s *notifyTestSuite) TestTemplate() {
+	_, err := NewRoute(&fakeSink{}, nil, 0, "{{.Policy")
+	assert.NotNil(s.T(), err)
+
+	sink := &fakeSink{}
+	route, err := NewRoute(sink, nil, 0, "{{.Type}} pnl={{index .Fields \"pnl\"}}")
+	assert.Nil(s.T(), err)
+	d := NewDispatcher(route)
+	d.Start()
+	d.Notify(&Event{Type: EVENT_EXIT, Fields: map[string]interface{}{"pnl": 1.5}})
+	d.Close(time.Second)
+
+	assert.Equal(s.T(), []string{"exit pnl=1.5"}, sink.texts)
+}
+
+func (s *notifyTestSuite) TestRateLimit() {
+	l := newRateLimiter(2, time.Minute)
+	now := time.Now()
+	assert.True(s.T(), l.Allow(now))
+	assert.True(s.T(), l.Allow(now))
+	assert.False(s.T(), l.Allow(now))
+	assert.True(s.T(), l.Allow(now.Add(30*time.Second)))
+	assert.False(s.T(), l.Allow(now.Add(30*time.Second)))
+}
+
+func (s *notifyTestSuite) TestWebhookSink() {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(s.T(), json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink("hook", server.URL)
+	assert.Nil(s.T(), sink.Send("hello", &Event{Type: EVENT_ENTRY, Symbol: "ADAUSDT"}))
+	assert.Equal(s.T(), "hello", got["text"])
+	assert.Equal(s.T(), "ADAUSDT", got["symbol"])
+}
+
+func (s *notifyTestSuite) TestTelegramSinkMasksToken() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer server.Close()
+
+	sink := NewTelegramSink("tg", server.URL, "bot-secret", "42")
+	err := sink.Send("hello", &Event{})
+	assert.NotNil(s.T(), err)
+	assert.False(s.T(), strings.Contains(err.Error(), "bot-secret"))
+}
+
+func (s *notifyTestSuite) TestFileSink() {
+	dir, err := ioutil.TempDir("", "notify")
+	assert.Nil(s.T(), err)
+	path := filepath.Join(dir, "events.log")
+
+	sink := NewFileSink("file", path)
+	assert.Nil(s.T(), sink.Send("one", &Event{Type: EVENT_ENTRY}))
+	assert.Nil(s.T(), sink.Send("two", &Event{Type: EVENT_EXIT}))
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(s.T(), err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(s.T(), lines, 2)
+}
@@ -0,0 +1,187 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_TELEGRAM_API = "https://api.telegram.org"
+	HTTP_TIMEOUT         = 10 * time.Second
+)
+
+var httpClient = &http.Client{Timeout: HTTP_TIMEOUT}
+
+// WebhookSink posts events as json to a generic webhook
+type WebhookSink struct {
+	name string
+	url  string
+}
+
+// NewWebhookSink creates a webhook sink
+func NewWebhookSink(name, url string) *WebhookSink {
+	return &WebhookSink{name: name, url: url}
+}
+
+func (s *WebhookSink) Name() string {
+	return s.name
+}
+
+func (s *WebhookSink) Send(text string, e *Event) error {
+	body, err := json.Marshal(struct {
+		*Event
+		Text string `json:"text"`
+	}{e, text})
+	if err != nil {
+		return err
+	}
+
+	return post(s.url, "application/json", bytes.NewReader(body))
+}
+
+// TelegramSink sends messages with a telegram bot style http api
+type TelegramSink struct {
+	name   string
+	api    string
+	token  string
+	chatID string
+}
+
+// NewTelegramSink creates a telegram sink, empty api means DEFAULT_TELEGRAM_API
+func NewTelegramSink(name, api, token, chatID string) *TelegramSink {
+	if api == "" {
+		api = DEFAULT_TELEGRAM_API
+	}
+	return &TelegramSink{
+		name:   name,
+		api:    strings.TrimSuffix(api, "/"),
+		token:  token,
+		chatID: chatID,
+	}
+}
+
+func (s *TelegramSink) Name() string {
+	return s.name
+}
+
+func (s *TelegramSink) Send(text string, _ *Event) error {
+	form := url.Values{}
+	form.Set("chat_id", s.chatID)
+	form.Set("text", text)
+
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", s.api, s.token)
+	err := post(endpoint, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil && s.token != "" {
+		// Do not leak the bot token with the url
+		return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), s.token, "******"))
+	}
+	return err
+}
+
+// SMTPSink sends messages by email
+type SMTPSink struct {
+	name     string
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewSMTPSink creates an smtp sink, plain auth is used if username is set
+func NewSMTPSink(name, host string, port uint, username, password, from string, to []string) *SMTPSink {
+	return &SMTPSink{
+		name:     name,
+		addr:     net.JoinHostPort(host, strconv.Itoa(int(port))),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}
+}
+
+func (s *SMTPSink) Name() string {
+	return s.name
+}
+
+func (s *SMTPSink) Send(text string, e *Event) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	subject := strings.SplitN(text, "\n", 2)[0]
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		s.from, strings.Join(s.to, ", "), subject, e.Time.Format(time.RFC1123Z), text)
+
+	return smtp.SendMail(s.addr, auth, s.from, s.to, []byte(msg))
+}
+
+// FileSink appends events as json lines to a local file
+type FileSink struct {
+	name string
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileSink creates a file sink
+func NewFileSink(name, path string) *FileSink {
+	return &FileSink{name: name, path: path}
+}
+
+func (s *FileSink) Name() string {
+	return s.name
+}
+
+func (s *FileSink) Send(text string, e *Event) error {
+	line, err := json.Marshal(struct {
+		*Event
+		Text string `json:"text"`
+	}{e, text})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// post sends a http post request and checks the status code
+func post(endpoint, contentType string, body io.Reader) error {
+	res, err := httpClient.Post(endpoint, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("unexpected status %v: %s", res.Status, data)
+	}
+
+	return nil
+}
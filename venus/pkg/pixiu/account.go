@@ -2,11 +2,10 @@ package pixiu
 
 import (
 	"fmt"
-	"context"
-	"strconv"
 
 	"github.com/adshao/go-binance/v2"
 	glog "github.com/vjoke/falcon/pkg/log"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
 )
 
 var accntLog = glog.RegisterScope("account", "account", 0)
@@ -14,6 +13,7 @@ var accntLog = glog.RegisterScope("account", "account", 0)
 // Account hold info for an account
 type Account struct {
 	arb     *Arbitrager
+	log     *glog.Scope
 	client  *binance.Client
 }
 
@@ -21,7 +21,8 @@ type Account struct {
 func NewAccount(arb *Arbitrager) *Account {
 	a := &Account{
 		arb:     arb,
-		client:  binance.NewClient(arb.config.Exchange.ApiKey, arb.config.Exchange.SecretKey),
+		log:     accntLog.WithLabels("policy", arb.name),
+		client:  arb.shared.Client(arb.config.Exchange.ApiKey.Value(), arb.config.Exchange.SecretKey.Value()),
 	}
 	
 	return a
@@ -29,23 +30,40 @@ func NewAccount(arb *Arbitrager) *Account {
 
 // GetAccount gets account info from api server
 func (a *Account) GetAccount() (*binance.Account, error) {
-	account, err := a.client.NewGetAccountService().Do(context.Background())
+	ctx, cancel := a.arb.requestContext(model.OP_ACCOUNT)
+	defer cancel()
+	account, err := a.client.NewGetAccountService().Do(ctx)
+	a.arb.observeRequest(model.OP_ACCOUNT, err)
 	if err != nil {
+		accountRequests.With(a.arb.name, RESULT_FAILURE).Inc()
 		return nil, err
 	}
+	accountRequests.With(a.arb.name, RESULT_SUCCESS).Inc()
 
 	a.removeZeroBalances(account)
-	accntLog.Infof("%+v", account)
+	a.log.Infof("%+v", account)
+	for _, b := range account.Balances {
+		if free, locked, err := a.parseBalance(&b); err == nil {
+			balanceGauge.With(a.arb.name, b.Asset).Set(free.Add(locked).Float64())
+		}
+	}
 
 	return account, nil
 }
 
-// GetBalance gets balance for an asset
-func (a *Account) GetBalance(asset string) (float64, float64, error) {
+// GetBalance gets balance for an asset, from the user data stream if it is
+// synced
+func (a *Account) GetBalance(asset string) (model.Decimal, model.Decimal, error) {
+	if a.arb.stream != nil {
+		if free, locked, ok, err := a.arb.stream.Balance(asset); ok {
+			return free, locked, err
+		}
+	}
+
 	account, err := a.GetAccount()
 	if err != nil {
-		accntLog.Error(err)
-		return 0, 0, err
+		a.log.Error(err)
+		return model.Decimal{}, model.Decimal{}, err
 	}
 
 	for _, b := range account.Balances {
@@ -54,28 +72,35 @@ func (a *Account) GetBalance(asset string) (float64, float64, error) {
 		}
 	}
 
-	return 0, 0, fmt.Errorf("found no asset %v", asset)
+	return model.Decimal{}, model.Decimal{}, fmt.Errorf("found no asset %v", asset)
 }
 
-// GetBalanceMap gets balance map for all the non-zero asset
-func (a *Account) GetBalanceMap() (map[string]float64, error) {
-	m := make(map[string]float64)
+// GetBalanceMap gets balance map for all the non-zero asset, from the user
+// data stream if it is synced
+func (a *Account) GetBalanceMap() (map[string]model.Decimal, error) {
+	if a.arb.stream != nil {
+		if m, ok := a.arb.stream.BalanceMap(); ok {
+			return m, nil
+		}
+	}
+
+	m := make(map[string]model.Decimal)
 	account, err := a.GetAccount()
 	if err != nil {
-		accntLog.Error(err)
+		a.log.Error(err)
 		return m, err
 	}
 
 	for _, b := range account.Balances {
 		free, locked, err := a.parseBalance(&b)
 		if err != nil {
-			accntLog.Error(err)
+			a.log.Error(err)
 			continue
 		} 
-		m[b.Asset] = free + locked
+		m[b.Asset] = free.Add(locked)
 	}	
 
-	accntLog.Debugf("balance map is %v", m)
+	a.log.Debugf("balance map is %v", m)
 	return m, nil
 }
 
@@ -84,7 +109,7 @@ func (a *Account) removeZeroBalances(account *binance.Account) {
 	balances := make([]binance.Balance, 0, len(account.Balances))
 	for _, b := range account.Balances {
 		free, locked, err := a.parseBalance(&b)
-		if err == nil && (free + locked) > 0 {
+		if err == nil && free.Add(locked).Sign() > 0 {
 			balances = append(balances, b)
 		}
 	}
@@ -92,18 +117,18 @@ func (a *Account) removeZeroBalances(account *binance.Account) {
 	account.Balances = balances
 }
 
-// parseBalance converts string value to float value
-func (a *Account) parseBalance(b *binance.Balance)(float64, float64, error) {
-	free, err := strconv.ParseFloat(b.Free, 64)
+// parseBalance converts string value to decimal value
+func (a *Account) parseBalance(b *binance.Balance)(model.Decimal, model.Decimal, error) {
+	free, err := model.ParseDecimal(b.Free)
 	if err != nil {
-		accntLog.Errorf("Convert free balance %v error: %v", b.Free, err)
-		return 0, 0, err
+		a.log.Errorf("Convert free balance %v error: %v", b.Free, err)
+		return model.Decimal{}, model.Decimal{}, err
 	}
 
-	locked, err := strconv.ParseFloat(b.Locked, 64)
+	locked, err := model.ParseDecimal(b.Locked)
 	if err != nil {
-		accntLog.Errorf("Convert locked balance %v, error: %v", b.Locked, err)
-		return 0, 0, err
+		a.log.Errorf("Convert locked balance %v, error: %v", b.Locked, err)
+		return model.Decimal{}, model.Decimal{}, err
 	}
 
 	return free, locked, nil
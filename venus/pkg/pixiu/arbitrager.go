@@ -1,27 +1,58 @@
 package pixiu
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
 	glog "github.com/vjoke/falcon/pkg/log"
 	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/notify"
 	"github.com/vjoke/falcon/venus/pkg/plutus"
-	"github.com/adshao/go-binance/v2"
 )
 
 const (
 	TIME_FORMAT = "2006-01-02 15:04:05.000000"
+	DEFAULT_SHUTDOWN_TIMEOUT = 20 * time.Second
+	NOTIFY_FLUSH_TIMEOUT = 5 * time.Second
 )
 
 var aLog = glog.RegisterScope("arbitrager", "arbitrager", 0)
 
-// ArbitragerBuilder implements the builder for pixiu arbitrager
+var _ plutus.Supervised = &Arbitrager{}
+
+// ArbitragerBuilder implements the builder for pixiu arbitrager, all the
+// arbitragers built by the same builder share the exchange clients and the
+// risk budget
 type ArbitragerBuilder struct {
 	configFile string
+	shared *Shared
 }
 
 func NewBuilder() *ArbitragerBuilder {
-	return &ArbitragerBuilder{}
+	return &ArbitragerBuilder{
+		shared: NewShared(0),
+	}
 } 
 
+// WithMaxExposure sets the combined exposure in USDT of all the arbitragers,
+// it should be called before building any arbitrager
+func (ab *ArbitragerBuilder) WithMaxExposure(maxExposure float64) *ArbitragerBuilder {
+	clock := ab.shared.Clock()
+	ab.shared = NewShared(maxExposure)
+	ab.shared.SetClock(clock)
+	return ab
+}
+
+// WithClock sets the clock of all the arbitragers, e.g. a simulated clock
+// for replays, it should be called before building any arbitrager
+func (ab *ArbitragerBuilder) WithClock(clock Clock) *ArbitragerBuilder {
+	ab.shared.SetClock(clock)
+	return ab
+}
+
 // WithConfig sets the config file
 func (ab *ArbitragerBuilder) WithConfig(configFile string) plutus.ArbitragerBuilder {
 	ab.configFile = configFile
@@ -39,10 +70,11 @@ func (ab *ArbitragerBuilder) Build() (plutus.Arbitrager, error) {
 		return nil, err
 	}
 
-	a, err := NewArbitrager(conf)
+	a, err := NewArbitrager(conf, ab.shared)
 	if err != nil {
 		return nil, err
 	}
+	a.configFile = ab.configFile
 
 	return a, nil
 }
@@ -50,63 +82,318 @@ func (ab *ArbitragerBuilder) Build() (plutus.Arbitrager, error) {
 
 // Arbitrager defines components for arbitraging
 type Arbitrager struct {
+	name string
+	log *glog.Scope
+	shared *Shared
+	configFile string
+	configMu sync.RWMutex
 	config *model.Config
+	reloadMu sync.Mutex
 	exch *Exchange
 	account *Account
+	// stream is nil if the user data stream is disabled
+	stream *UserStream
+	orderBook *OrderBook
 	fetcher *Fetcher
 	oracle *Oracle
 	trader *Trader
-	priceChannel chan *model.SamplePrice
-	tradeChannel chan *model.Order
+	// triangular is nil unless the policy is in triangular mode
+	triangular *Triangular
+	bus *Bus
+	clock Clock
+	pendingMu sync.Mutex
+	pendingOrders map[string]struct{}
+	decisions *DecisionLog
+	paused *atomic.Bool
+	stopping *atomic.Bool
+	notifier *notify.Dispatcher
+	health *Health
+	panics *workerPanics
+	// ctx is canceled when the arbitrager is stopped
+	ctx context.Context
+	cancel context.CancelFunc
+	// orderCtx is canceled at the shutdown deadline, it is also the parent
+	// of the requests made by Stop
+	orderCtx context.Context
+	stopOrders context.CancelFunc
 }
 
-// NewArbitrager creates a new arbitrager instance
-func NewArbitrager(config *model.Config) (*Arbitrager, error) {
-	binance.UseTestnet = config.Policy.Testnet
-	aLog.Infof("has %v symbols, testnet: %v, dryrun: %v", len(config.Policy.Symbols), config.Policy.Testnet, config.Policy.Dryrun)
-	priceChannel := make(chan *model.SamplePrice, 20)
-	tradeChannel := make(chan *model.Order, 40)
+// NewArbitrager creates a new arbitrager instance with the shared resources
+func NewArbitrager(config *model.Config, shared *Shared) (*Arbitrager, error) {
+	a := newArbitrager(config, shared)
+	a.log.Infof("has %v symbols, testnet: %v, dryrun: %v", len(config.Policy.Symbols), config.Policy.Testnet, config.Policy.Dryrun)
 
-	a := &Arbitrager{
-		config: config,
-		priceChannel: priceChannel,
-		tradeChannel: tradeChannel,
+	notifier, err := NewNotifier(config.Notify)
+	if err != nil {
+		return nil, err
+	}
+	a.notifier = notifier
+
+	if err := shared.Register(a.name, config.Policy.Testnet, config.Exchange.BaseURL); err != nil {
+		return nil, err
+	}
+	if err := shared.Claim(a.name, config.Exchange.ApiKey.Value(), config.Policy.Symbols); err != nil {
+		shared.Unregister(a.name)
+		return nil, err
 	}
 
 	exch, err := NewExchange(a)
 	if err != nil {
+		shared.Unregister(a.name)
 		return nil, err
 	}
 
 	a.exch = exch
+	a.initComponents()
+
+	return a, nil
+}
+
+// newArbitrager creates an arbitrager without components
+func newArbitrager(config *model.Config, shared *Shared) *Arbitrager {
+	ctx, cancel := context.WithCancel(context.Background())
+	orderCtx, stopOrders := context.WithCancel(context.Background())
+
+	return &Arbitrager{
+		name: config.Policy.Name,
+		log: aLog.WithLabels("policy", config.Policy.Name),
+		shared: shared,
+		config: config,
+		bus: NewBus(config.Policy.Name, shared.Clock()),
+		clock: shared.Clock(),
+		pendingOrders: make(map[string]struct{}),
+		decisions: NewDecisionLog(100, shared.Clock()),
+		paused: atomic.NewBool(false),
+		stopping: atomic.NewBool(false),
+		notifier: notify.NewDispatcher(),
+		health: NewHealth(shared.Clock()),
+		panics: newWorkerPanics(),
+		ctx: ctx,
+		cancel: cancel,
+		orderCtx: orderCtx,
+		stopOrders: stopOrders,
+	}
+}
+
+// initComponents creates the components after the exchange is ready
+func (a *Arbitrager) initComponents() {
 	a.account = NewAccount(a)
+	if !a.config.Exchange.DisableUserStream {
+		a.stream = NewUserStream(a)
+	}
+	a.orderBook = NewOrderBook(a)
 	a.fetcher = NewFetcher(a)
 	a.oracle = NewOracle(a)
 	a.trader = NewTrader(a)
+	if a.config.Policy.Mode == model.MODE_TRIANGULAR {
+		// the trader is not run, its subscriptions would block publishers
+		a.trader.intents.Unsubscribe()
+		a.trader.executions.Unsubscribe()
+		a.triangular = NewTriangular(a)
+	}
+}
 
-	return a, nil
+// Name returns the name of the policy
+func (a *Arbitrager) Name() string {
+	return a.name
 }
 
+// Start starts the arbitrager with its workers
 func (a *Arbitrager) Start(stopCh <-chan struct{}) {
+	a.Prepare(stopCh)
+	for _, w := range a.Workers() {
+		go w.Run(stopCh)
+	}
+}
+
+// Prepare starts the arbitrager without its workers, which are run by a
+// supervisor
+func (a *Arbitrager) Prepare(stopCh <-chan struct{}) {
+	a.notifier.Start()
 	go func() {
-		a.account.GetAccount()
+		<-stopCh
+		a.cancel()
 	}()
-	go a.fetcher.Run(stopCh)
-	go a.oracle.Run(stopCh)
-	go a.trader.Run(stopCh)
+	go a.runHealthChecks(stopCh)
+	go a.runExchangeRefresh(stopCh)
+	if a.stream != nil {
+		go a.stream.Run(stopCh)
+	}
 }
 
+// Workers returns the fetcher, oracle and trader as workers, or the
+// triangular arbitrage in triangular mode. A worker returning before stop
+// is closed is a failure
+func (a *Arbitrager) Workers() []plutus.Worker {
+	worker := func(name string, run func(<-chan struct{}) error) plutus.Worker {
+		return plutus.Worker{
+			Name: name,
+			Run: func(stop <-chan struct{}) error {
+				err := run(stop)
+				select {
+				case <-stop:
+					return nil
+				default:
+					if err == nil {
+						err = fmt.Errorf("%v of %v exited unexpectedly", name, a.name)
+					}
+					return err
+				}
+			},
+		}
+	}
+	// loop adapts a worker which fails only by its own panic
+	loop := func(run func(<-chan struct{})) func(<-chan struct{}) error {
+		return func(stop <-chan struct{}) error {
+			run(stop)
+			return nil
+		}
+	}
+
+	if a.triangular != nil {
+		return []plutus.Worker{worker("triangular", loop(a.triangular.Run))}
+	}
+	return []plutus.Worker{
+		worker("fetcher", a.fetcher.Run),
+		worker("oracle", loop(a.oracle.Run)),
+		worker("trader", a.trader.Run),
+	}
+}
+
+// Stop shuts down the arbitrager gracefully, it should be called after the
+// stop channel is closed. New order intents are refused, queued ones are
+// dropped and in-flight orders are waited until the deadline, then the exit
+// policy is applied to positions and open orders.
 func (a *Arbitrager) Stop() {
-	// TODO:
+	if !a.stopping.CAS(false, true) {
+		return
+	}
+	defer glog.Sync()
+
+	timeout, exit := DEFAULT_SHUTDOWN_TIMEOUT, model.EXIT_LEAVE
+	if s := a.Conf().Policy.Shutdown; s != nil {
+		if s.Timeout.Duration > 0 {
+			timeout = s.Timeout.Duration
+		}
+		if s.Exit != "" {
+			exit = s.Exit
+		}
+	}
+	a.log.Infof("stopping with timeout %v and exit policy %v", timeout, exit)
+	deadline := time.Now().Add(timeout)
+	// orders still in flight at the deadline are canceled
+	cancelOrders := time.AfterFunc(timeout, a.stopOrders)
+	defer cancelOrders.Stop()
+
+	done, worker := a.trader.done, "trader"
+	if a.triangular != nil {
+		done, worker = a.triangular.done, "triangular"
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		a.log.Warnf("%v is still running after timeout", worker)
+	}
+	a.drainOrders()
+
+	if !a.trader.waitInflight(time.Until(deadline)) {
+		a.log.Warnf("in-flight orders are not completed in %v", timeout)
+	}
+
+	switch exit {
+	case model.EXIT_CANCEL:
+		if err := a.CancelOrders(nil); err != nil {
+			a.exitFailed(exit, err)
+		}
+	case model.EXIT_FLATTEN:
+		a.log.Warnf("flatten %v on exit", a.Conf().Policy.Symbols)
+		select {
+		case err := <-a.trader.processSellOrder(a.Conf().Policy.Symbols):
+			if err != nil {
+				a.exitFailed(exit, err)
+			}
+		case <-time.After(time.Until(deadline)):
+			a.exitFailed(exit, fmt.Errorf("sells are not completed in %v", timeout))
+		}
+	default:
+		a.log.Info("leave positions and open orders as they are")
+	}
+
+	a.stopOrders()
+	a.notifier.Close(NOTIFY_FLUSH_TIMEOUT)
+	a.log.Info("arbitrager is stopped")
 }
 
-// UpdatePrice updates latest price for a symbol
+// exitFailed reports an exit policy which failed at shutdown, positions or
+// open orders may be left on the exchange
+func (a *Arbitrager) exitFailed(exit string, err error) {
+	a.log.Errorf("%v on exit error: %v", exit, err)
+	a.notify(notify.EVENT_ORDER_FAILED, "", fmt.Sprintf("%v on exit failed, check the positions and open orders: %v", exit, err),
+		map[string]interface{}{"exit": exit})
+}
+
+// drainOrders drops all the queued order intents
+func (a *Arbitrager) drainOrders() {
+	for {
+		select {
+		case e := <-a.trader.intents.C():
+			a.trader.intents.received()
+			o := e.OrderIntent()
+			a.dequeueOrder(o)
+			a.log.Warnf("drop queued order %v on shutdown", o.Key())
+		default:
+			return
+		}
+	}
+}
+
+// UpdatePrice publishes the latest price of a symbol
 func (a *Arbitrager) UpdatePrice(sp *model.SamplePrice) {
-	a.priceChannel <- sp
+	a.publish(TOPIC_SAMPLE, sp)
+}
+
+// Bus returns the event bus of the arbitrager, observers subscribe to it
+// without being wired into the arbitrager
+func (a *Arbitrager) Bus() *Bus {
+	return a.bus
+}
+
+// publish publishes an event on the bus of the arbitrager
+func (a *Arbitrager) publish(topic Topic, payload interface{}) {
+	if err := a.bus.Publish(topic, payload); err != nil {
+		a.log.Error(err)
+	}
 }
 
 // CreateOrders creates buy orders when uptrend is predicted
 // creates sell orders when downtrend is predicted.
+// An order identical to one still queued is collapsed.
 func (a *Arbitrager) CreateOrders(o *model.Order) {
-	a.tradeChannel <- o
+	key := o.Key()
+	if a.stopping.Load() {
+		a.log.Warnf("arbitrager is stopping, order %v refused", key)
+		return
+	}
+	a.pendingMu.Lock()
+	if _, ok := a.pendingOrders[key]; ok {
+		a.pendingMu.Unlock()
+		a.log.Infof("order %v is still queued, collapsed", key)
+		return
+	}
+	a.pendingOrders[key] = struct{}{}
+	a.pendingMu.Unlock()
+
+	if err := a.bus.Publish(TOPIC_ORDER_INTENT, o); err != nil {
+		// the order is not queued, it should not collapse later ones
+		a.log.Errorf("order %v is not queued: %v", key, err)
+		a.dequeueOrder(o)
+	}
+}
+
+// dequeueOrder marks an order intent as taken by the trader
+func (a *Arbitrager) dequeueOrder(o *model.Order) {
+	a.pendingMu.Lock()
+	defer a.pendingMu.Unlock()
+
+	delete(a.pendingOrders, o.Key())
 }
\ No newline at end of file
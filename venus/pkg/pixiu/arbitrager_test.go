@@ -0,0 +1,458 @@
+package pixiu
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/notify"
+	"github.com/vjoke/falcon/venus/pkg/server"
+)
+
+type arbitragerTestSuite struct {
+	suite.Suite
+	arb *Arbitrager
+}
+
+func TestArbitrager(t *testing.T) {
+	suite.Run(t, new(arbitragerTestSuite))
+}
+
+func (a *arbitragerTestSuite) SetupTest() {
+	conf := newTestConfig()
+	conf.Policy.Shutdown = &model.Shutdown{Exit: model.EXIT_LEAVE}
+	a.arb = newTestArbitrager(conf, "ADAUSDT", "DOTUSDT")
+}
+
+func (a *arbitragerTestSuite) TestCollapseQueuedOrders() {
+	a.arb.CreateOrders(&model.Order{Type: model.BUY_ORDER, Symbols: []string{"ADAUSDT", "DOTUSDT"}})
+	a.arb.CreateOrders(&model.Order{Type: model.BUY_ORDER, Symbols: []string{"DOTUSDT", "ADAUSDT"}})
+	a.arb.CreateOrders(&model.Order{Type: model.SELL_ORDER, Symbols: []string{"ADAUSDT", "DOTUSDT"}})
+	assert.Equal(a.T(), 2, a.arb.trader.intents.Len())
+
+	a.arb.dequeueOrder((<-a.arb.trader.intents.C()).OrderIntent())
+	a.arb.CreateOrders(&model.Order{Type: model.BUY_ORDER, Symbols: []string{"ADAUSDT", "DOTUSDT"}})
+	assert.Equal(a.T(), 2, a.arb.trader.intents.Len())
+}
+
+func (a *arbitragerTestSuite) TestOrderNotQueued() {
+	// the intents are dropped without the trader
+	a.arb.trader.intents.Unsubscribe()
+	a.arb.bus.Subscribe(TOPIC_ORDER_INTENT, "test", 0, OVERFLOW_DROP_NEWEST)
+
+	order := &model.Order{Type: model.BUY_ORDER, Symbols: []string{"ADAUSDT"}}
+	a.arb.CreateOrders(order)
+	assert.Empty(a.T(), a.arb.pendingOrders)
+	a.arb.CreateOrders(order)
+	assert.Empty(a.T(), a.arb.pendingOrders)
+}
+
+func (a *arbitragerTestSuite) TestStop() {
+	stop := make(chan struct{})
+	go a.arb.trader.Run(stop)
+	close(stop)
+	<-a.arb.trader.done
+
+	a.arb.CreateOrders(&model.Order{Type: model.BUY_ORDER, Symbols: []string{"ADAUSDT"}})
+	assert.Equal(a.T(), 1, a.arb.trader.intents.Len())
+
+	done := make(chan struct{})
+	go func() {
+		a.arb.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		a.T().Fatal("arbitrager is not stopped in time")
+	}
+
+	assert.Equal(a.T(), 0, a.arb.trader.intents.Len())
+	assert.Empty(a.T(), a.arb.pendingOrders)
+
+	a.arb.CreateOrders(&model.Order{Type: model.BUY_ORDER, Symbols: []string{"ADAUSDT"}})
+	assert.Equal(a.T(), 0, a.arb.trader.intents.Len())
+}
+
+// newExitArbitrager creates an arbitrager of the mock exchange holding 50
+// ADA with the exit policy
+func (a *arbitragerTestSuite) newExitArbitrager(exit string, failures ...*mockexchange.Failure) (*Arbitrager, *mockexchange.Exchange, func()) {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	script.Balances["ADA"] = 50
+	script.Failures = failures
+	exchange := mockexchange.New(script)
+	server := httptest.NewServer(exchange)
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	conf.Exchange.DisableUserStream = true
+	conf.Policy.Dryrun = false
+	conf.Policy.Shutdown = &model.Shutdown{Exit: exit, Timeout: model.Duration{Duration: 2 * time.Second}}
+	arb, err := NewArbitrager(conf, NewShared(0))
+	a.Require().NoError(err)
+	return arb, exchange, server.Close
+}
+
+// stop stops an arbitrager like the supervisor, the stop channel is closed
+// before Stop is called
+func (a *arbitragerTestSuite) stop(arb *Arbitrager) {
+	stop := make(chan struct{})
+	arb.Prepare(stop)
+	go arb.trader.Run(stop)
+	close(stop)
+	<-arb.ctx.Done()
+	arb.Stop()
+}
+
+// exitEvents records the notifications of the failed exit policy
+func (a *arbitragerTestSuite) exitEvents(arb *Arbitrager) func() []*notify.Event {
+	sink := &riskSink{}
+	route, err := notify.NewRoute(sink, []string{notify.EVENT_ORDER_FAILED}, 0, "")
+	a.Require().NoError(err)
+	arb.notifier = notify.NewDispatcher(route)
+
+	return func() []*notify.Event {
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		var events []*notify.Event
+		for _, e := range sink.events {
+			if _, ok := e.Fields["exit"]; ok {
+				events = append(events, e)
+			}
+		}
+		return events
+	}
+}
+
+func (a *arbitragerTestSuite) TestExitCancel() {
+	arb, exchange, stop := a.newExitArbitrager(model.EXIT_CANCEL)
+	defer stop()
+	events := a.exitEvents(arb)
+
+	_, err := arb.trader.client.NewCreateOrderService().Symbol("ADAUSDT").
+		Side(binance.SideTypeSell).Type(binance.OrderTypeLimit).TimeInForce(binance.TimeInForceTypeGTC).
+		Quantity("50").Price("2").Do(context.Background())
+	a.Require().NoError(err)
+	_, locked := exchange.Balance("ADA")
+	assert.Equal(a.T(), 50.0, locked)
+
+	a.stop(arb)
+	free, locked := exchange.Balance("ADA")
+	assert.Equal(a.T(), 50.0, free)
+	assert.Zero(a.T(), locked)
+	assert.Empty(a.T(), events())
+
+	// the failed cancel is notified
+	arb, _, stop = a.newExitArbitrager(model.EXIT_CANCEL, &mockexchange.Failure{
+		Method: http.MethodDelete, Path: "/api/v3/openOrders", Status: http.StatusInternalServerError,
+	})
+	defer stop()
+	events = a.exitEvents(arb)
+	a.stop(arb)
+	if assert.Len(a.T(), events(), 1) {
+		assert.Equal(a.T(), model.EXIT_CANCEL, events()[0].Fields["exit"])
+	}
+}
+
+func (a *arbitragerTestSuite) TestExitFlatten() {
+	arb, exchange, stop := a.newExitArbitrager(model.EXIT_FLATTEN)
+	defer stop()
+	events := a.exitEvents(arb)
+
+	a.stop(arb)
+	free, locked := exchange.Balance("ADA")
+	assert.Zero(a.T(), free)
+	assert.Zero(a.T(), locked)
+	assert.Empty(a.T(), events())
+
+	// the rejected sell is notified
+	arb, exchange, stop = a.newExitArbitrager(model.EXIT_FLATTEN, &mockexchange.Failure{
+		Method: http.MethodPost, Path: "/api/v3/order", Status: http.StatusBadRequest,
+		Code: -2010, Msg: "Account has insufficient balance for requested action.",
+	})
+	defer stop()
+	events = a.exitEvents(arb)
+	a.stop(arb)
+	free, _ = exchange.Balance("ADA")
+	assert.Equal(a.T(), 50.0, free)
+	if assert.Len(a.T(), events(), 1) {
+		e := events()[0]
+		assert.Equal(a.T(), model.EXIT_FLATTEN, e.Fields["exit"])
+		assert.Contains(a.T(), e.Message, "ADAUSDT")
+	}
+}
+
+func (a *arbitragerTestSuite) TestControlErrors() {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	script.Balances["ADA"] = 50
+	// the first sell is rejected
+	script.Failures = []*mockexchange.Failure{{
+		Method: http.MethodPost, Path: "/api/v3/order", Status: http.StatusBadRequest,
+		Code: -1013, Msg: "Filter failure: LOT_SIZE", Count: 1,
+	}}
+	exchange := mockexchange.New(script)
+	server := httptest.NewServer(exchange)
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	conf.Exchange.DisableUserStream = true
+	arb, err := NewArbitrager(conf, NewShared(0))
+	a.Require().NoError(err)
+
+	// symbols without open orders are not errors
+	assert.NoError(a.T(), arb.CancelOrders(nil))
+	err = arb.CancelOrders([]string{"ADAUSDT", "XRPUSDT"})
+	if assert.Error(a.T(), err) {
+		assert.Contains(a.T(), err.Error(), "[XRPUSDT] are not in policy")
+	}
+
+	err = arb.Flatten([]string{"ADAUSDT"})
+	if assert.Error(a.T(), err) {
+		assert.Contains(a.T(), err.Error(), "ADAUSDT: <APIError> code=-1013")
+	}
+	free, _ := exchange.Balance("ADA")
+	assert.Equal(a.T(), 50.0, free)
+
+	assert.NoError(a.T(), arb.Flatten([]string{"ADAUSDT"}))
+	free, _ = exchange.Balance("ADA")
+	assert.Zero(a.T(), free)
+}
+
+func (a *arbitragerTestSuite) TestSpawnedPanic() {
+	workers := a.arb.Workers()
+	a.Require().Equal("trader", workers[2].Name)
+
+	inst := server.New()
+	inst.RunSupervised("trader", &server.RestartOptions{
+		Policy: server.RESTART_ON_FAILURE, Backoff: time.Millisecond, MaxBackoff: time.Millisecond,
+	}, workers[2].Run)
+	stop := make(chan struct{})
+	a.Require().NoError(inst.Start(stop))
+	a.Require().Eventually(func() bool {
+		return inst.Status()[0].State == server.STATE_RUNNING
+	}, time.Second, time.Millisecond)
+
+	// a panic of a goroutine of the trader fails it instead of the process
+	a.arb.spawn("trader", func() { panic("boom") })
+	a.Require().Eventually(func() bool {
+		status := inst.Status()[0]
+		return status.Restarts == 1 && status.State == server.STATE_RUNNING
+	}, time.Second, time.Millisecond)
+	assert.Equal(a.T(), "panic in goroutine of trader: boom", inst.Status()[0].LastError)
+
+	close(stop)
+	<-a.arb.trader.done
+}
+
+func (a *arbitragerTestSuite) TestSimClockPipeline() {
+	exchange := mockexchange.New(mockexchange.DefaultScript("ADAUSDT", "DOTUSDT"))
+	server := httptest.NewServer(exchange)
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	conf.Exchange.DisableUserStream = true
+	conf.Policy.Dryrun = false
+	shared := NewShared(0)
+	start := time.Date(2021, 3, 1, 8, 0, 0, 0, time.UTC)
+	clock := NewSimClock(start)
+	shared.SetClock(clock)
+	arb, err := NewArbitrager(conf, shared)
+	a.Require().NoError(err)
+	a.Require().NoError(shared.TimeSync().Sync(context.Background(), arb.trader.client, true))
+	fills := arb.bus.Subscribe(TOPIC_FILL, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go arb.fetcher.Run(stop)
+	go arb.oracle.Run(stop)
+	go arb.trader.Run(stop)
+	// the fetcher waits for its sampling and heartbeat tickers, the oracle
+	// and the trader for their heartbeat tickers
+	a.Require().Eventually(func() bool { return clock.Waiters() == 4 }, time.Second, time.Millisecond)
+
+	// ADAUSDT rises for the 3 ticks of the window, DOTUSDT is bought
+	for tick := uint64(1); tick <= 3; tick++ {
+		exchange.SetPrice("ADAUSDT", 1+float64(tick)/100)
+		clock.Advance(time.Minute)
+		a.Require().Eventually(func() bool {
+			arb.oracle.mu.Lock()
+			defer arb.oracle.mu.Unlock()
+			return arb.oracle.tick == tick && arb.oracle.tickCount == 2
+		}, time.Second, time.Millisecond, "tick %v", tick)
+	}
+
+	decisions := arb.Decisions().([]*Decision)
+	a.Require().Len(decisions, 1)
+	assert.Equal(a.T(), DECISION_BUY, decisions[0].Action)
+	assert.Equal(a.T(), []string{"DOTUSDT"}, decisions[0].Symbols)
+	assert.Equal(a.T(), start.Add(3*time.Minute).Format(TIME_FORMAT), decisions[0].Time)
+
+	a.Require().Eventually(func() bool { return fills.Len() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(a.T(), "DOTUSDT", (<-fills.C()).Fill().Symbol)
+	position, ok := arb.trader.book.Get("DOTUSDT")
+	a.Require().True(ok)
+	assert.Equal(a.T(), start.Add(3*time.Minute), position.Time)
+}
+
+// newTimeoutArbitrager creates an arbitrager of a mock exchange whose order
+// requests time out after 100ms
+func (a *arbitragerTestSuite) TestFetchLatency() {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	// the second request of the price times out
+	script.Failures = []*mockexchange.Failure{{
+		Method: http.MethodGet, Path: "/api/v3/avgPrice", Delay: model.Duration{Duration: time.Second}, After: 1, Count: 1,
+	}}
+	server := httptest.NewServer(mockexchange.New(script))
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	conf.Exchange.DisableUserStream = true
+	conf.Exchange.Timeouts = &model.Timeouts{MarketData: model.Duration{Duration: 100 * time.Millisecond}}
+	conf.Policy.Sample.PriceMode = model.AVERAGE_PRICE
+	arb, err := NewArbitrager(conf, NewShared(0))
+	a.Require().NoError(err)
+
+	success := fetchLatency.With(arb.name, "ADAUSDT", RESULT_SUCCESS)
+	failure := fetchLatency.With(arb.name, "ADAUSDT", RESULT_FAILURE)
+	succeeded, failed := success.Count(), failure.Count()
+	arb.fetcher.queryPrice("ADAUSDT", model.AVERAGE_PRICE, 1)
+	arb.fetcher.queryPrice("ADAUSDT", model.AVERAGE_PRICE, 2)
+	assert.Equal(a.T(), succeeded+1, success.Count())
+	assert.Equal(a.T(), failed+1, failure.Count())
+}
+
+func (a *arbitragerTestSuite) TestHealthChecks() {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	// the account is not accessible at the first check
+	script.Failures = []*mockexchange.Failure{{
+		Method: http.MethodGet, Path: "/api/v3/account", Status: http.StatusInternalServerError,
+		Code: -1000, Msg: "internal error", Count: 1,
+	}}
+	server := httptest.NewServer(mockexchange.New(script))
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	conf.Exchange.DisableUserStream = true
+	shared := NewShared(0)
+	clock := NewSimClock(time.Now())
+	shared.SetClock(clock)
+	arb, err := NewArbitrager(conf, shared)
+	a.Require().NoError(err)
+
+	accountErr := func() string {
+		if err := arb.health.Ready(time.Hour); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go arb.runHealthChecks(stop)
+	a.Require().Eventually(func() bool { return strings.Contains(accountErr(), "internal error") }, time.Second, time.Millisecond)
+
+	// the next check is driven by the clock
+	a.Require().Eventually(func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+	clock.Advance(HEALTH_CHECK_INTERVAL)
+	a.Require().Eventually(func() bool { return !strings.Contains(accountErr(), "account") }, time.Second, time.Millisecond)
+}
+
+func (a *arbitragerTestSuite) newTimeoutArbitrager(failures ...*mockexchange.Failure) (*Arbitrager, *mockexchange.Exchange, func()) {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	script.Failures = failures
+	exchange := mockexchange.New(script)
+	server := httptest.NewServer(exchange)
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	conf.Exchange.DisableUserStream = true
+	conf.Exchange.Timeouts = &model.Timeouts{Order: model.Duration{Duration: 100 * time.Millisecond}}
+	conf.Policy.Dryrun = false
+	conf.Policy.Trade.Fee = mockexchange.DEFAULT_FEE
+	arb, err := NewArbitrager(conf, NewShared(0))
+	a.Require().NoError(err)
+	return arb, exchange, server.Close
+}
+
+// buy buys ADAUSDT for 12 USDT reserved in the risk budget
+func (a *arbitragerTestSuite) buy(arb *Arbitrager) {
+	a.Require().True(arb.shared.Budget().Reserve(arb.name, "ADAUSDT", dec("12")))
+	arb.trader.inflight.Add(1)
+	arb.trader.buyOrder("ADAUSDT", dec("12"))
+}
+
+func (a *arbitragerTestSuite) TestBuyInFlight() {
+	// the buy is executed after 300ms
+	arb, exchange, stop := a.newTimeoutArbitrager(&mockexchange.Failure{
+		Method: http.MethodPost, Path: "/api/v3/order", Delay: model.Duration{Duration: 300 * time.Millisecond}, Count: 1,
+	})
+	defer stop()
+	arb.config.Exchange.Timeouts.Order = model.Duration{Duration: time.Second}
+	a.Require().NoError(arb.shared.TimeSync().Sync(context.Background(), arb.trader.client, true))
+
+	arb.trader.processBuyOrder([]string{"ADAUSDT"})
+	a.Require().True(arb.trader.isBuying("ADAUSDT"))
+	// the symbol without position is neither bought again nor released
+	arb.trader.processBuyOrder([]string{"ADAUSDT"})
+	assert.Empty(a.T(), arb.trader.filterOpenPositions([]string{"ADAUSDT"}, nil))
+	assert.Equal(a.T(), dec("12"), arb.shared.Budget().Exposure(arb.name))
+
+	a.Require().True(arb.trader.waitInflight(2 * time.Second))
+	assert.False(a.T(), arb.trader.isBuying("ADAUSDT"))
+	_, ok := arb.trader.book.Get("ADAUSDT")
+	assert.True(a.T(), ok)
+	free, _ := exchange.Balance("USDT")
+	assert.Equal(a.T(), 988.0, free)
+	assert.Equal(a.T(), dec("12"), arb.shared.Budget().Exposure(arb.name))
+}
+
+func (a *arbitragerTestSuite) TestBuyTimeout() {
+	// the buy is executed but its response times out
+	late := &mockexchange.Failure{
+		Method: http.MethodPost, Path: "/api/v3/order", Delay: model.Duration{Duration: time.Second}, Late: true, Count: 1,
+	}
+	arb, exchange, stop := a.newTimeoutArbitrager(late)
+	fills := arb.bus.Subscribe(TOPIC_FILL, "test", 10, OVERFLOW_DROP_NEWEST)
+	a.buy(arb)
+	position, ok := arb.trader.book.Get("ADAUSDT")
+	a.Require().True(ok)
+	assert.Equal(a.T(), dec("1"), position.Price)
+	assert.Equal(a.T(), dec("11.988"), position.Quantity)
+	assert.Equal(a.T(), 1, fills.Len())
+	assert.Equal(a.T(), dec("12"), arb.shared.Budget().Exposure(arb.name))
+	// the position is protected by the oco order
+	_, locked := exchange.Balance("ADA")
+	assert.InDelta(a.T(), 11.9, locked, 1e-9)
+	stop()
+
+	// the buy times out before it is executed
+	arb, _, stop = a.newTimeoutArbitrager(&mockexchange.Failure{
+		Method: http.MethodPost, Path: "/api/v3/order", Delay: model.Duration{Duration: time.Second}, Count: 1,
+	})
+	a.buy(arb)
+	_, ok = arb.trader.book.Get("ADAUSDT")
+	assert.False(a.T(), ok)
+	assert.True(a.T(), arb.shared.Budget().Exposure(arb.name).IsZero())
+	stop()
+
+	// the order can not be queried, the reservation is kept
+	arb, _, stop = a.newTimeoutArbitrager(late, &mockexchange.Failure{
+		Method: http.MethodGet, Path: "/api/v3/order", Status: http.StatusInternalServerError,
+	})
+	defer stop()
+	a.buy(arb)
+	_, ok = arb.trader.book.Get("ADAUSDT")
+	assert.False(a.T(), ok)
+	assert.Equal(a.T(), dec("12"), arb.shared.Budget().Exposure(arb.name))
+}
@@ -0,0 +1,317 @@
+package pixiu
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+// Topic defines a topic of the event bus, the payload of each topic has a
+// fixed type
+type Topic string
+
+const (
+	// TOPIC_SAMPLE carries *model.SamplePrice from the fetcher
+	TOPIC_SAMPLE Topic = "sample"
+	// TOPIC_SIGNAL carries *Decision from the oracle
+	TOPIC_SIGNAL Topic = "signal"
+	// TOPIC_ORDER_INTENT carries *model.Order to the trader
+	TOPIC_ORDER_INTENT Topic = "order_intent"
+	// TOPIC_ORDER_RESULT carries *OrderResult of each order request
+	TOPIC_ORDER_RESULT Topic = "order_result"
+	// TOPIC_FILL carries *Fill of filled market orders
+	TOPIC_FILL Topic = "fill"
+	// TOPIC_POSITION carries *PositionChange when positions are opened or
+	// closed
+	TOPIC_POSITION Topic = "position"
+	// TOPIC_SYMBOL_STATUS carries *SymbolStatus when a symbol stops or
+	// resumes trading on the exchange
+	TOPIC_SYMBOL_STATUS Topic = "symbol_status"
+	// TOPIC_EXECUTION carries *ExecutionReport of the orders of the policy
+	// from the user data stream
+	TOPIC_EXECUTION Topic = "execution"
+)
+
+const (
+	// SAMPLE_BUFFER is the buffer of samples for the oracle, the oldest
+	// samples are dropped so a slow oracle does not block the fetcher
+	SAMPLE_BUFFER = 20
+	// ORDER_INTENT_BUFFER is the buffer of order intents for the trader,
+	// intents are never dropped
+	ORDER_INTENT_BUFFER = 40
+)
+
+var topicTypes = map[Topic]reflect.Type{
+	TOPIC_SAMPLE:        reflect.TypeOf(&model.SamplePrice{}),
+	TOPIC_SIGNAL:        reflect.TypeOf(&Decision{}),
+	TOPIC_ORDER_INTENT:  reflect.TypeOf(&model.Order{}),
+	TOPIC_ORDER_RESULT:  reflect.TypeOf(&OrderResult{}),
+	TOPIC_FILL:          reflect.TypeOf(&Fill{}),
+	TOPIC_POSITION:      reflect.TypeOf(&PositionChange{}),
+	TOPIC_SYMBOL_STATUS: reflect.TypeOf(&SymbolStatus{}),
+	TOPIC_EXECUTION:     reflect.TypeOf(&ExecutionReport{}),
+}
+
+// Overflow defines what happens when the buffer of a subscriber is full
+type Overflow string
+
+const (
+	// OVERFLOW_BLOCK blocks the publisher until there is room, it is for
+	// subscribers which must not miss events
+	OVERFLOW_BLOCK Overflow = "block"
+	// OVERFLOW_DROP_OLDEST drops the oldest buffered event
+	OVERFLOW_DROP_OLDEST Overflow = "drop_oldest"
+	// OVERFLOW_DROP_NEWEST drops the published event
+	OVERFLOW_DROP_NEWEST Overflow = "drop_newest"
+)
+
+// OrderResult defines the result of an order request
+type OrderResult struct {
+	Symbol  string `json:"symbol"`
+	Side    string `json:"side"`
+	OrderID int64  `json:"order_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Fill defines a filled market order
+type Fill struct {
+	Symbol   string        `json:"symbol"`
+	Side     string        `json:"side"`
+	OrderID  int64         `json:"order_id"`
+	Price    model.Decimal `json:"price"`
+	Quantity model.Decimal `json:"quantity"`
+}
+
+// PositionChange defines a change of a position in the position book
+type PositionChange struct {
+	Symbol string `json:"symbol"`
+	// Quantity is the quantity held after the change
+	Quantity model.Decimal `json:"quantity"`
+	// Price is the average entry price
+	Price model.Decimal `json:"price"`
+	// Pnl is the realized profit and loss of a close, nil if it is not a
+	// close
+	Pnl *model.Decimal `json:"pnl,omitempty"`
+}
+
+// Event defines an event published on the bus
+type Event struct {
+	Topic   Topic
+	Policy  string
+	Time    time.Time
+	Payload interface{}
+}
+
+// Sample returns the payload of a TOPIC_SAMPLE event
+func (e *Event) Sample() *model.SamplePrice {
+	sp, _ := e.Payload.(*model.SamplePrice)
+	return sp
+}
+
+// Signal returns the payload of a TOPIC_SIGNAL event
+func (e *Event) Signal() *Decision {
+	d, _ := e.Payload.(*Decision)
+	return d
+}
+
+// OrderIntent returns the payload of a TOPIC_ORDER_INTENT event
+func (e *Event) OrderIntent() *model.Order {
+	o, _ := e.Payload.(*model.Order)
+	return o
+}
+
+// OrderResult returns the payload of a TOPIC_ORDER_RESULT event
+func (e *Event) OrderResult() *OrderResult {
+	r, _ := e.Payload.(*OrderResult)
+	return r
+}
+
+// Fill returns the payload of a TOPIC_FILL event
+func (e *Event) Fill() *Fill {
+	f, _ := e.Payload.(*Fill)
+	return f
+}
+
+// PositionChange returns the payload of a TOPIC_POSITION event
+func (e *Event) PositionChange() *PositionChange {
+	p, _ := e.Payload.(*PositionChange)
+	return p
+}
+
+// SymbolStatus returns the payload of a TOPIC_SYMBOL_STATUS event
+func (e *Event) SymbolStatus() *SymbolStatus {
+	st, _ := e.Payload.(*SymbolStatus)
+	return st
+}
+
+// Execution returns the payload of a TOPIC_EXECUTION event
+func (e *Event) Execution() *ExecutionReport {
+	r, _ := e.Payload.(*ExecutionReport)
+	return r
+}
+
+// Subscription receives the events of a topic
+type Subscription struct {
+	bus      *Bus
+	topic    Topic
+	name     string
+	overflow Overflow
+	ch       chan *Event
+	done     chan struct{}
+	once     sync.Once
+}
+
+// C returns the channel of events, it is not closed on unsubscribe
+func (s *Subscription) C() <-chan *Event {
+	return s.ch
+}
+
+// Len returns the number of buffered events
+func (s *Subscription) Len() int {
+	return len(s.ch)
+}
+
+// Unsubscribe removes the subscription from the bus, blocked publishers are
+// released
+func (s *Subscription) Unsubscribe() {
+	s.bus.unsubscribe(s)
+}
+
+// received updates the backlog after an event is taken from the channel
+func (s *Subscription) received() {
+	busBacklog.With(s.bus.policy, string(s.topic), s.name).Set(float64(len(s.ch)))
+}
+
+// Next waits for the next event until stop is closed, ok is false then
+func (s *Subscription) Next(stopCh <-chan struct{}) (*Event, bool) {
+	select {
+	case <-stopCh:
+		return nil, false
+	case e := <-s.ch:
+		s.received()
+		return e, true
+	}
+}
+
+// deliver sends an event by the overflow policy, false is returned if the
+// event is dropped or the subscription is closed
+func (s *Subscription) deliver(e *Event) bool {
+	labels := []string{s.bus.policy, string(s.topic), s.name}
+	defer func() {
+		busBacklog.With(labels...).Set(float64(len(s.ch)))
+	}()
+
+	select {
+	case s.ch <- e:
+		return true
+	case <-s.done:
+		return false
+	default:
+	}
+
+	switch s.overflow {
+	case OVERFLOW_BLOCK:
+		select {
+		case s.ch <- e:
+			return true
+		case <-s.done:
+			return false
+		}
+	case OVERFLOW_DROP_NEWEST:
+		busDropped.With(labels...).Inc()
+		return false
+	default:
+		for {
+			select {
+			case s.ch <- e:
+				return true
+			default:
+			}
+			select {
+			case <-s.ch:
+				busDropped.With(labels...).Inc()
+			default:
+			}
+		}
+	}
+}
+
+// Bus is an in-process pub/sub of the events of a policy, each subscriber
+// has its own buffer so a slow subscriber only affects publishers by its
+// overflow policy
+type Bus struct {
+	policy string
+	clock  Clock
+	mu     sync.RWMutex
+	subs   map[Topic][]*Subscription
+}
+
+// NewBus creates a bus for a policy, events are stamped by the clock
+func NewBus(policy string, clock Clock) *Bus {
+	return &Bus{
+		policy: policy,
+		clock:  clock,
+		subs:   make(map[Topic][]*Subscription),
+	}
+}
+
+// Subscribe subscribes to a topic with a buffer of size events
+func (b *Bus) Subscribe(topic Topic, name string, size int, overflow Overflow) *Subscription {
+	s := &Subscription{
+		bus:      b,
+		topic:    topic,
+		name:     name,
+		overflow: overflow,
+		ch:       make(chan *Event, size),
+		done:     make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[topic] = append(b.subs[topic], s)
+	return s
+}
+
+func (b *Bus) unsubscribe(s *Subscription) {
+	s.once.Do(func() { close(s.done) })
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := b.subs[s.topic]
+	for i, sub := range subs {
+		if sub == s {
+			b.subs[s.topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	busBacklog.Delete(b.policy, string(s.topic), s.name)
+}
+
+// Publish publishes a payload to the subscribers of a topic, the payload
+// must be of the type of the topic. An error is returned if a subscriber
+// drops the event or is closed, the others still receive it
+func (b *Bus) Publish(topic Topic, payload interface{}) error {
+	if t, ok := topicTypes[topic]; !ok || reflect.TypeOf(payload) != t {
+		return fmt.Errorf("invalid payload %T for topic %v", payload, topic)
+	}
+
+	b.mu.RLock()
+	subs := b.subs[topic]
+	b.mu.RUnlock()
+
+	busPublished.With(b.policy, string(topic)).Inc()
+	e := &Event{Topic: topic, Policy: b.policy, Time: b.clock.Now(), Payload: payload}
+	var dropped []string
+	for _, s := range subs {
+		if !s.deliver(e) {
+			dropped = append(dropped, s.name)
+		}
+	}
+	if len(dropped) > 0 {
+		return fmt.Errorf("event of topic %v is not delivered to %v", topic, dropped)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package pixiu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+type busTestSuite struct {
+	suite.Suite
+	bus *Bus
+}
+
+func TestBus(t *testing.T) {
+	suite.Run(t, new(busTestSuite))
+}
+
+func (b *busTestSuite) SetupTest() {
+	b.bus = NewBus("test", NewRealClock())
+}
+
+func sample(tick uint64) *model.SamplePrice {
+	return &model.SamplePrice{Symbol: "ADAUSDT", Tick: tick}
+}
+
+func (b *busTestSuite) TestSubscribers() {
+	s1 := b.bus.Subscribe(TOPIC_SAMPLE, "s1", 2, OVERFLOW_DROP_OLDEST)
+	s2 := b.bus.Subscribe(TOPIC_SAMPLE, "s2", 2, OVERFLOW_DROP_NEWEST)
+	other := b.bus.Subscribe(TOPIC_SIGNAL, "other", 2, OVERFLOW_DROP_NEWEST)
+
+	for tick := uint64(1); tick <= 2; tick++ {
+		assert.NoError(b.T(), b.bus.Publish(TOPIC_SAMPLE, sample(tick)))
+	}
+	// s2 drops the newest sample, s1 still receives it
+	assert.Error(b.T(), b.bus.Publish(TOPIC_SAMPLE, sample(3)))
+	assert.Equal(b.T(), 0, other.Len())
+
+	stop := make(chan struct{})
+	e, ok := s1.Next(stop)
+	assert.True(b.T(), ok)
+	assert.Equal(b.T(), "test", e.Policy)
+	assert.Equal(b.T(), uint64(2), e.Sample().Tick)
+	e, _ = s1.Next(stop)
+	assert.Equal(b.T(), uint64(3), e.Sample().Tick)
+
+	e, _ = s2.Next(stop)
+	assert.Equal(b.T(), uint64(1), e.Sample().Tick)
+	e, _ = s2.Next(stop)
+	assert.Equal(b.T(), uint64(2), e.Sample().Tick)
+
+	close(stop)
+	_, ok = s2.Next(stop)
+	assert.False(b.T(), ok)
+}
+
+func (b *busTestSuite) TestBlock() {
+	s := b.bus.Subscribe(TOPIC_ORDER_INTENT, "trader", 1, OVERFLOW_BLOCK)
+	assert.NoError(b.T(), b.bus.Publish(TOPIC_ORDER_INTENT, &model.Order{Type: model.BUY_ORDER}))
+
+	published := make(chan struct{})
+	go func() {
+		b.bus.Publish(TOPIC_ORDER_INTENT, &model.Order{Type: model.SELL_ORDER})
+		close(published)
+	}()
+	select {
+	case <-published:
+		b.T().Fatal("publisher is not blocked")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	e := <-s.C()
+	assert.Equal(b.T(), model.BUY_ORDER, e.OrderIntent().Type)
+	<-published
+	e = <-s.C()
+	assert.Equal(b.T(), model.SELL_ORDER, e.OrderIntent().Type)
+
+	// unsubscribe releases blocked publishers
+	assert.NoError(b.T(), b.bus.Publish(TOPIC_ORDER_INTENT, &model.Order{Type: model.BUY_ORDER}))
+	published = make(chan struct{})
+	go func() {
+		b.bus.Publish(TOPIC_ORDER_INTENT, &model.Order{Type: model.SELL_ORDER})
+		close(published)
+	}()
+	s.Unsubscribe()
+	<-published
+	assert.NoError(b.T(), b.bus.Publish(TOPIC_ORDER_INTENT, &model.Order{Type: model.BUY_ORDER}))
+}
+
+func (b *busTestSuite) TestPayloadType() {
+	assert.Error(b.T(), b.bus.Publish(TOPIC_SAMPLE, &model.Order{}))
+	assert.Error(b.T(), b.bus.Publish(Topic("unknown"), sample(1)))
+	assert.NoError(b.T(), b.bus.Publish(TOPIC_FILL, &Fill{Symbol: "ADAUSDT"}))
+}
@@ -0,0 +1,269 @@
+package pixiu
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock provides the time of the trading logic: sampling ticks, heartbeats,
+// trading spans, cooldowns and timestamps. Timing against the exchange,
+// i.e. rate limits, time sync, request timeouts and shutdown deadlines,
+// always uses the wall clock.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock is the wall clock
+type RealClock struct{}
+
+// NewRealClock creates a wall clock
+func NewRealClock() Clock {
+	return RealClock{}
+}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) Since(t time.Time) time.Duration {
+	return time.Since(t)
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{t: time.NewTicker(d)}
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t *realTicker) Stop() {
+	t.t.Stop()
+}
+
+// AcceleratedClock runs factor times faster than the wall clock from a
+// start time, it replays time dependent behaviour faster than real time.
+// The times delivered on the channels are times of the clock.
+type AcceleratedClock struct {
+	start  time.Time
+	origin time.Time
+	factor float64
+}
+
+// NewAcceleratedClock creates a clock starting at start and running factor
+// times faster than the wall clock
+func NewAcceleratedClock(start time.Time, factor float64) *AcceleratedClock {
+	if factor <= 0 {
+		factor = 1
+	}
+	return &AcceleratedClock{
+		start:  start,
+		origin: time.Now(),
+		factor: factor,
+	}
+}
+
+func (c *AcceleratedClock) Now() time.Time {
+	return c.at(time.Now())
+}
+
+func (c *AcceleratedClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *AcceleratedClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	time.AfterFunc(c.real(d), func() {
+		ch <- c.Now()
+	})
+	return ch
+}
+
+func (c *AcceleratedClock) NewTicker(d time.Duration) Ticker {
+	t := &acceleratedTicker{
+		t:    time.NewTicker(c.real(d)),
+		ch:   make(chan time.Time, 1),
+		done: make(chan struct{}),
+	}
+	go func() {
+		for {
+			select {
+			case <-t.done:
+				return
+			case now := <-t.t.C:
+				select {
+				case t.ch <- c.at(now):
+				default:
+				}
+			}
+		}
+	}()
+	return t
+}
+
+// at converts a wall time to the time of the clock
+func (c *AcceleratedClock) at(wall time.Time) time.Time {
+	return c.start.Add(time.Duration(float64(wall.Sub(c.origin)) * c.factor))
+}
+
+// real converts a duration of the clock to a wall duration
+func (c *AcceleratedClock) real(d time.Duration) time.Duration {
+	r := time.Duration(float64(d) / c.factor)
+	if r <= 0 {
+		r = 1
+	}
+	return r
+}
+
+type acceleratedTicker struct {
+	t    *time.Ticker
+	ch   chan time.Time
+	done chan struct{}
+	once sync.Once
+}
+
+func (t *acceleratedTicker) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *acceleratedTicker) Stop() {
+	t.once.Do(func() {
+		t.t.Stop()
+		close(t.done)
+	})
+}
+
+// SimClock is a simulated clock which only moves when it is advanced, it
+// drives the trading logic through virtual time in tests and backtests
+type SimClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*simWaiter
+}
+
+// simWaiter is a timer or a ticker of a simulated clock
+type simWaiter struct {
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+// NewSimClock creates a simulated clock at start
+func NewSimClock(start time.Time) *SimClock {
+	return &SimClock{now: start}
+}
+
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *SimClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *SimClock) After(d time.Duration) <-chan time.Time {
+	return c.add(d, 0).ch
+}
+
+func (c *SimClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return &simTicker{clock: c, w: c.add(d, d)}
+}
+
+func (c *SimClock) add(d, period time.Duration) *simWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &simWaiter{
+		at:     c.now.Add(d),
+		period: period,
+		ch:     make(chan time.Time, 1),
+	}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+
+func (c *SimClock) remove(w *simWaiter) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, x := range c.waiters {
+		if x == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Waiters returns the number of pending timers and tickers, tests wait for
+// workers to create their tickers before advancing the clock
+func (c *SimClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+// Advance moves the clock forward by d, timers and tickers due are fired
+// in order. Like time.Ticker, ticks are dropped for slow receivers.
+func (c *SimClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+		if len(c.waiters) == 0 || c.waiters[0].at.After(target) {
+			break
+		}
+
+		w := c.waiters[0]
+		c.now = w.at
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+	c.now = target
+}
+
+type simTicker struct {
+	clock *SimClock
+	w     *simWaiter
+}
+
+func (t *simTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *simTicker) Stop() {
+	t.clock.remove(t.w)
+}
@@ -0,0 +1,88 @@
+package pixiu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type clockTestSuite struct {
+	suite.Suite
+	start time.Time
+	clock *SimClock
+}
+
+func TestClock(t *testing.T) {
+	suite.Run(t, new(clockTestSuite))
+}
+
+func (c *clockTestSuite) SetupTest() {
+	c.start = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.clock = NewSimClock(c.start)
+}
+
+func (c *clockTestSuite) TestSimTicker() {
+	ticker := c.clock.NewTicker(time.Second)
+	after := c.clock.After(1500 * time.Millisecond)
+	assert.Equal(c.T(), 2, c.clock.Waiters())
+
+	c.clock.Advance(999 * time.Millisecond)
+	assert.Len(c.T(), ticker.C(), 0)
+
+	c.clock.Advance(time.Millisecond)
+	assert.Equal(c.T(), c.start.Add(time.Second), <-ticker.C())
+
+	c.clock.Advance(time.Second)
+	assert.Equal(c.T(), c.start.Add(1500*time.Millisecond), <-after)
+	assert.Equal(c.T(), c.start.Add(2*time.Second), <-ticker.C())
+	assert.Equal(c.T(), 1, c.clock.Waiters())
+
+	// ticks are dropped for slow receivers
+	c.clock.Advance(5 * time.Second)
+	assert.Equal(c.T(), c.start.Add(3*time.Second), <-ticker.C())
+	assert.Len(c.T(), ticker.C(), 0)
+	assert.Equal(c.T(), 5*time.Second, c.clock.Since(c.start.Add(2*time.Second)))
+
+	ticker.Stop()
+	assert.Equal(c.T(), 0, c.clock.Waiters())
+}
+
+func (c *clockTestSuite) TestAccelerated() {
+	clock := NewAcceleratedClock(c.start, 1000)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	select {
+	case now := <-ticker.C():
+		assert.False(c.T(), now.Before(c.start.Add(time.Second)))
+	case <-time.After(time.Second):
+		c.T().Fatal("accelerated ticker does not tick")
+	}
+	<-clock.After(time.Second)
+	assert.True(c.T(), clock.Since(c.start) >= 2*time.Second)
+}
+
+func (c *clockTestSuite) TestWorkerHeartbeat() {
+	shared := NewShared(0)
+	shared.SetClock(c.clock)
+	arb := newSharedTestArbitrager(shared, newTestConfig(), "ADAUSDT", "DOTUSDT")
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go arb.oracle.Run(stop)
+	assert.Eventually(c.T(), func() bool { return c.clock.Waiters() == 1 }, time.Second, time.Millisecond)
+
+	beat := func() time.Time {
+		arb.health.mu.Lock()
+		defer arb.health.mu.Unlock()
+		return arb.health.beats["oracle"]
+	}
+	assert.Eventually(c.T(), func() bool { return beat().Equal(c.start) }, time.Second, time.Millisecond)
+
+	c.clock.Advance(HEARTBEAT_INTERVAL)
+	assert.Eventually(c.T(), func() bool {
+		return beat().Equal(c.start.Add(HEARTBEAT_INTERVAL))
+	}, time.Second, time.Millisecond)
+}
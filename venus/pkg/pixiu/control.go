@@ -0,0 +1,171 @@
+package pixiu
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/plutus"
+)
+
+var _ plutus.Inspector = &Arbitrager{}
+var _ plutus.Controller = &Arbitrager{}
+
+// Position defines an open position of a symbol
+type Position struct {
+	Symbol   string        `json:"symbol"`
+	Asset    string        `json:"asset"`
+	Quantity model.Decimal `json:"quantity"`
+}
+
+// Config returns the running config, credentials are masked by model.Secret
+// when it is encoded
+func (a *Arbitrager) Config() interface{} {
+	return a.Conf()
+}
+
+// Epochs returns the epoch windows and directions of all the symbols
+func (a *Arbitrager) Epochs() interface{} {
+	return a.oracle.Snapshot()
+}
+
+// Positions returns the open positions of the symbols in policy
+func (a *Arbitrager) Positions() (interface{}, error) {
+	balanceMap, err := a.account.GetBalanceMap()
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make([]*Position, 0)
+	for _, symbol := range a.Conf().Policy.Symbols {
+		asset := a.exch.BaseAsset(symbol)
+		quantity := balanceMap[asset]
+		if a.exch.IsPosition(symbol, quantity) {
+			positions = append(positions, &Position{
+				Symbol:   symbol,
+				Asset:    asset,
+				Quantity: quantity,
+			})
+		}
+	}
+
+	return positions, nil
+}
+
+// Orders returns all the open orders including legs of oco orders
+func (a *Arbitrager) Orders() (interface{}, error) {
+	ctx, cancel := a.requestContext(model.OP_ACCOUNT)
+	defer cancel()
+	orders, err := a.trader.client.NewListOpenOrdersService().Do(ctx)
+	a.observeRequest(model.OP_ACCOUNT, err)
+	return orders, err
+}
+
+// Decisions returns the recent decisions of the oracle
+func (a *Arbitrager) Decisions() interface{} {
+	return a.decisions.List()
+}
+
+// Balances returns the non-zero balances of the account
+func (a *Arbitrager) Balances() (interface{}, error) {
+	account, err := a.account.GetAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	return account.Balances, nil
+}
+
+// Pause stops handling new order requests, sampling continues
+func (a *Arbitrager) Pause() {
+	a.log.Warn("trading is paused")
+	a.paused.Store(true)
+}
+
+// Resume resumes handling order requests
+func (a *Arbitrager) Resume() {
+	a.log.Warn("trading is resumed")
+	a.paused.Store(false)
+}
+
+// Paused checks if trading is paused
+func (a *Arbitrager) Paused() bool {
+	return a.paused.Load()
+}
+
+// Flatten cancels open orders and sells the positions with market price,
+// the errors of the symbols are returned after the sells are completed
+func (a *Arbitrager) Flatten(symbols []string) error {
+	symbols, err := a.policySymbols(symbols)
+	if err != nil {
+		return err
+	}
+	a.log.Warnf("flatten %v", symbols)
+	return <-a.trader.processSellOrder(symbols)
+}
+
+// CancelOrders cancels all the open orders of symbols
+func (a *Arbitrager) CancelOrders(symbols []string) error {
+	symbols, err := a.policySymbols(symbols)
+	if err != nil {
+		return err
+	}
+	a.log.Warnf("cancel open orders of %v", symbols)
+	errs := &symbolErrors{}
+	a.trader.cancelAll(symbols, errs)
+	return errs.err()
+}
+
+// policySymbols returns all the symbols of the policy if symbols is empty,
+// symbols not in the policy are rejected
+func (a *Arbitrager) policySymbols(symbols []string) ([]string, error) {
+	policy := a.Conf().Policy.Symbols
+	if len(symbols) == 0 {
+		return policy, nil
+	}
+
+	known := make(map[string]bool, len(policy))
+	for _, symbol := range policy {
+		known[symbol] = true
+	}
+	unknown := make([]string, 0)
+	for _, symbol := range symbols {
+		if !known[symbol] {
+			unknown = append(unknown, symbol)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("symbols %v are not in policy %v", unknown, a.name)
+	}
+	return symbols, nil
+}
+
+// symbolErrors collects the errors of symbols handled concurrently
+type symbolErrors struct {
+	mu   sync.Mutex
+	errs []string
+}
+
+// add adds the error of a symbol, nil is ignored
+func (e *symbolErrors) add(symbol string, err error) {
+	if err == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errs = append(e.errs, fmt.Sprintf("%v: %v", symbol, err))
+}
+
+// err returns an error of all the symbols, nil if there is none
+func (e *symbolErrors) err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.errs) == 0 {
+		return nil
+	}
+	sort.Strings(e.errs)
+	return fmt.Errorf("failed for %d symbols: %v", len(e.errs), strings.Join(e.errs, "; "))
+}
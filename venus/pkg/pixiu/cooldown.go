@@ -0,0 +1,88 @@
+package pixiu
+
+import (
+	"sync"
+	"time"
+)
+
+// Cooldown tracks the quiet periods after entries and exits, so that a
+// persistent trend does not trigger the same trades on every tick
+type Cooldown struct {
+	mu           sync.Mutex
+	symbolPeriod time.Duration
+	globalPeriod time.Duration
+	lastGlobal   time.Time
+	lastSymbol   map[string]time.Time
+}
+
+// NewCooldown creates a new cooldown instance, zero period disables the
+// corresponding cooldown
+func NewCooldown(symbolPeriod, globalPeriod time.Duration) *Cooldown {
+	return &Cooldown{
+		symbolPeriod: symbolPeriod,
+		globalPeriod: globalPeriod,
+		lastSymbol:   make(map[string]time.Time),
+	}
+}
+
+// SetPeriods changes the cooldown periods
+func (c *Cooldown) SetPeriods(symbolPeriod, globalPeriod time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.symbolPeriod = symbolPeriod
+	c.globalPeriod = globalPeriod
+}
+
+// Record marks an entry or exit of a symbol at the given time
+func (c *Cooldown) Record(symbol string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastSymbol[symbol] = now
+	c.lastGlobal = now
+}
+
+// GlobalActive checks if the global cooldown is still active
+func (c *Cooldown) GlobalActive(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.active(c.lastGlobal, c.globalPeriod, now)
+}
+
+// SymbolActive checks if the cooldown of a symbol is still active
+func (c *Cooldown) SymbolActive(symbol string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.active(c.lastSymbol[symbol], c.symbolPeriod, now)
+}
+
+// Filter splits the symbols into the ones allowed for trading and the ones
+// still in cooldown, the order of symbols is preserved
+func (c *Cooldown) Filter(symbols []string, now time.Time) ([]string, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	allowed := make([]string, 0, len(symbols))
+	skipped := make([]string, 0)
+	for _, symbol := range symbols {
+		if c.active(c.lastSymbol[symbol], c.symbolPeriod, now) {
+			skipped = append(skipped, symbol)
+		} else {
+			allowed = append(allowed, symbol)
+		}
+	}
+
+	return allowed, skipped
+}
+
+// active checks if the period starting from last covers now
+func (c *Cooldown) active(last time.Time, period time.Duration, now time.Time) bool {
+	if period <= 0 || last.IsZero() {
+		return false
+	}
+
+	return now.Before(last.Add(period))
+}
@@ -0,0 +1,52 @@
+package pixiu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type cooldownTestSuite struct {
+	suite.Suite
+	now time.Time
+}
+
+func TestCooldown(t *testing.T) {
+	suite.Run(t, new(cooldownTestSuite))
+}
+
+func (c *cooldownTestSuite) SetupTest() {
+	c.now = time.Date(2021, 7, 1, 8, 0, 0, 0, time.UTC)
+}
+
+func (c *cooldownTestSuite) TestDisabled() {
+	cd := NewCooldown(0, 0)
+	cd.Record("ADAUSDT", c.now)
+	assert.False(c.T(), cd.GlobalActive(c.now))
+	assert.False(c.T(), cd.SymbolActive("ADAUSDT", c.now))
+}
+
+func (c *cooldownTestSuite) TestSymbol() {
+	cd := NewCooldown(time.Minute*30, 0)
+	cd.Record("ADAUSDT", c.now)
+
+	assert.True(c.T(), cd.SymbolActive("ADAUSDT", c.now.Add(time.Minute*29)))
+	assert.False(c.T(), cd.SymbolActive("ADAUSDT", c.now.Add(time.Minute*30)))
+	assert.False(c.T(), cd.SymbolActive("DOTUSDT", c.now))
+	assert.False(c.T(), cd.GlobalActive(c.now))
+
+	allowed, skipped := cd.Filter([]string{"DOTUSDT", "ADAUSDT", "XRPUSDT"}, c.now.Add(time.Minute))
+	assert.Equal(c.T(), []string{"DOTUSDT", "XRPUSDT"}, allowed)
+	assert.Equal(c.T(), []string{"ADAUSDT"}, skipped)
+}
+
+func (c *cooldownTestSuite) TestGlobal() {
+	cd := NewCooldown(0, time.Minute*2)
+	cd.Record("ADAUSDT", c.now)
+
+	assert.True(c.T(), cd.GlobalActive(c.now.Add(time.Minute)))
+	assert.False(c.T(), cd.GlobalActive(c.now.Add(time.Minute*2)))
+	assert.False(c.T(), cd.SymbolActive("ADAUSDT", c.now.Add(time.Minute)))
+}
@@ -0,0 +1,75 @@
+package pixiu
+
+import (
+	"sync"
+)
+
+const (
+	DECISION_BUY  = "buy"
+	DECISION_SELL = "sell"
+	DECISION_NONE = "none"
+)
+
+// Decision records the result of a detection by the oracle
+type Decision struct {
+	Tick    uint64   `json:"tick"`
+	Time    string   `json:"time"`
+	Action  string   `json:"action"`
+	Rise    int      `json:"rise"`
+	Fall    int      `json:"fall"`
+	Total   int      `json:"total"`
+	Symbols []string `json:"symbols,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+}
+
+// DecisionLog keeps the most recent decisions in a ring buffer
+type DecisionLog struct {
+	mu        sync.Mutex
+	clock     Clock
+	decisions []*Decision
+	next      int
+	full      bool
+}
+
+// NewDecisionLog creates a decision log holding at most size decisions,
+// decisions without a time are stamped by the clock
+func NewDecisionLog(size int, clock Clock) *DecisionLog {
+	return &DecisionLog{
+		clock:     clock,
+		decisions: make([]*Decision, size),
+	}
+}
+
+// Add appends a decision, the oldest one is dropped when full
+func (l *DecisionLog) Add(d *Decision) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if d.Time == "" {
+		d.Time = l.clock.Now().Format(TIME_FORMAT)
+	}
+	l.decisions[l.next] = d
+	l.next = (l.next + 1) % len(l.decisions)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// List returns the decisions from the newest to the oldest
+func (l *DecisionLog) List() []*Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.decisions)
+	}
+
+	r := make([]*Decision, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (l.next - i + len(l.decisions)) % len(l.decisions)
+		r = append(r, l.decisions[idx])
+	}
+
+	return r
+}
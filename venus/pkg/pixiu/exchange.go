@@ -1,14 +1,14 @@
 package pixiu
 
 import (
-	"context"
 	"fmt"
-	"math"
-	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/adshao/go-binance/v2"
-	"github.com/jinzhu/copier"
 	glog "github.com/vjoke/falcon/pkg/log"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
 )
 
 var eLog = glog.RegisterScope("exchange", "exchange", 0)
@@ -16,9 +16,11 @@ var eLog = glog.RegisterScope("exchange", "exchange", 0)
 // Exchange hold info for the binance exchange
 type Exchange struct {
 	arb *Arbitrager
+	log *glog.Scope
 	client *binance.Client
 	info *binance.ExchangeInfo
 	symbolMap map[string]*binance.Symbol
+	mu sync.RWMutex
 	extraMap map[string]*FilterExtra
 }
 
@@ -26,88 +28,165 @@ type Exchange struct {
 func NewExchange(arb *Arbitrager) (*Exchange, error) {
 	exch := &Exchange{
 		arb: arb,
-		client:  binance.NewClient(arb.config.Exchange.ApiKey, arb.config.Exchange.SecretKey),
+		log: eLog.WithLabels("policy", arb.name),
+		client:  arb.shared.Client(arb.config.Exchange.ApiKey.Value(), arb.config.Exchange.SecretKey.Value()),
 		symbolMap: make(map[string]*binance.Symbol),
 		extraMap: make(map[string]*FilterExtra),
 	}
 
-	info, err := exch.client.NewExchangeInfoService().Do(context.Background())
+	info, err := exch.queryInfo(0)
 	if err != nil {
-		eLog.Errorf("failed to get exchange info, err:%v", err)
 		return nil, err
 	}
+	exch.update(info)
 
-	exch.info = info
+	if err := exch.PrepareSymbols(arb.config.Policy.Symbols); err != nil {
+		exch.log.Errorf("failed to prepare symbols, err:%v", err)
+		return nil, err
+	}
 
-	for _, symbol := range info.Symbols {
-		// FIXME: if we use pointer of returned symbol, some data will be
-		// modified with unknown reasons
-		newSymbol := binance.Symbol{}
-		copier.Copy(&newSymbol, &symbol)
-		exch.symbolMap[symbol.Symbol] = &newSymbol
+	return exch, nil
+}
+
+// queryInfo gets the exchange info shared by the policies, which is queried
+// again if it is older than maxAge
+func (exch *Exchange) queryInfo(maxAge time.Duration) (*binance.ExchangeInfo, error) {
+	ctx, cancel := exch.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	info, err := exch.arb.shared.ExchangeInfo(ctx, exch.client, maxAge)
+	exch.arb.observeRequest(model.OP_MARKET_DATA, err)
+	if err != nil {
+		exch.log.Errorf("failed to get exchange info, err:%v", err)
+		exchangeRequests.With(exch.arb.name, RESULT_FAILURE).Inc()
+		return nil, err
 	}
+	exchangeRequests.With(exch.arb.name, RESULT_SUCCESS).Inc()
 
-	for _, symbol := range arb.config.Policy.Symbols {
-		fLotSize := exch.symbolMap[symbol].LotSizeFilter()
-		eLog.Debugf("%v lot filter is %+v", symbol, *fLotSize)
+	return info, nil
+}
+
+// Info returns the exchange info loaded last
+func (exch *Exchange) Info() *binance.ExchangeInfo {
+	exch.mu.RLock()
+	defer exch.mu.RUnlock()
+
+	return exch.info
+}
 
-		fPrice := exch.symbolMap[symbol].PriceFilter()
-		eLog.Debugf("%v price filter is %+v", symbol, *fPrice)
+// PrepareSymbols loads the filters of symbols which are not loaded yet,
+// returns error if any of the symbols is unknown to the exchange
+func (exch *Exchange) PrepareSymbols(symbols []string) error {
+	extras := make(map[string]*FilterExtra)
+	for _, symbol := range symbols {
+		if exch.getExtra(symbol) != nil {
+			continue
+		}
 
-		fe := &FilterExtra{
-			LotSize: GetLotExtra(fLotSize),
-			Price: GetPriceExtra(fPrice),
+		s, ok := exch.getSymbol(symbol)
+		if !ok {
+			return fmt.Errorf("unknown symbol %v", symbol)
+		}
+		fe, err := newFilterExtra(s)
+		if err != nil {
+			return err
 		}
+		extras[symbol] = fe
+	}
 
+	exch.mu.Lock()
+	defer exch.mu.Unlock()
+	for symbol, fe := range extras {
+		exch.log.Infof("loaded filters for %v", symbol)
 		exch.extraMap[symbol] = fe
 	}
 
-	return exch, nil
+	return nil
 }
 
-// NormalizeQuantity normalizes the quantity
-func (exch *Exchange) NormalizeQuantity(symbol string, quantity float64) string {
-	fe := exch.extraMap[symbol]
-	if fe == nil {
-		err_msg := fmt.Sprintf("failed to get extra map for %v", symbol)
-		panic(err_msg)
+// newFilterExtra loads the filters of a symbol
+func newFilterExtra(s *binance.Symbol) (*FilterExtra, error) {
+	fLotSize := s.LotSizeFilter()
+	fPrice := s.PriceFilter()
+	if fLotSize == nil || fPrice == nil {
+		return nil, fmt.Errorf("missing lot size or price filter for %v", s.Symbol)
 	}
 
-	temp := math.Trunc(quantity * fe.LotSize.fMinQuantityMultiply)
-	r := temp * fe.LotSize.fMinQuantity
+	fe := &FilterExtra{
+		LotSize: GetLotExtra(fLotSize),
+		Price: GetPriceExtra(fPrice),
+	}
+	loadOptionalFilters(s, fe)
+	return fe, nil
+}
+
+// getSymbol returns the symbol info of a symbol
+func (exch *Exchange) getSymbol(symbol string) (*binance.Symbol, bool) {
+	exch.mu.RLock()
+	defer exch.mu.RUnlock()
 
-	return strconv.FormatFloat(r, 'f', fe.LotSize.nPrecision, 64)
+	s, ok := exch.symbolMap[symbol]
+	return s, ok
 }
 
-// NormalizePrice normalizes the price
-func (exch *Exchange) NormalizePrice(symbol string, quantity float64) string {
-	fe := exch.extraMap[symbol]
-	if fe == nil {
-		err_msg := fmt.Sprintf("failed to get extra map for %v", symbol)
-		panic(err_msg)
+// getExtra returns the extra filters of a symbol
+func (exch *Exchange) getExtra(symbol string) *FilterExtra {
+	exch.mu.RLock()
+	defer exch.mu.RUnlock()
+
+	return exch.extraMap[symbol]
+}
+
+// NormalizeQuantity rounds the quantity down to the step size and formats
+// it with the precision of the step size, unknown symbols are errors
+func (exch *Exchange) NormalizeQuantity(symbol string, quantity model.Decimal) (string, error) {
+	fe, err := exch.mustExtra(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	step := fe.LotSize.stepSize
+	return quantity.FloorToStep(step).StringFixed(step.Places()), nil
+}
+
+// NormalizePrice rounds the price down to the tick size and formats it with
+// the precision of the tick size
+func (exch *Exchange) NormalizePrice(symbol string, price model.Decimal) (string, error) {
+	fe, err := exch.mustExtra(symbol)
+	if err != nil {
+		return "", err
 	}
 
-	temp := math.Trunc(quantity * fe.Price.fMinPriceMultiply)
-	r := temp * fe.Price.fMinPrice
+	tick := fe.Price.tickSize
+	return price.FloorToStep(tick).StringFixed(tick.Places()), nil
+}
 
-	return strconv.FormatFloat(r, 'f', fe.Price.nPrecision, 64)
+// BaseAsset returns the base asset of a symbol
+func (exch *Exchange) BaseAsset(symbol string) string {
+	if s, ok := exch.getSymbol(symbol); ok {
+		return s.BaseAsset
+	}
+	// FIXME: remove suffix USDT for unknown symbols
+	return strings.TrimSuffix(symbol, "USDT")
+}
+
+// IsPosition checks if the quantity of a symbol is tradable, quantity
+// below the minimum lot size is dust left by commissions
+func (exch *Exchange) IsPosition(symbol string, quantity model.Decimal) bool {
+	fe := exch.getExtra(symbol)
+	if fe == nil {
+		return quantity.Sign() > 0
+	}
+
+	return quantity.Sign() > 0 && !quantity.LessThan(fe.LotSize.minQuantity)
 }
 
 // GetLotExtra returns extra info for the lot filter
 // TODO: move to a common place
 func GetLotExtra(f *binance.LotSizeFilter) *LotSizeFilterExtra {
-	fMaxQuantity := MustParseFloat(f.MaxQuantity)
-	fMinQuantity := MustParseFloat(f.MinQuantity)
-	fStepSize := MustParseFloat(f.StepSize)
-	fMinQuantityMultiply := 1.0/fMinQuantity
-	nPrecision := GetPrecison(f.MinQuantity)
-
 	extra := &LotSizeFilterExtra{
-		fMaxQuantity,
-		fMinQuantity,
-		fStepSize,
-		fMinQuantityMultiply,
-		nPrecision,
+		maxQuantity: model.MustParseDecimal(f.MaxQuantity),
+		minQuantity: model.MustParseDecimal(f.MinQuantity),
+		stepSize: model.MustParseDecimal(f.StepSize),
 	}
 
 	eLog.Debugf("lot extra:%+v", extra)
@@ -117,19 +196,10 @@ func GetLotExtra(f *binance.LotSizeFilter) *LotSizeFilterExtra {
 
 // GetPriceExtra returns extra info for the price filter
 func GetPriceExtra(f *binance.PriceFilter) *PriceFilterExtra {
-	fMaxPrice := MustParseFloat(f.MaxPrice)
-	fMinPrice := MustParseFloat(f.MinPrice)
-	fTickSize := MustParseFloat(f.TickSize)
-
-	fMinPriceMultiply := 1.0/fMinPrice
-	nPrecision := GetPrecison(f.MinPrice)
-
 	extra := &PriceFilterExtra{
-		fMaxPrice,
-		fMinPrice,
-		fTickSize,
-		fMinPriceMultiply,
-		nPrecision,
+		maxPrice: model.MustParseDecimal(f.MaxPrice),
+		minPrice: model.MustParseDecimal(f.MinPrice),
+		tickSize: model.MustParseDecimal(f.TickSize),
 	}
 
 	eLog.Debugf("price extra:%+v", extra)
@@ -137,73 +207,30 @@ func GetPriceExtra(f *binance.PriceFilter) *PriceFilterExtra {
 	return extra
 }
 
-// FilterExtra define extra filters for normalizing
+// FilterExtra define extra filters for normalizing and checking orders
 type FilterExtra struct {
 	Price *PriceFilterExtra
 	LotSize *LotSizeFilterExtra
-	// TODO: add more extra filters
+	// the filters below are nil or zero if the symbol does not have them
+	MinNotional *MinNotionalFilterExtra
+	PercentPrice *PercentPriceFilterExtra
+	MarketLotSize *LotSizeFilterExtra
+	MaxNumOrders int
+	MaxNumAlgoOrders int
 }
 
-// PriceFilterExtra defines extra parameters for normalizing price 
+// PriceFilterExtra defines extra parameters for normalizing price, zero
+// values are unlimited
 type PriceFilterExtra struct {
-	fMaxPrice float64
-	fMinPrice float64
-	fTickSize float64
-
-	fMinPriceMultiply float64
-	nPrecision int
+	maxPrice model.Decimal
+	minPrice model.Decimal
+	tickSize model.Decimal
 }
 
-// LotSizeFilterExtra defines extra parameters for normalizing quantity
+// LotSizeFilterExtra defines extra parameters for normalizing quantity,
+// zero values are unlimited
 type LotSizeFilterExtra struct {
-	fMaxQuantity  float64
-	fMinQuantity float64
-	fStepSize    float64
-
-	fMinQuantityMultiply float64 
-	nPrecision	 int
+	maxQuantity model.Decimal
+	minQuantity model.Decimal
+	stepSize    model.Decimal
 }
-
-// MustParseFloat parses the float, panic if error
-func MustParseFloat(str string) float64 {
-	val, err := strconv.ParseFloat(str, 64)
-	if err != nil {
-		eLog.Error(err)
-		panic(err)
-	}
-
-	if val <= 0 {
-		panic("zero float value")
-	}
-
-	return val
-}
-
-// GetPrecison returns the precision of string float
-func GetPrecison(str string) int {
-	switch str {
-	case "1.00000000":
-		return 0
-	case "0.10000000":
-		return 1
-	case "0.01000000":
-		return 2
-	case "0.00100000":
-		return 3
-	case "0.00010000":
-		return 4
-	case "0.00001000":
-		return 5
-	case "0.00000100":
-		return 6
-	case "0.00000010":
-		return 7
-	case "0.00000001":
-		return 8
-	default:
-		return 8
-	}
-}
-
-
-
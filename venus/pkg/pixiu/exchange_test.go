@@ -2,12 +2,14 @@ package pixiu
 
 import (
 	"testing"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
 type exchangeTestSuite struct {
 	suite.Suite
+	arb *Arbitrager
 }
 
 func TestExchange(t *testing.T) {
@@ -15,9 +17,59 @@ func TestExchange(t *testing.T) {
 }
 
 func (e *exchangeTestSuite) SetupTest() {
-	
+	e.arb = newTestArbitrager(newTestConfig(), "ADAUSDT", "DOTUSDT")
+	s := newTestSymbol("DOTUSDT")
+	s.Filters = []map[string]interface{}{
+		{"filterType": "LOT_SIZE", "minQty": "0.01000000", "maxQty": "90000.00000000", "stepSize": "0.01000000"},
+		{"filterType": "PRICE_FILTER", "minPrice": "0.00100000", "maxPrice": "10000.00000000", "tickSize": "0.00100000"},
+	}
+	e.arb.exch.symbolMap["DOTUSDT"] = s
+	delete(e.arb.exch.extraMap, "DOTUSDT")
+	e.Require().NoError(e.arb.exch.PrepareSymbols([]string{"DOTUSDT"}))
 }
-	
+
 func (e *exchangeTestSuite) TestNormalizeQuantity() {
-	// TODO:
-} 
\ No newline at end of file
+	cases := []struct {
+		symbol   string
+		quantity string
+		want     string
+	}{
+		// 0.29 is 0.28999... as a float
+		{"DOTUSDT", "0.29", "0.29"},
+		{"DOTUSDT", "0.299", "0.29"},
+		{"DOTUSDT", "1.005", "1.00"},
+		{"DOTUSDT", "0.001", "0.00"},
+		{"ADAUSDT", "19.98", "19.9"},
+		{"ADAUSDT", "100", "100.0"},
+	}
+	for _, c := range cases {
+		quantity, err := e.arb.exch.NormalizeQuantity(c.symbol, dec(c.quantity))
+		assert.NoError(e.T(), err)
+		assert.Equal(e.T(), c.want, quantity, "%v of %v", c.quantity, c.symbol)
+	}
+
+	_, err := e.arb.exch.NormalizeQuantity("XRPUSDT", dec("1"))
+	assert.Error(e.T(), err)
+}
+
+func (e *exchangeTestSuite) TestNormalizePrice() {
+	cases := map[string]string{"1.2349": "1.234", "0.58": "0.580", "1.17654": "1.176"}
+	for in, want := range cases {
+		price, err := e.arb.exch.NormalizePrice("DOTUSDT", dec(in))
+		assert.NoError(e.T(), err)
+		assert.Equal(e.T(), want, price, in)
+	}
+	price, err := e.arb.exch.NormalizePrice("ADAUSDT", dec("0.58"))
+	assert.NoError(e.T(), err)
+	assert.Equal(e.T(), "0.5800", price)
+
+	_, err = e.arb.exch.NormalizePrice("XRPUSDT", dec("1"))
+	assert.Error(e.T(), err)
+}
+
+func (e *exchangeTestSuite) TestIsPosition() {
+	assert.True(e.T(), e.arb.exch.IsPosition("DOTUSDT", dec("0.01")))
+	assert.False(e.T(), e.arb.exch.IsPosition("DOTUSDT", dec("0.009")))
+	assert.False(e.T(), e.arb.exch.IsPosition("ADAUSDT", dec("0.05")))
+	assert.True(e.T(), e.arb.exch.IsPosition("XRPUSDT", dec("0.05")))
+}
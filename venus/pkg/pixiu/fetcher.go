@@ -1,90 +1,164 @@
 package pixiu
 
 import (
-	"context"
-	"strconv"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/adshao/go-binance/v2"
 	glog "github.com/vjoke/falcon/pkg/log"
 	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/notify"
+	"go.uber.org/atomic"
 )
 
 var fLog = glog.RegisterScope("fetcher", "fetcher", 0)
 
+const (
+	// CONNECTIVITY_LOST_THRESHOLD is the number of consecutive failed
+	// requests before the exchange is considered unreachable
+	CONNECTIVITY_LOST_THRESHOLD = 5
+)
+
 // Fetcher reads price and update price periodically
 type Fetcher struct {
 	arb       *Arbitrager
+	log       *glog.Scope
+	mu        sync.RWMutex
 	interval  time.Duration
 	priceMode string
 	symbols   []string
 	client    *binance.Client
 	Tick      uint64
+	failures  *atomic.Int32
+	lost      *atomic.Bool
 }
 
 // NewFetcher creates a new fetcher instance
 func NewFetcher(arb *Arbitrager) *Fetcher {
 	f := &Fetcher{
 		arb:       arb,
+		log:       fLog.WithLabels("policy", arb.name),
 		interval:  arb.config.Policy.Sample.Interval.Duration,
 		priceMode: arb.config.Policy.Sample.PriceMode,
-		symbols:   arb.config.Policy.Symbols,
-		client:    binance.NewClient(arb.config.Exchange.ApiKey, arb.config.Exchange.SecretKey),
+		symbols:   arb.exch.ActiveSymbols(arb.config.Policy.Symbols),
+		client:    arb.shared.Client(arb.config.Exchange.ApiKey.Value(), arb.config.Exchange.SecretKey.Value()),
+		failures:  atomic.NewInt32(0),
+		lost:      atomic.NewBool(false),
 	}
 
 	return f
 }
 
-// Run begins the fetching process which will get price every tick
-func (f *Fetcher) Run(stopCh <-chan struct{}) {
-	ticker := time.NewTicker(f.interval)
+// Run begins the fetching process which will get price every tick, it
+// fails with a panic of a query
+func (f *Fetcher) Run(stopCh <-chan struct{}) error {
+	ticker := f.arb.clock.NewTicker(f.interval)
 	defer ticker.Stop()
-	fLog.Info("worker is running")
+	heartbeat := f.arb.clock.NewTicker(HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	f.log.Info("worker is running")
 
 	for {
+		f.arb.health.Beat("fetcher")
 		select {
 		case <-stopCh:
-			fLog.Info("worker is stopped")
-			return
-		case <-ticker.C:
+			f.log.Info("worker is stopped")
+			return nil
+		case err := <-f.arb.panics.C("fetcher"):
+			return err
+		case <-heartbeat.C():
+		case <-ticker.C():
 			f.Tick++
 			tick := f.Tick
-			for _, symbol := range f.symbols {
-				go f.queryPrice(symbol, tick)
+			ticksTotal.With(f.arb.name).Inc()
+			f.mu.RLock()
+			symbols, priceMode := f.symbols, f.priceMode
+			f.mu.RUnlock()
+			for _, symbol := range symbols {
+				symbol := symbol
+				f.arb.spawn("fetcher", func() { f.queryPrice(symbol, priceMode, tick) })
 			}
 		}
 	}
 }
 
+// apply applies the sampling parameters of a reloaded config
+func (f *Fetcher) apply(conf *model.Config) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.priceMode = conf.Policy.Sample.PriceMode
+	f.symbols = f.arb.exch.ActiveSymbols(conf.Policy.Symbols)
+}
+
+// setSymbols sets the symbols to sample
+func (f *Fetcher) setSymbols(symbols []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.symbols = symbols
+}
+
 // queryPrice querys price from binance api server
-func (f *Fetcher) queryPrice(symbol string, tick uint64) {
-	fLog.Debugf("query %v price of %v", f.priceMode, symbol)
+func (f *Fetcher) queryPrice(symbol, priceMode string, tick uint64) {
+	f.log.Debugf("query %v price of %v", priceMode, symbol)
+
+	ctx, cancel := f.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
 
 	var priceStr string
-	switch f.priceMode {
+	begin := time.Now()
+	switch priceMode {
+	case model.MID_PRICE:
+		d, err := f.arb.orderBook.Depth(symbol)
+		f.observeLatency(symbol, begin, err)
+		if err == nil {
+			var mid model.Decimal
+			if mid, err = d.Mid(); err == nil {
+				priceStr = mid.String()
+			}
+		}
+		if err != nil {
+			f.log.Errorf("get mid price of %v error: %v", symbol, err)
+			fetchErrors.With(f.arb.name, symbol, errorReason(err)).Inc()
+			f.markFailure(err)
+			return
+		}
 	case model.REALTIME_PRICE:
-		r, err := f.client.NewListPricesService().Symbol(symbol).Do(context.Background())
+		r, err := f.client.NewListPricesService().Symbol(symbol).Do(ctx)
+		f.arb.observeRequest(model.OP_MARKET_DATA, err)
+		f.observeLatency(symbol, begin, err)
 		if err != nil {
-			fLog.Errorf("get price of %v error: %v", symbol, err)
+			f.log.Errorf("get price of %v error: %v", symbol, err)
+			fetchErrors.With(f.arb.name, symbol, errorReason(err)).Inc()
+			f.markFailure(err)
 			return
 		}
 		if len(r) == 0 {
-			fLog.Errorf("return empty price info for %v", symbol)
+			f.log.Errorf("return empty price info for %v", symbol)
+			fetchErrors.With(f.arb.name, symbol, "empty").Inc()
 			return
 		}
 		priceStr = r[0].Price
 	default:
-		r, err := f.client.NewAveragePriceService().Symbol(symbol).Do(context.Background())
+		r, err := f.client.NewAveragePriceService().Symbol(symbol).Do(ctx)
+		f.arb.observeRequest(model.OP_MARKET_DATA, err)
+		f.observeLatency(symbol, begin, err)
 		if err != nil {
-			fLog.Errorf("get price of %v error: %v", symbol, err)
+			f.log.Errorf("get price of %v error: %v", symbol, err)
+			fetchErrors.With(f.arb.name, symbol, errorReason(err)).Inc()
+			f.markFailure(err)
 			return
 		}
 		priceStr = r.Price
 	}
+	f.markSuccess()
 
-	price, err := strconv.ParseFloat(priceStr, 64)
+	price, err := model.ParseDecimal(priceStr)
 	if err != nil {
-		fLog.Errorf("convert price error: %v", err)
+		f.log.Errorf("convert price error: %v", err)
+		fetchErrors.With(f.arb.name, symbol, "invalid_price").Inc()
 		return
 	}
 
@@ -92,8 +166,40 @@ func (f *Fetcher) queryPrice(symbol string, tick uint64) {
 		Tick:   tick,
 		Symbol: symbol,
 		Price:  price,
-		Start:  time.Now().Format(TIME_FORMAT),
+		Start:  f.arb.clock.Now().Format(TIME_FORMAT),
 	}
 
+	f.arb.health.Sampled()
 	f.arb.UpdatePrice(sp)
 }
+
+// observeLatency records the latency of a price request by its result
+func (f *Fetcher) observeLatency(symbol string, begin time.Time, err error) {
+	result := RESULT_SUCCESS
+	if err != nil {
+		result = RESULT_FAILURE
+	}
+	fetchLatency.With(f.arb.name, symbol, result).Observe(time.Since(begin).Seconds())
+}
+
+// markFailure counts a failed request, connectivity lost is notified once
+// the failures reach CONNECTIVITY_LOST_THRESHOLD
+func (f *Fetcher) markFailure(err error) {
+	if f.failures.Inc() < CONNECTIVITY_LOST_THRESHOLD {
+		return
+	}
+	if f.lost.CAS(false, true) {
+		f.log.Warnf("connectivity to exchange is lost, last error: %v", err)
+		f.arb.notify(notify.EVENT_CONNECTIVITY_LOST, "",
+			fmt.Sprintf("exchange is unreachable after %v failures: %v", CONNECTIVITY_LOST_THRESHOLD, err), nil)
+	}
+}
+
+// markSuccess resets the failures and notifies if connectivity is restored
+func (f *Fetcher) markSuccess() {
+	f.failures.Store(0)
+	if f.lost.CAS(true, false) {
+		f.log.Info("connectivity to exchange is restored")
+		f.arb.notify(notify.EVENT_CONNECTIVITY_RESTORED, "", "exchange is reachable again", nil)
+	}
+}
@@ -0,0 +1,310 @@
+package pixiu
+
+import (
+	"fmt"
+
+	"github.com/adshao/go-binance/v2"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+// FILTER_MAX_NUM_ORDERS is missing in the filter types of go-binance
+const FILTER_MAX_NUM_ORDERS binance.SymbolFilterType = "MAX_NUM_ORDERS"
+
+// algoOrderTypes are the order types counted by MAX_NUM_ALGO_ORDERS
+var algoOrderTypes = map[binance.OrderType]bool{
+	binance.OrderTypeStopLoss:        true,
+	binance.OrderTypeStopLossLimit:   true,
+	binance.OrderTypeTakeProfit:      true,
+	binance.OrderTypeTakeProfitLimit: true,
+}
+
+// FilterError is returned when an order violates a filter of its symbol and
+// would be rejected by the exchange
+type FilterError struct {
+	Symbol string
+	Filter binance.SymbolFilterType
+	Reason string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%v of %v: %v", e.Filter, e.Symbol, e.Reason)
+}
+
+// MinNotionalFilterExtra defines extra parameters for the min notional
+type MinNotionalFilterExtra struct {
+	minNotional   model.Decimal
+	applyToMarket bool
+}
+
+// PercentPriceFilterExtra defines the range of prices around the average
+// price
+type PercentPriceFilterExtra struct {
+	multiplierUp   model.Decimal
+	multiplierDown model.Decimal
+}
+
+// FilterState is the state of a symbol on the exchange which filters are
+// checked against
+type FilterState struct {
+	// AvgPrice is the average price of the exchange, zero skips the checks
+	// based on it
+	AvgPrice model.Decimal
+	// OpenOrders and AlgoOrders are the open orders of the symbol
+	OpenOrders int
+	AlgoOrders int
+}
+
+// OCOOrder defines the legs of a sell oco order
+type OCOOrder struct {
+	Quantity       model.Decimal
+	Price          model.Decimal
+	StopPrice      model.Decimal
+	StopLimitPrice model.Decimal
+}
+
+// OCOParams defines the normalized parameters of an oco order
+type OCOParams struct {
+	Quantity       string
+	Price          string
+	StopPrice      string
+	StopLimitPrice string
+}
+
+// loadOptionalFilters loads the filters which not all the symbols have
+func loadOptionalFilters(s *binance.Symbol, fe *FilterExtra) {
+	if f := s.MinNotionalFilter(); f != nil {
+		fe.MinNotional = &MinNotionalFilterExtra{
+			minNotional:   parseFilterDecimal(f.MinNotional),
+			applyToMarket: f.ApplyToMarket,
+		}
+	}
+	if f := s.PercentPriceFilter(); f != nil {
+		fe.PercentPrice = &PercentPriceFilterExtra{
+			multiplierUp:   parseFilterDecimal(f.MultiplierUp),
+			multiplierDown: parseFilterDecimal(f.MultiplierDown),
+		}
+	}
+	if f := s.MarketLotSizeFilter(); f != nil {
+		// zero values of the market lot size mean no limit
+		fe.MarketLotSize = &LotSizeFilterExtra{
+			maxQuantity: parseFilterDecimal(f.MaxQuantity),
+			minQuantity: parseFilterDecimal(f.MinQuantity),
+			stepSize:    parseFilterDecimal(f.StepSize),
+		}
+	}
+	if f := s.MaxNumAlgoOrdersFilter(); f != nil {
+		fe.MaxNumAlgoOrders = f.MaxNumAlgoOrders
+	}
+	for _, f := range s.Filters {
+		if f["filterType"] == string(FILTER_MAX_NUM_ORDERS) {
+			if v, ok := f["maxNumOrders"].(float64); ok {
+				fe.MaxNumOrders = int(v)
+			}
+		}
+	}
+}
+
+// FilterState queries the average price and the open orders of a symbol,
+// open orders are only queried if the symbol limits them
+func (exch *Exchange) FilterState(symbol string) (*FilterState, error) {
+	fe := exch.getExtra(symbol)
+	if fe == nil {
+		return nil, fmt.Errorf("unknown symbol %v", symbol)
+	}
+
+	state := &FilterState{}
+	ctx, cancel := exch.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	avg, err := exch.client.NewAveragePriceService().Symbol(symbol).Do(ctx)
+	exch.arb.observeRequest(model.OP_MARKET_DATA, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get average price of %v: %v", symbol, err)
+	}
+	if state.AvgPrice, err = model.ParseDecimal(avg.Price); err != nil {
+		return nil, fmt.Errorf("invalid average price of %v: %v", symbol, err)
+	}
+
+	if fe.MaxNumOrders == 0 && fe.MaxNumAlgoOrders == 0 {
+		return state, nil
+	}
+	ctx, cancel = exch.arb.requestContext(model.OP_ACCOUNT)
+	defer cancel()
+	orders, err := exch.client.NewListOpenOrdersService().Symbol(symbol).Do(ctx)
+	exch.arb.observeRequest(model.OP_ACCOUNT, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open orders of %v: %v", symbol, err)
+	}
+	for _, o := range orders {
+		state.OpenOrders++
+		if algoOrderTypes[o.Type] {
+			state.AlgoOrders++
+		}
+	}
+
+	return state, nil
+}
+
+// CheckMarketBuy checks a market buy of quote quantity and returns the
+// normalized quote quantity. State may be nil to skip the checks based on
+// it.
+func (exch *Exchange) CheckMarketBuy(symbol string, quote model.Decimal, state *FilterState) (string, error) {
+	fe, err := exch.mustExtra(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	if fe.MinNotional != nil && quote.LessThan(fe.MinNotional.minNotional) {
+		return "", &FilterError{symbol, binance.SymbolFilterTypeMinNotional,
+			fmt.Sprintf("notional %v is below %v", quote, fe.MinNotional.minNotional)}
+	}
+	if state != nil && state.AvgPrice.Sign() > 0 {
+		// the executed quantity is estimated by the average price
+		base := quote.Div(state.AvgPrice)
+		if err := checkQuantityRange(symbol, binance.SymbolFilterTypeLotSize, fe.LotSize, base); err != nil {
+			return "", err
+		}
+		if err := checkQuantityRange(symbol, binance.SymbolFilterTypeMarketLotSize, fe.MarketLotSize, base); err != nil {
+			return "", err
+		}
+	}
+	if err := checkNumOrders(symbol, fe, state, 1, 0); err != nil {
+		return "", err
+	}
+
+	return quote.StringFixed(model.DECIMAL_PLACES), nil
+}
+
+// CheckMarketSell checks a market sell and returns the quantity adjusted to
+// the lot sizes. State may be nil to skip the checks based on it.
+func (exch *Exchange) CheckMarketSell(symbol string, quantity model.Decimal, state *FilterState) (string, error) {
+	fe, err := exch.mustExtra(symbol)
+	if err != nil {
+		return "", err
+	}
+
+	q := quantity.FloorToStep(fe.LotSize.stepSize)
+	if fe.MarketLotSize != nil {
+		q = q.FloorToStep(fe.MarketLotSize.stepSize)
+	}
+	if err := checkQuantityRange(symbol, binance.SymbolFilterTypeLotSize, fe.LotSize, q); err != nil {
+		return "", err
+	}
+	if err := checkQuantityRange(symbol, binance.SymbolFilterTypeMarketLotSize, fe.MarketLotSize, q); err != nil {
+		return "", err
+	}
+	if fe.MinNotional != nil && fe.MinNotional.applyToMarket && state != nil && state.AvgPrice.Sign() > 0 {
+		if notional := q.Mul(state.AvgPrice); notional.LessThan(fe.MinNotional.minNotional) {
+			return "", &FilterError{symbol, binance.SymbolFilterTypeMinNotional,
+				fmt.Sprintf("notional %v is below %v", notional, fe.MinNotional.minNotional)}
+		}
+	}
+	if err := checkNumOrders(symbol, fe, state, 1, 0); err != nil {
+		return "", err
+	}
+
+	return q.StringFixed(fe.LotSize.stepSize.Places()), nil
+}
+
+// CheckOCO checks both legs of a sell oco order and returns the parameters
+// adjusted to the tick size and the lot size. State may be nil to skip the
+// checks based on it.
+func (exch *Exchange) CheckOCO(symbol string, o *OCOOrder, state *FilterState) (*OCOParams, error) {
+	fe, err := exch.mustExtra(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	q := o.Quantity.FloorToStep(fe.LotSize.stepSize)
+	if err := checkQuantityRange(symbol, binance.SymbolFilterTypeLotSize, fe.LotSize, q); err != nil {
+		return nil, err
+	}
+
+	tick := fe.Price.tickSize
+	price, stopPrice, stopLimitPrice := o.Price.FloorToStep(tick), o.StopPrice.FloorToStep(tick), o.StopLimitPrice.FloorToStep(tick)
+	for _, p := range []model.Decimal{price, stopPrice, stopLimitPrice} {
+		if p.LessThan(fe.Price.minPrice) || (fe.Price.maxPrice.Sign() > 0 && p.GreaterThan(fe.Price.maxPrice)) {
+			return nil, &FilterError{symbol, binance.SymbolFilterTypePriceFilter,
+				fmt.Sprintf("price %v is out of [%v, %v]", p, fe.Price.minPrice, fe.Price.maxPrice)}
+		}
+	}
+	if price.Cmp(stopPrice) <= 0 {
+		return nil, &FilterError{symbol, binance.SymbolFilterTypePriceFilter,
+			fmt.Sprintf("limit price %v is not above stop price %v", price, stopPrice)}
+	}
+
+	// the limit prices of both legs are checked like limit orders
+	for _, p := range []model.Decimal{price, stopLimitPrice} {
+		if fe.PercentPrice != nil && state != nil && state.AvgPrice.Sign() > 0 {
+			up, down := state.AvgPrice.Mul(fe.PercentPrice.multiplierUp), state.AvgPrice.Mul(fe.PercentPrice.multiplierDown)
+			if p.GreaterThan(up) || p.LessThan(down) {
+				return nil, &FilterError{symbol, binance.SymbolFilterTypePercentPrice,
+					fmt.Sprintf("price %v is out of [%v, %v] of average price %v", p, down, up, state.AvgPrice)}
+			}
+		}
+		if fe.MinNotional != nil && p.Mul(q).LessThan(fe.MinNotional.minNotional) {
+			return nil, &FilterError{symbol, binance.SymbolFilterTypeMinNotional,
+				fmt.Sprintf("notional %v of price %v is below %v", p.Mul(q), p, fe.MinNotional.minNotional)}
+		}
+	}
+	if err := checkNumOrders(symbol, fe, state, 2, 1); err != nil {
+		return nil, err
+	}
+
+	return &OCOParams{
+		Quantity:       q.StringFixed(fe.LotSize.stepSize.Places()),
+		Price:          price.StringFixed(tick.Places()),
+		StopPrice:      stopPrice.StringFixed(tick.Places()),
+		StopLimitPrice: stopLimitPrice.StringFixed(tick.Places()),
+	}, nil
+}
+
+// mustExtra returns the extra filters of a symbol
+func (exch *Exchange) mustExtra(symbol string) (*FilterExtra, error) {
+	fe := exch.getExtra(symbol)
+	if fe == nil {
+		return nil, fmt.Errorf("unknown symbol %v", symbol)
+	}
+	return fe, nil
+}
+
+// checkQuantityRange checks the range of a quantity, zero bounds are
+// unlimited
+func checkQuantityRange(symbol string, filter binance.SymbolFilterType, lot *LotSizeFilterExtra, q model.Decimal) error {
+	if lot == nil {
+		return nil
+	}
+	if q.LessThan(lot.minQuantity) || q.Sign() <= 0 {
+		return &FilterError{symbol, filter, fmt.Sprintf("quantity %v is below %v", q, lot.minQuantity)}
+	}
+	if lot.maxQuantity.Sign() > 0 && q.GreaterThan(lot.maxQuantity) {
+		return &FilterError{symbol, filter, fmt.Sprintf("quantity %v is above %v", q, lot.maxQuantity)}
+	}
+	return nil
+}
+
+// checkNumOrders checks if the orders and algo orders to place exceed the
+// limits of open orders
+func checkNumOrders(symbol string, fe *FilterExtra, state *FilterState, orders, algoOrders int) error {
+	if state == nil {
+		return nil
+	}
+	if fe.MaxNumOrders > 0 && state.OpenOrders+orders > fe.MaxNumOrders {
+		return &FilterError{symbol, FILTER_MAX_NUM_ORDERS,
+			fmt.Sprintf("%v open orders, limit is %v", state.OpenOrders, fe.MaxNumOrders)}
+	}
+	if fe.MaxNumAlgoOrders > 0 && state.AlgoOrders+algoOrders > fe.MaxNumAlgoOrders {
+		return &FilterError{symbol, binance.SymbolFilterTypeMaxNumAlgoOrders,
+			fmt.Sprintf("%v open algo orders, limit is %v", state.AlgoOrders, fe.MaxNumAlgoOrders)}
+	}
+	return nil
+}
+
+// parseFilterDecimal parses a value of filters, invalid values are zero
+func parseFilterDecimal(str string) model.Decimal {
+	v, err := model.ParseDecimal(str)
+	if err != nil {
+		eLog.Warnf("invalid filter value %q: %v", str, err)
+		return model.Decimal{}
+	}
+	return v
+}
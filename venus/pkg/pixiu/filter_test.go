@@ -0,0 +1,152 @@
+package pixiu
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+)
+
+type filterTestSuite struct {
+	suite.Suite
+	arb   *Arbitrager
+	state *FilterState
+}
+
+func TestFilter(t *testing.T) {
+	suite.Run(t, new(filterTestSuite))
+}
+
+func (f *filterTestSuite) SetupTest() {
+	f.arb = newTestArbitrager(newTestConfig(), "ADAUSDT", "DOTUSDT")
+	s := newTestSymbol("ADAUSDT")
+	s.Filters = append(s.Filters,
+		map[string]interface{}{"filterType": "MIN_NOTIONAL", "minNotional": "10.00000000", "applyToMarket": true, "avgPriceMins": 5.0},
+		map[string]interface{}{"filterType": "PERCENT_PRICE", "multiplierUp": "1.1", "multiplierDown": "0.9", "avgPriceMins": 5.0},
+		map[string]interface{}{"filterType": "MARKET_LOT_SIZE", "minQty": "0.00000000", "maxQty": "1000.00000000", "stepSize": "0.00000000"},
+		map[string]interface{}{"filterType": "MAX_NUM_ORDERS", "maxNumOrders": 4.0},
+		map[string]interface{}{"filterType": "MAX_NUM_ALGO_ORDERS", "maxNumAlgoOrders": 1.0},
+	)
+	f.arb.exch.symbolMap["ADAUSDT"] = s
+	delete(f.arb.exch.extraMap, "ADAUSDT")
+	f.Require().NoError(f.arb.exch.PrepareSymbols([]string{"ADAUSDT"}))
+	f.state = &FilterState{AvgPrice: dec("1.2")}
+}
+
+// assertFilter asserts the error is a FilterError of filter
+func (f *filterTestSuite) assertFilter(filter binance.SymbolFilterType, err error) {
+	var filterErr *FilterError
+	if assert.True(f.T(), errors.As(err, &filterErr), "%v is not a filter error", err) {
+		assert.Equal(f.T(), filter, filterErr.Filter)
+		assert.Equal(f.T(), "ADAUSDT", filterErr.Symbol)
+	}
+}
+
+func (f *filterTestSuite) TestOptionalFilters() {
+	fe := f.arb.exch.getExtra("ADAUSDT")
+	assert.Equal(f.T(), dec("10"), fe.MinNotional.minNotional)
+	assert.True(f.T(), fe.MinNotional.applyToMarket)
+	assert.Equal(f.T(), dec("1.1"), fe.PercentPrice.multiplierUp)
+	assert.Equal(f.T(), dec("1000"), fe.MarketLotSize.maxQuantity)
+	assert.Equal(f.T(), 4, fe.MaxNumOrders)
+	assert.Equal(f.T(), 1, fe.MaxNumAlgoOrders)
+
+	// symbols without the optional filters are not limited by them
+	fe = f.arb.exch.getExtra("DOTUSDT")
+	assert.Nil(f.T(), fe.MinNotional)
+	assert.Zero(f.T(), fe.MaxNumOrders)
+	_, err := f.arb.exch.CheckMarketBuy("DOTUSDT", dec("1"), &FilterState{AvgPrice: dec("1"), OpenOrders: 100})
+	assert.NoError(f.T(), err)
+}
+
+func (f *filterTestSuite) TestMarketBuy() {
+	quote, err := f.arb.exch.CheckMarketBuy("ADAUSDT", dec("12"), f.state)
+	assert.NoError(f.T(), err)
+	assert.Equal(f.T(), "12.00000000", quote)
+
+	_, err = f.arb.exch.CheckMarketBuy("ADAUSDT", dec("9"), f.state)
+	f.assertFilter(binance.SymbolFilterTypeMinNotional, err)
+	_, err = f.arb.exch.CheckMarketBuy("ADAUSDT", dec("1500"), f.state)
+	f.assertFilter(binance.SymbolFilterTypeMarketLotSize, err)
+	_, err = f.arb.exch.CheckMarketBuy("ADAUSDT", dec("12"), &FilterState{AvgPrice: dec("1.2"), OpenOrders: 4})
+	f.assertFilter(FILTER_MAX_NUM_ORDERS, err)
+	assert.Equal(f.T(), "filter_max_num_orders", errorReason(err))
+
+	_, err = f.arb.exch.CheckMarketBuy("XRPUSDT", dec("12"), f.state)
+	assert.Error(f.T(), err)
+}
+
+func (f *filterTestSuite) TestMarketSell() {
+	quantity, err := f.arb.exch.CheckMarketSell("ADAUSDT", dec("9.98"), f.state)
+	assert.NoError(f.T(), err)
+	assert.Equal(f.T(), "9.9", quantity)
+
+	_, err = f.arb.exch.CheckMarketSell("ADAUSDT", dec("0.05"), f.state)
+	f.assertFilter(binance.SymbolFilterTypeLotSize, err)
+	_, err = f.arb.exch.CheckMarketSell("ADAUSDT", dec("8"), f.state)
+	f.assertFilter(binance.SymbolFilterTypeMinNotional, err)
+	_, err = f.arb.exch.CheckMarketSell("ADAUSDT", dec("1200"), f.state)
+	f.assertFilter(binance.SymbolFilterTypeMarketLotSize, err)
+
+	// checks based on the state are skipped without it
+	_, err = f.arb.exch.CheckMarketSell("ADAUSDT", dec("8"), nil)
+	assert.NoError(f.T(), err)
+}
+
+func (f *filterTestSuite) TestOCO() {
+	oco := &OCOOrder{Quantity: dec("9.98"), Price: dec("1.23456"), StopPrice: dec("1.17654"), StopLimitPrice: dec("1.17654")}
+	params, err := f.arb.exch.CheckOCO("ADAUSDT", oco, f.state)
+	assert.NoError(f.T(), err)
+	assert.Equal(f.T(), &OCOParams{Quantity: "9.9", Price: "1.2345", StopPrice: "1.1765", StopLimitPrice: "1.1765"}, params)
+
+	// the stop leg is below the min notional
+	oco.Quantity = dec("8.4")
+	_, err = f.arb.exch.CheckOCO("ADAUSDT", oco, f.state)
+	f.assertFilter(binance.SymbolFilterTypeMinNotional, err)
+
+	oco = &OCOOrder{Quantity: dec("20"), Price: dec("1.4"), StopPrice: dec("1.1"), StopLimitPrice: dec("1.1")}
+	_, err = f.arb.exch.CheckOCO("ADAUSDT", oco, f.state)
+	f.assertFilter(binance.SymbolFilterTypePercentPrice, err)
+
+	oco.Price = dec("1.3")
+	_, err = f.arb.exch.CheckOCO("ADAUSDT", oco, &FilterState{AvgPrice: dec("1.2"), OpenOrders: 1, AlgoOrders: 1})
+	f.assertFilter(binance.SymbolFilterTypeMaxNumAlgoOrders, err)
+	_, err = f.arb.exch.CheckOCO("ADAUSDT", oco, &FilterState{AvgPrice: dec("1.2"), OpenOrders: 3})
+	f.assertFilter(FILTER_MAX_NUM_ORDERS, err)
+
+	oco.StopPrice = dec("1.3")
+	_, err = f.arb.exch.CheckOCO("ADAUSDT", oco, f.state)
+	f.assertFilter(binance.SymbolFilterTypePriceFilter, err)
+}
+
+func (f *filterTestSuite) TestFilterState() {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	script.Balances["ADA"] = 50
+	exchange := mockexchange.New(script)
+	server := httptest.NewServer(exchange)
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	op, err := NewOperator(conf)
+	f.Require().NoError(err)
+
+	state, err := op.arb.exch.FilterState("ADAUSDT")
+	assert.NoError(f.T(), err)
+	assert.Equal(f.T(), &FilterState{AvgPrice: dec("1")}, state)
+
+	oco, err := op.arb.exch.CheckOCO("ADAUSDT", &OCOOrder{Quantity: dec("50"), Price: dec("1.1"), StopPrice: dec("0.9"), StopLimitPrice: dec("0.9")}, state)
+	f.Require().NoError(err)
+	_, err = op.client.NewCreateOCOService().Symbol("ADAUSDT").Side(binance.SideTypeSell).
+		Quantity(oco.Quantity).Price(oco.Price).StopPrice(oco.StopPrice).StopLimitPrice(oco.StopLimitPrice).
+		StopLimitTimeInForce(binance.TimeInForceTypeGTC).Do(op.arb.ctx)
+	f.Require().NoError(err)
+
+	state, err = op.arb.exch.FilterState("ADAUSDT")
+	assert.NoError(f.T(), err)
+	assert.Equal(f.T(), &FilterState{AvgPrice: dec("1"), OpenOrders: 2, AlgoOrders: 1}, state)
+}
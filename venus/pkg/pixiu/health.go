@@ -0,0 +1,177 @@
+package pixiu
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/plutus"
+)
+
+var _ plutus.Prober = &Arbitrager{}
+
+const (
+	// HEARTBEAT_INTERVAL is the interval of heartbeats from idle workers
+	HEARTBEAT_INTERVAL = 5 * time.Second
+	// HEARTBEAT_TIMEOUT is the age of the last heartbeat of a stuck worker
+	HEARTBEAT_TIMEOUT = time.Minute
+	// HEALTH_CHECK_INTERVAL is the interval to check account access and
+	// time sync in background
+	HEALTH_CHECK_INTERVAL = 30 * time.Second
+	// STALE_SAMPLE_INTERVALS is the number of sample intervals without
+	// samples to be not ready
+	STALE_SAMPLE_INTERVALS = 3
+)
+
+// Health keeps the heartbeats of workers and the state of the checks for
+// liveness and readiness
+type Health struct {
+	mu         sync.Mutex
+	clock      Clock
+	beats      map[string]time.Time
+	lastSample time.Time
+	accountErr error
+	timeErr    error
+}
+
+// NewHealth creates a health whose checks are not passed yet
+func NewHealth(clock Clock) *Health {
+	return &Health{
+		clock:      clock,
+		beats:      make(map[string]time.Time),
+		accountErr: fmt.Errorf("account is not checked yet"),
+		timeErr:    fmt.Errorf("time is not checked yet"),
+	}
+}
+
+// Beat records a heartbeat of a worker
+func (h *Health) Beat(worker string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.beats[worker] = h.clock.Now()
+}
+
+// Sampled records a sample price
+func (h *Health) Sampled() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastSample = h.clock.Now()
+}
+
+// setAccount records the result of accessing the account
+func (h *Health) setAccount(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.accountErr = err
+}
+
+// setTime records the result of checking time sync
+func (h *Health) setTime(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.timeErr = err
+}
+
+// Alive returns an error if any worker has no heartbeat in timeout
+func (h *Health) Alive(timeout time.Duration) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stuck := make([]string, 0)
+	for worker, t := range h.beats {
+		if h.clock.Since(t) > timeout {
+			stuck = append(stuck, worker)
+		}
+	}
+	if len(stuck) > 0 {
+		sort.Strings(stuck)
+		return fmt.Errorf("no heartbeat from %v in %v", stuck, timeout)
+	}
+	return nil
+}
+
+// Ready returns an error if the account or time sync check failed or there
+// is no sample in maxAge
+func (h *Health) Ready(maxAge time.Duration) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.accountErr != nil {
+		return fmt.Errorf("account is not accessible: %v", h.accountErr)
+	}
+	if h.timeErr != nil {
+		return fmt.Errorf("time is not synced: %v", h.timeErr)
+	}
+	if h.lastSample.IsZero() {
+		return fmt.Errorf("no sample yet")
+	}
+	if age := h.clock.Since(h.lastSample); age > maxAge {
+		return fmt.Errorf("last sample is %v old", age.Truncate(time.Second))
+	}
+	return nil
+}
+
+// Alive returns an error if any worker of the arbitrager is stuck
+func (a *Arbitrager) Alive() error {
+	return a.health.Alive(HEARTBEAT_TIMEOUT)
+}
+
+// Ready returns an error if the arbitrager is not ready to trade
+func (a *Arbitrager) Ready() error {
+	if a.exch == nil || a.exch.Info() == nil {
+		return fmt.Errorf("exchange info is not loaded")
+	}
+	interval := a.Conf().Policy.Sample.Interval.Duration
+	return a.health.Ready(STALE_SAMPLE_INTERVALS*interval + HEARTBEAT_INTERVAL)
+}
+
+// runHealthChecks checks account access and time sync periodically
+func (a *Arbitrager) runHealthChecks(stopCh <-chan struct{}) {
+	ticker := a.clock.NewTicker(HEALTH_CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		a.checkAccount()
+		a.checkTime()
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// checkAccount checks the access to the account, which is accessible while
+// the user data stream is synced
+func (a *Arbitrager) checkAccount() {
+	if a.stream != nil && a.stream.Synced() {
+		a.health.setAccount(nil)
+		return
+	}
+	_, err := a.account.GetAccount()
+	if err != nil {
+		a.log.Warnf("failed to access account: %v", err)
+	}
+	a.health.setAccount(err)
+}
+
+// checkTime syncs the time with the exchange if it is due and checks the
+// drift of the local clock
+func (a *Arbitrager) checkTime() {
+	ctx, cancel := a.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	ts := a.shared.TimeSync()
+	a.observeRequest(model.OP_MARKET_DATA, ts.Sync(ctx, a.account.client, false))
+
+	err := ts.Check(a.Conf().Exchange.TimeDrift())
+	if err != nil {
+		a.log.Warn(err)
+	}
+	a.health.setTime(err)
+}
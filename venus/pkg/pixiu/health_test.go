@@ -0,0 +1,60 @@
+package pixiu
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type healthTestSuite struct {
+	suite.Suite
+	clock  *SimClock
+	health *Health
+}
+
+func TestHealth(t *testing.T) {
+	suite.Run(t, new(healthTestSuite))
+}
+
+func (h *healthTestSuite) SetupTest() {
+	h.clock = NewSimClock(time.Now())
+	h.health = NewHealth(h.clock)
+}
+
+func (h *healthTestSuite) TestAlive() {
+	assert.NoError(h.T(), h.health.Alive(time.Minute))
+
+	h.health.Beat("fetcher")
+	h.health.Beat("trader")
+	assert.NoError(h.T(), h.health.Alive(time.Minute))
+
+	h.clock.Advance(2 * time.Minute)
+	h.health.Beat("fetcher")
+	err := h.health.Alive(time.Minute)
+	assert.Error(h.T(), err)
+	assert.Contains(h.T(), err.Error(), "trader")
+	assert.NotContains(h.T(), err.Error(), "fetcher")
+}
+
+func (h *healthTestSuite) TestReady() {
+	assert.Contains(h.T(), h.health.Ready(time.Minute).Error(), "account")
+
+	h.health.setAccount(nil)
+	assert.Contains(h.T(), h.health.Ready(time.Minute).Error(), "time")
+
+	h.health.setTime(nil)
+	assert.EqualError(h.T(), h.health.Ready(time.Minute), "no sample yet")
+
+	h.health.Sampled()
+	assert.NoError(h.T(), h.health.Ready(time.Minute))
+
+	h.clock.Advance(2 * time.Minute)
+	assert.Contains(h.T(), h.health.Ready(time.Minute).Error(), "old")
+
+	h.health.Sampled()
+	h.health.setAccount(fmt.Errorf("invalid api key"))
+	assert.Contains(h.T(), h.health.Ready(time.Minute).Error(), "invalid api key")
+}
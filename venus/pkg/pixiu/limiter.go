@@ -0,0 +1,329 @@
+package pixiu
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DEFAULT_WEIGHT_LIMIT is the request weight per minute shared by all
+	// the policies, it is kept below the limit of binance
+	DEFAULT_WEIGHT_LIMIT = 1000
+	// WEIGHT_BURST is the request weight allowed at once
+	WEIGHT_BURST = 100
+	// ORDER_RESERVE_RATIO is the ratio of the weight burst kept for order
+	// traffic, other requests wait when the available weight is below it
+	ORDER_RESERVE_RATIO = 0.2
+	// ORDER_LIMIT is the number of new orders per 10 seconds, it is kept
+	// below the limit of binance
+	ORDER_LIMIT = 40
+	// ORDER_BURST is the number of new orders allowed at once
+	ORDER_BURST = 10
+	// EXCHANGE_WEIGHT_LIMIT is the request weight per minute of binance
+	EXCHANGE_WEIGHT_LIMIT = 1200
+	// EXCHANGE_ORDER_LIMIT is the number of new orders per 10 seconds of
+	// binance
+	EXCHANGE_ORDER_LIMIT = 50
+	// USAGE_HIGH_WATER is the ratio of the usage reported by the exchange
+	// to the limit, requests are stopped until the next window above it
+	USAGE_HIGH_WATER = 0.9
+	// DEFAULT_RETRY_AFTER is the back off of 429 and 418 responses without
+	// the Retry-After header
+	DEFAULT_RETRY_AFTER = time.Minute
+)
+
+const (
+	HEADER_USED_WEIGHT = "X-MBX-USED-WEIGHT-1M"
+	HEADER_ORDER_COUNT = "X-MBX-ORDER-COUNT-10S"
+	HEADER_RETRY_AFTER = "Retry-After"
+)
+
+// bucket is a token bucket
+type bucket struct {
+	capacity float64
+	tokens   float64
+	perSec   float64
+	last     time.Time
+}
+
+func newBucket(rate uint, period time.Duration, burst uint) *bucket {
+	return &bucket{
+		capacity: float64(burst),
+		tokens:   float64(burst),
+		perSec:   float64(rate) / period.Seconds(),
+	}
+}
+
+// refill adds the tokens since the last refill
+func (b *bucket) refill(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.perSec
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
+
+// delay returns the time before n tokens are available above floor
+func (b *bucket) delay(n, floor float64) time.Duration {
+	missing := floor + n - b.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / b.perSec * float64(time.Second))
+}
+
+// Request defines how a request is limited
+type Request struct {
+	// Weight is the request weight of the endpoint
+	Weight int
+	// Order is true for order traffic, which is prioritised over market
+	// data and account requests
+	Order bool
+	// NewOrders is the number of orders counted by the order limit, an oco
+	// order list counts as two orders
+	NewOrders int
+}
+
+// RequestLimiter limits the request weight and the new orders to the
+// exchange, the weight is shared by all the requests but a part of it is
+// reserved for order traffic. The usage reported by the exchange and the
+// 429 and 418 responses stop requests until the limits are reset.
+type RequestLimiter struct {
+	mu      sync.Mutex
+	weight  *bucket
+	orders  *bucket
+	reserve float64
+	// bannedUntil stops all the requests after a 429 or 418 response
+	bannedUntil time.Time
+	// weightFullUntil stops requests other than orders when the used
+	// weight is close to the limit of the exchange
+	weightFullUntil time.Time
+	// ordersFullUntil stops new orders when the order count is close to
+	// the limit of the exchange
+	ordersFullUntil time.Time
+}
+
+// NewRequestLimiter creates a limiter allowing rate weight per period with
+// the burst
+func NewRequestLimiter(rate uint, period time.Duration, burst uint) *RequestLimiter {
+	return &RequestLimiter{
+		weight:  newBucket(rate, period, burst),
+		orders:  newBucket(ORDER_LIMIT, 10*time.Second, ORDER_BURST),
+		reserve: float64(burst) * ORDER_RESERVE_RATIO,
+	}
+}
+
+// take takes the weight of a request if it is allowed now, otherwise the
+// delay before it may be allowed is returned
+func (l *RequestLimiter) take(now time.Time, r Request) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Before(l.bannedUntil) {
+		return l.bannedUntil.Sub(now)
+	}
+	if !r.Order && now.Before(l.weightFullUntil) {
+		return l.weightFullUntil.Sub(now)
+	}
+	if r.NewOrders > 0 && now.Before(l.ordersFullUntil) {
+		return l.ordersFullUntil.Sub(now)
+	}
+
+	l.weight.refill(now)
+	l.orders.refill(now)
+
+	floor := l.reserve
+	if r.Order {
+		floor = 0
+	}
+	// a request heavier than the burst is allowed when the bucket is full,
+	// the tokens are negative then
+	need := float64(r.Weight)
+	if need > l.weight.capacity-floor {
+		need = l.weight.capacity - floor
+	}
+	delay := l.weight.delay(need, floor)
+	if r.NewOrders > 0 {
+		// like the weight, an order list larger than the burst is allowed
+		// when the bucket is full
+		orders := float64(r.NewOrders)
+		if orders > l.orders.capacity {
+			orders = l.orders.capacity
+		}
+		if d := l.orders.delay(orders, 0); d > delay {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		return delay
+	}
+
+	l.weight.tokens -= float64(r.Weight)
+	l.orders.tokens -= float64(r.NewOrders)
+	return 0
+}
+
+// Wait blocks until a request is allowed or the context is done
+func (l *RequestLimiter) Wait(ctx context.Context, r Request) error {
+	delayed := false
+	for {
+		delay := l.take(time.Now(), r)
+		if delay <= 0 {
+			return nil
+		}
+		if !delayed {
+			delayed = true
+			limiterDelays.With(requestClass(r)).Inc()
+			sLog.Debugf("%v request is delayed %v by the limiter", requestClass(r), delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Observe updates the limiter with the usage reported by a response of the
+// exchange, and backs off on 429 and 418 responses
+func (l *RequestLimiter) Observe(resp *http.Response, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if used, err := strconv.Atoi(resp.Header.Get(HEADER_USED_WEIGHT)); err == nil {
+		usedWeight.With().Set(float64(used))
+		if used >= int(EXCHANGE_WEIGHT_LIMIT*USAGE_HIGH_WATER) {
+			l.weightFullUntil = now.Truncate(time.Minute).Add(time.Minute)
+			sLog.Warnf("used weight %v is close to the limit, requests are stopped until %v", used, l.weightFullUntil)
+		}
+	}
+	if count, err := strconv.Atoi(resp.Header.Get(HEADER_ORDER_COUNT)); err == nil {
+		if count >= int(EXCHANGE_ORDER_LIMIT*USAGE_HIGH_WATER) {
+			l.ordersFullUntil = now.Truncate(10 * time.Second).Add(10 * time.Second)
+			sLog.Warnf("order count %v is close to the limit, orders are stopped until %v", count, l.ordersFullUntil)
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusTeapot {
+		retryAfter := DEFAULT_RETRY_AFTER
+		if seconds, err := strconv.Atoi(resp.Header.Get(HEADER_RETRY_AFTER)); err == nil && seconds > 0 {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		if until := now.Add(retryAfter); until.After(l.bannedUntil) {
+			l.bannedUntil = until
+		}
+		rateLimited.With(strconv.Itoa(resp.StatusCode)).Inc()
+		sLog.Errorf("rate limited by the exchange with %v, all the requests are stopped until %v", resp.StatusCode, l.bannedUntil)
+	}
+}
+
+// Transport wraps a round tripper with the limiter
+func (l *RequestLimiter) Transport(next http.RoundTripper) http.RoundTripper {
+	return &limitedTransport{limiter: l, next: next}
+}
+
+type limitedTransport struct {
+	limiter *RequestLimiter
+	next    http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context(), ClassifyRequest(req)); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.limiter.Observe(resp, time.Now())
+	return resp, nil
+}
+
+// ClassifyRequest returns the weight and the kind of a request to binance
+func ClassifyRequest(req *http.Request) Request {
+	path := req.URL.Path
+	hasSymbol := req.URL.Query().Get("symbol") != ""
+
+	switch {
+	case path == "/api/v3/order" || path == "/api/v3/order/oco":
+		if req.Method == http.MethodPost {
+			if path == "/api/v3/order/oco" {
+				// the limit and the stop orders of an oco are both counted
+				return Request{Weight: 1, Order: true, NewOrders: 2}
+			}
+			return Request{Weight: 1, Order: true, NewOrders: 1}
+		}
+		if req.Method == http.MethodDelete {
+			return Request{Weight: 1, Order: true}
+		}
+		return Request{Weight: 2}
+	case path == "/api/v3/openOrders":
+		if req.Method == http.MethodDelete {
+			return Request{Weight: 1, Order: true}
+		}
+		if hasSymbol {
+			return Request{Weight: 3}
+		}
+		return Request{Weight: 40}
+	case path == "/api/v3/ticker/price":
+		if hasSymbol {
+			return Request{Weight: 1}
+		}
+		return Request{Weight: 2}
+	case path == "/api/v3/ticker/bookTicker":
+		if hasSymbol {
+			return Request{Weight: 1}
+		}
+		return Request{Weight: 2}
+	case path == "/api/v3/ticker/24hr":
+		if hasSymbol {
+			return Request{Weight: 1}
+		}
+		return Request{Weight: 40}
+	case path == "/api/v3/depth":
+		return Request{Weight: depthWeight(req.URL.Query().Get("limit"))}
+	case path == "/api/v3/exchangeInfo" || path == "/api/v3/account" ||
+		path == "/api/v3/myTrades" || path == "/api/v3/allOrders":
+		return Request{Weight: 10}
+	default:
+		return Request{Weight: 1}
+	}
+}
+
+// depthWeight returns the weight of the order book by its limit
+func depthWeight(limit string) int {
+	n, err := strconv.Atoi(limit)
+	if err != nil {
+		n = 100
+	}
+
+	switch {
+	case n <= 100:
+		return 1
+	case n <= 500:
+		return 5
+	case n <= 1000:
+		return 10
+	default:
+		return 50
+	}
+}
+
+// requestClass returns the class of a request for metric labels
+func requestClass(r Request) string {
+	if r.Order {
+		return "order"
+	}
+	return "other"
+}
@@ -0,0 +1,128 @@
+package pixiu
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type limiterTestSuite struct {
+	suite.Suite
+}
+
+func TestLimiter(t *testing.T) {
+	suite.Run(t, new(limiterTestSuite))
+}
+
+func (s *limiterTestSuite) TestWeight() {
+	l := NewRequestLimiter(60, time.Second, 10)
+	now := time.Now()
+	assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 5}))
+	assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 3}))
+	// the last 2 are reserved for orders
+	assert.True(s.T(), l.take(now, Request{Weight: 1}) > 0)
+	assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 1, Order: true}))
+	assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 1, Order: true}))
+	assert.True(s.T(), l.take(now, Request{Weight: 1, Order: true}) > 0)
+
+	// refilled after a second
+	now = now.Add(time.Second)
+	assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 8}))
+
+	// a request heavier than the burst waits for a full bucket
+	now = now.Add(time.Second)
+	assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 40}))
+	assert.True(s.T(), l.take(now, Request{Weight: 1, Order: true}) > 0)
+}
+
+func (s *limiterTestSuite) TestOrderCount() {
+	l := NewRequestLimiter(6000, time.Second, 100)
+	now := time.Now()
+	for i := 0; i < ORDER_BURST; i++ {
+		assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 1, Order: true, NewOrders: 1}))
+	}
+	assert.True(s.T(), l.take(now, Request{Weight: 1, Order: true, NewOrders: 1}) > 0)
+	// cancels are not counted
+	assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 1, Order: true}))
+}
+
+func (s *limiterTestSuite) TestOcoOrderCount() {
+	l := NewRequestLimiter(6000, time.Second, 100)
+	now := time.Now()
+	oco := Request{Weight: 1, Order: true, NewOrders: 2}
+	for i := 0; i < ORDER_BURST/2; i++ {
+		assert.Equal(s.T(), time.Duration(0), l.take(now, oco))
+	}
+	assert.True(s.T(), l.take(now, Request{Weight: 1, Order: true, NewOrders: 1}) > 0)
+	// two orders are refilled in half a second
+	assert.Equal(s.T(), time.Duration(0), l.take(now.Add(500*time.Millisecond), oco))
+}
+
+func (s *limiterTestSuite) TestObserveUsage() {
+	l := NewRequestLimiter(6000, time.Second, 100)
+	now := time.Date(2021, 1, 1, 0, 0, 30, 0, time.UTC)
+
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	resp.Header.Set(HEADER_USED_WEIGHT, "1100")
+	resp.Header.Set(HEADER_ORDER_COUNT, "3")
+	l.Observe(resp, now)
+	assert.Equal(s.T(), 30*time.Second, l.take(now, Request{Weight: 1}))
+	assert.Equal(s.T(), time.Duration(0), l.take(now, Request{Weight: 1, Order: true, NewOrders: 1}))
+
+	resp.Header.Set(HEADER_ORDER_COUNT, "48")
+	l.Observe(resp, now.Add(2*time.Second))
+	assert.Equal(s.T(), 8*time.Second, l.take(now.Add(2*time.Second), Request{Weight: 1, Order: true, NewOrders: 1}))
+	assert.Equal(s.T(), time.Duration(0), l.take(now.Add(2*time.Second), Request{Weight: 1, Order: true}))
+
+	assert.Equal(s.T(), time.Duration(0), l.take(now.Add(30*time.Second), Request{Weight: 1}))
+}
+
+func (s *limiterTestSuite) TestObserveBan() {
+	l := NewRequestLimiter(6000, time.Second, 100)
+	now := time.Now()
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set(HEADER_RETRY_AFTER, "5")
+	l.Observe(resp, now)
+	assert.Equal(s.T(), 5*time.Second, l.take(now, Request{Weight: 1, Order: true}))
+
+	resp = &http.Response{StatusCode: http.StatusTeapot, Header: http.Header{}}
+	l.Observe(resp, now)
+	assert.Equal(s.T(), DEFAULT_RETRY_AFTER, l.take(now, Request{Weight: 1}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NotNil(s.T(), l.Wait(ctx, Request{Weight: 1}))
+}
+
+func (s *limiterTestSuite) TestClassifyRequest() {
+	cases := []struct {
+		method string
+		path   string
+		query  string
+		want   Request
+	}{
+		{http.MethodGet, "/api/v3/ticker/price", "symbol=ADAUSDT", Request{Weight: 1}},
+		{http.MethodGet, "/api/v3/ticker/price", "", Request{Weight: 2}},
+		{http.MethodGet, "/api/v3/ticker/24hr", "", Request{Weight: 40}},
+		{http.MethodGet, "/api/v3/openOrders", "symbol=ADAUSDT", Request{Weight: 3}},
+		{http.MethodGet, "/api/v3/openOrders", "", Request{Weight: 40}},
+		{http.MethodDelete, "/api/v3/openOrders", "symbol=ADAUSDT", Request{Weight: 1, Order: true}},
+		{http.MethodGet, "/api/v3/exchangeInfo", "", Request{Weight: 10}},
+		{http.MethodGet, "/api/v3/account", "", Request{Weight: 10}},
+		{http.MethodGet, "/api/v3/depth", "limit=500", Request{Weight: 5}},
+		{http.MethodPost, "/api/v3/order", "", Request{Weight: 1, Order: true, NewOrders: 1}},
+		{http.MethodPost, "/api/v3/order/oco", "", Request{Weight: 1, Order: true, NewOrders: 2}},
+		{http.MethodDelete, "/api/v3/order", "symbol=ADAUSDT", Request{Weight: 1, Order: true}},
+		{http.MethodGet, "/api/v3/time", "", Request{Weight: 1}},
+	}
+	for _, c := range cases {
+		req := &http.Request{Method: c.method, URL: &url.URL{Path: c.path, RawQuery: c.query}}
+		assert.Equal(s.T(), c.want, ClassifyRequest(req), "%v %v?%v", c.method, c.path, c.query)
+	}
+}
@@ -0,0 +1,97 @@
+package pixiu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/vjoke/falcon/pkg/metrics"
+)
+
+const (
+	RESULT_SUCCESS = "success"
+	RESULT_FAILURE = "failure"
+)
+
+var (
+	fetchLatency = metrics.NewHistogramVec("pixiu_fetch_latency_seconds",
+		"Latency of price fetching requests by result.", nil, "policy", "symbol", "result")
+	fetchErrors = metrics.NewCounterVec("pixiu_fetch_errors_total",
+		"Number of failed price fetching requests.", "policy", "symbol", "reason")
+	ticksTotal = metrics.NewCounterVec("pixiu_ticks_total",
+		"Number of sampling ticks.", "policy")
+	busPublished = metrics.NewCounterVec("pixiu_bus_published_total",
+		"Number of events published on the bus.", "policy", "topic")
+	busBacklog = metrics.NewGaugeVec("pixiu_bus_backlog",
+		"Number of events buffered for a subscriber of the bus.", "policy", "topic", "subscriber")
+	busDropped = metrics.NewCounterVec("pixiu_bus_dropped_total",
+		"Number of events dropped for a subscriber of the bus by its overflow policy.", "policy", "topic", "subscriber")
+	decisionsTotal = metrics.NewCounterVec("pixiu_decisions_total",
+		"Number of decisions made by the oracle.", "policy", "action")
+	ordersTotal = metrics.NewCounterVec("pixiu_orders_total",
+		"Number of orders placed by the trader.", "policy", "symbol", "side", "result", "reason")
+	realizedPnl = metrics.NewGaugeVec("pixiu_realized_pnl_usdt",
+		"Realized profit and loss in USDT of exits.", "policy", "symbol")
+	accountRequests = metrics.NewCounterVec("pixiu_account_requests_total",
+		"Number of account requests.", "policy", "result")
+	balanceGauge = metrics.NewGaugeVec("pixiu_balance",
+		"Free and locked balance of an asset.", "policy", "asset")
+	exchangeRequests = metrics.NewCounterVec("pixiu_exchange_requests_total",
+		"Number of exchange info requests.", "policy", "result")
+	symbolTrading = metrics.NewGaugeVec("pixiu_symbol_trading",
+		"Whether a symbol is trading on the exchange, 1 if it is.", "policy", "symbol")
+	userStreamConnected = metrics.NewGaugeVec("pixiu_user_stream_connected",
+		"Whether the user data stream is connected, 1 if it is.", "policy")
+	userStreamEvents = metrics.NewCounterVec("pixiu_user_stream_events_total",
+		"Number of events received from the user data stream.", "policy", "event")
+	depthRequests = metrics.NewCounterVec("pixiu_depth_requests_total",
+		"Number of order book depth requests.", "policy", "result")
+	expectedSlippage = metrics.NewGaugeVec("pixiu_expected_slippage",
+		"Slippage of the last buy estimated by the order book.", "policy", "symbol")
+	slippageActions = metrics.NewCounterVec("pixiu_slippage_actions_total",
+		"Number of buys skipped or shrunk by the slippage limit.", "policy", "action")
+	triangularCycles = metrics.NewCounterVec("pixiu_triangular_cycles_total",
+		"Number of triangular cycles by result.", "policy", "result")
+	triangularBest = metrics.NewGaugeVec("pixiu_triangular_best_edge",
+		"Net return after fees of the best triangular cycle at the tickers.", "policy")
+	triangularEdge = metrics.NewGaugeVec("pixiu_triangular_edge",
+		"Expected and realized net return of the last executed triangular cycle.", "policy", "kind")
+	riskExposure = metrics.NewGaugeVec("pixiu_risk_exposure_usdt",
+		"Exposure reserved in the shared risk budget.", "policy")
+	requestTimeouts = metrics.NewCounterVec("pixiu_request_timeouts_total",
+		"Number of exchange requests timed out by operation class.", "policy", "class")
+	usedWeight = metrics.NewGaugeVec("pixiu_used_weight",
+		"Request weight used in the current minute reported by the exchange.")
+	limiterDelays = metrics.NewCounterVec("pixiu_limiter_delays_total",
+		"Number of requests delayed by the shared limiter.", "class")
+	rateLimited = metrics.NewCounterVec("pixiu_rate_limited_total",
+		"Number of responses rejected by the rate limits of the exchange.", "code")
+	timeOffset = metrics.NewGaugeVec("pixiu_time_offset_seconds",
+		"Offset of the server time of the exchange to the local clock.")
+)
+
+// errorReason classifies an error for metric labels
+func errorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) {
+		return fmt.Sprintf("api_%d", apiErr.Code)
+	}
+	var filterErr *FilterError
+	if errors.As(err, &filterErr) {
+		return "filter_" + strings.ToLower(string(filterErr.Filter))
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+
+	return "other"
+}
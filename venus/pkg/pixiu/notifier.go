@@ -0,0 +1,56 @@
+package pixiu
+
+import (
+	"fmt"
+
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/notify"
+)
+
+// NewNotifier creates a dispatcher with the sinks in notify config
+func NewNotifier(conf *model.Notify) (*notify.Dispatcher, error) {
+	if conf == nil {
+		return notify.NewDispatcher(), nil
+	}
+
+	routes := make([]*notify.Route, 0, len(conf.Sinks))
+	for i, s := range conf.Sinks {
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("%v-%d", s.Type, i)
+		}
+
+		var sink notify.Sink
+		switch s.Type {
+		case model.SINK_WEBHOOK:
+			sink = notify.NewWebhookSink(name, s.URL)
+		case model.SINK_TELEGRAM:
+			sink = notify.NewTelegramSink(name, s.Api, s.Token.Value(), s.ChatID)
+		case model.SINK_SMTP:
+			sink = notify.NewSMTPSink(name, s.Host, s.Port, s.Username, s.Password.Value(), s.From, s.To)
+		case model.SINK_FILE:
+			sink = notify.NewFileSink(name, s.Path)
+		default:
+			return nil, fmt.Errorf("unknown sink type %v", s.Type)
+		}
+
+		route, err := notify.NewRoute(sink, s.Events, s.RateLimit, s.Template)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
+	return notify.NewDispatcher(routes...), nil
+}
+
+// notify sends an event of the policy to the notifier
+func (a *Arbitrager) notify(typ, symbol, message string, fields map[string]interface{}) {
+	a.notifier.Notify(&notify.Event{
+		Type:    typ,
+		Policy:  a.name,
+		Symbol:  symbol,
+		Message: message,
+		Fields:  fields,
+	})
+}
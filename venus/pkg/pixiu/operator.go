@@ -0,0 +1,279 @@
+package pixiu
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/adshao/go-binance/v2"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+// Operator performs manual operations on the account of a policy, it uses
+// the same config and credentials as the arbitrager without running it
+type Operator struct {
+	arb    *Arbitrager
+	client *binance.Client
+}
+
+// Balance defines a balance of the account with its valuation
+type Balance struct {
+	Asset  string        `json:"asset"`
+	Free   model.Decimal `json:"free"`
+	Locked model.Decimal `json:"locked"`
+	// Value is the valuation in USDT, zero if the asset has no USDT market
+	Value model.Decimal `json:"value"`
+}
+
+// SymbolOrders defines the open orders of a symbol
+type SymbolOrders struct {
+	Symbol string           `json:"symbol"`
+	Orders []*binance.Order `json:"orders"`
+	// OCO holds the legs of oco orders
+	OCO []*binance.Order `json:"oco"`
+}
+
+// Result defines the result of an operation on a symbol
+type Result struct {
+	Symbol   string `json:"symbol"`
+	Quantity string `json:"quantity,omitempty"`
+	OrderID  int64  `json:"order_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewOperator creates an operator for the policy of a config
+func NewOperator(conf *model.Config) (*Operator, error) {
+	shared := NewShared(0)
+	if err := shared.Register(conf.Policy.Name, conf.Policy.Testnet, conf.Exchange.BaseURL); err != nil {
+		return nil, err
+	}
+
+	a := newArbitrager(conf, shared)
+	exch, err := NewExchange(a)
+	if err != nil {
+		return nil, err
+	}
+	a.exch = exch
+	a.account = NewAccount(a)
+
+	client := shared.Client(conf.Exchange.ApiKey.Value(), conf.Exchange.SecretKey.Value())
+	ctx, cancel := a.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	if err := shared.TimeSync().Sync(ctx, client, true); err != nil {
+		a.log.Warnf("signed requests use the local clock, failed to sync time: %v", err)
+	}
+
+	return &Operator{
+		arb:    a,
+		client: client,
+	}, nil
+}
+
+// Symbols returns the symbols of the policy
+func (o *Operator) Symbols() []string {
+	return o.arb.Conf().Policy.Symbols
+}
+
+// Balances returns the non-zero balances valued in USDT and the total value
+func (o *Operator) Balances() ([]*Balance, model.Decimal, error) {
+	account, err := o.arb.account.GetAccount()
+	if err != nil {
+		return nil, model.Decimal{}, err
+	}
+
+	ctx, cancel := o.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	prices, err := o.client.NewListPricesService().Do(ctx)
+	if err != nil {
+		return nil, model.Decimal{}, err
+	}
+
+	balances, total := valueBalances(account.Balances, prices)
+	return balances, total, nil
+}
+
+// OpenOrders returns the open orders of symbols, the legs of oco orders
+// are listed separately
+func (o *Operator) OpenOrders(symbols []string) ([]*SymbolOrders, error) {
+	ctx, cancel := o.arb.requestContext(model.OP_ACCOUNT)
+	defer cancel()
+	orders, err := o.client.NewListOpenOrdersService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupOrders(orders, symbols), nil
+}
+
+// Cancel cancels all the open orders of symbols
+func (o *Operator) Cancel(symbols []string) []*Result {
+	results := make([]*Result, len(symbols))
+	var wg sync.WaitGroup
+	for i, symbol := range symbols {
+		wg.Add(1)
+		go func(i int, symbol string) {
+			defer wg.Done()
+			results[i] = &Result{Symbol: symbol}
+			ctx, cancel := o.arb.requestContext(model.OP_ORDER)
+			defer cancel()
+			if _, err := o.client.NewCancelOpenOrdersService().Symbol(symbol).Do(ctx); err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			o.arb.log.Warnf("cancelled open orders of %v", symbol)
+		}(i, symbol)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Flatten cancels the open orders of symbols and sells the positions with
+// market price, symbols without position are skipped
+func (o *Operator) Flatten(symbols []string) ([]*Result, error) {
+	if err := o.arb.exch.PrepareSymbols(symbols); err != nil {
+		return nil, err
+	}
+
+	// open orders of symbols which are not trading are kept to protect the
+	// positions, and orders of symbols without open orders fail to be
+	// cancelled, which is expected here
+	trading, _ := o.arb.exch.SplitTrading(symbols)
+	o.Cancel(trading)
+
+	balanceMap, err := o.arb.account.GetBalanceMap()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*Result, 0, len(symbols))
+	for _, symbol := range symbols {
+		r := &Result{Symbol: symbol}
+		results = append(results, r)
+		if !o.arb.exch.Trading(symbol) {
+			r.Error = "symbol is not trading"
+			continue
+		}
+
+		quantity := balanceMap[o.arb.exch.BaseAsset(symbol)]
+		if !o.arb.exch.IsPosition(symbol, quantity) {
+			r.Error = fmt.Sprintf("no position, balance is %v", quantity)
+			continue
+		}
+
+		state, err := o.arb.exch.FilterState(symbol)
+		if err != nil {
+			o.arb.log.Warnf("check filters of %v without state: %v", symbol, err)
+		}
+		if r.Quantity, err = o.arb.exch.CheckMarketSell(symbol, quantity, state); err != nil {
+			r.Error = err.Error()
+			continue
+		}
+		res, err := o.sell(symbol, r.Quantity)
+		if err != nil {
+			r.Error = err.Error()
+			continue
+		}
+		r.OrderID = res.OrderID
+		o.arb.log.Warnf("sold %v %v with market price", r.Quantity, symbol)
+	}
+
+	return results, nil
+}
+
+// Trades returns the recent fills of a symbol
+func (o *Operator) Trades(symbol string, limit int) ([]*binance.TradeV3, error) {
+	ctx, cancel := o.arb.requestContext(model.OP_ACCOUNT)
+	defer cancel()
+	return o.client.NewListTradesService().Symbol(symbol).Limit(limit).Do(ctx)
+}
+
+// sell places a market sell order
+func (o *Operator) sell(symbol, quantity string) (*binance.CreateOrderResponse, error) {
+	ctx, cancel := o.arb.requestContext(model.OP_ORDER)
+	defer cancel()
+	return o.client.NewCreateOrderService().Symbol(symbol).
+		Side(binance.SideTypeSell).Type(binance.OrderTypeMarket).
+		Quantity(quantity).Do(ctx)
+}
+
+// valueBalances values the non-zero balances with the prices of their USDT
+// markets, the balances are sorted by value
+func valueBalances(balances []binance.Balance, prices []*binance.SymbolPrice) ([]*Balance, model.Decimal) {
+	priceMap := make(map[string]model.Decimal, len(prices))
+	for _, p := range prices {
+		if price, err := model.ParseDecimal(p.Price); err == nil {
+			priceMap[p.Symbol] = price
+		}
+	}
+
+	var total model.Decimal
+	result := make([]*Balance, 0, len(balances))
+	for _, b := range balances {
+		free, err := model.ParseDecimal(b.Free)
+		if err != nil {
+			continue
+		}
+		locked, err := model.ParseDecimal(b.Locked)
+		if err != nil {
+			continue
+		}
+		if free.Add(locked).Sign() <= 0 {
+			continue
+		}
+
+		price := model.NewDecimal(1, 0)
+		if b.Asset != model.QUOTE_ASSET {
+			price = priceMap[b.Asset+model.QUOTE_ASSET]
+		}
+		value := free.Add(locked).Mul(price)
+		total = total.Add(value)
+		result = append(result, &Balance{
+			Asset:  b.Asset,
+			Free:   free,
+			Locked: locked,
+			Value:  value,
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Value.GreaterThan(result[j].Value) })
+	return result, total
+}
+
+// groupOrders groups the open orders by symbols, empty symbols selects all
+// the symbols with open orders
+func groupOrders(orders []*binance.Order, symbols []string) []*SymbolOrders {
+	groups := make(map[string]*SymbolOrders)
+	for _, symbol := range symbols {
+		groups[symbol] = &SymbolOrders{Symbol: symbol}
+	}
+
+	for _, order := range orders {
+		g, ok := groups[order.Symbol]
+		if !ok {
+			if len(symbols) > 0 {
+				continue
+			}
+			g = &SymbolOrders{Symbol: order.Symbol}
+			groups[order.Symbol] = g
+		}
+
+		if isOCOLeg(order) {
+			g.OCO = append(g.OCO, order)
+		} else {
+			g.Orders = append(g.Orders, order)
+		}
+	}
+
+	result := make([]*SymbolOrders, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Symbol < result[j].Symbol })
+	return result
+}
+
+// isOCOLeg checks if an order is a leg of the oco orders placed by trader
+func isOCOLeg(order *binance.Order) bool {
+	return order.Type == binance.OrderTypeLimitMaker || order.Type == binance.OrderTypeStopLossLimit
+}
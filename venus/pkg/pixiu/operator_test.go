@@ -0,0 +1,88 @@
+package pixiu
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+)
+
+type operatorTestSuite struct {
+	suite.Suite
+}
+
+func TestOperator(t *testing.T) {
+	suite.Run(t, new(operatorTestSuite))
+}
+
+func (o *operatorTestSuite) TestValueBalances() {
+	balances := []binance.Balance{
+		{Asset: "USDT", Free: "50", Locked: "0"},
+		{Asset: "ADA", Free: "100", Locked: "20"},
+		{Asset: "XYZ", Free: "3", Locked: "0"},
+		{Asset: "BNB", Free: "0", Locked: "0"},
+	}
+	prices := []*binance.SymbolPrice{
+		{Symbol: "ADAUSDT", Price: "1.5"},
+		{Symbol: "BNBUSDT", Price: "300"},
+	}
+
+	result, total := valueBalances(balances, prices)
+	assert.Len(o.T(), result, 3)
+	assert.Equal(o.T(), "ADA", result[0].Asset)
+	assert.Equal(o.T(), dec("180"), result[0].Value)
+	assert.Equal(o.T(), "USDT", result[1].Asset)
+	assert.Equal(o.T(), dec("50"), result[1].Value)
+	assert.Equal(o.T(), "XYZ", result[2].Asset)
+	assert.True(o.T(), result[2].Value.IsZero())
+	assert.Equal(o.T(), dec("230"), total)
+}
+
+func (o *operatorTestSuite) TestGroupOrders() {
+	orders := []*binance.Order{
+		{Symbol: "ADAUSDT", OrderID: 1, Type: binance.OrderTypeLimitMaker},
+		{Symbol: "ADAUSDT", OrderID: 2, Type: binance.OrderTypeStopLossLimit},
+		{Symbol: "DOTUSDT", OrderID: 3, Type: binance.OrderTypeLimit},
+	}
+
+	all := groupOrders(orders, nil)
+	assert.Len(o.T(), all, 2)
+	assert.Equal(o.T(), "ADAUSDT", all[0].Symbol)
+	assert.Len(o.T(), all[0].OCO, 2)
+	assert.Empty(o.T(), all[0].Orders)
+	assert.Len(o.T(), all[1].Orders, 1)
+
+	selected := groupOrders(orders, []string{"DOTUSDT", "BTCUSDT"})
+	assert.Len(o.T(), selected, 2)
+	assert.Equal(o.T(), "BTCUSDT", selected[0].Symbol)
+	assert.Empty(o.T(), selected[0].Orders)
+	assert.Equal(o.T(), int64(3), selected[1].Orders[0].OrderID)
+}
+
+func (o *operatorTestSuite) TestMockExchange() {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	script.Balances["ADA"] = 50
+	exchange := mockexchange.New(script)
+	server := httptest.NewServer(exchange)
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	op, err := NewOperator(conf)
+	o.Require().NoError(err)
+
+	balances, total, err := op.Balances()
+	assert.NoError(o.T(), err)
+	assert.Len(o.T(), balances, 2)
+	assert.Equal(o.T(), dec("1050"), total)
+
+	results, err := op.Flatten([]string{"ADAUSDT", "DOTUSDT"})
+	assert.NoError(o.T(), err)
+	assert.Empty(o.T(), results[0].Error)
+	assert.NotEmpty(o.T(), results[1].Error)
+	ada, _ := exchange.Balance("ADA")
+	assert.Zero(o.T(), ada)
+}
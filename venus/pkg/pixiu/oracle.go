@@ -1,6 +1,8 @@
 package pixiu
 
 import (
+	"sync"
+
 	glog "github.com/vjoke/falcon/pkg/log"
 	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
 )
@@ -10,6 +12,9 @@ var oLog = glog.RegisterScope("oracle", "oracle", 0)
 // Oracle determines if it's right time for trading
 type Oracle struct {
 	arb            *Arbitrager
+	log            *glog.Scope
+	samples        *Subscription
+	mu             sync.Mutex
 	windowLen      uint64
 	slideDetect    bool
 	symbolsLen     uint64
@@ -27,13 +32,15 @@ type Oracle struct {
 func NewOracle(arb *Arbitrager) *Oracle {
 	o := &Oracle{
 		arb:            arb,
+		log:            oLog.WithLabels("policy", arb.name),
+		samples:        arb.bus.Subscribe(TOPIC_SAMPLE, "oracle", SAMPLE_BUFFER, OVERFLOW_DROP_OLDEST),
 		slideDetect:    arb.config.Policy.Sample.SlideDetect,
 		buy_threshold:  arb.config.Policy.Trigger.BuyThreshold,
 		sell_threshold: arb.config.Policy.Trigger.SellThreshold,
 		sell_on_fail:   arb.config.Policy.Trade.SellOnFall,
 		chase_up:       arb.config.Policy.Trade.ChaseUp,
 		epochMap:       make(map[string]*model.Epoch),
-		symbols:        arb.config.Policy.Symbols,
+		symbols:        arb.exch.ActiveSymbols(arb.config.Policy.Symbols),
 	}
 
 	windowLen := arb.config.Policy.Sample.Window.Duration.Seconds() / arb.config.Policy.Sample.Interval.Duration.Seconds()
@@ -52,75 +59,202 @@ func NewOracle(arb *Arbitrager) *Oracle {
 
 // Run begins the process for check prices
 func (o *Oracle) Run(stopCh <-chan struct{}) {
-	oLog.Info("worker is running")
+	heartbeat := o.arb.clock.NewTicker(HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	o.log.Info("worker is running")
 
 	for {
+		o.arb.health.Beat("oracle")
 		select {
 		case <-stopCh:
-			oLog.Info("worker is stopped")
+			o.log.Info("worker is stopped")
 			return
-		case sp := <-o.arb.priceChannel:
-			oLog.Infof("got new price %v", sp)
-			epoch, ok := o.epochMap[sp.Symbol]
-			if !ok {
-				oLog.Errorf("unknown symbol: %v", sp.Symbol)
-				break
+		case <-heartbeat.C():
+		case e := <-o.samples.C():
+			o.samples.received()
+			o.mu.Lock()
+			order := o.processPrice(e.Sample())
+			o.mu.Unlock()
+			if order != nil {
+				o.arb.CreateOrders(order)
 			}
+		}
+	}
+}
 
-			if sp.Tick < o.tick {
-				oLog.Errorf("stale tick %v < %v, ignored", sp.Tick, o.tick)
-				break
-			} else if sp.Tick == o.tick {
-				o.tickCount++
-			} else {
-				oLog.Infof("tick changed %v --> %v", o.tick, sp.Tick)
-				o.tick = sp.Tick
-				o.tickCount = 1
-			}
-			curSlot := &epoch.Slots[sp.Tick%o.windowLen]
-			curSlot.Tick = sp.Tick
-			curSlot.Price = sp.Price
-			curSlot.Direction = model.DRAW
-			// FIXME: Tick starts from 1, so it's not possibe to underflow
-			prevTick := sp.Tick - 1
-			prevSlot := &epoch.Slots[prevTick%o.windowLen]
-
-			if prevSlot.Tick != prevTick {
-				oLog.Warnf("previous slot: %v does not match: %v", prevSlot, prevTick)
-				break
-			}
-			var legend string
-			curSlot.Direction, legend = getPriceDirection(prevSlot.Price, curSlot.Price)
-			oLog.Infof("current tick:%v, direction:%v", sp.Tick, legend)
-			if o.isSlotMature() {
-				riseGroup, fallGroup, otherGroup := o.groupSymbolsByDirection(o.tick)
-				// FIXME: firstly, detect downtrend, then detect uptrend
-				if float64(len(fallGroup))/float64(o.symbolsLen) >= o.sell_threshold {
-					oLog.Infof("trigger sell orders with fall:%v/all:%v, threshod %v", len(fallGroup), o.symbolsLen, o.sell_threshold)
-					if o.sell_on_fail {
-						sellGroup := append(fallGroup, otherGroup...)
-						o.arb.CreateOrders(&model.Order{Type: model.SELL_ORDER, Symbols: sellGroup})
-					} else {
-						oLog.Warnf("do not sell because sell_on_fall is disabled!!!")
-					}
-				} else if float64(len(riseGroup))/float64(o.symbolsLen) >= o.buy_threshold {
-					oLog.Infof("trigger buy orders with rise:%v/all:%v, threshod %v", len(riseGroup), o.symbolsLen, o.buy_threshold)
-					buyGroup := otherGroup
-					if o.chase_up {
-						// FIXME: riseGroup first
-						buyGroup = append(riseGroup, buyGroup...)
-					}
-					if len(buyGroup) == 0 {
-						oLog.Warnf("empty buy group for orders, do nothing!")
-					} else {
-						o.arb.CreateOrders(&model.Order{Type: model.BUY_ORDER, Symbols: buyGroup})
-					}
-				} else {
-					oLog.Infof("not trigger sell/buy orders with fall:%v-rise:%v-all:%v, sell threshold:%v, buy threshold:%v", len(fallGroup), len(riseGroup), o.symbolsLen, o.sell_threshold, o.buy_threshold)
-				}
+// processPrice updates the epoch with the sample price and returns
+// the order to create if any
+func (o *Oracle) processPrice(sp *model.SamplePrice) *model.Order {
+	o.log.Infof("got new price %v", sp)
+	epoch, ok := o.epochMap[sp.Symbol]
+	if !ok {
+		o.log.Errorf("unknown symbol: %v", sp.Symbol)
+		return nil
+	}
+
+	if sp.Tick < o.tick {
+		o.log.Errorf("stale tick %v < %v, ignored", sp.Tick, o.tick)
+		return nil
+	} else if sp.Tick == o.tick {
+		o.tickCount++
+	} else {
+		o.log.Infof("tick changed %v --> %v", o.tick, sp.Tick)
+		o.tick = sp.Tick
+		o.tickCount = 1
+	}
+	curSlot := &epoch.Slots[sp.Tick%o.windowLen]
+	curSlot.Tick = sp.Tick
+	curSlot.Price = sp.Price
+	curSlot.Direction = model.DRAW
+	// FIXME: Tick starts from 1, so it's not possibe to underflow
+	prevTick := sp.Tick - 1
+	prevSlot := &epoch.Slots[prevTick%o.windowLen]
+
+	if prevSlot.Tick != prevTick {
+		o.log.Warnf("previous slot: %v does not match: %v", prevSlot, prevTick)
+		return nil
+	}
+	var legend string
+	curSlot.Direction, legend = getPriceDirection(prevSlot.Price, curSlot.Price)
+	o.log.Infof("current tick:%v, direction:%v", sp.Tick, legend)
+	if !o.isSlotMature() {
+		return nil
+	}
+
+	riseGroup, fallGroup, otherGroup := o.groupSymbolsByDirection(o.tick)
+	decision := &Decision{
+		Tick:   o.tick,
+		Time:   o.arb.clock.Now().Format(TIME_FORMAT),
+		Action: DECISION_NONE,
+		Rise:   len(riseGroup),
+		Fall:   len(fallGroup),
+		Total:  int(o.symbolsLen),
+	}
+	defer func() {
+		o.arb.decisions.Add(decision)
+		decisionsTotal.With(o.arb.name, decision.Action).Inc()
+		o.arb.publish(TOPIC_SIGNAL, decision)
+	}()
+	// FIXME: firstly, detect downtrend, then detect uptrend
+	if float64(len(fallGroup))/float64(o.symbolsLen) >= o.sell_threshold {
+		o.log.Infof("trigger sell orders with fall:%v/all:%v, threshod %v", len(fallGroup), o.symbolsLen, o.sell_threshold)
+		if o.sell_on_fail {
+			sellGroup := append(fallGroup, otherGroup...)
+			decision.Action, decision.Symbols = DECISION_SELL, sellGroup
+			return &model.Order{Type: model.SELL_ORDER, Symbols: sellGroup}
+		}
+		o.log.Warnf("do not sell because sell_on_fall is disabled!!!")
+		decision.Reason = "sell_on_fall is disabled"
+	} else if float64(len(riseGroup))/float64(o.symbolsLen) >= o.buy_threshold {
+		o.log.Infof("trigger buy orders with rise:%v/all:%v, threshod %v", len(riseGroup), o.symbolsLen, o.buy_threshold)
+		buyGroup := otherGroup
+		if o.chase_up {
+			// FIXME: riseGroup first
+			buyGroup = append(riseGroup, buyGroup...)
+		}
+		if len(buyGroup) == 0 {
+			o.log.Warnf("empty buy group for orders, do nothing!")
+			decision.Reason = "empty buy group"
+		} else {
+			decision.Action, decision.Symbols = DECISION_BUY, buyGroup
+			return &model.Order{Type: model.BUY_ORDER, Symbols: buyGroup}
+		}
+	} else {
+		o.log.Infof("not trigger sell/buy orders with fall:%v-rise:%v-all:%v, sell threshold:%v, buy threshold:%v", len(fallGroup), len(riseGroup), o.symbolsLen, o.sell_threshold, o.buy_threshold)
+	}
+
+	return nil
+}
+
+// EpochStatus defines the status of an epoch for inspecting
+type EpochStatus struct {
+	Symbol    string       `json:"symbol"`
+	Direction string       `json:"direction"`
+	Slots     []model.Slot `json:"slots"`
+}
+
+// Snapshot returns the status of all the epochs
+func (o *Oracle) Snapshot() []*EpochStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	directions := make(map[string]string)
+	if o.tick >= o.windowLen {
+		riseGroup, fallGroup, _ := o.groupSymbolsByDirection(o.tick)
+		for _, symbol := range riseGroup {
+			directions[symbol] = "rise"
+		}
+		for _, symbol := range fallGroup {
+			directions[symbol] = "fall"
+		}
+	}
+
+	r := make([]*EpochStatus, 0, len(o.symbols))
+	for _, symbol := range o.symbols {
+		epoch := o.epochMap[symbol]
+		slots := make([]model.Slot, len(epoch.Slots))
+		copy(slots, epoch.Slots)
+		direction, ok := directions[symbol]
+		if !ok {
+			direction = "other"
+		}
+		r = append(r, &EpochStatus{
+			Symbol:    symbol,
+			Direction: direction,
+			Slots:     slots,
+		})
+	}
+
+	return r
+}
+
+// apply applies the detecting parameters of a reloaded config, epochs of
+// new symbols are created and epochs of removed symbols are dropped, only
+// the symbols trading on the exchange are detected
+func (o *Oracle) apply(conf *model.Config) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.slideDetect = conf.Policy.Sample.SlideDetect
+	o.buy_threshold = conf.Policy.Trigger.BuyThreshold
+	o.sell_threshold = conf.Policy.Trigger.SellThreshold
+	o.sell_on_fail = conf.Policy.Trade.SellOnFall
+	o.chase_up = conf.Policy.Trade.ChaseUp
+	o.updateEpochs(o.arb.exch.ActiveSymbols(conf.Policy.Symbols))
+}
+
+// setSymbols sets the symbols to detect
+func (o *Oracle) setSymbols(symbols []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.updateEpochs(symbols)
+}
+
+// updateEpochs creates the epochs of new symbols and drops the epochs of
+// removed symbols, the lock must be held
+func (o *Oracle) updateEpochs(symbols []string) {
+	epochMap := make(map[string]*model.Epoch)
+	for _, symbol := range symbols {
+		epoch, ok := o.epochMap[symbol]
+		if !ok {
+			o.log.Infof("add epoch for %v", symbol)
+			epoch = &model.Epoch{
+				Symbol: symbol,
+				Slots:  make([]model.Slot, o.windowLen),
 			}
 		}
+		epochMap[symbol] = epoch
+	}
+	for symbol := range o.epochMap {
+		if _, ok := epochMap[symbol]; !ok {
+			o.log.Infof("remove epoch for %v", symbol)
+		}
 	}
+
+	o.epochMap = epochMap
+	o.symbols = symbols
+	o.symbolsLen = uint64(len(o.symbols))
 }
 
 // isSlotMature check if the slot is mature for detecting
@@ -137,15 +271,15 @@ func (o *Oracle) isSlotMature() bool {
 }
 
 // getPriceDirection returns the price change direction and legend
-func getPriceDirection(prevPrice, curPrice float64) (int32, string) {
+func getPriceDirection(prevPrice, curPrice model.Decimal) (int32, string) {
 	colorGreen := "\033[32m"
 	colorRed := "\033[31m"
 
-	if prevPrice < curPrice {
+	if prevPrice.LessThan(curPrice) {
 		return model.RISE, colorGreen + "↗"
 	}
 
-	if prevPrice > curPrice {
+	if prevPrice.GreaterThan(curPrice) {
 		return model.FALL, colorRed + "↘"
 	}
 
@@ -163,7 +297,7 @@ func (o *Oracle) groupSymbolsByDirection(tick uint64) ([]string, []string, []str
 		var i uint64 = 0
 		for ; i < o.windowLen; i++ {
 			if tick < i {
-				oLog.Warnf("slot tick skew, tick:%v, i:%v", tick, i)
+				o.log.Warnf("slot tick skew, tick:%v, i:%v", tick, i)
 				break
 			}
 			// FIXME: is algorithm ok?
@@ -171,7 +305,7 @@ func (o *Oracle) groupSymbolsByDirection(tick uint64) ([]string, []string, []str
 			if slot.Tick == (tick - i) {
 				totalScore += slot.Direction
 			} else {
-				oLog.Warnf("slot tick mismatch, expected:%v, actual:%v", tick-i, slot.Tick)
+				o.log.Warnf("slot tick mismatch, expected:%v, actual:%v", tick-i, slot.Tick)
 				break
 			}
 		}
@@ -0,0 +1,227 @@
+package pixiu
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	glog "github.com/vjoke/falcon/pkg/log"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+var obLog = glog.RegisterScope("orderbook", "orderbook", 0)
+
+const (
+	// DEPTH_LIMIT is the number of levels fetched of each side, the weight
+	// of the request is 1 up to 100 levels
+	DEPTH_LIMIT = 100
+	// DEPTH_MAX_AGE is the age of a depth reused for pricing and estimates
+	DEPTH_MAX_AGE = time.Second
+)
+
+// Level defines a price level of an order book
+type Level struct {
+	Price    model.Decimal `json:"price"`
+	Quantity model.Decimal `json:"quantity"`
+}
+
+// Depth defines a snapshot of the order book of a symbol, the best levels
+// are first
+type Depth struct {
+	Symbol string    `json:"symbol"`
+	Bids   []Level   `json:"bids"`
+	Asks   []Level   `json:"asks"`
+	Time   time.Time `json:"time"`
+}
+
+// Estimate defines the expected execution of a market order by the order
+// book, a buy is of Quote and a sell is of Base
+type Estimate struct {
+	Quote model.Decimal `json:"quote"`
+	Mid   model.Decimal `json:"mid"`
+	// VWAP is the average price of the levels taken by the quote
+	VWAP model.Decimal `json:"vwap"`
+	Base model.Decimal `json:"base"`
+	// Slippage is the relative cost of the VWAP to the mid price
+	Slippage model.Decimal `json:"slippage"`
+	// Filled is false if the book is too thin for the order, the estimate
+	// covers the whole side then
+	Filled bool `json:"filled"`
+}
+
+// Mid returns the price between the best bid and the best ask
+func (d *Depth) Mid() (model.Decimal, error) {
+	if len(d.Bids) == 0 || len(d.Asks) == 0 {
+		return model.Decimal{}, fmt.Errorf("order book of %v has an empty side", d.Symbol)
+	}
+	return d.Bids[0].Price.Add(d.Asks[0].Price).Div(model.NewDecimal(2, 0)), nil
+}
+
+// EstimateBuy estimates a market buy of quote by taking the asks
+func (d *Depth) EstimateBuy(quote model.Decimal) (*Estimate, error) {
+	mid, err := d.Mid()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Estimate{Quote: quote, Mid: mid}
+	var spent model.Decimal
+	for _, l := range d.Asks {
+		left := quote.Sub(spent)
+		if left.Sign() <= 0 {
+			break
+		}
+		if notional := l.Price.Mul(l.Quantity); notional.LessThan(left) {
+			spent = spent.Add(notional)
+			e.Base = e.Base.Add(l.Quantity)
+			continue
+		}
+		spent = quote
+		e.Base = e.Base.Add(left.Div(l.Price))
+	}
+
+	e.Filled = !spent.LessThan(quote)
+	if e.Base.Sign() > 0 {
+		e.VWAP = spent.Div(e.Base)
+		e.Slippage = e.VWAP.Div(mid).Sub(model.NewDecimal(1, 0))
+	}
+	return e, nil
+}
+
+// EstimateSell estimates a market sell of base by taking the bids
+func (d *Depth) EstimateSell(base model.Decimal) (*Estimate, error) {
+	mid, err := d.Mid()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Estimate{Base: base, Mid: mid}
+	var sold model.Decimal
+	for _, l := range d.Bids {
+		left := base.Sub(sold)
+		if left.Sign() <= 0 {
+			break
+		}
+		quantity := l.Quantity.Min(left)
+		sold = sold.Add(quantity)
+		e.Quote = e.Quote.Add(quantity.Mul(l.Price))
+	}
+
+	e.Filled = !sold.LessThan(base)
+	if sold.Sign() > 0 {
+		e.VWAP = e.Quote.Div(sold)
+		e.Slippage = model.NewDecimal(1, 0).Sub(e.VWAP.Div(mid))
+	}
+	return e, nil
+}
+
+// MaxBuy returns the largest quote of a market buy whose VWAP is within
+// the slippage to the mid price, it is the notional of the whole book if
+// the book is too thin to exceed the slippage. It fails if even the best
+// ask exceeds the slippage
+func (d *Depth) MaxBuy(slippage model.Decimal) (model.Decimal, error) {
+	mid, err := d.Mid()
+	if err != nil {
+		return model.Decimal{}, err
+	}
+
+	limit := mid.Mul(model.NewDecimal(1, 0).Add(slippage))
+	var quote, base model.Decimal
+	for _, l := range d.Asks {
+		quantity := l.Quantity
+		if l.Price.GreaterThan(limit) {
+			// the quantity which keeps the VWAP at the limit,
+			// (quote + q * price) / (base + q) = limit
+			quantity = quantity.Min(limit.Mul(base).Sub(quote).Div(l.Price.Sub(limit)))
+		}
+		if quantity.Sign() <= 0 {
+			break
+		}
+		quote = quote.Add(quantity.Mul(l.Price))
+		base = base.Add(quantity)
+		if quantity.LessThan(l.Quantity) {
+			break
+		}
+	}
+	if quote.Sign() <= 0 {
+		return model.Decimal{}, fmt.Errorf("best ask exceeds the slippage limit %v of mid price %v", limit, mid)
+	}
+	return quote, nil
+}
+
+// OrderBook fetches the depth of the active symbols for pricing and for
+// estimating the slippage of orders
+type OrderBook struct {
+	arb    *Arbitrager
+	log    *glog.Scope
+	client *binance.Client
+	mu     sync.Mutex
+	depths map[string]*Depth
+}
+
+// NewOrderBook creates an order book without any depth
+func NewOrderBook(arb *Arbitrager) *OrderBook {
+	return &OrderBook{
+		arb:    arb,
+		log:    obLog.WithLabels("policy", arb.name),
+		client: arb.shared.Client(arb.config.Exchange.ApiKey.Value(), arb.config.Exchange.SecretKey.Value()),
+		depths: make(map[string]*Depth),
+	}
+}
+
+// Depth returns the depth of a trading symbol, a depth younger than
+// DEPTH_MAX_AGE is reused
+func (b *OrderBook) Depth(symbol string) (*Depth, error) {
+	if !b.arb.exch.Trading(symbol) {
+		return nil, fmt.Errorf("%v is not trading", symbol)
+	}
+
+	b.mu.Lock()
+	d, ok := b.depths[symbol]
+	b.mu.Unlock()
+	if ok && b.arb.clock.Since(d.Time) < DEPTH_MAX_AGE {
+		return d, nil
+	}
+
+	ctx, cancel := b.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	res, err := b.client.NewDepthService().Symbol(symbol).Limit(DEPTH_LIMIT).Do(ctx)
+	b.arb.observeRequest(model.OP_MARKET_DATA, err)
+	if err != nil {
+		depthRequests.With(b.arb.name, RESULT_FAILURE).Inc()
+		return nil, err
+	}
+	depthRequests.With(b.arb.name, RESULT_SUCCESS).Inc()
+
+	d = &Depth{Symbol: symbol, Time: b.arb.clock.Now()}
+	for _, bid := range res.Bids {
+		if d.Bids, err = appendLevel(d.Bids, bid.Price, bid.Quantity); err != nil {
+			return nil, err
+		}
+	}
+	for _, ask := range res.Asks {
+		if d.Asks, err = appendLevel(d.Asks, ask.Price, ask.Quantity); err != nil {
+			return nil, err
+		}
+	}
+	b.log.Debugf("depth of %v has %v bids and %v asks", symbol, len(d.Bids), len(d.Asks))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.depths[symbol] = d
+	return d, nil
+}
+
+// appendLevel parses a level and appends it to levels
+func appendLevel(levels []Level, price, quantity string) ([]Level, error) {
+	p, err := model.ParseDecimal(price)
+	if err != nil {
+		return nil, fmt.Errorf("invalid price %q of depth: %v", price, err)
+	}
+	q, err := model.ParseDecimal(quantity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quantity %q of depth: %v", quantity, err)
+	}
+	return append(levels, Level{Price: p, Quantity: q}), nil
+}
@@ -0,0 +1,199 @@
+package pixiu
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+type orderBookTestSuite struct {
+	suite.Suite
+}
+
+func TestOrderBook(t *testing.T) {
+	suite.Run(t, new(orderBookTestSuite))
+}
+
+// newTestDepth creates a depth with a mid price of 1 and asks of 10 base
+// at 1.1, 1.2 and 1.3
+func newTestDepth() *Depth {
+	return &Depth{
+		Symbol: "ADAUSDT",
+		Bids:   []Level{{dec("0.9"), dec("10")}},
+		Asks:   []Level{{dec("1.1"), dec("10")}, {dec("1.2"), dec("10")}, {dec("1.3"), dec("10")}},
+	}
+}
+
+func (o *orderBookTestSuite) TestEstimateBuy() {
+	d := newTestDepth()
+	mid, err := d.Mid()
+	assert.NoError(o.T(), err)
+	assert.Equal(o.T(), dec("1"), mid)
+
+	e, err := d.EstimateBuy(dec("11"))
+	assert.NoError(o.T(), err)
+	assert.True(o.T(), e.Filled)
+	assert.Equal(o.T(), dec("10"), e.Base)
+	assert.Equal(o.T(), dec("1.1"), e.VWAP)
+	assert.Equal(o.T(), dec("0.1"), e.Slippage)
+
+	e, err = d.EstimateBuy(dec("23"))
+	assert.NoError(o.T(), err)
+	assert.True(o.T(), e.Filled)
+	assert.Equal(o.T(), dec("20"), e.Base)
+	assert.Equal(o.T(), dec("0.15"), e.Slippage)
+
+	// the book is too thin
+	e, err = d.EstimateBuy(dec("100"))
+	assert.NoError(o.T(), err)
+	assert.False(o.T(), e.Filled)
+	assert.Equal(o.T(), dec("30"), e.Base)
+	assert.Equal(o.T(), dec("1.2"), e.VWAP)
+
+	d.Bids = nil
+	_, err = d.Mid()
+	assert.Error(o.T(), err)
+	_, err = d.EstimateBuy(dec("11"))
+	assert.Error(o.T(), err)
+}
+
+func (o *orderBookTestSuite) TestEstimateSell() {
+	d := newTestDepth()
+	d.Bids = []Level{{dec("0.9"), dec("10")}, {dec("0.8"), dec("10")}}
+
+	e, err := d.EstimateSell(dec("15"))
+	assert.NoError(o.T(), err)
+	assert.True(o.T(), e.Filled)
+	assert.Equal(o.T(), dec("13"), e.Quote)
+	assert.Equal(o.T(), dec("0.86666666"), e.VWAP)
+
+	e, err = d.EstimateSell(dec("30"))
+	assert.NoError(o.T(), err)
+	assert.False(o.T(), e.Filled)
+	assert.Equal(o.T(), dec("17"), e.Quote)
+	assert.Equal(o.T(), dec("0.85"), e.VWAP)
+}
+
+func (o *orderBookTestSuite) TestMaxBuy() {
+	d := newTestDepth()
+	for _, c := range []struct {
+		slippage string
+		quote    string
+	}{
+		{"0.1", "11"},
+		// 2.5 base of the second level keeps the vwap at 1.12
+		{"0.12", "14"},
+		{"0.15", "23"},
+		{"1", "36"},
+	} {
+		quote, err := d.MaxBuy(dec(c.slippage))
+		assert.NoError(o.T(), err)
+		assert.Equal(o.T(), dec(c.quote), quote, c.slippage)
+		e, _ := d.EstimateBuy(quote)
+		assert.False(o.T(), e.Slippage.GreaterThan(dec(c.slippage)), c.slippage)
+	}
+
+	// even the best ask exceeds the slippage
+	_, err := d.MaxBuy(dec("0.05"))
+	assert.Error(o.T(), err)
+}
+
+func (o *orderBookTestSuite) TestNotTrading() {
+	a := newTestArbitrager(newTestConfig(), "ADAUSDT", "DOTUSDT")
+	_, err := a.orderBook.Depth("BTCUSDT")
+	assert.Error(o.T(), err)
+}
+
+// newThinArbitrager creates an arbitrager of a mock exchange whose asks of
+// ADAUSDT are 5 base at each cent above 1
+func (o *orderBookTestSuite) newThinArbitrager(slippage *model.Slippage) (*Arbitrager, func()) {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	script.Symbols[0].TickSize = 0.01
+	script.Symbols[0].Liquidity = 5
+	server := httptest.NewServer(mockexchange.New(script))
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	conf.Exchange.DisableUserStream = true
+	conf.Policy.Trade.Slippage = slippage
+	a, err := NewArbitrager(conf, NewShared(0))
+	o.Require().NoError(err)
+	return a, server.Close
+}
+
+func (o *orderBookTestSuite) TestMidPrice() {
+	a, stop := o.newThinArbitrager(nil)
+	defer stop()
+	samples := a.bus.Subscribe(TOPIC_SAMPLE, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	a.fetcher.queryPrice("ADAUSDT", model.MID_PRICE, 1)
+	o.Require().Equal(1, samples.Len())
+	assert.Equal(o.T(), dec("1"), (<-samples.C()).Sample().Price)
+
+	// the depth is reused within DEPTH_MAX_AGE
+	d, err := a.orderBook.Depth("ADAUSDT")
+	assert.NoError(o.T(), err)
+	again, err := a.orderBook.Depth("ADAUSDT")
+	assert.NoError(o.T(), err)
+	assert.True(o.T(), d == again)
+}
+
+func (o *orderBookTestSuite) TestSkip() {
+	a, stop := o.newThinArbitrager(&model.Slippage{Max: 0.02})
+	defer stop()
+	results := a.bus.Subscribe(TOPIC_ORDER_RESULT, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	// 20 USDT takes 4 levels with a vwap of about 1.0246
+	a.trader.inflight.Add(1)
+	a.trader.buyOrder("ADAUSDT", dec("20"))
+	o.Require().Equal(1, results.Len())
+	assert.Contains(o.T(), (<-results.C()).OrderResult().Error, "slippage")
+	free, _, err := a.account.GetBalance("USDT")
+	assert.NoError(o.T(), err)
+	assert.Equal(o.T(), dec("1000"), free)
+
+	// a smaller buy is within the limit
+	a.trader.inflight.Add(1)
+	a.trader.buyOrder("ADAUSDT", dec("12"))
+	free, _, err = a.account.GetBalance("USDT")
+	assert.NoError(o.T(), err)
+	assert.Equal(o.T(), dec("988"), free)
+}
+
+func (o *orderBookTestSuite) TestShrink() {
+	a, stop := o.newThinArbitrager(&model.Slippage{Max: 0.02, Action: model.SLIPPAGE_SHRINK})
+	defer stop()
+
+	// 15.3 USDT of the first 3 levels keeps the vwap at 1.02
+	o.Require().True(a.shared.Budget().Reserve(a.name, "ADAUSDT", dec("20")))
+	a.trader.inflight.Add(1)
+	a.trader.buyOrder("ADAUSDT", dec("20"))
+	free, _, err := a.account.GetBalance("USDT")
+	assert.NoError(o.T(), err)
+	assert.Equal(o.T(), dec("984.7"), free)
+	_, ok := a.trader.book.Get("ADAUSDT")
+	assert.True(o.T(), ok)
+	// only the shrunk quote is reserved
+	assert.Equal(o.T(), dec("15.3"), a.shared.Budget().Exposure(a.name))
+}
+
+func (o *orderBookTestSuite) TestShrinkBelowBestAsk() {
+	a, stop := o.newThinArbitrager(&model.Slippage{Max: 0.005, Action: model.SLIPPAGE_SHRINK})
+	defer stop()
+	results := a.bus.Subscribe(TOPIC_ORDER_RESULT, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	// the best ask 1.01 is above the limit 1.005
+	o.Require().True(a.shared.Budget().Reserve(a.name, "ADAUSDT", dec("20")))
+	a.trader.inflight.Add(1)
+	a.trader.buyOrder("ADAUSDT", dec("20"))
+	o.Require().Equal(1, results.Len())
+	assert.Contains(o.T(), (<-results.C()).OrderResult().Error, "best ask exceeds the slippage limit")
+	free, _, err := a.account.GetBalance("USDT")
+	assert.NoError(o.T(), err)
+	assert.Equal(o.T(), dec("1000"), free)
+	assert.True(o.T(), a.shared.Budget().Exposure(a.name).IsZero())
+}
@@ -0,0 +1,59 @@
+package pixiu
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// workerPanics holds the panics of the goroutines spawned by the workers,
+// a worker fails with the first panic of its goroutines so that it is
+// restarted by the supervisor like a panic of its own
+type workerPanics struct {
+	mu    sync.Mutex
+	chans map[string]chan error
+}
+
+func newWorkerPanics() *workerPanics {
+	return &workerPanics{chans: make(map[string]chan error)}
+}
+
+// C returns the channel of the panics of the goroutines of a worker
+func (p *workerPanics) C(worker string) <-chan error {
+	return p.ch(worker)
+}
+
+func (p *workerPanics) ch(worker string) chan error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, ok := p.chans[worker]
+	if !ok {
+		ch = make(chan error, 1)
+		p.chans[worker] = ch
+	}
+	return ch
+}
+
+// report reports a panic of a worker, only the first one is kept until
+// the worker receives it
+func (p *workerPanics) report(worker string, err error) {
+	select {
+	case p.ch(worker) <- err:
+	default:
+	}
+}
+
+// spawn runs fn in a goroutine of a worker, its panic is recovered and
+// fails the worker
+func (a *Arbitrager) spawn(worker string, fn func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				a.log.Errorf("panic in goroutine of %v: %v\n%s", worker, r, debug.Stack())
+				a.panics.report(worker, fmt.Errorf("panic in goroutine of %v: %v", worker, r))
+			}
+		}()
+		fn()
+	}()
+}
@@ -0,0 +1,97 @@
+package pixiu
+
+import (
+	"sync"
+	"time"
+
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+// Entry defines the entry of a position opened by the trader
+type Entry struct {
+	Symbol   string        `json:"symbol"`
+	Price    model.Decimal `json:"price"`
+	Quantity model.Decimal `json:"quantity"`
+	Time     time.Time     `json:"time"`
+}
+
+// PositionBook keeps the entries of positions opened by the trader, so that
+// profit and loss can be calculated when they are closed
+type PositionBook struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+// NewPositionBook creates an empty position book
+func NewPositionBook() *PositionBook {
+	return &PositionBook{
+		entries: make(map[string]*Entry),
+	}
+}
+
+// Open records an entry, the average price is used when adding to an
+// existing position
+func (b *PositionBook) Open(symbol string, price, quantity model.Decimal, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[symbol]
+	if !ok {
+		b.entries[symbol] = &Entry{
+			Symbol:   symbol,
+			Price:    price,
+			Quantity: quantity,
+			Time:     now,
+		}
+		return
+	}
+
+	total := e.Quantity.Add(quantity)
+	if total.Sign() > 0 {
+		e.Price = e.Price.Mul(e.Quantity).Add(price.Mul(quantity)).Div(total)
+	}
+	e.Quantity = total
+	e.Time = now
+}
+
+// Close removes quantity from a position at the exit price and returns the
+// profit and loss, ok is false if there is no entry for the symbol
+func (b *PositionBook) Close(symbol string, price, quantity model.Decimal) (model.Decimal, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[symbol]
+	if !ok {
+		return model.Decimal{}, false
+	}
+
+	quantity = quantity.Min(e.Quantity)
+	pnl := price.Sub(e.Price).Mul(quantity)
+	e.Quantity = e.Quantity.Sub(quantity)
+	if e.Quantity.Sign() <= 0 {
+		delete(b.entries, symbol)
+	}
+
+	return pnl, true
+}
+
+// Get returns a copy of the entry of a symbol
+func (b *PositionBook) Get(symbol string) (Entry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[symbol]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// Remove drops the entry of a symbol, e.g. when the position is closed by
+// an oco order on the exchange
+func (b *PositionBook) Remove(symbol string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.entries, symbol)
+}
@@ -0,0 +1,48 @@
+package pixiu
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type positionTestSuite struct {
+	suite.Suite
+	book *PositionBook
+}
+
+func TestPosition(t *testing.T) {
+	suite.Run(t, new(positionTestSuite))
+}
+
+func (p *positionTestSuite) SetupTest() {
+	p.book = NewPositionBook()
+}
+
+func (p *positionTestSuite) TestOpenAndClose() {
+	p.book.Open("ADAUSDT", dec("1"), dec("10"), time.Now())
+	p.book.Open("ADAUSDT", dec("2"), dec("10"), time.Now())
+
+	e, ok := p.book.Get("ADAUSDT")
+	assert.True(p.T(), ok)
+	assert.Equal(p.T(), dec("1.5"), e.Price)
+	assert.Equal(p.T(), dec("20"), e.Quantity)
+
+	pnl, ok := p.book.Close("ADAUSDT", dec("2"), dec("5"))
+	assert.True(p.T(), ok)
+	assert.Equal(p.T(), dec("2.5"), pnl)
+
+	pnl, ok = p.book.Close("ADAUSDT", dec("1"), dec("100"))
+	assert.True(p.T(), ok)
+	assert.Equal(p.T(), dec("-7.5"), pnl)
+
+	_, ok = p.book.Get("ADAUSDT")
+	assert.False(p.T(), ok)
+}
+
+func (p *positionTestSuite) TestCloseUnknown() {
+	_, ok := p.book.Close("DOTUSDT", dec("1"), dec("1"))
+	assert.False(p.T(), ok)
+}
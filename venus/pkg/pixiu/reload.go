@@ -0,0 +1,78 @@
+package pixiu
+
+import (
+	"fmt"
+
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+// Reload reloads the config file of the arbitrager and applies the safe
+// changes to all the components, nothing is applied if any change is unsafe
+func (a *Arbitrager) Reload() error {
+	if a.configFile == "" {
+		return fmt.Errorf("no config file to reload")
+	}
+
+	conf, err := model.LoadConfigFromFile(a.configFile)
+	if err != nil {
+		return err
+	}
+
+	return a.ApplyConfig(conf)
+}
+
+// ApplyConfig verifies a new config and applies it atomically
+func (a *Arbitrager) ApplyConfig(conf *model.Config) error {
+	if err := model.VerifyConfig(conf); err != nil {
+		return err
+	}
+
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	changes, err := model.DiffConfig(a.Conf(), conf)
+	if err != nil {
+		a.log.Errorf("reject reloaded config: %v", err)
+		return err
+	}
+	if len(changes) == 0 {
+		a.log.Info("config is not changed")
+		return nil
+	}
+
+	if err := a.exch.PrepareSymbols(conf.Policy.Symbols); err != nil {
+		a.log.Errorf("reject reloaded config: %v", err)
+		return err
+	}
+
+	if err := a.shared.Claim(a.name, conf.Exchange.ApiKey.Value(), conf.Policy.Symbols); err != nil {
+		a.log.Errorf("reject reloaded config: %v", err)
+		return err
+	}
+
+	for _, c := range changes {
+		a.log.Infof("config changed, %v", c)
+	}
+
+	a.fetcher.apply(conf)
+	a.oracle.apply(conf)
+	a.trader.apply(conf)
+	if a.triangular != nil {
+		a.triangular.apply(conf)
+	}
+
+	a.configMu.Lock()
+	a.config = conf
+	a.configMu.Unlock()
+
+	a.log.Infof("applied %v changes of config", len(changes))
+	return nil
+}
+
+// Conf returns the running config
+func (a *Arbitrager) Conf() *model.Config {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+
+	return a.config
+}
@@ -0,0 +1,166 @@
+package pixiu
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+const testConfig = `
+[exchange]
+    name = "binance"
+    api_key = "key"
+    secret_key = "secret"
+[policy]
+    name = "test"
+    dryrun = true
+    symbols = ["ADAUSDT", "DOTUSDT"]
+    [policy.sample]
+        interval = "1m"
+        window = "3m"
+        price_mode = "realtime"
+    [policy.trigger]
+        sell_threshold = 0.6
+        buy_threshold = 0.3
+    [policy.trade]
+        stop_loss = 0.02
+        stop_profit = 0.008
+        position = 1.0
+        usdt_per_buy = 12.0
+        max_usdt_per_buy = 20.0
+        [policy.trade.span]
+            from = "00h00m00s"
+            to = "24h00m00s"
+[res]
+`
+
+// newTestConfig decodes the test config
+func newTestConfig() *model.Config {
+	var conf model.Config
+	if _, err := toml.Decode(testConfig, &conf); err != nil {
+		panic(err)
+	}
+	return &conf
+}
+
+// newTestSymbol creates a symbol with lot size and price filters
+func newTestSymbol(symbol string) *binance.Symbol {
+	return &binance.Symbol{
+		Symbol:     symbol,
+		Status:     string(binance.SymbolStatusTypeTrading),
+		BaseAsset:  symbol[:len(symbol)-4],
+		QuoteAsset: "USDT",
+		Filters: []map[string]interface{}{
+			{"filterType": "LOT_SIZE", "minQty": "0.10000000", "maxQty": "900000.00000000", "stepSize": "0.10000000"},
+			{"filterType": "PRICE_FILTER", "minPrice": "0.00010000", "maxPrice": "1000.00000000", "tickSize": "0.00010000"},
+		},
+	}
+}
+
+// dec parses a decimal of tests
+func dec(s string) model.Decimal {
+	return model.MustParseDecimal(s)
+}
+
+// newTestArbitrager creates an arbitrager without accessing the exchange
+func newTestArbitrager(conf *model.Config, symbols ...string) *Arbitrager {
+	return newSharedTestArbitrager(NewShared(0), conf, symbols...)
+}
+
+// newSharedTestArbitrager creates an arbitrager with the shared resources
+func newSharedTestArbitrager(shared *Shared, conf *model.Config, symbols ...string) *Arbitrager {
+	a := newArbitrager(conf, shared)
+	if err := shared.Register(a.name, conf.Policy.Testnet, conf.Exchange.BaseURL); err != nil {
+		panic(err)
+	}
+	if err := shared.Claim(a.name, conf.Exchange.ApiKey.Value(), conf.Policy.Symbols); err != nil {
+		panic(err)
+	}
+	a.exch = &Exchange{
+		arb:       a,
+		log:       eLog,
+		symbolMap: make(map[string]*binance.Symbol),
+		extraMap:  make(map[string]*FilterExtra),
+	}
+	for _, symbol := range symbols {
+		a.exch.symbolMap[symbol] = newTestSymbol(symbol)
+	}
+	if err := a.exch.PrepareSymbols(conf.Policy.Symbols); err != nil {
+		panic(err)
+	}
+	a.initComponents()
+	return a
+}
+
+type reloadTestSuite struct {
+	suite.Suite
+	arb *Arbitrager
+}
+
+func TestReload(t *testing.T) {
+	suite.Run(t, new(reloadTestSuite))
+}
+
+func (r *reloadTestSuite) SetupTest() {
+	r.arb = newTestArbitrager(newTestConfig(), "ADAUSDT", "DOTUSDT", "XRPUSDT")
+}
+
+func (r *reloadTestSuite) TestApplySafeChanges() {
+	conf := newTestConfig()
+	conf.Policy.Symbols = []string{"ADAUSDT", "XRPUSDT"}
+	conf.Policy.Trigger.BuyThreshold = 0.5
+	conf.Policy.Trade.StopProfit = 0.01
+
+	assert.Nil(r.T(), r.arb.ApplyConfig(conf))
+	assert.Equal(r.T(), conf, r.arb.Conf())
+	assert.Equal(r.T(), []string{"ADAUSDT", "XRPUSDT"}, r.arb.fetcher.symbols)
+	assert.Equal(r.T(), 0.5, r.arb.oracle.buy_threshold)
+	assert.Equal(r.T(), uint64(2), r.arb.oracle.symbolsLen)
+	assert.Contains(r.T(), r.arb.oracle.epochMap, "XRPUSDT")
+	assert.NotContains(r.T(), r.arb.oracle.epochMap, "DOTUSDT")
+	assert.Equal(r.T(), 0.01, r.arb.trader.stop_profit)
+	assert.NotNil(r.T(), r.arb.exch.getExtra("XRPUSDT"))
+}
+
+func (r *reloadTestSuite) TestRejectUnknownSymbol() {
+	conf := newTestConfig()
+	conf.Policy.Symbols = []string{"ADAUSDT", "FOOUSDT"}
+	conf.Policy.Trigger.BuyThreshold = 0.5
+
+	assert.NotNil(r.T(), r.arb.ApplyConfig(conf))
+	assert.Equal(r.T(), 0.3, r.arb.oracle.buy_threshold)
+	assert.Equal(r.T(), []string{"ADAUSDT", "DOTUSDT"}, r.arb.Conf().Policy.Symbols)
+}
+
+func (r *reloadTestSuite) TestRejectUnsafeChanges() {
+	conf := newTestConfig()
+	conf.Exchange.ApiKey = "another"
+	conf.Policy.Trigger.BuyThreshold = 0.5
+
+	err := r.arb.ApplyConfig(conf)
+	assert.NotNil(r.T(), err)
+	assert.Contains(r.T(), err.Error(), "exchange.api_key")
+	assert.Equal(r.T(), 0.3, r.arb.oracle.buy_threshold)
+}
+
+func (r *reloadTestSuite) TestRejectSymbolOfOtherPolicy() {
+	other := newTestConfig()
+	other.Policy.Name = "other"
+	other.Policy.Symbols = []string{"XRPUSDT"}
+	newSharedTestArbitrager(r.arb.shared, other, "XRPUSDT")
+
+	conf := newTestConfig()
+	conf.Policy.Symbols = []string{"ADAUSDT", "XRPUSDT"}
+	err := r.arb.ApplyConfig(conf)
+	assert.NotNil(r.T(), err)
+	assert.Contains(r.T(), err.Error(), "XRPUSDT(other)")
+
+	// Symbols released by a reload can be claimed by other policies
+	conf.Policy.Symbols = []string{"ADAUSDT"}
+	assert.Nil(r.T(), r.arb.ApplyConfig(conf))
+	assert.Nil(r.T(), r.arb.shared.Claim("other", "key", []string{"XRPUSDT", "DOTUSDT"}))
+}
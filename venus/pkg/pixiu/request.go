@@ -0,0 +1,35 @@
+package pixiu
+
+import (
+	"context"
+	"errors"
+
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+// requestContext returns the context of an exchange request of an
+// operation class with the timeout of the class. Requests are canceled when
+// the arbitrager is stopped, except orders and the requests made by Stop,
+// which are canceled at the shutdown deadline, so that in-flight orders and
+// the exit policy can complete.
+func (a *Arbitrager) requestContext(class string) (context.Context, context.CancelFunc) {
+	parent := a.ctx
+	if class == model.OP_ORDER || a.stopping.Load() {
+		parent = a.orderCtx
+	}
+
+	return context.WithTimeout(parent, a.Conf().Exchange.Timeouts.Get(class))
+}
+
+// observeRequest reports a timed out request distinctly from other failures
+func (a *Arbitrager) observeRequest(class string, err error) {
+	if err == nil || !errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	requestTimeouts.With(a.name, class).Inc()
+	a.log.Warnf("%v request timed out after %v: %v", class, a.Conf().Exchange.Timeouts.Get(class), err)
+	if class == model.OP_ORDER {
+		a.log.Warn("the order may have been executed by the exchange, check the open orders and balances")
+	}
+}
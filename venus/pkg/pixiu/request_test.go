@@ -0,0 +1,55 @@
+package pixiu
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+type requestTestSuite struct {
+	suite.Suite
+	arb *Arbitrager
+}
+
+func TestRequest(t *testing.T) {
+	suite.Run(t, new(requestTestSuite))
+}
+
+func (r *requestTestSuite) SetupTest() {
+	r.arb = newTestArbitrager(newTestConfig(), "ADAUSDT", "DOTUSDT")
+}
+
+func (r *requestTestSuite) TestTimeoutByClass() {
+	r.arb.config.Exchange.Timeouts = &model.Timeouts{}
+	r.arb.config.Exchange.Timeouts.Order.Duration = 3 * time.Second
+
+	ctx, cancel := r.arb.requestContext(model.OP_ORDER)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(r.T(), ok)
+	assert.InDelta(r.T(), 3*time.Second, time.Until(deadline), float64(100*time.Millisecond))
+
+	ctx, cancel = r.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	assert.InDelta(r.T(), model.DEFAULT_MARKET_DATA_TIMEOUT, time.Until(deadline), float64(100*time.Millisecond))
+}
+
+func (r *requestTestSuite) TestOrdersOutliveStop() {
+	market, cancelMarket := r.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancelMarket()
+	order, cancelOrder := r.arb.requestContext(model.OP_ORDER)
+	defer cancelOrder()
+
+	// canceled as the stop channel is closed
+	r.arb.cancel()
+	assert.Equal(r.T(), context.Canceled, market.Err())
+	assert.Nil(r.T(), order.Err())
+
+	r.arb.stopOrders()
+	assert.Equal(r.T(), context.Canceled, order.Err())
+}
@@ -0,0 +1,104 @@
+package pixiu
+
+import (
+	"sync"
+
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+// RiskBudget limits the combined exposure in USDT of all the policies, the
+// exposure of an entry is reserved before the order is placed and released
+// when the position is closed
+type RiskBudget struct {
+	mu       sync.Mutex
+	limit    model.Decimal
+	exposure map[string]map[string]model.Decimal
+}
+
+// NewRiskBudget creates a risk budget, zero limit means unlimited
+func NewRiskBudget(limit model.Decimal) *RiskBudget {
+	return &RiskBudget{
+		limit:    limit,
+		exposure: make(map[string]map[string]model.Decimal),
+	}
+}
+
+// Reserve adds the amount to the exposure of a symbol of a policy, returns
+// false if the limit would be exceeded
+func (b *RiskBudget) Reserve(policy, symbol string, amount model.Decimal) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limit.Sign() > 0 && b.total().Add(amount).GreaterThan(b.limit) {
+		return false
+	}
+
+	m, ok := b.exposure[policy]
+	if !ok {
+		m = make(map[string]model.Decimal)
+		b.exposure[policy] = m
+	}
+	m[symbol] = m[symbol].Add(amount)
+	riskExposure.With(policy).Set(sum(m).Float64())
+	return true
+}
+
+// Shrink lowers the exposure of a symbol of a policy to the amount, e.g.
+// when an order is shrunk after its exposure is reserved
+func (b *RiskBudget) Shrink(policy, symbol string, amount model.Decimal) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m, ok := b.exposure[policy]
+	if !ok || !amount.LessThan(m[symbol]) {
+		return
+	}
+	m[symbol] = amount
+	riskExposure.With(policy).Set(sum(m).Float64())
+}
+
+// Release removes the exposure of a symbol of a policy
+func (b *RiskBudget) Release(policy, symbol string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	m, ok := b.exposure[policy]
+	if !ok {
+		return
+	}
+	delete(m, symbol)
+	riskExposure.With(policy).Set(sum(m).Float64())
+}
+
+// Exposure returns the exposure of a policy, empty policy means all the
+// policies
+func (b *RiskBudget) Exposure(policy string) model.Decimal {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if policy == "" {
+		return b.total()
+	}
+	return sum(b.exposure[policy])
+}
+
+// Limit returns the limit of the budget
+func (b *RiskBudget) Limit() model.Decimal {
+	return b.limit
+}
+
+func (b *RiskBudget) total() model.Decimal {
+	var total model.Decimal
+	for _, m := range b.exposure {
+		total = total.Add(sum(m))
+	}
+	return total
+}
+
+func sum(m map[string]model.Decimal) model.Decimal {
+	var total model.Decimal
+	for _, v := range m {
+		total = total.Add(v)
+	}
+	return total
+}
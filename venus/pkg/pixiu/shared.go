@@ -0,0 +1,218 @@
+package pixiu
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	glog "github.com/vjoke/falcon/pkg/log"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+var sLog = glog.RegisterScope("shared", "shared", 0)
+
+// Shared holds the resources shared by all the arbitragers of a process:
+// exchange clients with a common request limit and time sync, the exchange
+// info, the symbols owned by each policy, the risk budget and the clock
+type Shared struct {
+	mu sync.Mutex
+	// infoMu serializes the queries of the exchange info without holding
+	// mu, which is taken by signing every request
+	infoMu     sync.Mutex
+	limiter    *RequestLimiter
+	timeSync   *TimeSync
+	httpClient *http.Client
+	clients    map[string]*binance.Client
+	secrets    map[string]string
+	info       *binance.ExchangeInfo
+	infoAt     time.Time
+	testnet    *bool
+	baseURL    string
+	policies   map[string]bool
+	owners     map[string]string
+	budget     *RiskBudget
+	clock      Clock
+}
+
+// NewShared creates the shared resources, maxExposure is the combined
+// exposure in USDT allowed for all the policies, zero means unlimited
+func NewShared(maxExposure float64) *Shared {
+	s := &Shared{
+		limiter:  NewRequestLimiter(DEFAULT_WEIGHT_LIMIT, time.Minute, WEIGHT_BURST),
+		timeSync: NewTimeSync(),
+		clients:  make(map[string]*binance.Client),
+		secrets:  make(map[string]string),
+		policies: make(map[string]bool),
+		owners:   make(map[string]string),
+		budget:   NewRiskBudget(model.NewDecimalFromFloat(maxExposure)),
+		clock:    NewRealClock(),
+	}
+	// signed requests are stamped after they pass the limiter
+	s.httpClient = &http.Client{
+		Transport: s.limiter.Transport(s.timeSync.Transport(s.secret, http.DefaultTransport)),
+	}
+	return s
+}
+
+// Register registers a policy, the names of policies must be unique and
+// all the policies must use the same network since binance.UseTestnet is
+// global, and the same base url since the exchange info is shared
+func (s *Shared) Register(policy string, testnet bool, baseURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.policies[policy] {
+		return fmt.Errorf("duplicate policy %v", policy)
+	}
+	if s.testnet != nil && *s.testnet != testnet {
+		return fmt.Errorf("policy %v uses testnet %v, but others use testnet %v", policy, testnet, *s.testnet)
+	}
+	if len(s.policies) > 0 && s.baseURL != baseURL {
+		return fmt.Errorf("policy %v uses base url %q, but others use %q", policy, baseURL, s.baseURL)
+	}
+
+	s.policies[policy] = true
+	s.testnet = &testnet
+	s.baseURL = baseURL
+	binance.UseTestnet = testnet
+	return nil
+}
+
+// Unregister removes a policy and releases its symbols
+func (s *Shared) Unregister(policy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.policies, policy)
+	for key, owner := range s.owners {
+		if owner == policy {
+			delete(s.owners, key)
+		}
+	}
+}
+
+// Client returns the client for an account, all the clients share the same
+// http client, request limit and time sync
+func (s *Shared) Client(apiKey, secretKey string) *binance.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := apiKey + ":" + secretKey
+	if c, ok := s.clients[key]; ok {
+		return c
+	}
+
+	c := binance.NewClient(apiKey, secretKey)
+	c.HTTPClient = s.httpClient
+	if s.baseURL != "" {
+		c.BaseURL = s.baseURL
+	}
+	s.clients[key] = c
+	s.secrets[apiKey] = secretKey
+	return c
+}
+
+// secret returns the secret key of an api key
+func (s *Shared) secret(apiKey string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, ok := s.secrets[apiKey]
+	return secret, ok
+}
+
+// TimeSync returns the time sync of all the clients
+func (s *Shared) TimeSync() *TimeSync {
+	return s.timeSync
+}
+
+// ExchangeInfo returns the exchange info, it is queried again if it is
+// older than maxAge, so policies refreshing it on the same schedule query it
+// once. Zero maxAge accepts the info of any age.
+func (s *Shared) ExchangeInfo(ctx context.Context, client *binance.Client, maxAge time.Duration) (*binance.ExchangeInfo, error) {
+	if info := s.cachedInfo(maxAge); info != nil {
+		return info, nil
+	}
+
+	s.infoMu.Lock()
+	defer s.infoMu.Unlock()
+	// another policy may have queried it while waiting
+	if info := s.cachedInfo(maxAge); info != nil {
+		return info, nil
+	}
+
+	info, err := client.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info = info
+	s.infoAt = time.Now()
+	return info, nil
+}
+
+// cachedInfo returns the exchange info if it is younger than maxAge
+func (s *Shared) cachedInfo(maxAge time.Duration) *binance.ExchangeInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.info != nil && (maxAge == 0 || time.Since(s.infoAt) < maxAge) {
+		return s.info
+	}
+	return nil
+}
+
+// Claim makes the symbols owned by a policy on an account, symbols which
+// are no longer claimed by the policy are released. Policies trading the
+// same symbol on the same account would sell and cancel orders of each
+// other, so it is rejected.
+func (s *Shared) Claim(policy, apiKey string, symbols []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claimed := make(map[string]bool)
+	conflicts := make([]string, 0)
+	for _, symbol := range symbols {
+		key := apiKey + ":" + symbol
+		if owner, ok := s.owners[key]; ok && owner != policy {
+			conflicts = append(conflicts, fmt.Sprintf("%v(%v)", symbol, owner))
+		}
+		claimed[key] = true
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("symbols are traded by other policies on the same account: %v", conflicts)
+	}
+
+	for key, owner := range s.owners {
+		if owner == policy && !claimed[key] {
+			delete(s.owners, key)
+		}
+	}
+	for key := range claimed {
+		s.owners[key] = policy
+	}
+	return nil
+}
+
+// Clock returns the clock of the trading logic
+func (s *Shared) Clock() Clock {
+	return s.clock
+}
+
+// SetClock sets the clock of the trading logic, it should be called before
+// creating any arbitrager
+func (s *Shared) SetClock(clock Clock) {
+	s.clock = clock
+}
+
+// Budget returns the shared risk budget
+func (s *Shared) Budget() *RiskBudget {
+	return s.budget
+}
@@ -0,0 +1,112 @@
+package pixiu
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type sharedTestSuite struct {
+	suite.Suite
+}
+
+func TestShared(t *testing.T) {
+	suite.Run(t, new(sharedTestSuite))
+}
+
+func (s *sharedTestSuite) TestRegister() {
+	shared := NewShared(0)
+	assert.Nil(s.T(), shared.Register("a", false, ""))
+	assert.NotNil(s.T(), shared.Register("a", false, ""))
+	assert.NotNil(s.T(), shared.Register("b", true, ""))
+	assert.NotNil(s.T(), shared.Register("b", false, "http://127.0.0.1:9090"))
+	assert.Nil(s.T(), shared.Register("b", false, ""))
+}
+
+func (s *sharedTestSuite) TestClaim() {
+	shared := NewShared(0)
+	assert.Nil(s.T(), shared.Claim("a", "key1", []string{"ADAUSDT", "DOTUSDT"}))
+	// The same symbol on another account is allowed
+	assert.Nil(s.T(), shared.Claim("b", "key2", []string{"ADAUSDT"}))
+	assert.NotNil(s.T(), shared.Claim("c", "key1", []string{"DOTUSDT"}))
+
+	shared.Unregister("a")
+	assert.Nil(s.T(), shared.Claim("c", "key1", []string{"DOTUSDT"}))
+}
+
+func (s *sharedTestSuite) TestClient() {
+	shared := NewShared(0)
+	c1 := shared.Client("key", "secret")
+	assert.Equal(s.T(), c1, shared.Client("key", "secret"))
+	assert.NotEqual(s.T(), c1, shared.Client("key2", "secret"))
+	assert.Equal(s.T(), c1.HTTPClient, shared.Client("key2", "secret").HTTPClient)
+}
+
+func (s *sharedTestSuite) TestRiskBudget() {
+	b := NewRiskBudget(dec("30"))
+	assert.True(s.T(), b.Reserve("a", "ADAUSDT", dec("12")))
+	assert.True(s.T(), b.Reserve("b", "ADAUSDT", dec("12")))
+	assert.False(s.T(), b.Reserve("a", "DOTUSDT", dec("12")))
+	assert.Equal(s.T(), dec("24"), b.Exposure(""))
+	assert.Equal(s.T(), dec("12"), b.Exposure("a"))
+
+	b.Release("a", "ADAUSDT")
+	assert.True(s.T(), b.Reserve("a", "DOTUSDT", dec("12")))
+
+	// shrinking never raises the exposure
+	b.Shrink("b", "ADAUSDT", dec("5"))
+	b.Shrink("b", "ADAUSDT", dec("8"))
+	assert.Equal(s.T(), dec("5"), b.Exposure("b"))
+
+	unlimited := NewRiskBudget(dec("0"))
+	assert.True(s.T(), unlimited.Reserve("a", "ADAUSDT", dec("1000000000")))
+}
+
+func (s *sharedTestSuite) TestExchangeInfoNotBlockingSigning() {
+	requested, release := make(chan struct{}, 2), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		<-release
+		w.Write([]byte(`{"symbols":[]}`))
+	}))
+	defer server.Close()
+
+	shared := NewShared(0)
+	s.Require().Nil(shared.Register("a", false, server.URL))
+	client := shared.Client("key", "secret")
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := shared.ExchangeInfo(context.Background(), client, time.Minute)
+			done <- err
+		}()
+	}
+
+	// signing is not blocked by the query in flight
+	<-requested
+	signed := make(chan bool)
+	go func() {
+		_, ok := shared.secret("key")
+		signed <- ok
+	}()
+	select {
+	case ok := <-signed:
+		assert.True(s.T(), ok)
+	case <-time.After(time.Second):
+		close(release)
+		s.T().Fatal("secret is blocked by the exchange info query")
+	}
+
+	close(release)
+	assert.Nil(s.T(), <-done)
+	assert.Nil(s.T(), <-done)
+	// the second query waits for the first one and reuses its info
+	assert.Len(s.T(), requested, 0)
+	assert.NotNil(s.T(), shared.cachedInfo(time.Minute))
+}
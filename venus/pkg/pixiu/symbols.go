@@ -0,0 +1,198 @@
+package pixiu
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/jinzhu/copier"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/notify"
+)
+
+const (
+	// EXCHANGE_INFO_INTERVAL is the interval to refresh the exchange info
+	EXCHANGE_INFO_INTERVAL = 10 * time.Minute
+	// SYMBOL_STATUS_DELISTED is the status of symbols missing in the
+	// exchange info
+	SYMBOL_STATUS_DELISTED = "DELISTED"
+)
+
+// SymbolStatus defines a status change of a symbol on the exchange
+type SymbolStatus struct {
+	Symbol string `json:"symbol"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	// Position is the balance of the base asset held when the change is
+	// detected
+	Position model.Decimal `json:"position"`
+}
+
+// Trading returns true if the symbol is trading now, symbols which are
+// halted, in break or delisted are not
+func (s *SymbolStatus) Trading() bool {
+	return s.To == string(binance.SymbolStatusTypeTrading)
+}
+
+// update replaces the symbols with the exchange info, filters of the
+// prepared symbols are reloaded if they are changed. It returns the status
+// changes of the prepared symbols.
+func (exch *Exchange) update(info *binance.ExchangeInfo) []*SymbolStatus {
+	symbolMap := make(map[string]*binance.Symbol, len(info.Symbols))
+	for _, symbol := range info.Symbols {
+		// FIXME: if we use pointer of returned symbol, some data will be
+		// modified with unknown reasons
+		newSymbol := binance.Symbol{}
+		copier.Copy(&newSymbol, &symbol)
+		symbolMap[symbol.Symbol] = &newSymbol
+	}
+
+	exch.mu.Lock()
+	defer exch.mu.Unlock()
+
+	changes := make([]*SymbolStatus, 0)
+	for symbol := range exch.extraMap {
+		old, known := exch.symbolMap[symbol]
+		s, ok := symbolMap[symbol]
+		if !ok && known {
+			// delisted symbols are kept to know their base assets
+			delisted := *old
+			delisted.Status = SYMBOL_STATUS_DELISTED
+			s = &delisted
+			symbolMap[symbol] = s
+		}
+		if s == nil {
+			continue
+		}
+
+		trading := 0.0
+		if s.Status == string(binance.SymbolStatusTypeTrading) {
+			trading = 1
+		}
+		symbolTrading.With(exch.arb.name, symbol).Set(trading)
+		if !known {
+			continue
+		}
+		if old.Status != s.Status {
+			exch.log.Warnf("status of %v is changed from %v to %v", symbol, old.Status, s.Status)
+			changes = append(changes, &SymbolStatus{Symbol: symbol, From: old.Status, To: s.Status})
+		}
+		if ok && !reflect.DeepEqual(old.Filters, s.Filters) {
+			fe, err := newFilterExtra(s)
+			if err != nil {
+				exch.log.Errorf("keep the filters of %v: %v", symbol, err)
+				continue
+			}
+			exch.log.Warnf("filters of %v are changed, reloaded", symbol)
+			exch.extraMap[symbol] = fe
+		}
+	}
+
+	exch.info = info
+	exch.symbolMap = symbolMap
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Symbol < changes[j].Symbol })
+	return changes
+}
+
+// Trading checks if a symbol is trading on the exchange
+func (exch *Exchange) Trading(symbol string) bool {
+	s, ok := exch.getSymbol(symbol)
+	return ok && s.Status == string(binance.SymbolStatusTypeTrading)
+}
+
+// SplitTrading splits symbols into the trading ones and the others
+func (exch *Exchange) SplitTrading(symbols []string) ([]string, []string) {
+	trading := make([]string, 0, len(symbols))
+	others := make([]string, 0)
+	for _, symbol := range symbols {
+		if exch.Trading(symbol) {
+			trading = append(trading, symbol)
+		} else {
+			others = append(others, symbol)
+		}
+	}
+	return trading, others
+}
+
+// ActiveSymbols returns the symbols which are trading, the others are
+// removed from sampling and detecting until they are trading again
+func (exch *Exchange) ActiveSymbols(symbols []string) []string {
+	trading, _ := exch.SplitTrading(symbols)
+	return trading
+}
+
+// runExchangeRefresh refreshes the exchange info periodically
+func (a *Arbitrager) runExchangeRefresh(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(EXCHANGE_INFO_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := a.refreshExchange(); err != nil {
+				a.log.Warnf("failed to refresh exchange info: %v", err)
+			}
+		}
+	}
+}
+
+// refreshExchange reloads the exchange info and applies the status changes
+// of the symbols. Symbols which stop trading are removed from the active
+// universe, their positions are kept with the open orders protecting them,
+// and they are restored once they are trading again.
+func (a *Arbitrager) refreshExchange() error {
+	// the info queried by another policy within half an interval is reused
+	info, err := a.exch.queryInfo(EXCHANGE_INFO_INTERVAL / 2)
+	if err != nil {
+		return err
+	}
+
+	a.reloadMu.Lock()
+	changes := a.exch.update(info)
+	if len(changes) > 0 {
+		active := a.exch.ActiveSymbols(a.Conf().Policy.Symbols)
+		a.fetcher.setSymbols(active)
+		a.oracle.setSymbols(active)
+	}
+	a.reloadMu.Unlock()
+	if len(changes) == 0 {
+		return nil
+	}
+
+	balanceMap, err := a.account.GetBalanceMap()
+	if err != nil {
+		a.log.Warnf("status changes are notified without positions: %v", err)
+	}
+	for _, c := range changes {
+		c.Position = balanceMap[a.exch.BaseAsset(c.Symbol)]
+		a.symbolStatusChanged(c)
+	}
+	return nil
+}
+
+// symbolStatusChanged publishes and notifies a status change of a symbol
+func (a *Arbitrager) symbolStatusChanged(c *SymbolStatus) {
+	a.publish(TOPIC_SYMBOL_STATUS, c)
+
+	held := a.exch.IsPosition(c.Symbol, c.Position)
+	fields := map[string]interface{}{"from": c.From, "to": c.To, "position": c.Position}
+	if c.Trading() {
+		a.log.Infof("%v is trading again", c.Symbol)
+		a.notify(notify.EVENT_SYMBOL_STATUS, c.Symbol, fmt.Sprintf("%v is trading again", c.Symbol), fields)
+		return
+	}
+
+	msg := fmt.Sprintf("%v is %v, removed from trading", c.Symbol, c.To)
+	if held {
+		// orders can not be placed or cancelled until the symbol is trading
+		// again, so the open orders are left to protect the position
+		msg = fmt.Sprintf("%v, position %v is kept with its open orders", msg, c.Position)
+		fields["critical"] = c.To == SYMBOL_STATUS_DELISTED
+	}
+	a.log.Warn(msg)
+	a.notify(notify.EVENT_SYMBOL_STATUS, c.Symbol, msg, fields)
+}
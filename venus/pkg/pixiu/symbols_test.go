@@ -0,0 +1,109 @@
+package pixiu
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+)
+
+type symbolsTestSuite struct {
+	suite.Suite
+}
+
+func TestSymbols(t *testing.T) {
+	suite.Run(t, new(symbolsTestSuite))
+}
+
+// testInfo returns the exchange info of symbols
+func testInfo(symbols ...*binance.Symbol) *binance.ExchangeInfo {
+	info := &binance.ExchangeInfo{}
+	for _, s := range symbols {
+		info.Symbols = append(info.Symbols, *s)
+	}
+	return info
+}
+
+func (s *symbolsTestSuite) TestUpdate() {
+	a := newTestArbitrager(newTestConfig(), "ADAUSDT", "DOTUSDT", "XRPUSDT")
+	assert.True(s.T(), a.exch.Trading("ADAUSDT"))
+	assert.False(s.T(), a.exch.Trading("BTCUSDT"))
+
+	ada, dot, xrp := newTestSymbol("ADAUSDT"), newTestSymbol("DOTUSDT"), newTestSymbol("XRPUSDT")
+	ada.Status = string(binance.SymbolStatusTypeBreak)
+	dot.Filters[0]["stepSize"] = "0.01000000"
+	// symbols which are not prepared are not reported
+	xrp.Status = string(binance.SymbolStatusTypeHalt)
+	changes := a.exch.update(testInfo(ada, dot, xrp))
+	assert.Equal(s.T(), []*SymbolStatus{{Symbol: "ADAUSDT", From: "TRADING", To: "BREAK"}}, changes)
+	assert.False(s.T(), a.exch.Trading("ADAUSDT"))
+	assert.Equal(s.T(), []string{"DOTUSDT"}, a.exch.ActiveSymbols([]string{"ADAUSDT", "DOTUSDT"}))
+	quantity, err := a.exch.NormalizeQuantity("DOTUSDT", dec("0.29"))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "0.29", quantity)
+
+	// unchanged
+	assert.Empty(s.T(), a.exch.update(testInfo(ada, dot)))
+
+	ada.Status = string(binance.SymbolStatusTypeTrading)
+	changes = a.exch.update(testInfo(ada))
+	assert.Equal(s.T(), []*SymbolStatus{
+		{Symbol: "ADAUSDT", From: "BREAK", To: "TRADING"},
+		{Symbol: "DOTUSDT", From: "TRADING", To: SYMBOL_STATUS_DELISTED},
+	}, changes)
+	assert.True(s.T(), changes[0].Trading())
+	assert.False(s.T(), a.exch.Trading("DOTUSDT"))
+	assert.Equal(s.T(), "DOT", a.exch.BaseAsset("DOTUSDT"))
+	assert.Empty(s.T(), a.exch.update(testInfo(ada)))
+}
+
+func (s *symbolsTestSuite) TestRefresh() {
+	script := mockexchange.DefaultScript("ADAUSDT", "DOTUSDT")
+	script.Balances["ADA"] = 50
+	exchange := mockexchange.New(script)
+	server := httptest.NewServer(exchange)
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	a, err := NewArbitrager(conf, NewShared(0))
+	s.Require().NoError(err)
+	statuses := a.bus.Subscribe(TOPIC_SYMBOL_STATUS, "test", 10, OVERFLOW_DROP_NEWEST)
+	assert.Equal(s.T(), []string{"ADAUSDT", "DOTUSDT"}, a.fetcher.symbols)
+
+	// the info is reused within half an interval
+	exchange.SetStatus("ADAUSDT", string(binance.SymbolStatusTypeBreak))
+	assert.NoError(s.T(), a.refreshExchange())
+	assert.True(s.T(), a.exch.Trading("ADAUSDT"))
+
+	a.shared.infoAt = time.Time{}
+	assert.NoError(s.T(), a.refreshExchange())
+	assert.False(s.T(), a.exch.Trading("ADAUSDT"))
+	assert.Equal(s.T(), []string{"DOTUSDT"}, a.fetcher.symbols)
+	assert.Equal(s.T(), []string{"DOTUSDT"}, a.oracle.symbols)
+	assert.NotContains(s.T(), a.oracle.epochMap, "ADAUSDT")
+	if assert.Equal(s.T(), 1, statuses.Len()) {
+		st := (<-statuses.C()).SymbolStatus()
+		assert.Equal(s.T(), "BREAK", st.To)
+		assert.Equal(s.T(), dec("50"), st.Position)
+	}
+
+	// the position is neither sold nor left without its orders
+	op := &Operator{arb: a, client: a.trader.client}
+	results, err := op.Flatten([]string{"ADAUSDT"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "symbol is not trading", results[0].Error)
+	free, _ := exchange.Balance("ADA")
+	assert.Equal(s.T(), 50.0, free)
+
+	exchange.SetStatus("ADAUSDT", string(binance.SymbolStatusTypeTrading))
+	a.shared.infoAt = time.Time{}
+	assert.NoError(s.T(), a.refreshExchange())
+	assert.Equal(s.T(), []string{"ADAUSDT", "DOTUSDT"}, a.fetcher.symbols)
+	assert.Equal(s.T(), []string{"ADAUSDT", "DOTUSDT"}, a.oracle.symbols)
+	assert.Equal(s.T(), 1, statuses.Len())
+}
@@ -0,0 +1,207 @@
+package pixiu
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+const (
+	// TIME_SYNC_INTERVAL is the interval to measure the offset to the server
+	// time of the exchange
+	TIME_SYNC_INTERVAL = time.Minute
+	// STALE_SYNC_INTERVALS is the number of sync intervals without a
+	// successful measurement to distrust the offset
+	STALE_SYNC_INTERVALS = 3
+	// DEFAULT_RECV_WINDOW is the recvWindow of signed requests which do not
+	// set it
+	DEFAULT_RECV_WINDOW = model.RECV_WINDOW
+)
+
+const (
+	HEADER_API_KEY    = "X-MBX-APIKEY"
+	PARAM_TIMESTAMP   = "timestamp"
+	PARAM_SIGNATURE   = "signature"
+	PARAM_RECV_WINDOW = "recvWindow"
+)
+
+// TimeSync keeps the offset of the server time of the exchange to the local
+// clock, the offset is applied to the timestamps of all the signed requests
+type TimeSync struct {
+	mu        sync.Mutex
+	offset    time.Duration
+	rtt       time.Duration
+	synced    time.Time
+	attempted time.Time
+	err       error
+}
+
+// NewTimeSync creates a time sync which is not synced yet
+func NewTimeSync() *TimeSync {
+	return &TimeSync{}
+}
+
+// Offset returns the server time minus the local time
+func (ts *TimeSync) Offset() time.Duration {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.offset
+}
+
+// Now returns the current server time of the exchange
+func (ts *TimeSync) Now() time.Time {
+	return time.Now().Add(ts.Offset())
+}
+
+// Sync measures the offset to the server time, it is skipped if the last
+// attempt is within TIME_SYNC_INTERVAL unless force is true, so policies
+// sharing the time sync measure it once
+func (ts *TimeSync) Sync(ctx context.Context, client *binance.Client, force bool) error {
+	ts.mu.Lock()
+	if !force && !ts.attempted.IsZero() && time.Since(ts.attempted) < TIME_SYNC_INTERVAL {
+		ts.mu.Unlock()
+		return nil
+	}
+	ts.attempted = time.Now()
+	ts.mu.Unlock()
+
+	begin := time.Now()
+	serverTime, err := client.NewServerTimeService().Do(ctx)
+	rtt := time.Since(begin)
+	if err != nil {
+		ts.record(0, 0, err)
+		return err
+	}
+
+	// the server time is compared to the middle of the request
+	local := begin.Add(rtt / 2)
+	offset := time.Unix(0, serverTime*int64(time.Millisecond)).Sub(local)
+	ts.record(offset, rtt, nil)
+	return nil
+}
+
+// record records the result of a measurement, the last offset is kept if it
+// failed
+func (ts *TimeSync) record(offset, rtt time.Duration, err error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.err = err
+	if err != nil {
+		sLog.Warnf("failed to sync time: %v", err)
+		return
+	}
+
+	if ts.synced.IsZero() || absDuration(offset-ts.offset) > rtt {
+		sLog.Infof("offset to the server time is %v, rtt %v", offset, rtt)
+	}
+	ts.offset = offset
+	ts.rtt = rtt
+	ts.synced = time.Now()
+	timeOffset.With().Set(offset.Seconds())
+}
+
+// Check returns an error if the offset is unknown, stale or exceeds
+// maxDrift, no new position should be opened then
+func (ts *TimeSync) Check(maxDrift time.Duration) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.synced.IsZero() {
+		if ts.err != nil {
+			return fmt.Errorf("time is not synced: %v", ts.err)
+		}
+		return fmt.Errorf("time is not synced yet")
+	}
+	if age := time.Since(ts.synced); age > STALE_SYNC_INTERVALS*TIME_SYNC_INTERVAL {
+		return fmt.Errorf("last time sync is %v old: %v", age.Truncate(time.Second), ts.err)
+	}
+	if drift := absDuration(ts.offset); drift > maxDrift {
+		return fmt.Errorf("clock drift %v exceeds %v", drift, maxDrift)
+	}
+	return nil
+}
+
+// Transport wraps a round tripper to stamp signed requests with the server
+// time when they are sent, so requests delayed by the limiter are not
+// rejected by recvWindow. secret returns the secret key of an api key.
+func (ts *TimeSync) Transport(secret func(apiKey string) (string, bool), next http.RoundTripper) http.RoundTripper {
+	return &stampedTransport{sync: ts, secret: secret, next: next}
+}
+
+type stampedTransport struct {
+	sync   *TimeSync
+	secret func(apiKey string) (string, bool)
+	next   http.RoundTripper
+}
+
+func (t *stampedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get(PARAM_SIGNATURE) == "" {
+		return t.next.RoundTrip(req)
+	}
+	secret, ok := t.secret(req.Header.Get(HEADER_API_KEY))
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	stamped, err := stamp(req, secret, t.sync.Now())
+	if err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(stamped)
+}
+
+// stamp returns a copy of a signed request with the timestamp and signed
+// again, the signature is computed in the same way as binance.Client
+func stamp(req *http.Request, secret string, now time.Time) (*http.Request, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	q := req.URL.Query()
+	q.Del(PARAM_SIGNATURE)
+	q.Set(PARAM_TIMESTAMP, strconv.FormatInt(binance.FormatTimestamp(now), 10))
+	if q.Get(PARAM_RECV_WINDOW) == "" {
+		q.Set(PARAM_RECV_WINDOW, strconv.FormatInt(int64(DEFAULT_RECV_WINDOW/time.Millisecond), 10))
+	}
+	queryString := q.Encode()
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(queryString))
+	mac.Write(body)
+
+	stamped := req.Clone(req.Context())
+	stamped.URL.RawQuery = fmt.Sprintf("%s&%s=%x", queryString, PARAM_SIGNATURE, mac.Sum(nil))
+	if req.Body != nil {
+		stamped.Body = ioutil.NopCloser(bytes.NewReader(body))
+		stamped.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	return stamped, nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,92 @@
+package pixiu
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+type timeSyncTestSuite struct {
+	suite.Suite
+}
+
+func TestTimeSync(t *testing.T) {
+	suite.Run(t, new(timeSyncTestSuite))
+}
+
+func (s *timeSyncTestSuite) TestSync() {
+	offset := 3 * time.Second
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"serverTime": %v}`, binance.FormatTimestamp(time.Now().Add(offset)))
+	}))
+	defer server.Close()
+
+	client := binance.NewClient("", "")
+	client.BaseURL = server.URL
+	ts := NewTimeSync()
+	assert.EqualError(s.T(), ts.Check(model.DEFAULT_MAX_TIME_DRIFT), "time is not synced yet")
+
+	assert.NoError(s.T(), ts.Sync(context.Background(), client, false))
+	assert.InDelta(s.T(), offset.Seconds(), ts.Offset().Seconds(), 0.1)
+	assert.Contains(s.T(), ts.Check(model.DEFAULT_MAX_TIME_DRIFT).Error(), "clock drift")
+	// the threshold is configured by the exchange
+	assert.NoError(s.T(), ts.Check(4*time.Second))
+
+	// skipped within the interval unless forced
+	offset = 0
+	assert.NoError(s.T(), ts.Sync(context.Background(), client, false))
+	assert.InDelta(s.T(), 3, ts.Offset().Seconds(), 0.1)
+	assert.NoError(s.T(), ts.Sync(context.Background(), client, true))
+	assert.NoError(s.T(), ts.Check(model.DEFAULT_MAX_TIME_DRIFT))
+
+	ts.synced = time.Now().Add(-STALE_SYNC_INTERVALS*TIME_SYNC_INTERVAL - time.Second)
+	assert.Contains(s.T(), ts.Check(model.DEFAULT_MAX_TIME_DRIFT).Error(), "old")
+}
+
+func (s *timeSyncTestSuite) TestStamp() {
+	offset := -2 * time.Second
+	var query, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		query, body = r.URL.RawQuery, string(data)
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	ts := NewTimeSync()
+	ts.record(offset, 0, nil)
+	secret := func(apiKey string) (string, bool) { return "secret", apiKey == "key" }
+	client := binance.NewClient("key", "secret")
+	client.BaseURL = server.URL
+	client.HTTPClient = &http.Client{Transport: ts.Transport(secret, http.DefaultTransport)}
+
+	_, err := client.NewCreateOrderService().Symbol("ADAUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).QuoteOrderQty("10").Do(context.Background())
+	assert.NoError(s.T(), err)
+	assert.Contains(s.T(), body, "symbol=ADAUSDT")
+
+	i := strings.LastIndex(query, "&signature=")
+	assert.True(s.T(), i > 0)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(query[:i] + body))
+	assert.Equal(s.T(), fmt.Sprintf("%x", mac.Sum(nil)), query[i+len("&signature="):])
+
+	values, _ := url.ParseQuery(query[:i])
+	timestamp, _ := strconv.ParseInt(values.Get(PARAM_TIMESTAMP), 10, 64)
+	assert.InDelta(s.T(), binance.FormatTimestamp(time.Now().Add(offset)), timestamp, 1000)
+	assert.Equal(s.T(), "5000", values.Get(PARAM_RECV_WINDOW))
+}
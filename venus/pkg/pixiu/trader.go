@@ -1,37 +1,65 @@
 package pixiu
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
-	"context"
-	"strconv"
 	"sync"
 
 	"github.com/adshao/go-binance/v2"
+	"github.com/adshao/go-binance/v2/common"
 	glog "github.com/vjoke/falcon/pkg/log"
 	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/notify"
+	"go.uber.org/atomic"
 )
 
 var tLog = glog.RegisterScope("trader", "trader", 0)
 
+// CODE_UNKNOWN_ORDER is the error code of canceling the open orders of a
+// symbol without any
+const CODE_UNKNOWN_ORDER = -2011
+
+// CODE_NO_SUCH_ORDER is the error code of querying an order which does not
+// exist
+const CODE_NO_SUCH_ORDER = -2013
+
 // Trader places orders according to events
 type Trader struct {
 	arb         *Arbitrager
+	log         *glog.Scope
+	mu          sync.RWMutex
 	span		*model.Span
 	stop_profit float64
 	stop_loss   float64
 	position    float64
-	usdt_per_buy float64
-	max_usdt_per_buy float64
+	usdt_per_buy model.Decimal
+	max_usdt_per_buy model.Decimal
 	dryrun		bool
 	one_by_one	bool
+	slippage    *model.Slippage
+	cooldown    *Cooldown
+	book        *PositionBook
 	client      *binance.Client
+	intents     *Subscription
+	executions  *Subscription
+	// inflight tracks the goroutines placing orders
+	inflight    sync.WaitGroup
+	// orderSeq numbers the client order ids of buys
+	orderSeq    atomic.Uint64
+	// buying holds the symbols whose buys are in flight, they have no
+	// position yet but their reservations are kept
+	buyingMu    sync.Mutex
+	buying      map[string]struct{}
+	done        chan struct{}
 }
 
 // NewTrader creates a new trader instance
 func NewTrader(arb *Arbitrager) *Trader {
 	t := &Trader{
 		arb:         arb,
+		log:         tLog.WithLabels("policy", arb.name),
 		span: arb.config.Policy.Trade.Span,
 		stop_profit: arb.config.Policy.Trade.StopProfit,
 		stop_loss:   arb.config.Policy.Trade.StopLoss,
@@ -40,39 +68,117 @@ func NewTrader(arb *Arbitrager) *Trader {
 		max_usdt_per_buy: arb.config.Policy.Trade.MaxUSDTPerBuy,
 		dryrun:    	 arb.config.Policy.Dryrun,
 		one_by_one:  arb.config.Policy.Trade.OneByOne,
-		client:      binance.NewClient(arb.config.Exchange.ApiKey, arb.config.Exchange.SecretKey),
+		slippage:    arb.config.Policy.Trade.Slippage,
+		book:        NewPositionBook(),
+		buying:      make(map[string]struct{}),
+		done:        make(chan struct{}),
+		intents:     arb.bus.Subscribe(TOPIC_ORDER_INTENT, "trader", ORDER_INTENT_BUFFER, OVERFLOW_BLOCK),
+		executions:  arb.bus.Subscribe(TOPIC_EXECUTION, "trader", EXECUTION_BUFFER, OVERFLOW_BLOCK),
+		client:      arb.shared.Client(arb.config.Exchange.ApiKey.Value(), arb.config.Exchange.SecretKey.Value()),
+	}
+
+	if c := arb.config.Policy.Trade.Cooldown; c != nil {
+		t.cooldown = NewCooldown(c.Symbol.Duration, c.Global.Duration)
+	} else {
+		t.cooldown = NewCooldown(0, 0)
 	}
 
 	return t
 }
 
 // Run begins the trading process
-func (t *Trader) Run(stopCh <-chan struct{}) {
-	tLog.Info("worker is running")
+func (t *Trader) Run(stopCh <-chan struct{}) error {
+	heartbeat := t.arb.clock.NewTicker(HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	t.log.Info("worker is running")
 	for {
+		t.arb.health.Beat("trader")
 		select {
 		case <-stopCh:
-			tLog.Info("worker is stopped")
-			return
-		case o := <-t.arb.tradeChannel:
-			tLog.Debug("order request: %v", o)
-			if !t.timeInSpan() {
-				tLog.Warn("out of timespan for trading, ignored")
-				break
-			}
-			if t.dryrun {
-				tLog.Info("ignore order request in dryrun mode")
-				break
-			}
-			if o.Type == model.BUY_ORDER {
-				t.processBuyOrder(o.Symbols)
-			} else {
-				t.processSellOrder(o.Symbols)
-			}
+			t.log.Info("worker is stopped")
+			// done is closed only once on stop, the worker may be restarted
+			// after failures
+			close(t.done)
+			return nil
+		case err := <-t.arb.panics.C("trader"):
+			return err
+		case <-heartbeat.C():
+		case e := <-t.intents.C():
+			t.intents.received()
+			o := e.OrderIntent()
+			t.arb.dequeueOrder(o)
+			t.processOrder(o)
+		case e := <-t.executions.C():
+			t.executions.received()
+			t.processExecution(e.Execution())
 		}
 	}
 }
 
+// processExecution closes the position in the book by the fills of oco
+// legs, fills of market orders are known from their responses
+func (t *Trader) processExecution(r *ExecutionReport) {
+	if r.ExecutionType != EXECUTION_TRADE || r.OrderListID < 0 || r.Side != string(binance.SideTypeSell) {
+		return
+	}
+
+	t.log.Infof("oco order %v of %v filled %v at %v", r.OrderID, r.Symbol, r.LastQuantity, r.LastPrice)
+	t.arb.publish(TOPIC_FILL, &Fill{Symbol: r.Symbol, Side: "sell", OrderID: r.OrderID, Price: r.LastPrice, Quantity: r.LastQuantity})
+	t.closePosition(r.Symbol, r.LastPrice, r.LastQuantity)
+}
+
+// processOrder processes an order request, parameters of the trader stay
+// unchanged during processing
+func (t *Trader) processOrder(o *model.Order) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	t.log.Debugf("order request: %v", o)
+	if t.arb.Paused() {
+		t.log.Warnf("trading is paused, %v ignored", o.Key())
+		return
+	}
+	if t.cooldown.GlobalActive(t.arb.clock.Now()) {
+		t.log.Infof("global cooldown is active, %v ignored", o.Key())
+		return
+	}
+	if !t.timeInSpan() {
+		t.log.Warn("out of timespan for trading, ignored")
+		return
+	}
+	if t.dryrun {
+		t.log.Info("ignore order request in dryrun mode")
+		return
+	}
+	if o.Type == model.BUY_ORDER {
+		t.processBuyOrder(o.Symbols)
+	} else {
+		t.processSellOrder(o.Symbols)
+	}
+}
+
+// apply applies the trading parameters of a reloaded config
+func (t *Trader) apply(conf *model.Config) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	trade := conf.Policy.Trade
+	t.span = trade.Span
+	t.stop_profit = trade.StopProfit
+	t.stop_loss = trade.StopLoss
+	t.position = trade.Position
+	t.usdt_per_buy = trade.USDTPerBuy
+	t.max_usdt_per_buy = trade.MaxUSDTPerBuy
+	t.dryrun = conf.Policy.Dryrun
+	t.one_by_one = trade.OneByOne
+	t.slippage = trade.Slippage
+	if c := trade.Cooldown; c != nil {
+		t.cooldown.SetPeriods(c.Symbol.Duration, c.Global.Duration)
+	} else {
+		t.cooldown.SetPeriods(0, 0)
+	}
+}
+
 // timeInSpan check if current time is within the timespan for trading
 func (t *Trader) timeInSpan() bool {
 	// China doesn't have daylight saving. It uses a fixed 8 hour offset from UTC.
@@ -80,12 +186,12 @@ func (t *Trader) timeInSpan() bool {
 	secondsEastOfUTC := int((8 * time.Hour).Seconds())
 	beijing := time.FixedZone("Beijing Time", secondsEastOfUTC)
 
-	now := time.Now()
+	now := t.arb.clock.Now()
 	begin := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, beijing)
 	start := begin.Add(t.span.From.Duration)
 	end := begin.Add(t.span.To.Duration)
 	
-	tLog.Debugf("timespan for trading is %v - %v", start.Format(TIME_FORMAT), end.Format(TIME_FORMAT))
+	t.log.Debugf("timespan for trading is %v - %v", start.Format(TIME_FORMAT), end.Format(TIME_FORMAT))
 	// FIXME: should we adjust timezone before comparing time?
 	return start.Before(now) && end.After(now)
 
@@ -93,185 +199,660 @@ func (t *Trader) timeInSpan() bool {
 
 // processBuyOrder processes buy orders
 func (t *Trader) processBuyOrder(symbols []string) {
+	// signed requests are rejected or misjudged with a drifting clock
+	if err := t.arb.shared.TimeSync().Check(t.arb.Conf().Exchange.TimeDrift()); err != nil {
+		t.log.Warnf("refuse to buy %v: %v", symbols, err)
+		t.arb.notify(notify.EVENT_RISK, "", fmt.Sprintf("refuse to buy %v: %v", symbols, err),
+			map[string]interface{}{"limit": "time_sync", "symbols": symbols})
+		return
+	}
+	symbols, halted := t.arb.exch.SplitTrading(symbols)
+	if len(halted) > 0 {
+		t.log.Warnf("skip %v which are not trading", halted)
+	}
+	symbols, skipped := t.cooldown.Filter(symbols, t.arb.clock.Now())
+	if len(skipped) > 0 {
+		t.log.Infof("skip %v in cooldown", skipped)
+	}
+	symbols, pending := t.splitBuying(symbols)
+	if len(pending) > 0 {
+		t.log.Infof("skip %v with buys in flight", pending)
+	}
+	if len(symbols) == 0 {
+		return
+	}
+	// Skip symbols which already hold an open position
+	balanceMap, err := t.arb.account.GetBalanceMap()
+	if err != nil {
+		t.log.Error(err)
+		return
+	}
+	symbols = t.filterOpenPositions(symbols, balanceMap)
+	if len(symbols) == 0 {
+		return
+	}
 	// Check balance
 	free, _, err := t.arb.account.GetBalance("USDT")
 	if err != nil {
-		tLog.Error(err)
+		t.log.Error(err)
 		return
 	}
 	// Place orders 
-	total := free * t.position
+	total := free.Mul(model.NewDecimalFromFloat(t.position))
 	for _, symbol := range symbols {
-		if total < t.usdt_per_buy {
-			tLog.Warnf("insufficient usdt: %v < %v", total, t.usdt_per_buy)
+		if total.LessThan(t.usdt_per_buy) {
+			t.log.Warnf("insufficient usdt: %v < %v", total, t.usdt_per_buy)
 			break
 		} 
-		total -= t.usdt_per_buy
-		go t.buyOrder(symbol, t.usdt_per_buy)
+		if !t.arb.shared.Budget().Reserve(t.arb.name, symbol, t.usdt_per_buy) {
+			limit := t.arb.shared.Budget().Limit()
+			t.log.Warnf("risk budget %v USDT is exhausted, skip %v", limit, symbol)
+			t.arb.notify(notify.EVENT_RISK, symbol, fmt.Sprintf("risk budget %v USDT is exhausted, buy is skipped", limit),
+				map[string]interface{}{"limit": "risk_budget", "budget": limit})
+			break
+		}
+		total = total.Sub(t.usdt_per_buy)
+		t.setBuying(symbol, true)
+		t.inflight.Add(1)
+		symbol, quote := symbol, t.usdt_per_buy
+		t.arb.spawn("trader", func() { t.buyOrder(symbol, quote) })
 		if t.one_by_one {
-			tLog.Warnf("buy %v, one by one", symbol)
+			t.log.Warnf("buy %v, one by one", symbol)
 			break
 		}
 	}
 }
 
+// filterOpenPositions removes the symbols holding an open position, the
+// symbols whose buys are in flight are removed with their reservations kept
+func (t *Trader) filterOpenPositions(symbols []string, balanceMap map[string]model.Decimal) []string {
+	r := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		quantity := balanceMap[t.arb.exch.BaseAsset(symbol)]
+		if t.arb.exch.IsPosition(symbol, quantity) {
+			t.log.Infof("skip %v with open position %v", symbol, quantity)
+			continue
+		}
+		if t.isBuying(symbol) {
+			t.log.Infof("skip %v with buy in flight", symbol)
+			continue
+		}
+		// The position may have been closed by the oco order
+		t.book.Remove(symbol)
+		t.arb.shared.Budget().Release(t.arb.name, symbol)
+		r = append(r, symbol)
+	}
+
+	return r
+}
+
+// setBuying marks a symbol whose buy is in flight, or clears it
+func (t *Trader) setBuying(symbol string, buying bool) {
+	t.buyingMu.Lock()
+	defer t.buyingMu.Unlock()
+	if buying {
+		t.buying[symbol] = struct{}{}
+	} else {
+		delete(t.buying, symbol)
+	}
+}
+
+// isBuying returns true if the buy of a symbol is in flight
+func (t *Trader) isBuying(symbol string) bool {
+	t.buyingMu.Lock()
+	defer t.buyingMu.Unlock()
+	_, ok := t.buying[symbol]
+	return ok
+}
+
+// splitBuying splits symbols into the ones without buys in flight and the
+// ones with
+func (t *Trader) splitBuying(symbols []string) ([]string, []string) {
+	idle := make([]string, 0, len(symbols))
+	buying := make([]string, 0)
+	for _, symbol := range symbols {
+		if t.isBuying(symbol) {
+			buying = append(buying, symbol)
+		} else {
+			idle = append(idle, symbol)
+		}
+	}
+	return idle, buying
+}
+
 // buyOrder places a market order for a symbol
-func (t *Trader) buyOrder(symbol string, quantity float64) {
-	strQuantity := strconv.FormatFloat(quantity, 'f', 8, 64)
-	tLog.Infof("will buy %v with %v USDT", symbol, strQuantity)
+func (t *Trader) buyOrder(symbol string, quantity model.Decimal) {
+	defer t.inflight.Done()
+	defer t.setBuying(symbol, false)
+	quantity, estimate, err := t.checkSlippage(symbol, quantity)
+	if err != nil {
+		t.log.Warnf("refuse to buy %v: %v", symbol, err)
+		t.orderResult(symbol, "buy", 0, err)
+		t.arb.shared.Budget().Release(t.arb.name, symbol)
+		return
+	}
+	// the exposure is reserved for the quote before it is shrunk
+	t.arb.shared.Budget().Shrink(t.arb.name, symbol, quantity)
+	state, strQuantity, err := t.checkBuy(symbol, quantity)
+	if err != nil {
+		// the position could not be protected by the oco order
+		t.log.Warnf("refuse to buy %v: %v", symbol, err)
+		t.orderResult(symbol, "buy", 0, err)
+		t.arb.shared.Budget().Release(t.arb.name, symbol)
+		return
+	}
+	t.log.Infof("will buy %v with %v USDT", symbol, strQuantity)
+	// the order is looked up by its client order id if the request times out
+	clientID := t.newClientOrderID()
+	ctx, cancel := t.arb.requestContext(model.OP_ORDER)
+	defer cancel()
 	res, err := t.client.NewCreateOrderService().Symbol(symbol).
 		Side(binance.SideTypeBuy).Type(binance.OrderTypeMarket).
 		// TimeInForce(binance.TimeInForceTypeGTC).
-		QuoteOrderQty(strQuantity).Do(context.Background())
+		QuoteOrderQty(strQuantity).NewClientOrderID(clientID).Do(ctx)
+	t.arb.observeRequest(model.OP_ORDER, err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.recoverBuy(symbol, clientID, state, err)
+		return
+	}
 	if err != nil {
-		tLog.Error(err)
+		t.log.Error(err)
+		t.orderResult(symbol, "buy", 0, err)
+		t.arb.shared.Budget().Release(t.arb.name, symbol)
+		t.arb.notify(notify.EVENT_ORDER_FAILED, symbol, fmt.Sprintf("buy order failed: %v", err),
+			map[string]interface{}{"side": "buy", "quote_qty": strQuantity})
 		return
 	}
-	tLog.Infof("created order %+v", res)
+	t.orderResult(symbol, "buy", res.OrderID, nil)
+	t.log.Infof("created order %+v", res)
+	t.cooldown.Record(symbol, t.arb.clock.Now())
 	// Calculate average price
 	avgPrice, base, err := t.getMarketOrderInfo(res)
 	if err != nil {
 		// TODO: require manual operation to sell order?
-		tLog.Errorf("failed to get average price, err:%v", err)
+		t.log.Errorf("failed to get average price, err:%v", err)
+		t.arb.notify(notify.EVENT_ORDER_FAILED, symbol, fmt.Sprintf("buy order %v needs manual check: %v", res.OrderID, err),
+			map[string]interface{}{"side": "buy", "order_id": res.OrderID})
+		return
+	}
+	if estimate != nil {
+		t.log.Infof("bought %v at %v, expected %v with slippage %v", symbol, avgPrice, estimate.VWAP, estimate.Slippage)
+	}
+	t.protect(symbol, res.OrderID, avgPrice, base, state)
+}
+
+// recoverBuy looks up a market buy whose request timed out by its client
+// order id, the order may have been executed by the exchange. The position
+// is opened if the order is filled and the reservation is released if it
+// does not exist, otherwise the reservation is kept and a critical
+// notification asks for a manual check.
+func (t *Trader) recoverBuy(symbol, clientID string, state *FilterState, cause error) {
+	ctx, cancel := t.arb.requestContext(model.OP_ORDER)
+	defer cancel()
+	o, err := t.client.NewGetOrderService().Symbol(symbol).OrigClientOrderID(clientID).Do(ctx)
+	t.arb.observeRequest(model.OP_ORDER, err)
+
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == CODE_NO_SUCH_ORDER {
+		t.log.Warnf("buy order %v of %v timed out and was not executed", clientID, symbol)
+		t.orderResult(symbol, "buy", 0, cause)
+		t.arb.shared.Budget().Release(t.arb.name, symbol)
+		t.arb.notify(notify.EVENT_ORDER_FAILED, symbol, fmt.Sprintf("buy order failed: %v", cause),
+			map[string]interface{}{"side": "buy", "client_order_id": clientID})
 		return
 	}
+	if err == nil && o.Status == binance.OrderStatusTypeFilled {
+		avgPrice, base, ferr := t.queriedFill(o)
+		if ferr == nil {
+			t.log.Warnf("buy order %v of %v timed out but was filled", o.OrderID, symbol)
+			t.orderResult(symbol, "buy", o.OrderID, nil)
+			t.cooldown.Record(symbol, t.arb.clock.Now())
+			t.protect(symbol, o.OrderID, avgPrice, base, state)
+			return
+		}
+		err = ferr
+	} else if err == nil {
+		err = fmt.Errorf("order %v is %v", o.OrderID, o.Status)
+	}
+
+	// the budget stays reserved for the order which may hold a position
+	t.log.Errorf("buy order %v of %v timed out and its state is unknown: %v", clientID, symbol, err)
+	t.orderResult(symbol, "buy", 0, cause)
+	t.arb.notify(notify.EVENT_ORDER_FAILED, symbol,
+		fmt.Sprintf("CRITICAL: buy order %v timed out and needs manual check: %v", clientID, err),
+		map[string]interface{}{"side": "buy", "client_order_id": clientID, "critical": true})
+}
+
+// queriedFill returns the average price and the base received of a filled
+// order, the commission is estimated by the fee as the fills of a queried
+// order are unknown
+func (t *Trader) queriedFill(o *binance.Order) (model.Decimal, model.Decimal, error) {
+	var zero model.Decimal
+	base, err := model.ParseDecimal(o.ExecutedQuantity)
+	if err != nil {
+		return zero, zero, fmt.Errorf("convert executed quantity error: %v", err)
+	}
+	quote, err := model.ParseDecimal(o.CummulativeQuoteQuantity)
+	if err != nil {
+		return zero, zero, fmt.Errorf("convert quote quantity error: %v", err)
+	}
+	if base.Sign() <= 0 {
+		return zero, zero, fmt.Errorf("order %v has no executed quantity", o.OrderID)
+	}
 
-	baseStr := t.arb.exch.NormalizeQuantity(symbol, base)
-	// Calculate sell price
-	sellPrice := avgPrice * (1 + t.stop_profit)
-	stopPrice := avgPrice * (1 - t.stop_loss)
+	keep := model.NewDecimalFromFloat(1 - t.arb.Conf().Policy.Trade.Fee)
+	return quote.Div(base), base.Mul(keep), nil
+}
+
+// newClientOrderID returns a unique client order id of a buy
+func (t *Trader) newClientOrderID() string {
+	return fmt.Sprintf("pixiu-%x-%d", time.Now().UnixNano(), t.orderSeq.Inc())
+}
 
-	avgPriceStr := t.arb.exch.NormalizePrice(symbol, avgPrice)
-	sellPriceStr := t.arb.exch.NormalizePrice(symbol, sellPrice)
-	stopPriceStr := t.arb.exch.NormalizePrice(symbol, stopPrice)
-	stopLimitPriceStr := stopPriceStr // FIXME: use the same value?
-	// Create sell order or OTC order
-	tLog.Infof("will sell %v %v avg: %v with sellPrice: %v stopPrice: %v, stopLimitPrice: %v", 
-		baseStr, symbol, avgPriceStr, sellPriceStr, stopPriceStr, stopLimitPriceStr)
+// protect records the position opened by a filled buy and protects it by
+// an oco order
+func (t *Trader) protect(symbol string, orderID int64, avgPrice, base model.Decimal, state *FilterState) {
+	t.book.Open(symbol, avgPrice, base, t.arb.clock.Now())
+	t.arb.publish(TOPIC_FILL, &Fill{Symbol: symbol, Side: "buy", OrderID: orderID, Price: avgPrice, Quantity: base})
+	t.publishPosition(symbol, nil)
+	t.arb.notify(notify.EVENT_ENTRY, symbol, fmt.Sprintf("bought %v at %v", base, avgPrice),
+		map[string]interface{}{"price": avgPrice, "quantity": base, "order_id": orderID})
+
+	// Create sell order or OTC order, the market buy has been filled
+	oco, err := t.arb.exch.CheckOCO(symbol, t.ocoOrder(avgPrice, base), state)
+	if err != nil {
+		t.log.Errorf("oco order for %v violates filters, err:%v", symbol, err)
+		t.orderResult(symbol, "oco", 0, err)
+		t.arb.notify(notify.EVENT_ORDER_FAILED, symbol, fmt.Sprintf("CRITICAL: position is unprotected, oco order is invalid: %v", err),
+			map[string]interface{}{"side": "oco", "quantity": base, "critical": true})
+		return
+	}
+	t.log.Infof("will sell %v %v avg: %v with sellPrice: %v stopPrice: %v, stopLimitPrice: %v", 
+		oco.Quantity, symbol, avgPrice, oco.Price, oco.StopPrice, oco.StopLimitPrice)
+	ocoCtx, ocoCancel := t.arb.requestContext(model.OP_ORDER)
+	defer ocoCancel()
 	ocoRes, err := t.client.NewCreateOCOService().
 		Symbol(symbol).
 		Side(binance.SideTypeSell).
-		Quantity(baseStr).
-		Price(sellPriceStr).
-		StopPrice(stopPriceStr).
-		StopLimitPrice(stopLimitPriceStr).
+		Quantity(oco.Quantity).
+		Price(oco.Price).
+		StopPrice(oco.StopPrice).
+		StopLimitPrice(oco.StopLimitPrice).
 		StopLimitTimeInForce(binance.TimeInForceTypeGTC). // FIXME: GTC/IOC/FOK
-		Do(context.Background())
+		Do(ocoCtx)
+	t.arb.observeRequest(model.OP_ORDER, err)
 
 	if err != nil {
 		// TODO: retry?
-		tLog.Errorf("failed to create oco order for %v, err:%v", symbol, err)
+		t.log.Errorf("failed to create oco order for %v, err:%v", symbol, err)
+		t.orderResult(symbol, "oco", 0, err)
+		// The position is open without any stop orders now
+		t.arb.notify(notify.EVENT_ORDER_FAILED, symbol, fmt.Sprintf("CRITICAL: position is unprotected, oco order failed: %v", err),
+			map[string]interface{}{"side": "oco", "quantity": oco.Quantity, "critical": true})
 		return
 	}
+	t.orderResult(symbol, "oco", ocoRes.OrderListID, nil)
 
-	tLog.Infof("created oco order: %+v", ocoRes)
+	t.log.Infof("created oco order: %+v", ocoRes)
+}
+
+// checkSlippage estimates the slippage of a market buy of quote by the
+// order book, the quote is shrunk or refused if the slippage exceeds the
+// limit, the estimate is nil without a limit
+func (t *Trader) checkSlippage(symbol string, quote model.Decimal) (model.Decimal, *Estimate, error) {
+	t.mu.RLock()
+	slippage := t.slippage
+	t.mu.RUnlock()
+	if slippage == nil {
+		return quote, nil, nil
+	}
+
+	depth, err := t.arb.orderBook.Depth(symbol)
+	if err != nil {
+		return quote, nil, fmt.Errorf("failed to estimate slippage: %w", err)
+	}
+	e, err := depth.EstimateBuy(quote)
+	if err != nil {
+		return quote, nil, fmt.Errorf("failed to estimate slippage: %w", err)
+	}
+	expectedSlippage.With(t.arb.name, symbol).Set(e.Slippage.Float64())
+	max := model.NewDecimalFromFloat(slippage.Max)
+	if e.Filled && !e.Slippage.GreaterThan(max) {
+		return quote, e, nil
+	}
+
+	if slippage.Action != model.SLIPPAGE_SHRINK {
+		slippageActions.With(t.arb.name, model.SLIPPAGE_SKIP).Inc()
+		return quote, nil, fmt.Errorf("expected slippage %v of %v USDT exceeds %v", e.Slippage, quote, max)
+	}
+	shrunk, err := depth.MaxBuy(max)
+	if err != nil {
+		slippageActions.With(t.arb.name, model.SLIPPAGE_SKIP).Inc()
+		return quote, nil, fmt.Errorf("expected slippage %v of %v USDT exceeds %v: %w", e.Slippage, quote, max, err)
+	}
+	slippageActions.With(t.arb.name, model.SLIPPAGE_SHRINK).Inc()
+	t.log.Infof("shrink buy of %v from %v to %v USDT, expected slippage %v exceeds %v", symbol, quote, shrunk, e.Slippage, max)
+	if e, err = depth.EstimateBuy(shrunk); err != nil {
+		return quote, nil, err
+	}
+	return shrunk, e, nil
+}
+
+// checkBuy checks a market buy of quote quantity and the oco order placed
+// after its fill, which is estimated with the average price
+func (t *Trader) checkBuy(symbol string, quote model.Decimal) (*FilterState, string, error) {
+	state, err := t.arb.exch.FilterState(symbol)
+	if err != nil {
+		return nil, "", err
+	}
+	strQuote, err := t.arb.exch.CheckMarketBuy(symbol, quote, state)
+	if err != nil {
+		return nil, "", err
+	}
+	base := quote.Div(state.AvgPrice).Mul(model.NewDecimalFromFloat(1 - t.arb.Conf().Policy.Trade.Fee))
+	if _, err := t.arb.exch.CheckOCO(symbol, t.ocoOrder(state.AvgPrice, base), state); err != nil {
+		return nil, "", err
+	}
+
+	return state, strQuote, nil
+}
+
+// ocoOrder returns the oco order protecting a position bought at price
+func (t *Trader) ocoOrder(price, quantity model.Decimal) *OCOOrder {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	// FIXME: use the same value for stop price and stop limit price?
+	stopPrice := price.Mul(model.NewDecimalFromFloat(1 - t.stop_loss))
+	return &OCOOrder{
+		Quantity:       quantity,
+		Price:          price.Mul(model.NewDecimalFromFloat(1 + t.stop_profit)),
+		StopPrice:      stopPrice,
+		StopLimitPrice: stopPrice,
+	}
 }
 
 // getMarketOrderInfo gets info for market order
-func (t *Trader) getMarketOrderInfo(res *binance.CreateOrderResponse) (float64, float64, error) {
+func (t *Trader) getMarketOrderInfo(res *binance.CreateOrderResponse) (model.Decimal, model.Decimal, error) {
+	var zero model.Decimal
 	if res.Status != binance.OrderStatusTypeFilled {
-		return 0, 0, fmt.Errorf("order %v is not filled", res.OrderID)
+		return zero, zero, fmt.Errorf("order %v is not filled", res.OrderID)
 	}
 
-	var quote float64
-	var base float64
-	var totalCommission float64
+	var quote model.Decimal
+	var base model.Decimal
+	var totalCommission model.Decimal
 	for _, f := range res.Fills {
-		// TODO: set response type to avoid unnecessary conversion
-		price, err := strconv.ParseFloat(f.Price, 64)
+		price, err := model.ParseDecimal(f.Price)
 		if err != nil {
-			return 0, 0, fmt.Errorf("convert price error: %v", err)
+			return zero, zero, fmt.Errorf("convert price error: %v", err)
 		}
 
-		quantity, err := strconv.ParseFloat(f.Quantity, 64)
+		quantity, err := model.ParseDecimal(f.Quantity)
 		if err != nil {
-			return 0, 0, fmt.Errorf("convert quantity error: %v", err)
+			return zero, zero, fmt.Errorf("convert quantity error: %v", err)
 		}
 
-		commission, err := strconv.ParseFloat(f.Commission, 64)
+		commission, err := model.ParseDecimal(f.Commission)
 		if err != nil{
-			return 0, 0, fmt.Errorf("convert commission error: %v", err)
+			return zero, zero, fmt.Errorf("convert commission error: %v", err)
 		}
 
-		quote += price * quantity
-		base += quantity
-		totalCommission += commission
+		quote = quote.Add(price.Mul(quantity))
+		base = base.Add(quantity)
+		totalCommission = totalCommission.Add(commission)
 	}
 
-	tLog.Debugf("market order: quote: %v, base: %v, totalCommission: %v", 
+	t.log.Debugf("market order: quote: %v, base: %v, totalCommission: %v", 
 		quote, base, totalCommission)
 
-	if base <= 0 {
-		return 0, 0, fmt.Errorf("total base is zero")
+	if base.Sign() <= 0 {
+		return zero, zero, fmt.Errorf("total base is zero")
 	}
 	// FIXME: is commissionAsset the same with base asset?
-	baseLeft := base - totalCommission
-	if baseLeft <= 0 {
-		return 0, 0, fmt.Errorf("total base left is zero")
+	baseLeft := base.Sub(totalCommission)
+	if baseLeft.Sign() <= 0 {
+		return zero, zero, fmt.Errorf("total base left is zero")
 	}	
 
 	// FIXME: use base to calculate average instead of the base left
-	return quote / base, baseLeft, nil
+	return quote.Div(base), baseLeft, nil
 }
 
-// processSellOrder processes sell orders
-func (t *Trader) processSellOrder(symbols []string) {
-	// cancel all the pending orders if any
-	var wg sync.WaitGroup
-	for _, symbol := range symbols {
-		wg.Add(1)
-		go t.cancelOrders(symbol, &wg)
+// getAverageFillPrice gets the average price and total base quantity of
+// the fills of an order
+func getAverageFillPrice(res *binance.CreateOrderResponse) (model.Decimal, model.Decimal, error) {
+	var zero model.Decimal
+	var quote model.Decimal
+	var base model.Decimal
+	for _, f := range res.Fills {
+		price, err := model.ParseDecimal(f.Price)
+		if err != nil {
+			return zero, zero, fmt.Errorf("convert price error: %v", err)
+		}
+
+		quantity, err := model.ParseDecimal(f.Quantity)
+		if err != nil {
+			return zero, zero, fmt.Errorf("convert quantity error: %v", err)
+		}
+
+		quote = quote.Add(price.Mul(quantity))
+		base = base.Add(quantity)
 	}
-	wg.Wait()
 
-	tLog.Infof("all the open orders for %v have been cancelled", symbols)
+	if base.Sign() <= 0 {
+		return zero, zero, fmt.Errorf("total base is zero")
+	}
+
+	return quote.Div(base), base, nil
+}
+
+// processSellOrder cancels the open orders of symbols and sells their
+// positions with market price in the background, the returned channel
+// receives the errors of the symbols once the sells are completed
+func (t *Trader) processSellOrder(symbols []string) <-chan error {
+	result := make(chan error, 1)
+	errs := &symbolErrors{}
+	// orders of symbols which are not trading can not be placed, so their
+	// open orders are kept to protect the positions
+	symbols, halted := t.arb.exch.SplitTrading(symbols)
+	if len(halted) > 0 {
+		t.log.Warnf("keep positions and open orders of %v which are not trading", halted)
+		for _, symbol := range halted {
+			errs.add(symbol, fmt.Errorf("symbol is not trading"))
+		}
+	}
+	if len(symbols) == 0 {
+		result <- errs.err()
+		return result
+	}
+	// cancel all the pending orders if any
+	t.cancelAll(symbols, errs)
+
+	t.log.Infof("open orders of %v are cancelled", symbols)
 	// get remaining balances
 	balanceMap, err := t.arb.account.GetBalanceMap()
 	if err != nil {
-		tLog.Error(err)
-		return // FIXME:
+		t.log.Error(err)
+		result <- fmt.Errorf("get balances error: %v", err)
+		return result
 	}
 	// send sell order with market price
+	var sells sync.WaitGroup
 	for _, symbol := range symbols {
-		go func(sym string) {
-			asset := sym[:len(sym)-4] // FIXME：remove suffix USDT
-			quantity := balanceMap[asset]
-			if quantity <= 0 {
-				tLog.Warnf("quantity for selling is invalid: %v", quantity)
+		t.inflight.Add(1)
+		sells.Add(1)
+		sym := symbol
+		t.arb.spawn("trader", func() {
+			defer t.inflight.Done()
+			defer sells.Done()
+			completed := false
+			defer func() {
+				if !completed {
+					errs.add(sym, fmt.Errorf("sell is aborted"))
+				}
+			}()
+			quantity := balanceMap[t.arb.exch.BaseAsset(sym)]
+			if quantity.Sign() <= 0 {
+				t.log.Warnf("quantity for selling is invalid: %v", quantity)
+				t.arb.shared.Budget().Release(t.arb.name, sym)
 			} else {
-				t.sellOrder(sym, quantity)
+				errs.add(sym, t.sellOrder(sym, quantity))
 			}
-		}(symbol)
+			completed = true
+		})
+	}
+	go func() {
+		sells.Wait()
+		result <- errs.err()
+	}()
+	return result
+}
+
+// waitInflight waits for the in-flight orders until timeout, returns false
+// if any of them is not completed
+func (t *Trader) waitInflight(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		t.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
 	}
 }
 
 // sellOrder creates sell order
-func (t *Trader) sellOrder(symbol string, quantity float64) error {
-	strQuantity := t.arb.exch.NormalizeQuantity(symbol, quantity)
-	tLog.Infof("will sell %v %v", strQuantity, symbol)
+func (t *Trader) sellOrder(symbol string, quantity model.Decimal) error {
+	// the exit is not blocked by failing to get the state of filters
+	state, err := t.arb.exch.FilterState(symbol)
+	if err != nil {
+		t.log.Warnf("check filters of %v without state: %v", symbol, err)
+	}
+	strQuantity, err := t.arb.exch.CheckMarketSell(symbol, quantity, state)
+	if err != nil {
+		t.log.Errorf("failed to sell %v order %v", symbol, err)
+		t.orderResult(symbol, "sell", 0, err)
+		t.arb.notify(notify.EVENT_ORDER_FAILED, symbol, fmt.Sprintf("sell order is invalid: %v", err),
+			map[string]interface{}{"side": "sell", "quantity": quantity})
+		return err
+	}
+	t.log.Infof("will sell %v %v", strQuantity, symbol)
+	ctx, cancel := t.arb.requestContext(model.OP_ORDER)
+	defer cancel()
 	res, err := t.client.NewCreateOrderService().Symbol(symbol).
 		Side(binance.SideTypeSell).Type(binance.OrderTypeMarket).
 		// TimeInForce(binance.TimeInForceTypeGTC).
-		Quantity(strQuantity).Do(context.Background())
+		Quantity(strQuantity).Do(ctx)
+	t.arb.observeRequest(model.OP_ORDER, err)
 	if err != nil {
-		tLog.Errorf("failed to sell %v order %v", symbol, err)
+		t.log.Errorf("failed to sell %v order %v", symbol, err)
+		t.orderResult(symbol, "sell", 0, err)
+		t.arb.notify(notify.EVENT_ORDER_FAILED, symbol, fmt.Sprintf("sell order failed: %v", err),
+			map[string]interface{}{"side": "sell", "quantity": strQuantity})
 		return err
 	}
+	t.orderResult(symbol, "sell", res.OrderID, nil)
 
-	tLog.Infof("created sell order %v", res)
+	t.log.Infof("created sell order %v", res)
+	t.cooldown.Record(symbol, t.arb.clock.Now())
+	if avgPrice, base, err := getAverageFillPrice(res); err == nil {
+		t.arb.publish(TOPIC_FILL, &Fill{Symbol: symbol, Side: "sell", OrderID: res.OrderID, Price: avgPrice, Quantity: base})
+		t.closePosition(symbol, avgPrice, base)
+	}
 	return nil
 }
 
-// cancelOrders cancel all the open orders
-// TODO: check orders before cancelling
-func (t *Trader) cancelOrders(symbol string, wg *sync.WaitGroup) {
-	defer wg.Done()
-	res, err := t.client.NewCancelOpenOrdersService().Symbol(symbol).Do(context.Background())
-	if err != nil {
-		tLog.Errorf("failed to cancel open orders of %v, err:%v", symbol, err)
-		// TODO: retry?
+// closePosition closes quantity of a position in the book at price, the
+// risk budget of the symbol is released when the position is closed
+func (t *Trader) closePosition(symbol string, price, quantity model.Decimal) {
+	pnl, ok := t.book.Close(symbol, price, quantity)
+	if !ok {
 		return
 	}
+	t.log.Infof("closed %v %v at %v, pnl: %v USDT", quantity, symbol, price, pnl)
+	if e, open := t.book.Get(symbol); open && !t.arb.exch.IsPosition(symbol, e.Quantity) {
+		// the dust left by rounding to the lot size can not be sold
+		t.book.Remove(symbol)
+	}
+	t.publishPosition(symbol, &pnl)
+	realizedPnl.With(t.arb.name, symbol).Add(pnl.Float64())
+	if _, open := t.book.Get(symbol); !open {
+		t.arb.shared.Budget().Release(t.arb.name, symbol)
+	}
+	t.arb.notify(notify.EVENT_EXIT, symbol, fmt.Sprintf("sold %v at %v, pnl: %v USDT", quantity, price, pnl),
+		map[string]interface{}{"price": price, "quantity": quantity, "pnl": pnl})
+}
+
+// cancelAll cancels the open orders of symbols concurrently, the errors
+// are collected by symbol
+func (t *Trader) cancelAll(symbols []string, errs *symbolErrors) {
+	var wg sync.WaitGroup
+	for _, symbol := range symbols {
+		wg.Add(1)
+		symbol := symbol
+		t.arb.spawn("trader", func() {
+			defer wg.Done()
+			completed := false
+			defer func() {
+				if !completed {
+					errs.add(symbol, fmt.Errorf("cancel is aborted"))
+				}
+			}()
+			errs.add(symbol, t.cancelOrders(symbol))
+			completed = true
+		})
+	}
+	wg.Wait()
+}
+
+// cancelOrders cancels all the open orders of a symbol, a symbol without
+// open orders is not an error
+func (t *Trader) cancelOrders(symbol string) error {
+	ctx, cancel := t.arb.requestContext(model.OP_ORDER)
+	defer cancel()
+	res, err := t.client.NewCancelOpenOrdersService().Symbol(symbol).Do(ctx)
+	t.arb.observeRequest(model.OP_ORDER, err)
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == CODE_UNKNOWN_ORDER {
+		t.log.Infof("no open orders of %v to cancel", symbol)
+		return nil
+	}
+	if err != nil {
+		t.log.Errorf("failed to cancel open orders of %v, err:%v", symbol, err)
+		t.orderResult(symbol, "cancel", 0, err)
+		t.arb.notify(notify.EVENT_ORDER_FAILED, symbol, fmt.Sprintf("cancel open orders failed: %v", err),
+			map[string]interface{}{"side": "cancel"})
+		return err
+	}
+	t.orderResult(symbol, "cancel", 0, nil)
+
+	t.log.Infof("cancelled open orders of %v, got %v", symbol, res)
+	return nil
+}
 
-	tLog.Info("cancelled open orders of %v, got %v", symbol, res)
+// orderResult counts the result of an order request and publishes it
+func (t *Trader) orderResult(symbol, side string, orderID int64, err error) {
+	r := &OrderResult{Symbol: symbol, Side: side, OrderID: orderID}
+	if err != nil {
+		r.Error = err.Error()
+		ordersTotal.With(t.arb.name, symbol, side, RESULT_FAILURE, errorReason(err)).Inc()
+	} else {
+		ordersTotal.With(t.arb.name, symbol, side, RESULT_SUCCESS, "").Inc()
+	}
+	t.arb.publish(TOPIC_ORDER_RESULT, r)
+}
+
+// publishPosition publishes the position of a symbol in the book after a
+// change, pnl is the realized profit and loss of a close or nil
+func (t *Trader) publishPosition(symbol string, pnl *model.Decimal) {
+	change := &PositionChange{Symbol: symbol, Pnl: pnl}
+	if e, ok := t.book.Get(symbol); ok {
+		change.Quantity, change.Price = e.Quantity, e.Price
+	}
+	t.arb.publish(TOPIC_POSITION, change)
 }
@@ -0,0 +1,639 @@
+package pixiu
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/adshao/go-binance/v2"
+	glog "github.com/vjoke/falcon/pkg/log"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/notify"
+)
+
+var triLog = glog.RegisterScope("triangular", "triangular", 0)
+
+// Results of cycles for metrics
+const (
+	// CYCLE_DETECTED is a cycle whose edge at the tickers exceeds the
+	// threshold
+	CYCLE_DETECTED = "detected"
+	// CYCLE_SHALLOW is a detected cycle whose edge by the depth is below
+	// the threshold
+	CYCLE_SHALLOW = "shallow"
+	// CYCLE_FILTERED is a detected cycle whose legs violate the filters
+	CYCLE_FILTERED = "filtered"
+	CYCLE_DRYRUN   = "dryrun"
+	CYCLE_EXECUTED = "executed"
+	// CYCLE_FAILED is a cycle with a failed leg, the asset held is unwound
+	CYCLE_FAILED  = "failed"
+	CYCLE_UNWOUND = "unwound"
+)
+
+// Leg defines an edge of the currency graph, it converts From to To by a
+// market order of Symbol
+type Leg struct {
+	Symbol string           `json:"symbol"`
+	From   string           `json:"from"`
+	To     string           `json:"to"`
+	Side   binance.SideType `json:"side"`
+}
+
+func (l *Leg) String() string {
+	return fmt.Sprintf("%v %v", l.Side, l.Symbol)
+}
+
+// Cycle defines three legs from the quote asset back to it, e.g.
+// USDT->BTC->ADA->USDT
+type Cycle struct {
+	Legs []*Leg `json:"legs"`
+}
+
+func (c *Cycle) String() string {
+	assets := []string{c.Legs[0].From}
+	for _, l := range c.Legs {
+		assets = append(assets, l.To)
+	}
+	return strings.Join(assets, "->")
+}
+
+// Return returns the amount of the quote asset after trading amount through
+// the legs at the best bid and ask, keep is the ratio of a fill left after
+// the fee. False is returned if a ticker is missing.
+func (c *Cycle) Return(amount model.Decimal, tickers map[string]*BookTicker, keep model.Decimal) (model.Decimal, bool) {
+	for _, l := range c.Legs {
+		t, ok := tickers[l.Symbol]
+		if !ok || t.Bid.Sign() <= 0 || t.Ask.Sign() <= 0 {
+			return model.Decimal{}, false
+		}
+		if l.Side == binance.SideTypeBuy {
+			amount = amount.Div(t.Ask)
+		} else {
+			amount = amount.Mul(t.Bid)
+		}
+		amount = amount.Mul(keep)
+	}
+	return amount, true
+}
+
+// BookTicker defines the best bid and ask of a symbol
+type BookTicker struct {
+	Bid         model.Decimal `json:"bid"`
+	BidQuantity model.Decimal `json:"bid_quantity"`
+	Ask         model.Decimal `json:"ask"`
+	AskQuantity model.Decimal `json:"ask_quantity"`
+}
+
+// Graph defines the currency graph of symbols, the assets are the vertexes
+// and each symbol is an edge of both directions
+type Graph struct {
+	quote   string
+	edges   map[string][]*Leg
+	cycles  []*Cycle
+	symbols []string
+}
+
+// NewGraph builds the graph of symbols and finds its cycles of three legs
+// starting from the quote asset
+func NewGraph(quote string, symbols []*binance.Symbol) *Graph {
+	g := &Graph{quote: quote, edges: make(map[string][]*Leg)}
+	for _, s := range symbols {
+		g.edges[s.QuoteAsset] = append(g.edges[s.QuoteAsset], &Leg{s.Symbol, s.QuoteAsset, s.BaseAsset, binance.SideTypeBuy})
+		g.edges[s.BaseAsset] = append(g.edges[s.BaseAsset], &Leg{s.Symbol, s.BaseAsset, s.QuoteAsset, binance.SideTypeSell})
+	}
+
+	seen := make(map[string]bool)
+	for _, first := range g.edges[quote] {
+		for _, second := range g.edges[first.To] {
+			if second.To == quote {
+				continue
+			}
+			for _, third := range g.edges[second.To] {
+				if third.To != quote {
+					continue
+				}
+				g.cycles = append(g.cycles, &Cycle{Legs: []*Leg{first, second, third}})
+				for _, l := range []*Leg{first, second, third} {
+					if !seen[l.Symbol] {
+						seen[l.Symbol] = true
+						g.symbols = append(g.symbols, l.Symbol)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(g.symbols)
+	return g
+}
+
+// Cycles returns the cycles of the graph
+func (g *Graph) Cycles() []*Cycle {
+	return g.cycles
+}
+
+// Symbols returns the symbols of the cycles
+func (g *Graph) Symbols() []string {
+	return g.symbols
+}
+
+// exit returns the leg converting an asset to the quote asset
+func (g *Graph) exit(asset string) *Leg {
+	for _, l := range g.edges[asset] {
+		if l.To == g.quote {
+			return l
+		}
+	}
+	return nil
+}
+
+// exits returns the routes converting an asset to the quote asset without
+// trading symbol, the direct legs first and then the routes through an
+// intermediate asset
+func (g *Graph) exits(asset, symbol string) [][]*Leg {
+	var direct, indirect [][]*Leg
+	for _, l := range g.edges[asset] {
+		if l.Symbol == symbol {
+			continue
+		}
+		if l.To == g.quote {
+			direct = append(direct, []*Leg{l})
+		} else if next := g.exit(l.To); next != nil && next.Symbol != symbol {
+			indirect = append(indirect, []*Leg{l, next})
+		}
+	}
+	return append(direct, indirect...)
+}
+
+// Triangular detects cycles of the symbols of a policy whose net return
+// after fees exceeds the threshold and executes their legs
+type Triangular struct {
+	arb       *Arbitrager
+	log       *glog.Scope
+	client    *binance.Client
+	mu        sync.RWMutex
+	graph     *Graph
+	threshold model.Decimal
+	notional  model.Decimal
+	keep      model.Decimal
+	dryrun    bool
+	done      chan struct{}
+}
+
+// NewTriangular creates the triangular arbitrage of a policy in triangular
+// mode
+func NewTriangular(arb *Arbitrager) *Triangular {
+	t := &Triangular{
+		arb:    arb,
+		log:    triLog.WithLabels("policy", arb.name),
+		client: arb.shared.Client(arb.config.Exchange.ApiKey.Value(), arb.config.Exchange.SecretKey.Value()),
+		done:   make(chan struct{}),
+	}
+	t.apply(arb.config)
+	return t
+}
+
+// apply applies the parameters and rebuilds the graph of the symbols of a
+// config
+func (t *Triangular) apply(conf *model.Config) {
+	quote := model.QUOTE_ASSET
+	if conf.Policy.Triangular.Quote != "" {
+		quote = conf.Policy.Triangular.Quote
+	}
+	symbols := make([]*binance.Symbol, 0, len(conf.Policy.Symbols))
+	for _, symbol := range conf.Policy.Symbols {
+		if s, ok := t.arb.exch.getSymbol(symbol); ok {
+			symbols = append(symbols, s)
+		}
+	}
+	graph := NewGraph(quote, symbols)
+	t.log.Infof("%v cycles of %v among %v symbols", len(graph.Cycles()), quote, len(graph.Symbols()))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.graph = graph
+	t.threshold = model.NewDecimalFromFloat(conf.Policy.Triangular.Threshold)
+	t.notional = conf.Policy.Triangular.Notional
+	t.keep = model.NewDecimalFromFloat(1 - conf.Policy.Trade.Fee)
+	t.dryrun = conf.Policy.Dryrun
+}
+
+// Run scans the tickers every sample interval, a cycle is executed within
+// the scan so it is completed when Run returns
+func (t *Triangular) Run(stopCh <-chan struct{}) {
+	ticker := t.arb.clock.NewTicker(t.arb.Conf().Policy.Sample.Interval.Duration)
+	defer ticker.Stop()
+	heartbeat := t.arb.clock.NewTicker(HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	t.log.Info("worker is running")
+
+	for {
+		t.arb.health.Beat("triangular")
+		select {
+		case <-stopCh:
+			t.log.Info("worker is stopped")
+			// done is closed only once on stop, the worker may be restarted
+			// after failures
+			close(t.done)
+			return
+		case <-heartbeat.C():
+		case <-ticker.C():
+			ticksTotal.With(t.arb.name).Inc()
+			t.scan()
+		}
+	}
+}
+
+// scan finds the best cycle at the tickers and executes it if its edge is
+// above the threshold at the tickers and by the depth
+func (t *Triangular) scan() {
+	t.mu.RLock()
+	graph, threshold, notional, keep, dryrun := t.graph, t.threshold, t.notional, t.keep, t.dryrun
+	t.mu.RUnlock()
+	if len(graph.Cycles()) == 0 {
+		return
+	}
+
+	tickers, err := t.tickers(graph.Symbols())
+	if err != nil {
+		t.log.Errorf("get tickers error: %v", err)
+		fetchErrors.With(t.arb.name, "all", errorReason(err)).Inc()
+		return
+	}
+	t.arb.health.Sampled()
+
+	cycle, edge := t.best(graph, tickers, notional, keep)
+	if cycle == nil {
+		return
+	}
+	triangularBest.With(t.arb.name).Set(edge.Float64())
+	if edge.LessThan(threshold) {
+		t.log.Debugf("best cycle %v has edge %v", cycle, edge)
+		return
+	}
+	triangularCycles.With(t.arb.name, CYCLE_DETECTED).Inc()
+	t.log.Infof("cycle %v has edge %v at the tickers", cycle, edge)
+	if t.arb.Paused() {
+		t.log.Warnf("trading is paused, cycle %v ignored", cycle)
+		return
+	}
+
+	expected, err := t.checkDepth(cycle, notional, keep)
+	if err != nil {
+		t.log.Warnf("cycle %v is not executable: %v", cycle, err)
+		triangularCycles.With(t.arb.name, errorResult(err)).Inc()
+		return
+	}
+	if expected.LessThan(threshold) {
+		t.log.Infof("cycle %v has edge %v by the depth, below %v", cycle, expected, threshold)
+		triangularCycles.With(t.arb.name, CYCLE_SHALLOW).Inc()
+		return
+	}
+	if dryrun {
+		t.log.Infof("ignore cycle %v with expected edge %v in dryrun mode", cycle, expected)
+		triangularCycles.With(t.arb.name, CYCLE_DRYRUN).Inc()
+		return
+	}
+
+	// signed requests are rejected or misjudged with a drifting clock
+	if err := t.arb.shared.TimeSync().Check(t.arb.Conf().Exchange.TimeDrift()); err != nil {
+		t.log.Warnf("refuse to execute cycle %v: %v", cycle, err)
+		t.arb.notify(notify.EVENT_RISK, "", fmt.Sprintf("refuse to execute cycle %v: %v", cycle, err),
+			map[string]interface{}{"limit": "time_sync", "cycle": cycle.String()})
+		return
+	}
+
+	first := cycle.Legs[0].Symbol
+	if !t.arb.shared.Budget().Reserve(t.arb.name, first, notional) {
+		limit := t.arb.shared.Budget().Limit()
+		t.log.Warnf("risk budget %v is exhausted, cycle %v ignored", limit, cycle)
+		t.arb.notify(notify.EVENT_RISK, first, fmt.Sprintf("risk budget %v is exhausted, cycle %v is ignored", limit, cycle),
+			map[string]interface{}{"limit": "risk_budget", "budget": limit, "cycle": cycle.String()})
+		return
+	}
+	defer t.arb.shared.Budget().Release(t.arb.name, first)
+	t.execute(cycle, notional, expected)
+}
+
+// errorResult returns the cycle result of an error checking the depth
+func errorResult(err error) string {
+	var filterErr *FilterError
+	if errors.As(err, &filterErr) {
+		return CYCLE_FILTERED
+	}
+	return CYCLE_SHALLOW
+}
+
+// tickers queries the best bid and ask of all the symbols by one request
+func (t *Triangular) tickers(symbols []string) (map[string]*BookTicker, error) {
+	ctx, cancel := t.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	res, err := t.client.NewListBookTickersService().Do(ctx)
+	t.arb.observeRequest(model.OP_MARKET_DATA, err)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		wanted[symbol] = true
+	}
+	tickers := make(map[string]*BookTicker, len(symbols))
+	for _, r := range res {
+		if !wanted[r.Symbol] {
+			continue
+		}
+		var ticker BookTicker
+		for _, v := range []struct {
+			dst *model.Decimal
+			src string
+		}{
+			{&ticker.Bid, r.BidPrice}, {&ticker.BidQuantity, r.BidQuantity},
+			{&ticker.Ask, r.AskPrice}, {&ticker.AskQuantity, r.AskQuantity},
+		} {
+			if *v.dst, err = model.ParseDecimal(v.src); err != nil {
+				return nil, fmt.Errorf("invalid ticker of %v: %v", r.Symbol, err)
+			}
+		}
+		tickers[r.Symbol] = &ticker
+	}
+	return tickers, nil
+}
+
+// best returns the cycle of trading symbols with the highest edge at the
+// tickers
+func (t *Triangular) best(graph *Graph, tickers map[string]*BookTicker, notional, keep model.Decimal) (*Cycle, model.Decimal) {
+	var best *Cycle
+	var edge model.Decimal
+	for _, c := range graph.Cycles() {
+		trading := true
+		for _, l := range c.Legs {
+			trading = trading && t.arb.exch.Trading(l.Symbol)
+		}
+		if !trading {
+			continue
+		}
+		amount, ok := c.Return(notional, tickers, keep)
+		if !ok {
+			continue
+		}
+		if e := amount.Div(notional).Sub(model.NewDecimal(1, 0)); best == nil || e.GreaterThan(edge) {
+			best, edge = c, e
+		}
+	}
+	return best, edge
+}
+
+// checkDepth estimates the legs of a cycle by the order books and checks
+// them against the filters, the expected edge is returned
+func (t *Triangular) checkDepth(c *Cycle, notional, keep model.Decimal) (model.Decimal, error) {
+	amount := notional
+	for _, l := range c.Legs {
+		depth, err := t.arb.orderBook.Depth(l.Symbol)
+		if err != nil {
+			return model.Decimal{}, err
+		}
+
+		var e *Estimate
+		if l.Side == binance.SideTypeBuy {
+			if e, err = depth.EstimateBuy(amount); err == nil {
+				_, err = t.arb.exch.CheckMarketBuy(l.Symbol, amount, &FilterState{AvgPrice: e.Mid})
+			}
+		} else {
+			if e, err = depth.EstimateSell(amount); err == nil {
+				_, err = t.arb.exch.CheckMarketSell(l.Symbol, amount, &FilterState{AvgPrice: e.Mid})
+			}
+		}
+		if err != nil {
+			return model.Decimal{}, err
+		}
+		if !e.Filled {
+			return model.Decimal{}, fmt.Errorf("order book of %v is too thin for %v %v", l.Symbol, amount, l.From)
+		}
+
+		if l.Side == binance.SideTypeBuy {
+			amount = e.Base.Mul(keep)
+		} else {
+			amount = e.Quote.Mul(keep)
+		}
+	}
+	return amount.Div(notional).Sub(model.NewDecimal(1, 0)), nil
+}
+
+// execute trades the legs of a cycle one after another, each leg trades
+// the amount received by the previous one. The asset held after a failed
+// leg is converted back to the quote asset.
+func (t *Triangular) execute(c *Cycle, notional, expected model.Decimal) {
+	t.log.Infof("execute cycle %v with %v %v, expected edge %v", c, notional, c.Legs[0].From, expected)
+	amount := notional
+	fees := make(map[string]model.Decimal)
+	for i, l := range c.Legs {
+		received, legFees, err := t.trade(l, amount)
+		if err != nil {
+			t.log.Errorf("leg %d %v of cycle %v failed: %v", i+1, l, c, err)
+			triangularCycles.With(t.arb.name, CYCLE_FAILED).Inc()
+			if i > 0 {
+				t.unwind(l, amount)
+			}
+			t.arb.notify(notify.EVENT_ORDER_FAILED, l.Symbol, fmt.Sprintf("leg %d of cycle %v failed: %v", i+1, c, err),
+				map[string]interface{}{"side": strings.ToLower(string(l.Side)), "cycle": c.String(), "leg": i + 1})
+			return
+		}
+		t.log.Infof("leg %d %v traded %v %v for %v %v", i+1, l, amount, l.From, received, l.To)
+		amount = received
+		for asset, fee := range legFees {
+			fees[asset] = fees[asset].Add(fee)
+		}
+	}
+
+	// commissions paid in other assets, e.g. BNB, are not deducted from the
+	// amounts traded but from the return
+	net := amount
+	if len(fees) > 0 {
+		quote := c.Legs[0].From
+		if cost, err := t.quoteValue(fees, quote); err != nil {
+			t.log.Warnf("commissions %v are not valued in %v, the realized edge excludes them: %v", fees, quote, err)
+		} else {
+			net = amount.Sub(cost)
+		}
+	}
+	realized := net.Div(notional).Sub(model.NewDecimal(1, 0))
+	t.log.Infof("cycle %v returned %v of %v %v, expected edge %v, realized edge %v",
+		c, amount, notional, c.Legs[0].From, expected, realized)
+	triangularCycles.With(t.arb.name, CYCLE_EXECUTED).Inc()
+	triangularEdge.With(t.arb.name, "expected").Set(expected.Float64())
+	triangularEdge.With(t.arb.name, "realized").Set(realized.Float64())
+}
+
+// unwind converts the asset held after a failed leg back to the quote
+// asset by a route without the symbol of the failed leg, so the last leg is
+// not retried. The asset is left to manual operation if all the routes fail.
+func (t *Triangular) unwind(failed *Leg, amount model.Decimal) {
+	asset := failed.From
+	t.mu.RLock()
+	routes := t.graph.exits(asset, failed.Symbol)
+	t.mu.RUnlock()
+
+	err := fmt.Errorf("no route to sell %v other than the failed %v", asset, failed.Symbol)
+	for _, route := range routes {
+		held, received := asset, amount
+		for _, l := range route {
+			var next model.Decimal
+			if next, _, err = t.trade(l, received); err != nil {
+				break
+			}
+			held, received = l.To, next
+		}
+		if err == nil {
+			t.log.Warnf("unwound %v %v for %v %v by %v", amount, asset, received, held, route)
+			triangularCycles.With(t.arb.name, CYCLE_UNWOUND).Inc()
+			return
+		}
+		if held != asset {
+			// the route failed halfway, the intermediate asset is left
+			asset, amount = held, received
+			break
+		}
+		t.log.Warnf("failed to unwind %v %v by %v: %v", amount, asset, route, err)
+	}
+
+	t.log.Errorf("failed to unwind %v %v: %v", amount, asset, err)
+	t.arb.notify(notify.EVENT_ORDER_FAILED, asset, fmt.Sprintf("CRITICAL: %v %v is left by a failed cycle: %v", amount, asset, err),
+		map[string]interface{}{"asset": asset, "quantity": amount, "critical": true})
+}
+
+// trade places the market order of a leg for amount of its From asset and
+// returns the amount of its To asset received after the commission, and
+// the commissions paid in other assets
+func (t *Triangular) trade(l *Leg, amount model.Decimal) (model.Decimal, map[string]model.Decimal, error) {
+	side := strings.ToLower(string(l.Side))
+	service := t.client.NewCreateOrderService().Symbol(l.Symbol).Side(l.Side).Type(binance.OrderTypeMarket)
+	if l.Side == binance.SideTypeBuy {
+		quote, err := t.arb.exch.CheckMarketBuy(l.Symbol, amount, nil)
+		if err != nil {
+			return model.Decimal{}, nil, err
+		}
+		service.QuoteOrderQty(quote)
+	} else {
+		quantity, err := t.arb.exch.CheckMarketSell(l.Symbol, amount, nil)
+		if err != nil {
+			return model.Decimal{}, nil, err
+		}
+		service.Quantity(quantity)
+	}
+
+	ctx, cancel := t.arb.requestContext(model.OP_ORDER)
+	defer cancel()
+	res, err := service.Do(ctx)
+	t.arb.observeRequest(model.OP_ORDER, err)
+	if err != nil {
+		t.arb.trader.orderResult(l.Symbol, side, 0, err)
+		return model.Decimal{}, nil, err
+	}
+	t.arb.trader.orderResult(l.Symbol, side, res.OrderID, nil)
+
+	fill, err := legFill(l, res)
+	if err != nil {
+		return model.Decimal{}, nil, err
+	}
+	t.arb.publish(TOPIC_FILL, &Fill{Symbol: l.Symbol, Side: side, OrderID: res.OrderID, Price: fill.Price, Quantity: fill.Base})
+	return fill.Received, fill.Fees, nil
+}
+
+// LegFill defines the fills of the market order of a leg
+type LegFill struct {
+	// Price is the average price of the fills
+	Price model.Decimal
+	// Base is the base quantity filled
+	Base model.Decimal
+	// Received is the amount of the To asset received after the commission
+	Received model.Decimal
+	// Fees are the commissions paid in other assets than the To asset
+	Fees map[string]model.Decimal
+}
+
+// legFill returns the fills of the market order of a leg
+func legFill(l *Leg, res *binance.CreateOrderResponse) (*LegFill, error) {
+	var base, quote, commission model.Decimal
+	fees := make(map[string]model.Decimal)
+	for _, f := range res.Fills {
+		price, err := model.ParseDecimal(f.Price)
+		if err != nil {
+			return nil, fmt.Errorf("convert price error: %v", err)
+		}
+		quantity, err := model.ParseDecimal(f.Quantity)
+		if err != nil {
+			return nil, fmt.Errorf("convert quantity error: %v", err)
+		}
+		fee, err := model.ParseDecimal(f.Commission)
+		if err != nil {
+			return nil, fmt.Errorf("convert commission error: %v", err)
+		}
+
+		base = base.Add(quantity)
+		quote = quote.Add(price.Mul(quantity))
+		if f.CommissionAsset == l.To {
+			commission = commission.Add(fee)
+		} else if !fee.IsZero() {
+			fees[f.CommissionAsset] = fees[f.CommissionAsset].Add(fee)
+		}
+	}
+	if base.Sign() <= 0 {
+		return nil, fmt.Errorf("order %v of %v is not filled", res.OrderID, l.Symbol)
+	}
+
+	received := quote
+	if l.Side == binance.SideTypeBuy {
+		received = base
+	}
+	return &LegFill{Price: quote.Div(base), Base: base, Received: received.Sub(commission), Fees: fees}, nil
+}
+
+// quoteValue returns the value in the quote asset of commissions at the
+// last prices of the symbols pairing their assets with the quote asset
+func (t *Triangular) quoteValue(fees map[string]model.Decimal, quote string) (model.Decimal, error) {
+	var total model.Decimal
+	for asset, fee := range fees {
+		if asset == quote {
+			total = total.Add(fee)
+			continue
+		}
+
+		symbol, inverse := asset+quote, false
+		if _, ok := t.arb.exch.getSymbol(symbol); !ok {
+			symbol, inverse = quote+asset, true
+			if _, ok := t.arb.exch.getSymbol(symbol); !ok {
+				return model.Decimal{}, fmt.Errorf("no symbol to value %v in %v", asset, quote)
+			}
+		}
+		price, err := t.lastPrice(symbol)
+		if err != nil {
+			return model.Decimal{}, err
+		}
+		if price.Sign() <= 0 {
+			return model.Decimal{}, fmt.Errorf("invalid price %v of %v", price, symbol)
+		}
+		if inverse {
+			total = total.Add(fee.Div(price))
+		} else {
+			total = total.Add(fee.Mul(price))
+		}
+	}
+	return total, nil
+}
+
+// lastPrice queries the last price of a symbol
+func (t *Triangular) lastPrice(symbol string) (model.Decimal, error) {
+	ctx, cancel := t.arb.requestContext(model.OP_MARKET_DATA)
+	defer cancel()
+	res, err := t.client.NewListPricesService().Symbol(symbol).Do(ctx)
+	t.arb.observeRequest(model.OP_MARKET_DATA, err)
+	if err != nil {
+		return model.Decimal{}, err
+	}
+	if len(res) == 0 {
+		return model.Decimal{}, fmt.Errorf("no price of %v", symbol)
+	}
+	return model.ParseDecimal(res[0].Price)
+}
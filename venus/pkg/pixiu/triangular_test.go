@@ -0,0 +1,365 @@
+package pixiu
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+	"github.com/vjoke/falcon/venus/pkg/notify"
+)
+
+type triangularTestSuite struct {
+	suite.Suite
+}
+
+func TestTriangular(t *testing.T) {
+	suite.Run(t, new(triangularTestSuite))
+}
+
+// newCrossSymbol creates a symbol of a base and a quote asset
+func newCrossSymbol(base, quote string) *binance.Symbol {
+	return &binance.Symbol{Symbol: base + quote, BaseAsset: base, QuoteAsset: quote}
+}
+
+func (r *triangularTestSuite) TestGraph() {
+	g := NewGraph("USDT", []*binance.Symbol{
+		newCrossSymbol("BTC", "USDT"),
+		newCrossSymbol("ADA", "BTC"),
+		newCrossSymbol("ADA", "USDT"),
+		newCrossSymbol("DOT", "USDT"),
+	})
+
+	cycles := make([]string, 0)
+	for _, c := range g.Cycles() {
+		cycles = append(cycles, c.String())
+	}
+	assert.Equal(r.T(), []string{"USDT->BTC->ADA->USDT", "USDT->ADA->BTC->USDT"}, cycles)
+	assert.Equal(r.T(), []string{"ADABTC", "ADAUSDT", "BTCUSDT"}, g.Symbols())
+	assert.Equal(r.T(), "SELL ADAUSDT", g.exit("ADA").String())
+	assert.Nil(r.T(), g.exit("ETH"))
+
+	routes := func(asset, symbol string) []string {
+		r := make([]string, 0)
+		for _, route := range g.exits(asset, symbol) {
+			r = append(r, fmt.Sprint(route))
+		}
+		return r
+	}
+	assert.Equal(r.T(), []string{"[SELL ADAUSDT]", "[SELL ADABTC SELL BTCUSDT]"}, routes("ADA", ""))
+	assert.Equal(r.T(), []string{"[SELL ADABTC SELL BTCUSDT]"}, routes("ADA", "ADAUSDT"))
+	assert.Empty(r.T(), routes("DOT", "DOTUSDT"))
+
+	assert.Empty(r.T(), NewGraph("BTC", []*binance.Symbol{newCrossSymbol("ADA", "USDT")}).Cycles())
+}
+
+func (r *triangularTestSuite) TestReturn() {
+	g := NewGraph("USDT", []*binance.Symbol{
+		newCrossSymbol("BTC", "USDT"),
+		newCrossSymbol("ADA", "BTC"),
+		newCrossSymbol("ADA", "USDT"),
+	})
+	tickers := map[string]*BookTicker{
+		"BTCUSDT": {Bid: dec("49990"), Ask: dec("50000")},
+		"ADABTC":  {Bid: dec("0.00001999"), Ask: dec("0.00002")},
+		"ADAUSDT": {Bid: dec("1.2"), Ask: dec("1.21")},
+	}
+
+	// 100 USDT buys 0.002 BTC, which buys 100 ADA sold for 120 USDT
+	amount, ok := g.Cycles()[0].Return(dec("100"), tickers, dec("1"))
+	assert.True(r.T(), ok)
+	assert.Equal(r.T(), dec("120"), amount)
+	amount, _ = g.Cycles()[0].Return(dec("100"), tickers, dec("0.999"))
+	assert.Equal(r.T(), dec("119.64035988"), amount)
+
+	delete(tickers, "ADABTC")
+	_, ok = g.Cycles()[0].Return(dec("100"), tickers, dec("1"))
+	assert.False(r.T(), ok)
+}
+
+// newTriangularArbitrager creates an arbitrager in triangular mode of a
+// mock exchange, where USDT->BTC->ADA->USDT returns about 20%
+func (r *triangularTestSuite) newTriangularArbitrager(failures ...*mockexchange.Failure) (*Arbitrager, *mockexchange.Exchange, func()) {
+	script := mockexchange.DefaultScript("BTCUSDT", "ADABTC", "ADAUSDT")
+	btc, cross, ada := script.Symbols[0], script.Symbols[1], script.Symbols[2]
+	btc.Prices, btc.TickSize, btc.StepSize = []float64{50000}, 0.01, 0.000001
+	cross.BaseAsset, cross.QuoteAsset, cross.MinNotional = "ADA", "BTC", 0.0001
+	cross.Prices, cross.TickSize = []float64{0.00002}, 0.00000001
+	ada.Prices = []float64{1.2}
+	script.Failures = failures
+	exchange := mockexchange.New(script)
+	server := httptest.NewServer(exchange)
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	conf.Exchange.DisableUserStream = true
+	conf.Policy.Dryrun = false
+	conf.Policy.Mode = model.MODE_TRIANGULAR
+	conf.Policy.Symbols = []string{"BTCUSDT", "ADABTC", "ADAUSDT"}
+	conf.Policy.Trade.Fee = 0.001
+	conf.Policy.Triangular = &model.Triangular{Threshold: 0.002, Notional: dec("20")}
+	a, err := NewArbitrager(conf, NewShared(0))
+	r.Require().NoError(err)
+	r.Require().NotNil(a.triangular)
+	return a, exchange, server.Close
+}
+
+// syncTime syncs the time with the mock exchange, cycles are not executed
+// before
+func (r *triangularTestSuite) syncTime(a *Arbitrager) {
+	r.Require().NoError(a.shared.TimeSync().Sync(context.Background(), a.triangular.client, true))
+}
+
+// balance returns the free balance of an asset
+func (r *triangularTestSuite) balance(a *Arbitrager, asset string) model.Decimal {
+	m, err := a.account.GetBalanceMap()
+	r.Require().NoError(err)
+	return m[asset]
+}
+
+func (r *triangularTestSuite) TestExecute() {
+	a, _, stop := r.newTriangularArbitrager()
+	defer stop()
+	fills := a.bus.Subscribe(TOPIC_FILL, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	workers := a.Workers()
+	if r.Len(workers, 1) {
+		assert.Equal(r.T(), "triangular", workers[0].Name)
+	}
+
+	// the time is not synced yet
+	a.triangular.scan()
+	assert.Equal(r.T(), 0, fills.Len())
+
+	r.syncTime(a)
+	a.triangular.scan()
+	assert.Equal(r.T(), 3, fills.Len())
+	// 0.0003996 BTC buys 19.9 ADA, 19.8 ADA is sold for 23.76 USDT less fee
+	assert.Equal(r.T(), dec("1003.73624"), r.balance(a, "USDT"))
+	assert.Equal(r.T(), dec("0.0801"), r.balance(a, "ADA"))
+	assert.True(r.T(), a.shared.Budget().Exposure(a.name).IsZero())
+}
+
+// riskSink records the events sent to it
+type riskSink struct {
+	mu     sync.Mutex
+	events []*notify.Event
+}
+
+func (s *riskSink) Name() string { return "risk" }
+func (s *riskSink) Send(text string, e *notify.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (r *triangularTestSuite) TestRiskNotified() {
+	a, _, stop := r.newTriangularArbitrager()
+	defer stop()
+	sink := &riskSink{}
+	route, err := notify.NewRoute(sink, []string{notify.EVENT_RISK}, 0, "")
+	r.Require().NoError(err)
+	a.notifier = notify.NewDispatcher(route)
+	a.notifier.Start()
+
+	// the time is not synced yet
+	a.triangular.scan()
+	// the notional 20 exceeds the budget
+	r.syncTime(a)
+	a.shared.budget = NewRiskBudget(dec("10"))
+	a.triangular.scan()
+	a.notifier.Close(time.Second)
+
+	r.Require().Len(sink.events, 2)
+	assert.Equal(r.T(), "time_sync", sink.events[0].Fields["limit"])
+	assert.Equal(r.T(), "risk_budget", sink.events[1].Fields["limit"])
+	assert.Equal(r.T(), "BTCUSDT", sink.events[1].Symbol)
+	assert.Equal(r.T(), dec("10"), sink.events[1].Fields["budget"])
+}
+
+func (r *triangularTestSuite) TestUnwind() {
+	// the order of the second leg is rejected
+	a, _, stop := r.newTriangularArbitrager(&mockexchange.Failure{
+		Method: http.MethodPost, Path: "/api/v3/order", Status: http.StatusBadRequest,
+		Code: -2010, Msg: "Account has insufficient balance for requested action.", After: 1, Count: 1,
+	})
+	defer stop()
+	results := a.bus.Subscribe(TOPIC_ORDER_RESULT, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	r.syncTime(a)
+	a.triangular.scan()
+	r.Require().Equal(3, results.Len())
+	assert.Empty(r.T(), (<-results.C()).OrderResult().Error)
+	assert.NotEmpty(r.T(), (<-results.C()).OrderResult().Error)
+	unwind := (<-results.C()).OrderResult()
+	assert.Equal(r.T(), "BTCUSDT", unwind.Symbol)
+	assert.Equal(r.T(), "sell", unwind.Side)
+	assert.Empty(r.T(), unwind.Error)
+	// 0.000399 BTC is sold back, the dust below the step size is left
+	assert.Equal(r.T(), dec("999.930050"), r.balance(a, "USDT"))
+	assert.Equal(r.T(), dec("0.0000006"), r.balance(a, "BTC"))
+}
+
+func (r *triangularTestSuite) TestUnwindLastLeg() {
+	// the order of the last leg is rejected, ADA is sold by ADABTC and
+	// BTCUSDT instead
+	a, _, stop := r.newTriangularArbitrager(&mockexchange.Failure{
+		Method: http.MethodPost, Path: "/api/v3/order", Status: http.StatusBadRequest,
+		Code: -2010, Msg: "Account has insufficient balance for requested action.", After: 2, Count: 1,
+	})
+	defer stop()
+	results := a.bus.Subscribe(TOPIC_ORDER_RESULT, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	r.syncTime(a)
+	a.triangular.scan()
+	r.Require().Equal(5, results.Len())
+	for i := 0; i < 2; i++ {
+		assert.Empty(r.T(), (<-results.C()).OrderResult().Error)
+	}
+	failed := (<-results.C()).OrderResult()
+	assert.Equal(r.T(), "ADAUSDT", failed.Symbol)
+	assert.NotEmpty(r.T(), failed.Error)
+	for _, symbol := range []string{"ADABTC", "BTCUSDT"} {
+		unwind := (<-results.C()).OrderResult()
+		assert.Equal(r.T(), symbol, unwind.Symbol)
+		assert.Equal(r.T(), "sell", unwind.Side)
+		assert.Empty(r.T(), unwind.Error)
+	}
+	// 19.8 ADA is sold back, the dust below the step size is left
+	assert.Equal(r.T(), dec("999.73025"), r.balance(a, "USDT"))
+	assert.Equal(r.T(), dec("0.0801"), r.balance(a, "ADA"))
+}
+
+func (r *triangularTestSuite) TestUnwindFailed() {
+	// the last leg and the route of the unwind are rejected
+	a, _, stop := r.newTriangularArbitrager(&mockexchange.Failure{
+		Method: http.MethodPost, Path: "/api/v3/order", Status: http.StatusBadRequest,
+		Code: -2010, Msg: "Account has insufficient balance for requested action.", After: 2, Count: 2,
+	})
+	defer stop()
+	sink := &riskSink{}
+	route, err := notify.NewRoute(sink, []string{notify.EVENT_ORDER_FAILED}, 0, "")
+	r.Require().NoError(err)
+	a.notifier = notify.NewDispatcher(route)
+	a.notifier.Start()
+
+	r.syncTime(a)
+	a.triangular.scan()
+	a.notifier.Close(time.Second)
+
+	var critical *notify.Event
+	for _, e := range sink.events {
+		if e.Fields["critical"] == true {
+			critical = e
+		}
+	}
+	r.Require().NotNil(critical)
+	assert.Equal(r.T(), "ADA", critical.Symbol)
+	assert.Contains(r.T(), critical.Message, "insufficient balance")
+	assert.False(r.T(), r.balance(a, "ADA").IsZero())
+}
+
+func (r *triangularTestSuite) TestBelowThreshold() {
+	a, exchange, stop := r.newTriangularArbitrager()
+	defer stop()
+	fills := a.bus.Subscribe(TOPIC_FILL, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	// the cycles lose the fees and the spreads
+	exchange.SetPrice("ADAUSDT", 1)
+	a.triangular.scan()
+	assert.Equal(r.T(), 0, fills.Len())
+
+	// the depth is too thin for the notional
+	exchange.SetPrice("ADAUSDT", 1.2)
+	conf := *a.Conf()
+	policy := *conf.Policy
+	policy.Triangular = &model.Triangular{Threshold: 0.002, Notional: dec("2000000")}
+	conf.Policy = &policy
+	a.triangular.apply(&conf)
+	a.triangular.scan()
+	assert.Equal(r.T(), 0, fills.Len())
+
+	// dryrun only logs the cycle
+	policy.Triangular = &model.Triangular{Threshold: 0.002, Notional: dec("20")}
+	policy.Dryrun = true
+	a.triangular.apply(&conf)
+	a.triangular.scan()
+	assert.Equal(r.T(), 0, fills.Len())
+	assert.Equal(r.T(), dec("1000"), r.balance(a, "USDT"))
+}
+
+func (r *triangularTestSuite) TestLegFill() {
+	leg := &Leg{Symbol: "BTCUSDT", From: "USDT", To: "BTC", Side: binance.SideTypeBuy}
+	fill, err := legFill(leg, &binance.CreateOrderResponse{Fills: []*binance.Fill{
+		{Price: "50000", Quantity: "0.0002", Commission: "0.0000002", CommissionAsset: "BTC"},
+		{Price: "50010", Quantity: "0.0002", Commission: "0.0001", CommissionAsset: "BNB"},
+		{Price: "50010", Quantity: "0.0002", Commission: "0.0001", CommissionAsset: "BNB"},
+	}})
+	r.Require().NoError(err)
+	assert.Equal(r.T(), dec("0.0006"), fill.Base)
+	assert.Equal(r.T(), dec("0.0005998"), fill.Received)
+	assert.Equal(r.T(), map[string]model.Decimal{"BNB": dec("0.0002")}, fill.Fees)
+
+	_, err = legFill(leg, &binance.CreateOrderResponse{})
+	assert.Error(r.T(), err)
+}
+
+func (r *triangularTestSuite) TestQuoteValue() {
+	a, _, stop := r.newTriangularArbitrager()
+	defer stop()
+
+	// BTC is valued by BTCUSDT
+	cost, err := a.triangular.quoteValue(map[string]model.Decimal{"USDT": dec("0.1"), "BTC": dec("0.000002")}, "USDT")
+	r.Require().NoError(err)
+	assert.Equal(r.T(), dec("0.2"), cost)
+	// USDT is valued in ADA by ADAUSDT
+	cost, err = a.triangular.quoteValue(map[string]model.Decimal{"USDT": dec("1.2")}, "ADA")
+	r.Require().NoError(err)
+	assert.Equal(r.T(), dec("1"), cost)
+
+	_, err = a.triangular.quoteValue(map[string]model.Decimal{"BNB": dec("0.001")}, "USDT")
+	assert.Error(r.T(), err)
+}
+
+func (r *triangularTestSuite) TestRestart() {
+	a, _, stop := r.newTriangularArbitrager()
+	defer stop()
+	clock := NewSimClock(time.Now())
+	a.clock = clock
+
+	// a panic of a scan is recovered by the supervisor and the worker is
+	// restarted, done is closed only on stop
+	graph := a.triangular.graph
+	a.triangular.graph = nil
+	for i := 0; i < 2; i++ {
+		exited := make(chan struct{})
+		go func() {
+			defer close(exited)
+			defer func() { recover() }()
+			a.triangular.Run(make(chan struct{}))
+		}()
+		r.Require().Eventually(func() bool { return clock.Waiters() == 2 }, time.Second, time.Millisecond)
+		clock.Advance(a.Conf().Policy.Sample.Interval.Duration)
+		<-exited
+		select {
+		case <-a.triangular.done:
+			r.T().Fatal("done is closed by a failure")
+		default:
+		}
+	}
+
+	a.triangular.graph = graph
+	stopCh := make(chan struct{})
+	close(stopCh)
+	a.triangular.Run(stopCh)
+	<-a.triangular.done
+}
@@ -0,0 +1,528 @@
+package pixiu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/gorilla/websocket"
+	glog "github.com/vjoke/falcon/pkg/log"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+var usLog = glog.RegisterScope("userstream", "userstream", 0)
+
+const (
+	// USER_STREAM_KEEPALIVE is the interval to keep the listen key alive,
+	// which expires in 60 minutes without keepalive
+	USER_STREAM_KEEPALIVE = 30 * time.Minute
+	// USER_STREAM_RETRY is the delay before reconnecting a closed stream
+	USER_STREAM_RETRY = 5 * time.Second
+	// USER_STREAM_BUFFER is the buffer of messages received while the
+	// snapshot of the account is taken
+	USER_STREAM_BUFFER = 100
+	// EXECUTION_BUFFER is the buffer of executions for the trader,
+	// executions are never dropped
+	EXECUTION_BUFFER = 40
+)
+
+// event types of the user data stream
+const (
+	EVENT_EXECUTION_REPORT = "executionReport"
+	EVENT_LIST_STATUS      = "listStatus"
+	EVENT_ACCOUNT_POSITION = "outboundAccountPosition"
+)
+
+const (
+	// EXECUTION_TRADE is the execution type of a fill
+	EXECUTION_TRADE = "TRADE"
+	// LIST_ALL_DONE and LIST_REJECT are the list order status of a finished
+	// oco
+	LIST_ALL_DONE = "ALL_DONE"
+	LIST_REJECT   = "REJECT"
+)
+
+const (
+	WS_MAIN_URL    = "wss://stream.binance.com:9443/ws"
+	WS_TESTNET_URL = "wss://testnet.binance.vision/ws"
+)
+
+// ExecutionReport defines an executionReport event of the user data
+// stream. Keys of binance differ only in case, e.g. c and C, all of them
+// are declared since json matches keys case-insensitively.
+type ExecutionReport struct {
+	Event               string        `json:"e"`
+	EventTime           int64         `json:"E"`
+	Symbol              string        `json:"s"`
+	ClientOrderID       string        `json:"c"`
+	Side                string        `json:"S"`
+	Type                string        `json:"o"`
+	TimeInForce         string        `json:"f"`
+	Quantity            model.Decimal `json:"q"`
+	Price               model.Decimal `json:"p"`
+	StopPrice           model.Decimal `json:"P"`
+	IcebergQuantity     model.Decimal `json:"F"`
+	OrderListID         int64         `json:"g"`
+	OrigClientOrderID   string        `json:"C"`
+	ExecutionType       string        `json:"x"`
+	Status              string        `json:"X"`
+	RejectReason        string        `json:"r"`
+	OrderID             int64         `json:"i"`
+	LastQuantity        model.Decimal `json:"l"`
+	FilledQuantity      model.Decimal `json:"z"`
+	LastPrice           model.Decimal `json:"L"`
+	Commission          model.Decimal `json:"n"`
+	CommissionAsset     string        `json:"N"`
+	TransactionTime     int64         `json:"T"`
+	TradeID             int64         `json:"t"`
+	Ignore              int64         `json:"I"`
+	IsWorking           bool          `json:"w"`
+	WorkingTime         int64         `json:"W"`
+	IsMaker             bool          `json:"m"`
+	IsBestMatch         bool          `json:"M"`
+	CreateTime          int64         `json:"O"`
+	FilledQuoteQuantity model.Decimal `json:"Z"`
+	LastQuoteQuantity   model.Decimal `json:"Y"`
+	QuoteOrderQuantity  model.Decimal `json:"Q"`
+}
+
+// Done checks if an order is not open any more
+func (r *ExecutionReport) Done() bool {
+	switch binance.OrderStatusType(r.Status) {
+	case binance.OrderStatusTypeFilled, binance.OrderStatusTypeCanceled,
+		binance.OrderStatusTypeRejected, binance.OrderStatusTypeExpired:
+		return true
+	}
+	return false
+}
+
+// ListStatus defines a listStatus event of an oco
+type ListStatus struct {
+	Event             string `json:"e"`
+	EventTime         int64  `json:"E"`
+	Symbol            string `json:"s"`
+	OrderListID       int64  `json:"g"`
+	ContingencyType   string `json:"c"`
+	ListStatusType    string `json:"l"`
+	ListOrderStatus   string `json:"L"`
+	RejectReason      string `json:"r"`
+	ListClientOrderID string `json:"C"`
+	TransactionTime   int64  `json:"T"`
+	Orders            []struct {
+		Symbol        string `json:"s"`
+		OrderID       int64  `json:"i"`
+		ClientOrderID string `json:"c"`
+	} `json:"O"`
+}
+
+// accountPosition defines an outboundAccountPosition event with the
+// balances changed
+type accountPosition struct {
+	Event      string `json:"e"`
+	EventTime  int64  `json:"E"`
+	UpdateTime int64  `json:"u"`
+	Balances   []struct {
+		Asset  string        `json:"a"`
+		Free   model.Decimal `json:"f"`
+		Locked model.Decimal `json:"l"`
+	} `json:"B"`
+}
+
+type streamBalance struct {
+	free   model.Decimal
+	locked model.Decimal
+	// updated is the update time of the balance on the exchange
+	updated int64
+}
+
+// UserStream keeps the balances and the open orders of the account from the
+// user data stream, the cache is only used while the stream is connected
+// and synced with a snapshot of the account
+type UserStream struct {
+	arb      *Arbitrager
+	log      *glog.Scope
+	client   *binance.Client
+	retry    time.Duration
+	mu       sync.RWMutex
+	synced   bool
+	balances map[string]*streamBalance
+	orders   map[int64]*ExecutionReport
+	lists    map[int64]*ListStatus
+}
+
+// NewUserStream creates a user stream which is not synced yet
+func NewUserStream(arb *Arbitrager) *UserStream {
+	return &UserStream{
+		arb:      arb,
+		log:      usLog.WithLabels("policy", arb.name),
+		client:   arb.shared.Client(arb.config.Exchange.ApiKey.Value(), arb.config.Exchange.SecretKey.Value()),
+		retry:    USER_STREAM_RETRY,
+		balances: make(map[string]*streamBalance),
+		orders:   make(map[int64]*ExecutionReport),
+		lists:    make(map[int64]*ListStatus),
+	}
+}
+
+// Synced checks if the cache is synced with the account
+func (s *UserStream) Synced() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.synced
+}
+
+// Balance returns the free and locked balance of an asset, ok is false if
+// the cache is not synced
+func (s *UserStream) Balance(asset string) (model.Decimal, model.Decimal, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.synced {
+		return model.Decimal{}, model.Decimal{}, false, nil
+	}
+	b, ok := s.balances[asset]
+	if !ok {
+		return model.Decimal{}, model.Decimal{}, true, fmt.Errorf("found no asset %v", asset)
+	}
+	return b.free, b.locked, true, nil
+}
+
+// BalanceMap returns the non-zero balances of all the assets, ok is false
+// if the cache is not synced
+func (s *UserStream) BalanceMap() (map[string]model.Decimal, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.synced {
+		return nil, false
+	}
+	m := make(map[string]model.Decimal, len(s.balances))
+	for asset, b := range s.balances {
+		if total := b.free.Add(b.locked); total.Sign() > 0 {
+			m[asset] = total
+		}
+	}
+	return m, true
+}
+
+// OpenOrders returns the open orders of a symbol sorted by id, ok is false
+// if the cache is not synced
+func (s *UserStream) OpenOrders(symbol string) ([]*ExecutionReport, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.synced {
+		return nil, false
+	}
+	orders := make([]*ExecutionReport, 0)
+	for _, r := range s.orders {
+		if r.Symbol == symbol {
+			copied := *r
+			orders = append(orders, &copied)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].OrderID < orders[j].OrderID })
+	return orders, true
+}
+
+// Run keeps the stream connected until stop is closed, it reconnects with a
+// new listen key after failures
+func (s *UserStream) Run(stopCh <-chan struct{}) {
+	for {
+		err := s.serve(stopCh)
+		s.setSynced(false)
+		select {
+		case <-stopCh:
+			s.log.Info("user data stream is stopped")
+			return
+		default:
+		}
+
+		s.log.Warnf("user data stream is closed, reconnect in %v: %v", s.retry, err)
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(s.retry):
+		}
+	}
+}
+
+// serve connects the stream and handles its events until it fails or stop
+// is closed. Events received while the snapshot is taken are buffered and
+// applied after it.
+func (s *UserStream) serve(stopCh <-chan struct{}) error {
+	ctx, cancel := s.arb.requestContext(model.OP_ACCOUNT)
+	listenKey, err := s.client.NewStartUserStreamService().Do(ctx)
+	cancel()
+	s.arb.observeRequest(model.OP_ACCOUNT, err)
+	if err != nil {
+		return fmt.Errorf("failed to start listen key: %v", err)
+	}
+	defer s.closeListenKey(listenKey)
+
+	conn, _, err := websocket.DefaultDialer.Dial(s.endpoint(listenKey), nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	userStreamConnected.With(s.arb.name).Set(1)
+	defer userStreamConnected.With(s.arb.name).Set(0)
+
+	done := make(chan struct{})
+	defer close(done)
+	messages := make(chan []byte, USER_STREAM_BUFFER)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case messages <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := s.snapshot(); err != nil {
+		return err
+	}
+	s.log.Info("user data stream is synced")
+
+	keepalive := time.NewTicker(USER_STREAM_KEEPALIVE)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case err := <-errc:
+			return err
+		case <-keepalive.C:
+			ctx, cancel := s.arb.requestContext(model.OP_ACCOUNT)
+			err := s.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx)
+			cancel()
+			s.arb.observeRequest(model.OP_ACCOUNT, err)
+			if err != nil {
+				return fmt.Errorf("failed to keep listen key alive: %v", err)
+			}
+		case message := <-messages:
+			s.handle(message)
+		}
+	}
+}
+
+// closeListenKey closes a listen key, the arbitrager may be stopped so its
+// context is not used
+func (s *UserStream) closeListenKey(listenKey string) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.arb.Conf().Exchange.Timeouts.Get(model.OP_ACCOUNT))
+	defer cancel()
+	if err := s.client.NewCloseUserStreamService().ListenKey(listenKey).Do(ctx); err != nil {
+		s.log.Warnf("failed to close listen key: %v", err)
+	}
+}
+
+// endpoint returns the websocket endpoint of a listen key, a base url of
+// the REST API is mapped to the ws path of the same host
+func (s *UserStream) endpoint(listenKey string) string {
+	conf := s.arb.Conf()
+	if conf.Exchange.BaseURL == "" {
+		if conf.Policy.Testnet {
+			return WS_TESTNET_URL + "/" + listenKey
+		}
+		return WS_MAIN_URL + "/" + listenKey
+	}
+
+	u, err := url.Parse(conf.Exchange.BaseURL)
+	if err != nil {
+		return ""
+	}
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws/" + listenKey
+	return u.String()
+}
+
+// snapshot loads the balances and the open orders of the policy by REST,
+// events before the snapshot are ignored for the balances
+func (s *UserStream) snapshot() error {
+	start := binance.FormatTimestamp(s.arb.shared.TimeSync().Now())
+	account, err := s.arb.account.GetAccount()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := s.arb.requestContext(model.OP_ACCOUNT)
+	defer cancel()
+	orders, err := s.client.NewListOpenOrdersService().Do(ctx)
+	s.arb.observeRequest(model.OP_ACCOUNT, err)
+	if err != nil {
+		return err
+	}
+
+	symbols := make(map[string]bool)
+	for _, symbol := range s.arb.Conf().Policy.Symbols {
+		symbols[symbol] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances = make(map[string]*streamBalance, len(account.Balances))
+	for _, b := range account.Balances {
+		free, locked, err := s.arb.account.parseBalance(&b)
+		if err != nil {
+			continue
+		}
+		s.balances[b.Asset] = &streamBalance{free: free, locked: locked, updated: start}
+	}
+	s.orders = make(map[int64]*ExecutionReport)
+	for _, o := range orders {
+		if symbols[o.Symbol] {
+			s.orders[o.OrderID] = reportOf(o)
+		}
+	}
+	s.lists = make(map[int64]*ListStatus)
+	s.synced = true
+	return nil
+}
+
+// reportOf converts an open order to the execution report of its last
+// execution, the oco of a leg is unknown by the open orders api
+func reportOf(o *binance.Order) *ExecutionReport {
+	parse := func(v string) model.Decimal {
+		d, _ := model.ParseDecimal(v)
+		return d
+	}
+	return &ExecutionReport{
+		Event:               EVENT_EXECUTION_REPORT,
+		Symbol:              o.Symbol,
+		ClientOrderID:       o.ClientOrderID,
+		Side:                string(o.Side),
+		Type:                string(o.Type),
+		TimeInForce:         string(o.TimeInForce),
+		Quantity:            parse(o.OrigQuantity),
+		Price:               parse(o.Price),
+		StopPrice:           parse(o.StopPrice),
+		OrderListID:         -1,
+		Status:              string(o.Status),
+		OrderID:             o.OrderID,
+		FilledQuantity:      parse(o.ExecutedQuantity),
+		FilledQuoteQuantity: parse(o.CummulativeQuoteQuantity),
+		TransactionTime:     o.UpdateTime,
+		IsWorking:           o.IsWorking,
+		CreateTime:          o.Time,
+	}
+}
+
+func (s *UserStream) setSynced(synced bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.synced = synced
+}
+
+// handle applies an event of the stream to the cache, executions of the
+// symbols of the policy are published on the bus
+func (s *UserStream) handle(message []byte) {
+	var head struct {
+		Event string `json:"e"`
+		Time  int64  `json:"E"`
+	}
+	if err := json.Unmarshal(message, &head); err != nil {
+		s.log.Errorf("invalid event %s: %v", message, err)
+		return
+	}
+	userStreamEvents.With(s.arb.name, head.Event).Inc()
+
+	switch head.Event {
+	case EVENT_EXECUTION_REPORT:
+		r := &ExecutionReport{}
+		if err := json.Unmarshal(message, r); err != nil {
+			s.log.Errorf("invalid execution report %s: %v", message, err)
+			return
+		}
+		if s.applyExecution(r) {
+			s.arb.publish(TOPIC_EXECUTION, r)
+		}
+	case EVENT_LIST_STATUS:
+		l := &ListStatus{}
+		if err := json.Unmarshal(message, l); err != nil {
+			s.log.Errorf("invalid list status %s: %v", message, err)
+			return
+		}
+		s.applyList(l)
+	case EVENT_ACCOUNT_POSITION:
+		p := &accountPosition{}
+		if err := json.Unmarshal(message, p); err != nil {
+			s.log.Errorf("invalid account position %s: %v", message, err)
+			return
+		}
+		s.applyPosition(p)
+	default:
+		s.log.Debugf("ignore event %v", head.Event)
+	}
+}
+
+// applyExecution updates the open orders, orders of other symbols are
+// ignored and false is returned
+func (s *UserStream) applyExecution(r *ExecutionReport) bool {
+	found := false
+	for _, symbol := range s.arb.Conf().Policy.Symbols {
+		if symbol == r.Symbol {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	s.log.Infof("order %v of %v is %v by %v", r.OrderID, r.Symbol, r.Status, r.ExecutionType)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Done() {
+		delete(s.orders, r.OrderID)
+	} else {
+		s.orders[r.OrderID] = r
+	}
+	return true
+}
+
+// applyList updates the open ocos, the legs of a finished oco are removed
+// with their own reports
+func (s *UserStream) applyList(l *ListStatus) {
+	s.log.Infof("oco %v of %v is %v", l.OrderListID, l.Symbol, l.ListOrderStatus)
+	if l.ListOrderStatus == LIST_REJECT {
+		s.log.Warnf("oco %v of %v is rejected: %v", l.OrderListID, l.Symbol, l.RejectReason)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l.ListOrderStatus == LIST_ALL_DONE || l.ListOrderStatus == LIST_REJECT {
+		delete(s.lists, l.OrderListID)
+	} else {
+		s.lists[l.OrderListID] = l
+	}
+}
+
+// applyPosition updates the balances changed, updates older than the
+// balances are ignored
+func (s *UserStream) applyPosition(p *accountPosition) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range p.Balances {
+		cur, ok := s.balances[b.Asset]
+		if ok && cur.updated > p.UpdateTime {
+			continue
+		}
+		s.balances[b.Asset] = &streamBalance{free: b.Free, locked: b.Locked, updated: p.UpdateTime}
+		balanceGauge.With(s.arb.name, b.Asset).Set(b.Free.Add(b.Locked).Float64())
+	}
+}
@@ -0,0 +1,156 @@
+package pixiu
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"github.com/vjoke/falcon/venus/pkg/mockexchange"
+	model "github.com/vjoke/falcon/venus/pkg/model/pixiu"
+)
+
+type userStreamTestSuite struct {
+	suite.Suite
+}
+
+func TestUserStream(t *testing.T) {
+	suite.Run(t, new(userStreamTestSuite))
+}
+
+// the example of binance, keys differ only in case
+const testExecutionReport = `{"e":"executionReport","E":1499405658658,"s":"ADAUSDT","c":"mUvoqJxFIILMdfAW5iGSOW",
+"S":"BUY","o":"LIMIT","f":"GTC","q":"1.00000000","p":"0.10264410","P":"0.00000000","F":"0.00000000","g":-1,"C":"",
+"x":"NEW","X":"NEW","r":"NONE","i":4293153,"l":"0.00000000","z":"0.00000000","L":"0.00000000","n":"0","N":null,
+"T":1499405658657,"t":-1,"I":8641984,"w":true,"m":false,"M":false,"O":1499405658657,"Z":"0.00000000",
+"Y":"0.00000000","Q":"0.00000000"}`
+
+func (u *userStreamTestSuite) TestHandle() {
+	a := newTestArbitrager(newTestConfig(), "ADAUSDT", "DOTUSDT")
+	s := a.stream
+	executions := a.bus.Subscribe(TOPIC_EXECUTION, "test", 10, OVERFLOW_DROP_NEWEST)
+
+	_, _, ok, _ := s.Balance("USDT")
+	assert.False(u.T(), ok)
+	_, ok = s.BalanceMap()
+	assert.False(u.T(), ok)
+	s.setSynced(true)
+
+	s.handle([]byte(testExecutionReport))
+	orders, ok := s.OpenOrders("ADAUSDT")
+	assert.True(u.T(), ok)
+	if assert.Len(u.T(), orders, 1) {
+		r := orders[0]
+		assert.Equal(u.T(), "mUvoqJxFIILMdfAW5iGSOW", r.ClientOrderID)
+		assert.Equal(u.T(), "", r.OrigClientOrderID)
+		assert.Equal(u.T(), "LIMIT", r.Type)
+		assert.Equal(u.T(), "BUY", r.Side)
+		assert.Equal(u.T(), int64(4293153), r.OrderID)
+		assert.Equal(u.T(), dec("0.1026441"), r.Price)
+		assert.Equal(u.T(), int64(1499405658657), r.CreateTime)
+	}
+
+	filled := `{"e":"executionReport","s":"ADAUSDT","S":"BUY","o":"LIMIT","g":-1,"x":"TRADE","X":"FILLED","i":4293153,
+"l":"1.00000000","L":"0.10000000","z":"1.00000000","n":"0.001","N":"ADA"}`
+	s.handle([]byte(filled))
+	orders, _ = s.OpenOrders("ADAUSDT")
+	assert.Empty(u.T(), orders)
+	assert.Equal(u.T(), 2, executions.Len())
+	<-executions.C()
+	r := (<-executions.C()).Execution()
+	assert.Equal(u.T(), EXECUTION_TRADE, r.ExecutionType)
+	assert.Equal(u.T(), dec("0.1"), r.LastPrice)
+	assert.Equal(u.T(), "ADA", r.CommissionAsset)
+
+	// orders of other policies are ignored
+	s.handle([]byte(`{"e":"executionReport","s":"BTCUSDT","x":"NEW","X":"NEW","i":1}`))
+	orders, _ = s.OpenOrders("BTCUSDT")
+	assert.Empty(u.T(), orders)
+	assert.Equal(u.T(), 0, executions.Len())
+
+	s.handle([]byte(`{"e":"outboundAccountPosition","u":10,"B":[{"a":"USDT","f":"100.5","l":"1"},{"a":"ADA","f":"0","l":"0"}]}`))
+	s.handle([]byte(`{"e":"outboundAccountPosition","u":5,"B":[{"a":"USDT","f":"1","l":"0"}]}`))
+	free, locked, ok, err := s.Balance("USDT")
+	assert.True(u.T(), ok)
+	assert.NoError(u.T(), err)
+	assert.Equal(u.T(), dec("100.5"), free)
+	assert.Equal(u.T(), dec("1"), locked)
+	m, _ := s.BalanceMap()
+	assert.Equal(u.T(), map[string]model.Decimal{"USDT": dec("101.5")}, m)
+	_, _, _, err = s.Balance("DOT")
+	assert.Error(u.T(), err)
+}
+
+func (u *userStreamTestSuite) TestEndpoint() {
+	conf := newTestConfig()
+	a := newTestArbitrager(conf, "ADAUSDT", "DOTUSDT")
+	assert.Equal(u.T(), "wss://stream.binance.com:9443/ws/key", a.stream.endpoint("key"))
+	conf.Policy.Testnet = true
+	assert.Equal(u.T(), "wss://testnet.binance.vision/ws/key", a.stream.endpoint("key"))
+	conf.Exchange.BaseURL = "http://127.0.0.1:9090/"
+	assert.Equal(u.T(), "ws://127.0.0.1:9090/ws/key", a.stream.endpoint("key"))
+	conf.Exchange.BaseURL = "https://example.com"
+	assert.Equal(u.T(), "wss://example.com/ws/key", a.stream.endpoint("key"))
+}
+
+func (u *userStreamTestSuite) TestStream() {
+	exchange := mockexchange.New(mockexchange.DefaultScript("ADAUSDT", "DOTUSDT"))
+	server := httptest.NewServer(exchange)
+	defer server.Close()
+
+	conf := newTestConfig()
+	conf.Exchange.BaseURL = server.URL
+	a, err := NewArbitrager(conf, NewShared(0))
+	u.Require().NoError(err)
+	a.stream.retry = 10 * time.Millisecond
+	positions := a.bus.Subscribe(TOPIC_POSITION, "test", 10, OVERFLOW_DROP_NEWEST)
+	stop := make(chan struct{})
+	defer close(stop)
+	go a.stream.Run(stop)
+	u.Require().Eventually(a.stream.Synced, 5*time.Second, 10*time.Millisecond)
+
+	free, _, err := a.account.GetBalance("USDT")
+	assert.NoError(u.T(), err)
+	assert.Equal(u.T(), dec("1000"), free)
+
+	a.trader.inflight.Add(1)
+	a.trader.buyOrder("ADAUSDT", dec("20"))
+	// balances and orders are updated by the stream without polling
+	assert.Eventually(u.T(), func() bool {
+		orders, _ := a.stream.OpenOrders("ADAUSDT")
+		return len(orders) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	free, _, err = a.account.GetBalance("USDT")
+	assert.NoError(u.T(), err)
+	assert.Equal(u.T(), dec("980"), free)
+
+	// the oco closes the position in the book when it is filled
+	exchange.SetPrice("ADAUSDT", 1.1)
+	for open := true; open; _, open = a.trader.book.Get("ADAUSDT") {
+		select {
+		case e := <-a.trader.executions.C():
+			a.trader.executions.received()
+			a.trader.processExecution(e.Execution())
+		case <-time.After(5 * time.Second):
+			u.FailNow("position is not closed by the oco")
+		}
+	}
+	var change *PositionChange
+	for positions.Len() > 0 {
+		change = (<-positions.C()).PositionChange()
+	}
+	if assert.NotNil(u.T(), change) && assert.NotNil(u.T(), change.Pnl) {
+		assert.Equal(u.T(), 1, change.Pnl.Sign())
+	}
+	// only the dust below the lot size is left
+	assert.Eventually(u.T(), func() bool {
+		m, _ := a.account.GetBalanceMap()
+		return m["ADA"] == dec("0.08")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the stream reconnects and syncs again
+	exchange.CloseStreams()
+	assert.Eventually(u.T(), func() bool { return !a.stream.Synced() }, 5*time.Second, time.Millisecond)
+	assert.Eventually(u.T(), a.stream.Synced, 5*time.Second, 10*time.Millisecond)
+}
@@ -2,6 +2,8 @@ package plutus
 
 // Arbitrager defines the interface for arbitrators
 type Arbitrager interface {
+	// Name returns the name of the policy, it is unique in a process
+	Name() string
 	Start(stop <-chan struct{})
 	Stop()
 }
@@ -10,4 +12,51 @@ type Arbitrager interface {
 type ArbitragerBuilder interface {
 	WithConfig(string) ArbitragerBuilder 
 	Build()(Arbitrager, error)
-} 
\ No newline at end of file
+} 
+
+// Inspector defines the interface for inspecting an arbitrager at runtime,
+// the returned values are encoded as json by the admin server
+type Inspector interface {
+	Config() interface{}
+	Epochs() interface{}
+	Positions() (interface{}, error)
+	Orders() (interface{}, error)
+	Decisions() interface{}
+	Balances() (interface{}, error)
+}
+
+// Controller defines the interface for controlling an arbitrager at runtime,
+// empty symbols means all the symbols of the policy
+type Controller interface {
+	Pause()
+	Resume()
+	Paused() bool
+	Flatten(symbols []string) error
+	CancelOrders(symbols []string) error
+	Reload() error
+}
+
+// Worker defines a long running worker of an arbitrager, Run blocks until
+// stop is closed and an error is returned if it fails
+type Worker struct {
+	Name string
+	Run  func(stop <-chan struct{}) error
+}
+
+// Supervised defines the interface for arbitragers whose workers are run
+// and restarted by a supervisor instead of Start
+type Supervised interface {
+	// Prepare starts the arbitrager without its workers
+	Prepare(stop <-chan struct{})
+	// Workers returns the workers to supervise
+	Workers() []Worker
+}
+
+// Prober defines the interface for probing the health of an arbitrager
+type Prober interface {
+	// Alive returns an error if the arbitrager is stuck and should be
+	// restarted
+	Alive() error
+	// Ready returns an error if the arbitrager is not ready to trade
+	Ready() error
+}
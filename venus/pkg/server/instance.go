@@ -44,6 +44,18 @@ type Instance interface {
 	// Note: this is best effort; a process can die at any time.
 	RunComponentAsyncAndWait(t Component)
 
+	// RunSupervised runs the named component asynchronously, it is
+	// restarted by the restart options and its panics are recovered. A
+	// component failing repeatedly is escalated to Failed.
+	RunSupervised(name string, opts *RestartOptions, t Component)
+
+	// Status returns the status of the supervised components.
+	Status() []ComponentStatus
+
+	// Failed returns a channel which receives the failure of a supervised
+	// component escalated to shut down the server.
+	Failed() <-chan error
+
 	// Wait for this server Instance to shutdown.
 	Wait()
 }
@@ -55,6 +67,7 @@ func New() Instance {
 	return &instance{
 		done:       make(chan struct{}),
 		components: make(chan Component, 1000), // should be enough?
+		failed:     make(chan error, 1),
 	}
 }
 
@@ -66,6 +79,10 @@ type instance struct {
 	// if they are not stopped. This allows important cleanup tasks to be completed.
 	// Note: this is still best effort; a process can die at any time.
 	requiredTerminations sync.WaitGroup
+
+	supervisedMu sync.Mutex
+	supervised   []*supervised
+	failed       chan error
 }
 
 func (i *instance) Start(stop <-chan struct{}) error {
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vjoke/falcon/pkg/log"
+)
+
+// RestartPolicy defines when a supervised component is restarted
+type RestartPolicy string
+
+const (
+	// RESTART_NEVER never restarts the component
+	RESTART_NEVER RestartPolicy = "never"
+	// RESTART_ON_FAILURE restarts the component if it returns an error or
+	// panics
+	RESTART_ON_FAILURE RestartPolicy = "on-failure"
+	// RESTART_ALWAYS restarts the component whenever it returns before the
+	// server is stopped
+	RESTART_ALWAYS RestartPolicy = "always"
+)
+
+const (
+	STATE_PENDING    = "pending"
+	STATE_RUNNING    = "running"
+	STATE_RESTARTING = "restarting"
+	STATE_EXITED     = "exited"
+	STATE_FAILED     = "failed"
+	STATE_STOPPED    = "stopped"
+)
+
+// RestartOptions defines the restart behavior of a supervised component
+type RestartOptions struct {
+	Policy RestartPolicy
+	// Backoff is the delay before the first restart, it is doubled for
+	// each consecutive failure up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// MaxFailures is the number of consecutive failures after which the
+	// failure is escalated to shut down the server, zero never escalates
+	MaxFailures int
+	// ResetAfter resets the consecutive failures and the backoff if the
+	// component has run for at least the duration
+	ResetAfter time.Duration
+}
+
+// DefaultRestartOptions returns the default restart options
+func DefaultRestartOptions() *RestartOptions {
+	return &RestartOptions{
+		Policy:      RESTART_ON_FAILURE,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+		MaxFailures: 5,
+		ResetAfter:  5 * time.Minute,
+	}
+}
+
+// ValidRestartPolicy checks if a restart policy is known
+func ValidRestartPolicy(p RestartPolicy) bool {
+	return p == RESTART_NEVER || p == RESTART_ON_FAILURE || p == RESTART_ALWAYS
+}
+
+// ComponentStatus defines the status of a supervised component
+type ComponentStatus struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// supervised is a component run by the supervisor
+type supervised struct {
+	name   string
+	opts   *RestartOptions
+	run    Component
+	mu     sync.Mutex
+	status ComponentStatus
+}
+
+// RunSupervised runs a named component asynchronously, it is restarted by
+// the restart policy and its panics are recovered as failures
+func (i *instance) RunSupervised(name string, opts *RestartOptions, t Component) {
+	if opts == nil {
+		opts = DefaultRestartOptions()
+	}
+	s := &supervised{
+		name: name,
+		opts: opts,
+		run:  t,
+		status: ComponentStatus{
+			Name:  name,
+			State: STATE_PENDING,
+			Since: time.Now(),
+		},
+	}
+
+	i.supervisedMu.Lock()
+	i.supervised = append(i.supervised, s)
+	i.supervisedMu.Unlock()
+
+	i.RunComponent(func(stop <-chan struct{}) error {
+		go i.supervise(s, stop)
+		return nil
+	})
+}
+
+// Status returns the status of the supervised components sorted by name
+func (i *instance) Status() []ComponentStatus {
+	i.supervisedMu.Lock()
+	defer i.supervisedMu.Unlock()
+
+	result := make([]ComponentStatus, 0, len(i.supervised))
+	for _, s := range i.supervised {
+		s.mu.Lock()
+		result = append(result, s.status)
+		s.mu.Unlock()
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].Name < result[b].Name })
+	return result
+}
+
+// Failed returns the channel of the escalated failure of a component
+func (i *instance) Failed() <-chan error {
+	return i.failed
+}
+
+// supervise runs a component until the server is stopped or the component
+// is not restarted anymore
+func (i *instance) supervise(s *supervised, stop <-chan struct{}) {
+	backoff := s.opts.Backoff
+	failures := 0
+	for {
+		s.update(STATE_RUNNING, nil, failures)
+		started := time.Now()
+		err := runRecovered(s.run, stop)
+
+		select {
+		case <-stop:
+			s.update(STATE_STOPPED, err, failures)
+			return
+		default:
+		}
+
+		if s.opts.ResetAfter > 0 && time.Since(started) >= s.opts.ResetAfter {
+			failures = 0
+			backoff = s.opts.Backoff
+		}
+		if err != nil {
+			failures++
+			log.Errorf("component %v failed (%v in a row): %v", s.name, failures, err)
+		} else {
+			log.Warnf("component %v exited before the server is stopped", s.name)
+		}
+
+		restart := s.opts.Policy == RESTART_ALWAYS || (s.opts.Policy == RESTART_ON_FAILURE && err != nil)
+		if err != nil && s.opts.MaxFailures > 0 && failures >= s.opts.MaxFailures {
+			s.update(STATE_FAILED, err, failures)
+			i.escalate(fmt.Errorf("component %v failed %v times in a row: %v", s.name, failures, err))
+			return
+		}
+		if !restart {
+			state := STATE_EXITED
+			if err != nil {
+				state = STATE_FAILED
+			}
+			s.update(state, err, failures)
+			return
+		}
+
+		s.update(STATE_RESTARTING, err, failures)
+		log.Infof("restart component %v in %v", s.name, backoff)
+		select {
+		case <-stop:
+			s.update(STATE_STOPPED, nil, failures)
+			return
+		case <-time.After(backoff):
+		}
+		s.restarted()
+
+		if err != nil {
+			backoff *= 2
+			if s.opts.MaxBackoff > 0 && backoff > s.opts.MaxBackoff {
+				backoff = s.opts.MaxBackoff
+			}
+		}
+	}
+}
+
+// escalate reports the first escalated failure
+func (i *instance) escalate(err error) {
+	log.Errorf("escalate failure to shut down: %v", err)
+	select {
+	case i.failed <- err:
+	default:
+	}
+}
+
+// update changes the state of a component, the last error is kept if err
+// is nil
+func (s *supervised) update(state string, err error, failures int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status.State != state {
+		s.status.State = state
+		s.status.Since = time.Now()
+	}
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+	s.status.Failures = failures
+}
+
+// restarted counts a restart of a component
+func (s *supervised) restarted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.Restarts++
+}
+
+// runRecovered runs a component and converts its panic to an error
+func runRecovered(t Component, stop <-chan struct{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("panic in component: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return t(stop)
+}
@@ -0,0 +1,110 @@
+package server_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.uber.org/atomic"
+
+	"github.com/vjoke/falcon/venus/pkg/server"
+)
+
+func fastRestart(policy server.RestartPolicy, maxFailures int) *server.RestartOptions {
+	return &server.RestartOptions{
+		Policy:      policy,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+		MaxFailures: maxFailures,
+	}
+}
+
+func TestSupervisedRestartOnPanic(t *testing.T) {
+	g := NewWithT(t)
+
+	runs := atomic.NewInt32(0)
+	inst := server.New()
+	inst.RunSupervised("worker", fastRestart(server.RESTART_ON_FAILURE, 0), func(stop <-chan struct{}) error {
+		if runs.Inc() < 3 {
+			panic("boom")
+		}
+		<-stop
+		return nil
+	})
+
+	stop := newReclosableChannel()
+	t.Cleanup(stop.Close)
+	g.Expect(inst.Start(stop.c)).To(BeNil())
+
+	g.Eventually(func() string {
+		return inst.Status()[0].State
+	}).Should(Equal(server.STATE_RUNNING))
+	g.Eventually(runs.Load).Should(Equal(int32(3)))
+
+	status := inst.Status()[0]
+	g.Expect(status.Name).To(Equal("worker"))
+	g.Expect(status.Restarts).To(Equal(2))
+	g.Expect(status.LastError).To(Equal("panic: boom"))
+
+	stop.Close()
+	g.Eventually(func() string {
+		return inst.Status()[0].State
+	}).Should(Equal(server.STATE_STOPPED))
+}
+
+func TestSupervisedEscalation(t *testing.T) {
+	g := NewWithT(t)
+
+	inst := server.New()
+	inst.RunSupervised("worker", fastRestart(server.RESTART_ALWAYS, 3), func(stop <-chan struct{}) error {
+		return errors.New("fake")
+	})
+
+	stop := newReclosableChannel()
+	t.Cleanup(stop.Close)
+	g.Expect(inst.Start(stop.c)).To(BeNil())
+
+	var err error
+	g.Eventually(inst.Failed()).Should(Receive(&err))
+	g.Expect(err.Error()).To(ContainSubstring("worker failed 3 times"))
+
+	status := inst.Status()[0]
+	g.Expect(status.State).To(Equal(server.STATE_FAILED))
+	g.Expect(status.Failures).To(Equal(3))
+}
+
+func TestSupervisedNoRestart(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy server.RestartPolicy
+		err    error
+		state  string
+	}{
+		{name: "never", policy: server.RESTART_NEVER, err: errors.New("fake"), state: server.STATE_FAILED},
+		{name: "exited", policy: server.RESTART_ON_FAILURE, err: nil, state: server.STATE_EXITED},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			runs := atomic.NewInt32(0)
+			inst := server.New()
+			inst.RunSupervised("worker", fastRestart(c.policy, 0), func(stop <-chan struct{}) error {
+				runs.Inc()
+				return c.err
+			})
+
+			stop := newReclosableChannel()
+			t.Cleanup(stop.Close)
+			g.Expect(inst.Start(stop.c)).To(BeNil())
+
+			g.Eventually(func() string {
+				return inst.Status()[0].State
+			}).Should(Equal(c.state))
+			g.Consistently(runs.Load, 50*time.Millisecond).Should(Equal(int32(1)))
+			g.Expect(inst.Failed()).NotTo(Receive())
+		})
+	}
+}